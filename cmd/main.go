@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"user-api/internal/auth"
 	"user-api/internal/db"
 	"user-api/internal/handlers"
 	"user-api/internal/healthz"
@@ -38,8 +40,11 @@ import (
 func main() {
 	_ = godotenv.Load(".env")
 	db.Connect()
+	handlers.StartVerificationSweeper(context.Background())
+	handlers.StartSlotGenerator(context.Background())
 
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Post("/api/admin/login", handlers.AdminLogin)
 	r.Post("/api/admin/refresh", handlers.AdminRefreshToken) // Добавляем роут для обновления админского токена
@@ -47,56 +52,100 @@ func main() {
 
 	// User login endpoint
 	r.Post("/api/login", handlers.UserLogin)
-	// Google OAuth endpoint
+	// Google OAuth endpoint (ID token from Google Identity Services)
 	r.Post("/api/auth/google", handlers.GoogleAuth)
+	// OpenID Connect login with any configured provider (authorization code + PKCE)
+	r.Get("/api/auth/oidc/providers", handlers.GetOIDCProviders)
+	r.Get("/api/auth/oidc/{provider}/start", handlers.OIDCStart)
+	r.Post("/api/auth/oidc/{provider}/callback", handlers.OIDCCallback)
 	// Refresh token endpoint
 	r.Post("/api/auth/refresh", handlers.RefreshToken)
-
-	// Security admin URI
+	// Logout revokes the refresh token of the current device (user or admin)
+	r.Post("/api/auth/logout", handlers.Logout)
+	// Password recovery endpoints (users and administrators)
+	r.With(authmw.RateLimit(handlers.RateLimitPasswordForgot)).Post("/api/auth/password/forgot", handlers.ForgotPassword)
+	r.Post("/api/auth/password/reset", handlers.ResetPassword)
+	// Passwordless login by email link (enabled per role in the admin settings)
+	r.With(authmw.RateLimit(handlers.RateLimitMagicLink)).Post("/api/auth/magic-link", handlers.RequestMagicLink)
+	r.Get("/api/auth/magic-link/consume", handlers.ConsumeMagicLink)
+	// Email change links: confirmation from the new address, undo from the old one
+	r.Post("/api/auth/email-change/confirm", handlers.ConfirmEmailChange)
+	r.Post("/api/auth/email-change/undo", handlers.UndoEmailChange)
+	// Second step of login when two-factor authentication is enabled or required
+	r.Post("/api/auth/mfa/setup", handlers.MFASetup)
+	r.Post("/api/auth/mfa/verify", handlers.MFAVerify)
+
+	// Security admin URI. Every route needs a permission of the administrator's role
+	// (see internal/auth/permissions.go): moderator < admin < master.
 	r.Group(func(r chi.Router) {
 		r.Use(authmw.RequireAdmin)
-
-		r.Post("/api/admin/users", handlers.CreateUser)
-		r.Delete("/api/admin/users/{id}", handlers.DeleteUser)
-		r.Get("/api/admin/users/{id}", handlers.GetUser)
-		r.Get("/api/admin/users", handlers.GetAllUsers)
-		r.Put("/api/admin/users/{id}", handlers.UpdateUser)
-		r.Put("/api/admin/users/{id}/password", handlers.AdminChangeUserPassword)
-		r.Put("/api/admin/users/{id}/portfolio", handlers.AdminUpdateUserPortfolio)
-
-		r.Post("/api/admin/skills", handlers.CreateSkill)
-		r.Get("/api/admin/skills", handlers.GetSkills)
-		r.Post("/api/admin/skills/categories", handlers.CreateSkillCategory)
-		r.Get("/api/admin/skills/categories", handlers.GetSkillCategories)
-		r.Delete("/api/admin/skills/{id}", handlers.DeleteSkill)
-		r.Delete("/api/admin/skills/categories/{id}", handlers.DeleteSkillCategory)
-		r.Put("/api/admin/skills/{id}", handlers.UpdateSkill)
-		r.Put("/api/admin/skills/categories/{id}", handlers.UpdateSkillCategory)
-
-		r.Get("/api/admin/plans", handlers.GetPlans)
-		r.Post("/api/admin/plans", handlers.CreatePlan)
-		r.Put("/api/admin/plans/{id}", handlers.UpdatePlan)
-		r.Delete("/api/admin/plans/{id}", handlers.DeletePlan)
-
-		r.Post("/api/admin/administrators", handlers.CreateAdmin)
-		r.Put("/api/admin/administrators/{id}", handlers.UpdateAdmin)
-		r.Delete("/api/admin/administrators/{id}", handlers.DeleteAdmin)
-		r.Get("/api/admin/administrators", handlers.GetAdministrators)
+		perm := authmw.RequirePermission
+
+		r.With(perm(auth.PermUsersWrite)).Post("/api/admin/users", handlers.CreateUser)
+		r.With(perm(auth.PermUsersDelete)).Delete("/api/admin/users/{id}", handlers.DeleteUser)
+		r.With(perm(auth.PermUsersRead)).Get("/api/admin/users/{id}", handlers.GetUser)
+		r.With(perm(auth.PermUsersRead)).Get("/api/admin/users", handlers.GetAllUsers)
+		r.With(perm(auth.PermUsersWrite)).Put("/api/admin/users/{id}", handlers.UpdateUser)
+		r.With(perm(auth.PermUsersPassword)).Put("/api/admin/users/{id}/password", handlers.AdminChangeUserPassword)
+		r.With(perm(auth.PermUsersWrite)).Post("/api/admin/users/{id}/verification/resend", handlers.AdminResendVerification)
+		r.With(perm(auth.PermUsersImpersonate)).Post("/api/admin/users/{id}/impersonate", handlers.ImpersonateUser)
+		r.With(perm(auth.PermUsersWrite)).Put("/api/admin/users/{id}/portfolio", handlers.AdminUpdateUserPortfolio)
+		r.With(perm(auth.PermUsersWrite)).Post("/api/admin/users/{id}/unlock", handlers.UnlockUser)
+
+		r.With(perm(auth.PermSkillsManage)).Post("/api/admin/skills", handlers.CreateSkill)
+		r.With(perm(auth.PermSkillsRead)).Get("/api/admin/skills", handlers.GetSkills)
+		r.With(perm(auth.PermSkillsManage)).Post("/api/admin/skills/categories", handlers.CreateSkillCategory)
+		r.With(perm(auth.PermSkillsRead)).Get("/api/admin/skills/categories", handlers.GetSkillCategories)
+		r.With(perm(auth.PermSkillsManage)).Delete("/api/admin/skills/{id}", handlers.DeleteSkill)
+		r.With(perm(auth.PermSkillsManage)).Delete("/api/admin/skills/categories/{id}", handlers.DeleteSkillCategory)
+		r.With(perm(auth.PermSkillsManage)).Put("/api/admin/skills/{id}", handlers.UpdateSkill)
+		r.With(perm(auth.PermSkillsManage)).Put("/api/admin/skills/categories/{id}", handlers.UpdateSkillCategory)
+
+		r.With(perm(auth.PermPlansRead)).Get("/api/admin/plans", handlers.GetPlans)
+		r.With(perm(auth.PermPlansManage)).Post("/api/admin/plans", handlers.CreatePlan)
+		r.With(perm(auth.PermPlansManage)).Put("/api/admin/plans/{id}", handlers.UpdatePlan)
+		r.With(perm(auth.PermPlansManage)).Delete("/api/admin/plans/{id}", handlers.DeletePlan)
+
+		// Only master manages other administrators
+		r.With(perm(auth.PermAdminsManage)).Post("/api/admin/administrators", handlers.CreateAdmin)
+		r.With(perm(auth.PermAdminsManage)).Put("/api/admin/administrators/{id}", handlers.UpdateAdmin)
+		r.With(perm(auth.PermAdminsManage)).Delete("/api/admin/administrators/{id}", handlers.DeleteAdmin)
+		r.With(perm(auth.PermAdminsRead)).Get("/api/admin/administrators", handlers.GetAdministrators)
 
 		// Админські роути для новин
-		r.Post("/api/admin/news", handlers.CreateNews)
-		r.Get("/api/admin/news", handlers.GetAllNews)
-		r.Get("/api/admin/news/{id}", handlers.GetNews)
-		r.Put("/api/admin/news/{id}", handlers.UpdateNews)
-		r.Delete("/api/admin/news/{id}", handlers.DeleteNews)
+		r.With(perm(auth.PermNewsManage)).Post("/api/admin/news", handlers.CreateNews)
+		r.With(perm(auth.PermNewsRead)).Get("/api/admin/news", handlers.GetAllNews)
+		r.With(perm(auth.PermNewsRead)).Get("/api/admin/news/{id}", handlers.GetNews)
+		r.With(perm(auth.PermNewsManage)).Put("/api/admin/news/{id}", handlers.UpdateNews)
+		r.With(perm(auth.PermNewsManage)).Delete("/api/admin/news/{id}", handlers.DeleteNews)
+
+		// Review moderation
+		r.With(perm(auth.PermReviewsRead)).Get("/api/admin/reviews", handlers.GetAllReviews)
+		r.With(perm(auth.PermReviewsDelete)).Delete("/api/admin/reviews/{id}", handlers.DeleteReview)
+
+		// Two-factor authentication (own account, any role)
+		r.Post("/api/admin/self/2fa/enroll", handlers.EnrollAdminMFA)
+		r.Post("/api/admin/self/2fa/verify", handlers.VerifyAdminMFA)
+		r.Post("/api/admin/self/2fa/disable", handlers.DisableAdminMFA)
+		r.Get("/api/admin/settings/mfa", handlers.GetMFASettings)
+		r.With(perm(auth.PermSettingsManage)).Put("/api/admin/settings/mfa", handlers.UpdateMFASettings)
+		r.Get("/api/admin/settings/magic-link", handlers.GetMagicLinkSettings)
+		r.With(perm(auth.PermSettingsManage)).Put("/api/admin/settings/magic-link", handlers.UpdateMagicLinkSettings)
+
+		// Audit log of administrative actions (JSON or CSV)
+		r.With(perm(auth.PermAuditRead)).Get("/api/admin/audit", handlers.GetAuditEvents)
+
+		// Background jobs
+		r.With(perm(auth.PermJobsRead)).Get("/api/admin/jobs/slot-generation", handlers.GetSlotGenerationStatus)
 
 	})
 	// Serve static files from the uploads directory
 	r.Handle("/api/uploads/*", http.StripPrefix("/api/uploads/", http.FileServer(http.Dir("./uploads"))))
 
 	// Public registration and verification routes
-	r.Post("/api/register", handlers.RegisterUser)
+	r.With(authmw.RateLimit(handlers.RateLimitRegister)).Post("/api/register", handlers.RegisterUser)
 	r.Get("/api/verify", handlers.VerifyEmail)
+	r.With(authmw.RateLimit(handlers.RateLimitVerifyResend)).Post("/api/verify/resend", handlers.ResendVerification)
 
 	// Публічні роути для новин (без авторизації)
 	r.Get("/api/news", handlers.GetPublicNews)
@@ -114,7 +163,19 @@ func main() {
 		r.Get("/api/users/{id}", handlers.GetUserProfile) // Змініть з GetUser на GetUserProfile
 		r.Post("/api/reviews/{psychologist_id}", handlers.CreateReview)
 		r.Put("/api/users/self/updateuser", handlers.ClientSelfUpdate)
-		r.Put("/api/users/self/password", handlers.ChangePassword)
+		r.Get("/api/users/self/devices", handlers.GetMyDevices)
+
+		// Account owner only: blocked while an administrator impersonates the user
+		r.Group(func(r chi.Router) {
+			r.Use(authmw.DenyImpersonation)
+			r.Put("/api/users/self/password", handlers.ChangePassword)
+			r.Post("/api/users/self/email", handlers.RequestEmailChange)
+			r.Post("/api/users/self/2fa/enroll", handlers.EnrollUserMFA)
+			r.Post("/api/users/self/2fa/verify", handlers.VerifyUserMFA)
+			r.Post("/api/users/self/2fa/disable", handlers.DisableUserMFA)
+			r.Delete("/api/users/self/devices/{id}", handlers.RevokeMyDevice)
+			r.Post("/api/conversations", handlers.StartConversation)
+		})
 
 		r.Post("/api/users/blog", handlers.CreateBlogPost)
 
@@ -125,7 +186,7 @@ func main() {
 
 		r.Get("/api/users/{user_id}/skills", handlers.GetUserSkills)
 
-		r.Post("/api/users/portfolio/photo", handlers.UploadPortfolioPhoto)
+		r.With(authmw.RateLimit(handlers.RateLimitUpload)).Post("/api/users/portfolio/photo", handlers.UploadPortfolioPhoto)
 		r.Delete("/api/users/portfolio/photo/{photo_id}", handlers.DeletePortfolioPhoto)
 
 		r.Get("/api/users/self", handlers.GetSelfProfile)
@@ -148,35 +209,62 @@ func main() {
 		r.Put("/api/users/self/child", handlers.UpdateSelfChild)
 
 		// Search endpoints (only for registered users)
-		r.Post("/api/users/search/specialists", handlers.SearchSpecialists)
-		r.Get("/api/users/search/specialists", handlers.SearchSpecialistsGET)
+		r.With(authmw.RateLimit(handlers.RateLimitSearch)).Post("/api/users/search/specialists", handlers.SearchSpecialists)
+		r.With(authmw.RateLimit(handlers.RateLimitSearch)).Get("/api/users/search/specialists", handlers.SearchSpecialistsGET)
 
-		// --- Routes for managing availability (for psychologists) ---
-		r.Post("/api/users/availability", handlers.CreateAvailabilitySlot)
-		r.Delete("/api/users/availability/{slotId}", handlers.DeleteAvailabilitySlot)
-
-		// --- Schedule templates (for psychologists) ---
-		r.Post("/api/users/schedule-templates", handlers.CreateScheduleTemplate)
-		r.Get("/api/users/schedule-templates", handlers.GetMyScheduleTemplates)
-		r.Put("/api/users/schedule-templates/{id}", handlers.UpdateScheduleTemplate)
-		r.Delete("/api/users/schedule-templates/{id}", handlers.DeleteScheduleTemplate)
-		r.Post("/api/users/schedule-templates/generate", handlers.GenerateSlotsFromTemplates)
-
-		// --- Routes for sessions (for clients and psychologists) ---
-		r.Post("/api/users/sessions/book/{slotId}", handlers.BookSession)
-		r.Post("/api/users/sessions/request", handlers.RequestFreeTimeSession)
-		r.Get("/api/users/sessions/my", handlers.GetMySessions)
-		r.Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
-		r.Put("/api/users/sessions/{id}/confirm", handlers.ConfirmSession)
-		r.Put("/api/users/sessions/{id}/complete", handlers.CompleteSession)
+		// --- Personal API keys (managed with a JWT only, never with a key) ---
+		r.Get("/api/users/self/api-keys", handlers.GetMyAPIKeys)
+		r.With(authmw.DenyImpersonation).Post("/api/users/self/api-keys", handlers.CreateAPIKey)
+		r.With(authmw.DenyImpersonation).Delete("/api/users/self/api-keys/{id}", handlers.RevokeMyAPIKey)
 
 		// --- Chat REST endpoints ---
-		r.Post("/api/conversations", handlers.StartConversation)
 		r.Get("/api/conversations", handlers.GetMyConversations)
 		r.Get("/api/conversations/unread", handlers.GetUnreadCount)
 		r.Get("/api/conversations/{id}/messages", handlers.GetConversationMessages)
 	})
 
+	// Protected user endpoints that integrations may also call with a personal API key of the given scope
+	r.Group(func(r chi.Router) {
+		r.Use(authmw.RequireUserOrAPIKey)
+		sessionsRead := authmw.RequireScope(auth.ScopeSessionsRead)
+		sessionsWrite := authmw.RequireScope(auth.ScopeSessionsWrite)
+		availabilityRead := authmw.RequireScope(auth.ScopeAvailabilityRead)
+		availabilityWrite := authmw.RequireScope(auth.ScopeAvailabilityWrite)
+
+		// --- Routes for managing availability (for psychologists) ---
+		r.With(availabilityWrite).Post("/api/users/availability", handlers.CreateAvailabilitySlot)
+		r.With(availabilityWrite).Delete("/api/users/availability/{slotId}", handlers.DeleteAvailabilitySlot)
+
+		// --- Schedule templates (for psychologists) ---
+		r.With(availabilityWrite).Post("/api/users/schedule-templates", handlers.CreateScheduleTemplate)
+		r.With(availabilityRead).Get("/api/users/schedule-templates", handlers.GetMyScheduleTemplates)
+		r.With(availabilityWrite).Put("/api/users/schedule-templates/{id}", handlers.UpdateScheduleTemplate)
+		r.With(availabilityWrite).Delete("/api/users/schedule-templates/{id}", handlers.DeleteScheduleTemplate)
+		r.With(availabilityWrite).Post("/api/users/schedule-templates/generate", handlers.GenerateSlotsFromTemplates)
+
+		// --- Schedule exceptions: time off, changed and extra hours (for psychologists) ---
+		r.With(availabilityWrite).Post("/api/users/schedule-exceptions", handlers.CreateScheduleException)
+		r.With(availabilityRead).Get("/api/users/schedule-exceptions", handlers.GetMyScheduleExceptions)
+		r.With(availabilityWrite).Delete("/api/users/schedule-exceptions/{id}", handlers.DeleteScheduleException)
+
+		// --- Routes for sessions (for clients and psychologists) ---
+		r.With(sessionsWrite).Post("/api/users/sessions/book/{slotId}", handlers.BookSession)
+		r.With(sessionsWrite).Post("/api/users/sessions/request", handlers.RequestFreeTimeSession)
+		r.With(sessionsWrite).Post("/api/users/sessions/series", handlers.BookSessionSeries)
+		r.With(sessionsRead).Get("/api/users/sessions/series/{id}", handlers.GetSessionSeries)
+		r.With(sessionsRead).Get("/api/users/sessions/my", handlers.GetMySessions)
+		r.With(sessionsRead).Get("/api/users/sessions/clients/stats", handlers.GetClientSessionStats)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/confirm", handlers.ConfirmSession)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/complete", handlers.CompleteSession)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/start", handlers.StartSession)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/no-show", handlers.MarkNoShow)
+		r.With(sessionsRead).Get("/api/users/sessions/{id}/history", handlers.GetSessionHistory)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/reschedule", handlers.RescheduleSession)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/reschedule/approve", handlers.ApproveReschedule)
+		r.With(sessionsWrite).Put("/api/users/sessions/{id}/reschedule/decline", handlers.DeclineReschedule)
+	})
+
 	// WebSocket chat — auth via ?token= query param (outside RequireUser middleware)
 	r.Get("/api/ws/{id}", handlers.WSChat)
 
@@ -189,6 +277,9 @@ func main() {
 	// Public route for booking page (schedule info + slots)
 	r.Get("/api/users/{id}/schedule-info", handlers.GetPsychologistScheduleInfo)
 
+	// Public keys for verifying user access tokens
+	r.Get("/.well-known/jwks.json", handlers.JWKS)
+
 	// Services API endpoints
 	r.Get("/api/healthz", healthz.HealthCheck)
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
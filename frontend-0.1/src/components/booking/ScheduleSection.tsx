@@ -23,6 +23,11 @@ export default function ScheduleSection({ user, authenticatedFetch, onReload }:
   const [loading, setLoading] = useState(true);
   const [enforced, setEnforced] = useState(user?.portfolio?.scheduleEnforced ?? false);
   const [enforcedLoading, setEnforcedLoading] = useState(false);
+  const [freeCancelHours, setFreeCancelHours] = useState(user?.portfolio?.freeCancelHours ?? 24);
+  const [noShowGraceMinutes, setNoShowGraceMinutes] = useState(user?.portfolio?.noShowGraceMinutes ?? 15);
+  const [bufferMinutes, setBufferMinutes] = useState(user?.portfolio?.bufferMinutes ?? 0);
+  const [scheduleTimeZone, setScheduleTimeZone] = useState(user?.portfolio?.timeZone || user?.timeZone || '');
+  const [policySaved, setPolicySaved] = useState(false);
   const [generateWeeks, setGenerateWeeks] = useState(4);
   const [generateLoading, setGenerateLoading] = useState(false);
   const [generateResult, setGenerateResult] = useState<string | null>(null);
@@ -65,6 +70,26 @@ export default function ScheduleSection({ user, authenticatedFetch, onReload }:
     }
   };
 
+  // Політика скасувань
+  const handleSavePolicy = async () => {
+    setError('');
+    setPolicySaved(false);
+    try {
+      const res = await authenticatedFetch('/api/users/self/portfolio', {
+        method: 'PUT',
+        body: JSON.stringify({ freeCancelHours, noShowGraceMinutes, bufferMinutes, timeZone: scheduleTimeZone }),
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        setError(data.message || 'Не вдалося зберегти політику скасувань');
+        return;
+      }
+      setPolicySaved(true);
+    } catch {
+      setError('Не вдалося зберегти політику скасувань');
+    }
+  };
+
   // Додати шаблон
   const handleAddTemplate = async (tmpl: Omit<ScheduleTemplate, 'id' | 'psychologistId' | 'createdAt'>) => {
     setError('');
@@ -122,7 +147,8 @@ export default function ScheduleSection({ user, authenticatedFetch, onReload }:
         { startDate, endDate },
         { headers: { Authorization: `Bearer ${token}` } }
       );
-      setGenerateResult(`Згенеровано ${res.data.generated} слотів`);
+      const skipped = res.data.conflicts?.length ?? 0;
+      setGenerateResult(`Згенеровано ${res.data.generated} слотів` + (skipped ? `, пропущено ${skipped} через накладки` : ''));
     } catch (e: any) {
       setError(e.response?.data?.message || 'Помилка генерації слотів');
     } finally {
@@ -191,6 +217,57 @@ export default function ScheduleSection({ user, authenticatedFetch, onReload }:
             )}
           </div>
 
+          {/* Політика скасувань */}
+          <div className="bg-white rounded-2xl border border-gray-200 p-5 space-y-3">
+            <div>
+              <p className="text-sm font-semibold text-gray-800">Політика скасувань</p>
+              <p className="text-xs text-gray-500 mt-0.5">
+                Скасування клієнтом пізніше ніж за вказаний час до початку вважається пізнім
+              </p>
+            </div>
+            <div className="flex flex-wrap items-end gap-3">
+              <label className="flex flex-col gap-1 text-xs text-gray-600">
+                Безкоштовне скасування, год
+                <input
+                  type="number" min={0} max={720} value={freeCancelHours}
+                  onChange={e => setFreeCancelHours(Number(e.target.value))}
+                  className="w-28 px-2 py-1.5 text-sm border border-gray-300 rounded-lg"
+                />
+              </label>
+              <label className="flex flex-col gap-1 text-xs text-gray-600">
+                Неявка після початку, хв
+                <input
+                  type="number" min={0} max={1440} value={noShowGraceMinutes}
+                  onChange={e => setNoShowGraceMinutes(Number(e.target.value))}
+                  className="w-28 px-2 py-1.5 text-sm border border-gray-300 rounded-lg"
+                />
+              </label>
+              <label className="flex flex-col gap-1 text-xs text-gray-600">
+                Перерва між сесіями, хв
+                <input
+                  type="number" min={0} max={240} value={bufferMinutes}
+                  onChange={e => setBufferMinutes(Number(e.target.value))}
+                  className="w-28 px-2 py-1.5 text-sm border border-gray-300 rounded-lg"
+                />
+              </label>
+              <label className="flex flex-col gap-1 text-xs text-gray-600">
+                Часовий пояс розкладу
+                <input
+                  value={scheduleTimeZone} placeholder="Europe/Kyiv"
+                  onChange={e => setScheduleTimeZone(e.target.value)}
+                  className="w-40 px-2 py-1.5 text-sm border border-gray-300 rounded-lg"
+                />
+              </label>
+              <button
+                onClick={handleSavePolicy}
+                className="px-3 py-1.5 text-sm font-medium bg-blue-600 text-white rounded-lg hover:bg-blue-700 transition-colors"
+              >
+                Зберегти
+              </button>
+              {policySaved && <span className="text-xs text-green-600">Збережено</span>}
+            </div>
+          </div>
+
           {/* Шаблони тижневого розкладу */}
           <div className="bg-white rounded-2xl border border-gray-200 p-5 space-y-4">
             <div className="flex items-center gap-2">
@@ -1,10 +1,10 @@
 import React from 'react';
-import { Calendar, Clock, User, CheckCircle, XCircle, AlertCircle, Check } from 'lucide-react';
+import { Calendar, Clock, User, CheckCircle, XCircle, AlertCircle, Check, PlayCircle, RefreshCw, UserX } from 'lucide-react';
 import { format, parseISO } from 'date-fns';
 import { uk } from 'date-fns/locale';
-import { Session } from '../../types/booking';
+import { Session, SessionStatus } from '../../types/booking';
 
-const STATUS_CONFIG = {
+const STATUS_CONFIG: Record<SessionStatus, { label: string; color: string; icon: React.ReactNode }> = {
   pending: {
     label: 'Очікує підтвердження',
     color: 'bg-amber-100 text-amber-700',
@@ -15,24 +15,54 @@ const STATUS_CONFIG = {
     color: 'bg-blue-100 text-blue-700',
     icon: <CheckCircle className="w-3.5 h-3.5" />,
   },
+  rescheduled: {
+    label: 'Перенесено',
+    color: 'bg-blue-100 text-blue-700',
+    icon: <RefreshCw className="w-3.5 h-3.5" />,
+  },
+  in_progress: {
+    label: 'Триває',
+    color: 'bg-indigo-100 text-indigo-700',
+    icon: <PlayCircle className="w-3.5 h-3.5" />,
+  },
   completed: {
     label: 'Завершено',
     color: 'bg-green-100 text-green-700',
     icon: <Check className="w-3.5 h-3.5" />,
   },
+  canceled_by_client: {
+    label: 'Скасовано клієнтом',
+    color: 'bg-red-100 text-red-700',
+    icon: <XCircle className="w-3.5 h-3.5" />,
+  },
+  canceled_by_psychologist: {
+    label: 'Скасовано спеціалістом',
+    color: 'bg-red-100 text-red-700',
+    icon: <XCircle className="w-3.5 h-3.5" />,
+  },
   canceled: {
     label: 'Скасовано',
     color: 'bg-red-100 text-red-700',
     icon: <XCircle className="w-3.5 h-3.5" />,
   },
+  no_show: {
+    label: 'Неявка',
+    color: 'bg-gray-100 text-gray-700',
+    icon: <UserX className="w-3.5 h-3.5" />,
+  },
 };
 
+// Статуси, у яких сесія ще займає час
+const ACTIVE_STATUSES: SessionStatus[] = ['pending', 'confirmed', 'rescheduled'];
+
 type Props = {
   session: Session;
   userRole: 'client' | 'psychologist';
   onCancel?: (id: number) => void;
+  onCancelFollowing?: (id: number) => void;
   onConfirm?: (id: number) => void;
   onComplete?: (id: number) => void;
+  onNoShow?: (id: number) => void;
   loading?: number | null; // ID сесії що зараз завантажується
 };
 
@@ -40,8 +70,10 @@ export const SessionCard: React.FC<Props> = ({
   session,
   userRole,
   onCancel,
+  onCancelFollowing,
   onConfirm,
   onComplete,
+  onNoShow,
   loading,
 }) => {
   const statusCfg = STATUS_CONFIG[session.status];
@@ -93,6 +125,13 @@ export const SessionCard: React.FC<Props> = ({
         </p>
       )}
 
+      {/* Пізнє скасування (у межах вікна безкоштовного скасування) */}
+      {session.cancellation === 'late' && (
+        <p className="text-xs text-orange-700 bg-orange-50 rounded-lg px-2.5 py-1.5">
+          Пізнє скасування
+        </p>
+      )}
+
       {/* Кнопки дій */}
       <div className="flex gap-2 flex-wrap pt-1">
         {/* Психолог підтверджує pending */}
@@ -106,8 +145,8 @@ export const SessionCard: React.FC<Props> = ({
           </button>
         )}
 
-        {/* Психолог завершує confirmed */}
-        {userRole === 'psychologist' && session.status === 'confirmed' && onComplete && (
+        {/* Психолог завершує confirmed / rescheduled / in_progress */}
+        {userRole === 'psychologist' && ['confirmed', 'rescheduled', 'in_progress'].includes(session.status) && onComplete && (
           <button
             onClick={() => onComplete(session.id)}
             disabled={isLoading}
@@ -117,8 +156,19 @@ export const SessionCard: React.FC<Props> = ({
           </button>
         )}
 
-        {/* Скасування: обидві ролі для pending/confirmed */}
-        {(session.status === 'pending' || session.status === 'confirmed') && onCancel && (
+        {/* Психолог відмічає неявку після початку сесії */}
+        {userRole === 'psychologist' && ['confirmed', 'rescheduled', 'in_progress'].includes(session.status) && onNoShow && startDate < new Date() && (
+          <button
+            onClick={() => onNoShow(session.id)}
+            disabled={isLoading}
+            className="flex-1 px-3 py-1.5 text-xs font-medium bg-white text-gray-700 border border-gray-300 rounded-lg hover:bg-gray-50 disabled:opacity-60 transition-colors"
+          >
+            {isLoading ? '...' : 'Неявка'}
+          </button>
+        )}
+
+        {/* Скасування: обидві ролі, поки сесія не почалась */}
+        {ACTIVE_STATUSES.includes(session.status) && onCancel && (
           <button
             onClick={() => onCancel(session.id)}
             disabled={isLoading}
@@ -127,6 +177,17 @@ export const SessionCard: React.FC<Props> = ({
             {isLoading ? '...' : 'Скасувати'}
           </button>
         )}
+
+        {/* Серія: скасувати цю та всі наступні */}
+        {session.seriesId && ACTIVE_STATUSES.includes(session.status) && onCancelFollowing && (
+          <button
+            onClick={() => onCancelFollowing(session.id)}
+            disabled={isLoading}
+            className="w-full px-3 py-1.5 text-xs font-medium bg-white text-red-600 border border-red-200 rounded-lg hover:bg-red-50 disabled:opacity-60 transition-colors"
+          >
+            {isLoading ? '...' : 'Скасувати цю та наступні'}
+          </button>
+        )}
       </div>
     </div>
   );
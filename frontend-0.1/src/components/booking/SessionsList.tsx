@@ -1,7 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import axios from 'axios';
 import { useUserAuth } from '../../context/UserAuthContext';
-import { Session } from '../../types/booking';
+import { Session, isCanceled } from '../../types/booking';
 import { SessionCard } from './SessionCard';
 import { CalendarOff } from 'lucide-react';
 
@@ -45,10 +45,11 @@ export const SessionsList: React.FC<Props> = ({ userRole }) => {
   const handleCancel = async (id: number) => {
     setActionLoading(id);
     try {
-      await axios.put(`/api/users/sessions/${id}/cancel`, {}, {
+      const res = await axios.put(`/api/users/sessions/${id}/cancel`, {}, {
         headers: { Authorization: `Bearer ${token}` },
       });
-      setSessions(prev => prev.map(s => s.id === id ? { ...s, status: 'canceled' } : s));
+      const updated: Session = res.data.data;
+      setSessions(prev => prev.map(s => s.id === id ? { ...s, ...updated } : s));
     } catch {
       setError('Не вдалося скасувати сесію');
     } finally {
@@ -56,6 +57,21 @@ export const SessionsList: React.FC<Props> = ({ userRole }) => {
     }
   };
 
+  const handleCancelFollowing = async (id: number) => {
+    setActionLoading(id);
+    try {
+      const res = await axios.put(`/api/users/sessions/${id}/cancel?scope=following`, {}, {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      const canceled = new Map<number, Session>((res.data.data as Session[]).map(s => [s.id, s]));
+      setSessions(prev => prev.map(s => canceled.has(s.id) ? { ...s, ...canceled.get(s.id) } : s));
+    } catch {
+      setError('Не вдалося скасувати сесії серії');
+    } finally {
+      setActionLoading(null);
+    }
+  };
+
   const handleConfirm = async (id: number) => {
     setActionLoading(id);
     try {
@@ -84,10 +100,26 @@ export const SessionsList: React.FC<Props> = ({ userRole }) => {
     }
   };
 
+  const handleNoShow = async (id: number) => {
+    setActionLoading(id);
+    try {
+      await axios.put(`/api/users/sessions/${id}/no-show`, {}, {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      setSessions(prev => prev.map(s => s.id === id ? { ...s, status: 'no_show' } : s));
+    } catch (e: any) {
+      setError(e.response?.data?.code === 'TOO_EARLY'
+        ? 'Неявку можна відмітити лише після початку сесії'
+        : 'Не вдалося відмітити неявку');
+    } finally {
+      setActionLoading(null);
+    }
+  };
+
   const now = new Date().toISOString();
   const filtered = sessions.filter(s => {
-    if (filter === 'upcoming') return s.startTime >= now && s.status !== 'canceled';
-    if (filter === 'past') return s.startTime < now || s.status === 'completed' || s.status === 'canceled';
+    if (filter === 'upcoming') return s.startTime >= now && !isCanceled(s.status);
+    if (filter === 'past') return s.startTime < now || s.status === 'completed' || isCanceled(s.status);
     return true;
   });
 
@@ -138,8 +170,10 @@ export const SessionsList: React.FC<Props> = ({ userRole }) => {
               session={session}
               userRole={userRole}
               onCancel={handleCancel}
+              onCancelFollowing={handleCancelFollowing}
               onConfirm={userRole === 'psychologist' ? handleConfirm : undefined}
               onComplete={userRole === 'psychologist' ? handleComplete : undefined}
+              onNoShow={userRole === 'psychologist' ? handleNoShow : undefined}
               loading={actionLoading}
             />
           ))}
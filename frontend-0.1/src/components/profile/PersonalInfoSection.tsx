@@ -17,6 +17,7 @@ const PersonalInfoSection: React.FC<Props> = ({ user, authenticatedFetch, onRelo
     firstName: user.firstName || '',
     lastName: user.lastName || '',
     phone: user.phone || '',
+    timeZone: user.timeZone || Intl.DateTimeFormat().resolvedOptions().timeZone,
   });
 
   const handleSave = async () => {
@@ -75,6 +76,11 @@ const PersonalInfoSection: React.FC<Props> = ({ user, authenticatedFetch, onRelo
               <input type="tel" value={form.phone} onChange={e => setForm({ ...form, phone: e.target.value })}
                 className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent text-sm" placeholder="+380..." />
             </div>
+            <div>
+              <label className="block text-sm font-medium text-gray-600 mb-1.5">Часовий пояс</label>
+              <input value={form.timeZone} onChange={e => setForm({ ...form, timeZone: e.target.value })}
+                className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent text-sm" placeholder="Europe/Kyiv" />
+            </div>
           </div>
           <div className="flex gap-2 pt-2">
             <button onClick={handleSave} disabled={saving}
@@ -93,6 +99,7 @@ const PersonalInfoSection: React.FC<Props> = ({ user, authenticatedFetch, onRelo
           <InfoField label="Прізвище" value={user.lastName} />
           <InfoField label="Email" value={user.email} />
           <InfoField label="Телефон" value={user.phone || 'Не вказано'} muted={!user.phone} />
+          <InfoField label="Часовий пояс" value={user.timeZone || 'За замовчуванням'} muted={!user.timeZone} />
         </div>
       )}
     </div>
@@ -38,6 +38,7 @@ export type UserProfile = {
   phone?: string;
   role: string;
   verified: boolean;
+  timeZone?: string;
   skills?: SkillItem[];
   child?: ChildData;
   portfolio?: {
@@ -58,6 +59,10 @@ export type UserProfile = {
     clientAgeMin?: number;
     clientAgeMax?: number;
     scheduleEnforced?: boolean;
+    freeCancelHours?: number;
+    noShowGraceMinutes?: number;
+    bufferMinutes?: number;
+    timeZone?: string;
     photos?: Photo[];
     educations?: Education[];
   };
@@ -13,11 +13,15 @@ export interface GoogleUser {
   firstName: string;
   lastName: string;
   googleId: string;
+  // Proof of the provider login, sent back to /api/register
+  registrationToken?: string;
 }
 
 export interface GoogleAuthResponse {
   status: 'authenticated' | 'registration_required';
   access_token?: string;
+  provider?: string;
+  registrationToken?: string;
   googleUser?: GoogleUser;
 }
 
@@ -90,7 +90,9 @@ const LoginModal: React.FC<LoginModalProps> = ({ isOpen, onClose, onSuccess }) =
       }
     } else if (response.status === 'registration_required' && response.googleUser) {
       onClose();
-      navigate('/register-role', { state: { googleUser: response.googleUser } });
+      navigate('/register-role', {
+        state: { googleUser: { ...response.googleUser, registrationToken: response.registrationToken } },
+      });
     }
   };
 
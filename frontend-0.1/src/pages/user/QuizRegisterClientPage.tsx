@@ -61,7 +61,7 @@ const QuizRegisterClientPage: React.FC = () => {
         email: data.email,
         password: data.password,
         role: 'client',
-        ...(googleUser?.googleId ? { googleId: googleUser.googleId } : {}),
+        ...(googleUser?.registrationToken ? { registrationToken: googleUser.registrationToken } : {}),
         firstName: data.firstName,
         lastName: data.lastName,
         phone: data.phone,
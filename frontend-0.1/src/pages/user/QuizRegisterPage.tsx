@@ -95,8 +95,8 @@ const QuizRegisterPage: React.FC = () => {
     setBusy(true);
     try {
       const payload: any = { ...data };
-      if (googleUser?.googleId) {
-        payload.googleId = googleUser.googleId;
+      if (googleUser?.registrationToken) {
+        payload.registrationToken = googleUser.registrationToken;
       }
       if (selectedSkillIds.length > 0) {
         payload.skillIds = selectedSkillIds;
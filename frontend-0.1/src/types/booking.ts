@@ -5,6 +5,36 @@ export type AvailabilitySlot = {
   endTime: string;
   status: 'available' | 'booked';
   createdAt: string;
+  startTimeLocal?: string;
+  endTimeLocal?: string;
+  timeZone?: string;
+};
+
+export type SessionStatus =
+  | 'pending'
+  | 'confirmed'
+  | 'rescheduled'
+  | 'in_progress'
+  | 'completed'
+  | 'canceled_by_client'
+  | 'canceled_by_psychologist'
+  | 'canceled' // скасовано до того, як почали зберігати, хто скасував
+  | 'no_show';
+
+export const isCanceled = (status: SessionStatus) =>
+  status === 'canceled_by_client' || status === 'canceled_by_psychologist' || status === 'canceled';
+
+export type SessionReschedule = {
+  id: number;
+  sessionId: number;
+  requestedBy: number;
+  requesterType: 'client' | 'psychologist';
+  availabilityId?: number;
+  startTime: string;
+  endTime: string;
+  reason: string;
+  status: 'pending' | 'approved' | 'declined' | 'canceled';
+  createdAt: string;
 };
 
 export type Session = {
@@ -12,12 +42,32 @@ export type Session = {
   psychologistId: number;
   clientId?: number;
   availabilityId?: number;
+  seriesId?: number;
   startTime: string;
   endTime: string;
-  status: 'pending' | 'confirmed' | 'completed' | 'canceled';
+  status: SessionStatus;
   clientNotes?: string;
+  canceledBy?: number;
+  canceledAt?: string;
+  cancellation?: 'free' | 'late';
   psychologist?: { id: number; firstName: string; lastName: string };
   client?: { id: number; firstName: string; lastName: string };
+  pendingReschedule?: SessionReschedule;
+  createdAt: string;
+  startTimeLocal?: string;
+  endTimeLocal?: string;
+  timeZone?: string;
+};
+
+export type SessionSeries = {
+  id: number;
+  psychologistId: number;
+  clientId: number;
+  frequency: 'weekly' | 'biweekly';
+  count?: number;
+  until?: string;
+  startTime: string;
+  endTime: string;
   createdAt: string;
 };
 
@@ -0,0 +1,153 @@
+// Package audit records mutating administrative actions in the audit_events table.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// Target types used in audit events
+const (
+	TargetUser          = "user"
+	TargetSkill         = "skill"
+	TargetSkillCategory = "skill_category"
+	TargetPlan          = "plan"
+	TargetAdministrator = "administrator"
+	TargetNews          = "news"
+	TargetReview        = "review"
+	TargetSetting       = "setting"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are never written to the audit log; a change is recorded as redacted on both sides
+var sensitiveFields = map[string]bool{
+	"password":          true,
+	"newpassword":       true,
+	"totpsecret":        true,
+	"verificationtoken": true,
+	"refreshtoken":      true,
+}
+
+// FieldChange is the before and after value of one changed field
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Record stores an audit event for the administrator authenticated in the request.
+// before and after are JSON-serialisable snapshots of the target (nil for create / delete);
+// only the fields that differ are kept. Failures are logged and never break the request.
+func Record(r *http.Request, action, targetType string, targetID interface{}, before, after interface{}) {
+	admin, ok := auth.AdminFromContext(r.Context())
+	if !ok {
+		log.Warn().Str("action", action).Msg("audit: no administrator in context, event not recorded")
+		return
+	}
+
+	changes, err := json.Marshal(Diff(before, after))
+	if err != nil {
+		log.Error().Err(err).Str("action", action).Msg("audit: failed to encode changes")
+		changes = []byte("{}")
+	}
+
+	event := models.AuditEvent{
+		ActorID:       admin.ID,
+		ActorUsername: admin.Username,
+		Action:        action,
+		TargetType:    targetType,
+		TargetID:      fmt.Sprint(targetID),
+		Changes:       changes,
+		IP:            utils.ClientIP(r),
+		RequestID:     middleware.GetReqID(r.Context()),
+	}
+	if err := db.DB.Create(&event).Error; err != nil {
+		log.Error().Err(err).Str("action", action).Str("target_type", targetType).Msg("audit: failed to store event")
+	}
+}
+
+// Diff compares two snapshots field by field (top-level JSON keys) and returns the changed fields
+func Diff(before, after interface{}) map[string]FieldChange {
+	b := toMap(before)
+	a := toMap(after)
+
+	changes := make(map[string]FieldChange)
+	for key, oldValue := range b {
+		newValue, exists := a[key]
+		if !exists || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = redact(key, FieldChange{Before: oldValue, After: newValue})
+		}
+	}
+	for key, newValue := range a {
+		if _, exists := b[key]; !exists {
+			changes[key] = redact(key, FieldChange{After: newValue})
+		}
+	}
+	return changes
+}
+
+func redact(key string, change FieldChange) FieldChange {
+	if !sensitiveFields[strings.ToLower(key)] {
+		return FieldChange{Before: scrub(change.Before), After: scrub(change.After)}
+	}
+	if change.Before != nil {
+		change.Before = redacted
+	}
+	if change.After != nil {
+		change.After = redacted
+	}
+	return change
+}
+
+// scrub redacts sensitive fields nested anywhere inside a value (e.g. a preloaded author)
+func scrub(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		clean := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if sensitiveFields[strings.ToLower(k)] {
+				clean[k] = redacted
+			} else {
+				clean[k] = scrub(item)
+			}
+		}
+		return clean
+	case []interface{}:
+		clean := make([]interface{}, len(value))
+		for i, item := range value {
+			clean[i] = scrub(item)
+		}
+		return clean
+	default:
+		return v
+	}
+}
+
+// toMap converts a snapshot to its JSON object form
+func toMap(v interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	if v == nil {
+		return result
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return result
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		// Not an object (e.g. a plain value): keep it under a single key
+		var value interface{}
+		json.Unmarshal(data, &value)
+		result["value"] = value
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"user-api/internal/models"
+)
+
+// AdminContextKey is the context key under which RequireAdmin stores the loaded *models.Administrator.
+// Handlers should use AdminFromContext instead of reading it directly.
+const AdminContextKey = "admin"
+
+// WithAdmin returns a copy of ctx carrying the authenticated administrator
+func WithAdmin(ctx context.Context, admin *models.Administrator) context.Context {
+	return context.WithValue(ctx, AdminContextKey, admin)
+}
+
+// AdminFromContext returns the administrator loaded by RequireAdmin
+func AdminFromContext(ctx context.Context) (*models.Administrator, bool) {
+	admin, ok := ctx.Value(AdminContextKey).(*models.Administrator)
+	return admin, ok && admin != nil
+}
+
+// AuthPrincipal is the authenticated user as loaded by RequireUser. Handlers read it with
+// PrincipalFromContext instead of looking the user up by email.
+type AuthPrincipal struct {
+	UserID uint64
+	Email  string
+	Role   string // client or psychologist
+	Status string // Active, Disabled or Blocked
+	PlanID *uint64
+
+	// Impersonator is the administrator acting as the user (see POST /api/admin/users/{id}/impersonate),
+	// nil when the user signed in personally
+	Impersonator *Impersonator
+
+	// APIKeyID and Scopes are set when the request is authenticated with a personal API key
+	// (Authorization: ApiKey ...); the key only reaches routes that require one of its scopes
+	APIKeyID uint64
+	Scopes   []string
+}
+
+// Impersonator identifies the administrator behind an impersonation token
+type Impersonator struct {
+	AdminID  uint64
+	Username string
+}
+
+// HasScope reports whether the request may use a route that requires the scope.
+// Requests signed in with a JWT are not limited by scopes.
+func (p *AuthPrincipal) HasScope(scope string) bool {
+	if p.APIKeyID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImpersonated reports whether the request is made by an administrator acting as the user
+func (p *AuthPrincipal) IsImpersonated() bool {
+	return p.Impersonator != nil
+}
+
+// IsClient reports whether the principal is a client
+func (p *AuthPrincipal) IsClient() bool {
+	return p.Role == "client"
+}
+
+// IsPsychologist reports whether the principal is a psychologist
+func (p *AuthPrincipal) IsPsychologist() bool {
+	return p.Role == "psychologist"
+}
+
+// principalKey is private so the principal can only be set through WithPrincipal
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated user
+func WithPrincipal(ctx context.Context, principal *AuthPrincipal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the user loaded by RequireUser
+func PrincipalFromContext(ctx context.Context) (*AuthPrincipal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*AuthPrincipal)
+	return principal, ok && principal != nil
+}
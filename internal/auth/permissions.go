@@ -0,0 +1,97 @@
+// Package auth holds the administrator permission model and the request context accessors
+// shared by the middleware and the handlers.
+package auth
+
+import "sort"
+
+// Administrator permissions checked by middleware.RequirePermission
+const (
+	PermUsersRead        = "users.read"
+	PermUsersWrite       = "users.write"
+	PermUsersDelete      = "users.delete"
+	PermUsersPassword    = "users.password"
+	PermUsersImpersonate = "users.impersonate"
+	PermSkillsRead       = "skills.read"
+	PermSkillsManage     = "skills.manage"
+	PermPlansRead        = "plans.read"
+	PermPlansManage      = "plans.manage"
+	PermAdminsRead       = "admins.read"
+	PermAdminsManage     = "admins.manage"
+	PermNewsRead         = "news.read"
+	PermNewsManage       = "news.manage"
+	PermReviewsRead      = "reviews.read"
+	PermReviewsDelete    = "reviews.delete"
+	PermSettingsManage   = "settings.manage"
+	PermAuditRead        = "audit.read"
+	PermJobsRead         = "jobs.read"
+)
+
+// Administrator roles, from the least to the most privileged
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleMaster    = "master"
+)
+
+var moderatorPermissions = []string{
+	PermUsersRead,
+	PermSkillsRead,
+	PermNewsRead,
+	PermNewsManage,
+	PermReviewsRead,
+	PermReviewsDelete,
+}
+
+var adminPermissions = append([]string{
+	PermUsersWrite,
+	PermUsersDelete,
+	PermUsersPassword,
+	PermUsersImpersonate,
+	PermSkillsManage,
+	PermPlansRead,
+	PermPlansManage,
+	PermAdminsRead,
+	PermAuditRead,
+	PermJobsRead,
+}, moderatorPermissions...)
+
+var masterPermissions = append([]string{
+	PermAdminsManage,
+	PermSettingsManage,
+}, adminPermissions...)
+
+// rolePermissions is the permission set of every administrator role
+var rolePermissions = map[string]map[string]bool{
+	RoleModerator: toSet(moderatorPermissions),
+	RoleAdmin:     toSet(adminPermissions),
+	RoleMaster:    toSet(masterPermissions),
+}
+
+func toSet(perms []string) map[string]bool {
+	set := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+// IsAdminRole reports whether role is one of the administrator roles
+func IsAdminRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether an administrator role has the permission
+func Can(role, permission string) bool {
+	return rolePermissions[role][permission]
+}
+
+// PermissionsFor returns the sorted permission list of a role (empty for unknown roles)
+func PermissionsFor(role string) []string {
+	perms := make([]string, 0, len(rolePermissions[role]))
+	for p := range rolePermissions[role] {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
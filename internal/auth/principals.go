@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// PrincipalLoader loads a user's principal from the database
+type PrincipalLoader func(userID uint64) (*AuthPrincipal, error)
+
+// PrincipalCache keeps loaded principals for a short time so RequireUser does not query the
+// users table on every request. A status or role change is picked up once the entry expires,
+// or immediately when the handler that made it calls Invalidate.
+type PrincipalCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[uint64]principalEntry
+	now     func() time.Time
+	ops     int
+}
+
+type principalEntry struct {
+	principal *AuthPrincipal
+	expiresAt time.Time
+}
+
+// Principals is the cache used by RequireUser; the middleware sets its TTL from config
+var Principals = NewPrincipalCache(30 * time.Second)
+
+// NewPrincipalCache creates a cache; a zero ttl disables caching
+func NewPrincipalCache(ttl time.Duration) *PrincipalCache {
+	return &PrincipalCache{ttl: ttl, entries: make(map[uint64]principalEntry), now: time.Now}
+}
+
+// SetClock replaces the time source (used by tests)
+func (c *PrincipalCache) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// Get returns the cached principal of a user, loading it when missing or expired.
+// Load errors are not cached.
+func (c *PrincipalCache) Get(userID uint64, load PrincipalLoader) (*AuthPrincipal, error) {
+	c.mu.Lock()
+	now := c.now()
+	if entry, ok := c.entries[userID]; ok && now.Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.principal, nil
+	}
+	c.mu.Unlock()
+
+	principal, err := load(userID)
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl <= 0 {
+		return principal, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[userID] = principalEntry{principal: principal, expiresAt: now.Add(c.ttl)}
+	c.ops++
+	if c.ops%1000 == 0 {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// Invalidate drops the cached principal of a user (call it after changing status, role or plan)
+func (c *PrincipalCache) Invalidate(userID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "sort"
+
+// API key scopes: "<resource>:<access>". A key can only reach the routes that require one of its scopes.
+const (
+	ScopeSessionsRead      = "sessions:read"
+	ScopeSessionsWrite     = "sessions:write"
+	ScopeAvailabilityRead  = "availability:read"
+	ScopeAvailabilityWrite = "availability:write"
+)
+
+var apiKeyScopes = toSet([]string{
+	ScopeSessionsRead,
+	ScopeSessionsWrite,
+	ScopeAvailabilityRead,
+	ScopeAvailabilityWrite,
+})
+
+// IsAPIKeyScope reports whether scope is a known API key scope
+func IsAPIKeyScope(scope string) bool {
+	return apiKeyScopes[scope]
+}
+
+// APIKeyScopes returns the sorted list of API key scopes
+func APIKeyScopes() []string {
+	scopes := make([]string, 0, len(apiKeyScopes))
+	for s := range apiKeyScopes {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
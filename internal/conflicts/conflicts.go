@@ -0,0 +1,105 @@
+// Package conflicts finds the sessions and open availability slots of a psychologist that overlap a time
+// range, keeping an optional buffer around sessions. Every path that puts something in a psychologist's
+// calendar locks the psychologist first, so two requests for the same time are checked one after the other.
+package conflicts
+
+import (
+	"fmt"
+	"time"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Conflict types
+const (
+	TypeSession = "session"
+	TypeSlot    = "slot"
+)
+
+// Conflict is a session or an open slot in the way of a new time range
+type Conflict struct {
+	Type      string    `json:"type"`
+	ID        uint64    `json:"id"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Status    string    `json:"status"`
+}
+
+// Error is returned by Check when the range is taken
+type Error struct {
+	Conflicts []Conflict
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("time range overlaps %d sessions or slots", len(e.Conflicts))
+}
+
+// Query describes the range to check
+type Query struct {
+	PsychologistID uint64
+	Start, End     time.Time
+	// Buffer is the free time to keep before and after every session. Open slots may be back to back:
+	// a slot is only a candidate time, and the buffer is checked again when it becomes a session.
+	Buffer time.Duration
+	// IgnoreSessionID and IgnoreSlotID leave out the session being moved or confirmed and its own slot
+	IgnoreSessionID uint64
+	IgnoreSlotID    uint64
+}
+
+// LockPsychologist locks the psychologist's user row until the end of the transaction. Callers take it
+// after locking the session they change (if any) and before locking availability slots.
+func LockPsychologist(tx *gorm.DB, psychologistID uint64) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, psychologistID).Error
+}
+
+// Find returns the active sessions of the psychologist that overlap the range widened by the buffer, and
+// the open slots that overlap the range itself. A booked slot is covered by its session, so only available
+// slots are returned.
+func Find(tx *gorm.DB, q Query) ([]Conflict, error) {
+	from, to := q.Start.Add(-q.Buffer), q.End.Add(q.Buffer)
+
+	var sessions []models.Session
+	query := tx.Select("id", "start_time", "end_time", "status").
+		Where("psychologist_id = ? AND status IN ? AND start_time < ? AND end_time > ?", q.PsychologistID, sessionstate.Active(), to, from)
+	if q.IgnoreSessionID != 0 {
+		query = query.Where("id <> ?", q.IgnoreSessionID)
+	}
+	if err := query.Order("start_time").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	var slots []models.Availability
+	query = tx.Select("id", "start_time", "end_time", "status").
+		Where("psychologist_id = ? AND status = 'available' AND start_time < ? AND end_time > ?", q.PsychologistID, q.End, q.Start)
+	if q.IgnoreSlotID != 0 {
+		query = query.Where("id <> ?", q.IgnoreSlotID)
+	}
+	if err := query.Order("start_time").Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	found := make([]Conflict, 0, len(sessions)+len(slots))
+	for _, s := range sessions {
+		found = append(found, Conflict{Type: TypeSession, ID: s.ID, StartTime: s.StartTime, EndTime: s.EndTime, Status: s.Status})
+	}
+	for _, s := range slots {
+		found = append(found, Conflict{Type: TypeSlot, ID: s.ID, StartTime: s.StartTime, EndTime: s.EndTime, Status: s.Status})
+	}
+	return found, nil
+}
+
+// Check returns an *Error listing the conflicts, or nil if the range is free
+func Check(tx *gorm.DB, q Query) error {
+	found, err := Find(tx, q)
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return &Error{Conflicts: found}
+	}
+	return nil
+}
@@ -13,8 +13,10 @@ import (
 var DB *gorm.DB
 
 func Connect() {
+	// Times are stored in UTC whatever the zone of the server: loc makes the driver write and read
+	// DATETIME values as UTC and time_zone makes NOW() and friends agree with it
 	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%%27%%2B00%%3A00%%27",
 		os.Getenv("DB_USER"),
 		os.Getenv("DB_PASSWORD"),
 		os.Getenv("DB_HOST"),
@@ -44,11 +46,66 @@ func Connect() {
 		&models.Rating{},
 		&models.BlogPost{},
 		&models.Session{},
+		&models.SessionEvent{},
+		&models.SessionReschedule{},
+		&models.SessionSeries{},
 		&models.Conversation{},
 		&models.Message{},
 		&models.Availability{},
 		&models.News{},
 		&models.Child{},
 		&models.ScheduleTemplate{},
+		&models.ScheduleException{},
+		&models.PasswordResetToken{},
+		&models.MagicLinkToken{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.EmailChange{},
+		&models.APIKey{},
+		&models.MFARecoveryCode{},
+		&models.MFAPendingToken{},
+		&models.SystemSetting{},
+		&models.RefreshToken{},
+		&models.AuditEvent{},
+		&models.LoginAttempt{},
+		&models.RateLimitBucket{},
+		&models.JobLease{},
+		&models.JobRun{},
+		&models.SchemaMigration{},
 	)
+
+	// Older versions stored local times of the server; convert them before anything new is written
+	if err := ApplyOnce("datetimes_to_utc", migrateDatetimesToUTC); err != nil {
+		log.Fatal("Failed to convert stored times to UTC:", err)
+	}
+
+	// Refresh tokens moved to the refresh_tokens table (one row per device)
+	for _, model := range []interface{}{&models.User{}, &models.Administrator{}} {
+		if DB.Migrator().HasColumn(model, "refresh_token") {
+			DB.Migrator().DropColumn(model, "refresh_token")
+		}
+	}
+
+	// Verification tokens are stored hashed; SHA2() gives the same lowercase hex as the handlers
+	if DB.Migrator().HasColumn(&models.User{}, "verification_token") {
+		if err := DB.Exec(`UPDATE users SET verification_hash = SHA2(verification_token, 256)
+			WHERE verification_token IS NOT NULL AND verification_token <> ''`).Error; err != nil {
+			log.Fatal("Failed to hash verification tokens:", err)
+		}
+		DB.Migrator().DropColumn(&models.User{}, "verification_token")
+	}
+
+	// Google accounts moved from users.google_id to user_identities (one row per provider account)
+	if DB.Migrator().HasColumn(&models.User{}, "google_id") {
+		if err := DB.Exec(`INSERT IGNORE INTO user_identities (user_id, provider, subject, email, created_at)
+			SELECT id, 'google', google_id, email, NOW() FROM users WHERE google_id IS NOT NULL AND google_id <> ''`).Error; err != nil {
+			log.Fatal("Failed to migrate Google accounts to user_identities:", err)
+		}
+		DB.Migrator().DropColumn(&models.User{}, "google_id")
+	}
+
+	// Cancellations record who canceled since the session state machine; older ones stay neutral
+	if err := ApplyOnce("sessions_legacy_cancellations", ClassifyLegacyCancellations); err != nil {
+		log.Fatal("Failed to migrate canceled sessions:", err)
+	}
 }
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"user-api/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ApplyOnce runs migrate in a transaction unless the migration called name was applied before.
+// The marker row is inserted first, so of several instances starting at once only one migrates;
+// the others wait for its transaction and then skip it.
+func ApplyOnce(name string, migrate func(tx *gorm.DB) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.SchemaMigration{Name: name, AppliedAt: time.Now().UTC()})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return migrate(tx)
+	})
+}
+
+// ClassifyLegacyCancellations gives the sessions canceled before the session state machine a status
+// that does not blame anyone. Who canceled them was never stored, so they keep the neutral legacy
+// status "canceled" unless canceled_by says otherwise. It also reverts the earlier migration that
+// attributed all of them to the psychologist: a cancellation by the psychologist that has neither
+// canceled_by nor a session event was not made through the state machine.
+func ClassifyLegacyCancellations(tx *gorm.DB) error {
+	if err := tx.Exec(`UPDATE sessions SET status = 'canceled'
+		WHERE status = 'canceled_by_psychologist' AND canceled_by IS NULL
+		AND NOT EXISTS (SELECT 1 FROM session_events e WHERE e.session_id = sessions.id AND e.to_status = 'canceled_by_psychologist')`).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE sessions SET status = CASE
+			WHEN canceled_by = psychologist_id THEN 'canceled_by_psychologist'
+			WHEN canceled_by = client_id THEN 'canceled_by_client'
+			ELSE status END
+		WHERE status = 'canceled' AND canceled_by IS NOT NULL`).Error
+}
+
+// ConvertDatetimesToUTC rewrites every DATETIME column of the database, written by an older version in
+// the server's local time, from zone to UTC. zone is an IANA name, which needs the MySQL time zone tables
+// (loaded by the official MySQL image), or an offset such as "+02:00". TIMESTAMP columns are stored in
+// UTC by MySQL itself and are left alone.
+func ConvertDatetimesToUTC(tx *gorm.DB, zone string) error {
+	var known bool
+	if err := tx.Raw("SELECT CONVERT_TZ('2000-01-01 00:00:00', ?, '+00:00') IS NOT NULL", zone).Scan(&known).Error; err != nil {
+		return err
+	}
+	if !known {
+		return fmt.Errorf("MySQL cannot convert from time zone %q: load the time zone tables or use an offset such as +02:00", zone)
+	}
+
+	var columns []struct {
+		TableName  string
+		ColumnName string
+	}
+	if err := tx.Raw(`SELECT TABLE_NAME AS table_name, COLUMN_NAME AS column_name FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND DATA_TYPE = 'datetime' AND TABLE_NAME <> 'schema_migrations'
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`).Scan(&columns).Error; err != nil {
+		return err
+	}
+	var tables []string
+	sets := map[string][]string{}
+	args := map[string][]interface{}{}
+	for _, c := range columns {
+		if _, ok := sets[c.TableName]; !ok {
+			tables = append(tables, c.TableName)
+		}
+		sets[c.TableName] = append(sets[c.TableName], fmt.Sprintf("`%s` = CONVERT_TZ(`%s`, ?, '+00:00')", c.ColumnName, c.ColumnName))
+		args[c.TableName] = append(args[c.TableName], zone)
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf("UPDATE `%s` SET %s", table, strings.Join(sets[table], ", "))
+		if err := tx.Exec(query, args[table]...).Error; err != nil {
+			return fmt.Errorf("convert %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// errLegacyTimeZoneRequired stops the first start on a database with data when its zone is unknown
+var errLegacyTimeZoneRequired = errors.New("set DB_LEGACY_TIME_ZONE to the time zone the server had before times were stored in UTC (UTC if it already was)")
+
+// migrateDatetimesToUTC converts the times written by versions that stored them in the server's local
+// time, once. A new database has nothing to convert; an existing one needs DB_LEGACY_TIME_ZONE.
+func migrateDatetimesToUTC(tx *gorm.DB) error {
+	zone := os.Getenv("DB_LEGACY_TIME_ZONE")
+	if zone == "" {
+		var users int64
+		if err := tx.Model(&models.User{}).Count(&users).Error; err != nil {
+			return err
+		}
+		if users > 0 {
+			return errLegacyTimeZoneRequired
+		}
+		return nil
+	}
+	if zone == "UTC" || zone == "+00:00" {
+		return nil
+	}
+	return ConvertDatetimesToUTC(tx, zone)
+}
@@ -4,13 +4,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
 	"user-api/internal/db"
+	"user-api/internal/loginguard"
 	"user-api/internal/models"
 	"user-api/internal/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // CreateUser godoc
@@ -32,11 +37,12 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !processUserCreation(w, &user) {
+	if !processUserCreation(w, &user, true) {
 		return
 	}
 
 	log.Info().Str("email", user.Email).Str("role", user.Role).Msg("CreateUser: user successfully created")
+	audit.Record(r, "user.create", audit.TargetUser, user.ID, nil, user)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -85,7 +91,18 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, user)
+
+	lockout, err := LoginGuard.Status(loginguard.AccountKey("user", user.Email))
+	if err != nil {
+		log.Error().Err(err).Uint64("user_id", user.ID).Msg("GetUser: failed to read lockout state")
+	}
+	utils.WriteJSON(w, http.StatusOK, adminUserResponse{User: user, Lockout: lockout})
+}
+
+// adminUserResponse is a user as seen by administrators, with the login lockout state
+type adminUserResponse struct {
+	models.User
+	Lockout loginguard.Status `json:"lockout"`
 }
 
 // AdminChangeUserPassword godoc
@@ -113,16 +130,15 @@ func AdminChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
 		return
 	}
-	if len(req.NewPassword) < 8 {
-		utils.WriteError(w, http.StatusBadRequest, "PASSWORD_TOO_SHORT", "Password must be at least 8 characters")
-		return
-	}
 
 	var user models.User
 	if err := db.DB.First(&user, id).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 		return
 	}
+	if !checkPasswordPolicy(w, req.NewPassword, user.FirstName, user.LastName, user.Email) {
+		return
+	}
 
 	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -134,6 +150,8 @@ func AdminChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update password")
 		return
 	}
+	audit.Record(r, "user.password_change", audit.TargetUser, user.ID,
+		map[string]interface{}{"password": "old"}, map[string]interface{}{"password": "new"})
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -160,20 +178,24 @@ func AdminUpdateUserPortfolio(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Description      *string  `json:"description"`
-		Experience       *int     `json:"experience"`
-		City             *string  `json:"city"`
-		Address          *string  `json:"address"`
-		Rate             *float64 `json:"rate"`
-		ContactEmail     *string  `json:"contactEmail"`
-		ContactPhone     *string  `json:"contactPhone"`
-		Telegram         *string  `json:"telegram"`
-		FacebookURL      *string  `json:"facebookURL"`
-		InstagramURL     *string  `json:"instagramURL"`
-		VideoURL         *string  `json:"videoURL"`
-		ScheduleEnforced *bool    `json:"scheduleEnforced"`
-		ClientAgeMin     *int     `json:"clientAgeMin"`
-		ClientAgeMax     *int     `json:"clientAgeMax"`
+		Description        *string  `json:"description"`
+		Experience         *int     `json:"experience"`
+		City               *string  `json:"city"`
+		Address            *string  `json:"address"`
+		Rate               *float64 `json:"rate"`
+		ContactEmail       *string  `json:"contactEmail"`
+		ContactPhone       *string  `json:"contactPhone"`
+		Telegram           *string  `json:"telegram"`
+		FacebookURL        *string  `json:"facebookURL"`
+		InstagramURL       *string  `json:"instagramURL"`
+		VideoURL           *string  `json:"videoURL"`
+		ScheduleEnforced   *bool    `json:"scheduleEnforced"`
+		FreeCancelHours    *int     `json:"freeCancelHours"`
+		NoShowGraceMinutes *int     `json:"noShowGraceMinutes"`
+		BufferMinutes      *int     `json:"bufferMinutes"`
+		TimeZone           *string  `json:"timeZone"`
+		ClientAgeMin       *int     `json:"clientAgeMin"`
+		ClientAgeMax       *int     `json:"clientAgeMax"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
@@ -182,6 +204,7 @@ func AdminUpdateUserPortfolio(w http.ResponseWriter, r *http.Request) {
 
 	var portfolio models.Portfolio
 	db.DB.Where("psychologist_id = ?", id).FirstOrCreate(&portfolio, models.Portfolio{PsychologistID: uint64(id)})
+	before := portfolio
 
 	if req.Description != nil {
 		portfolio.Description = *req.Description
@@ -219,6 +242,15 @@ func AdminUpdateUserPortfolio(w http.ResponseWriter, r *http.Request) {
 	if req.ScheduleEnforced != nil {
 		portfolio.ScheduleEnforced = *req.ScheduleEnforced
 	}
+	if !applyCancellationPolicy(w, &portfolio, req.FreeCancelHours, req.NoShowGraceMinutes) {
+		return
+	}
+	if !applyBufferMinutes(w, &portfolio, req.BufferMinutes) {
+		return
+	}
+	if !applyTimeZone(w, &portfolio.TimeZone, req.TimeZone) {
+		return
+	}
 	if req.ClientAgeMin != nil {
 		portfolio.ClientAgeMin = req.ClientAgeMin
 	}
@@ -230,6 +262,7 @@ func AdminUpdateUserPortfolio(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update portfolio")
 		return
 	}
+	audit.Record(r, "user.portfolio_update", audit.TargetUser, id, before, portfolio)
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -263,6 +296,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Incorrect request format")
 		return
 	}
+	before := user
 
 	for key, value := range updatedUser {
 		switch key {
@@ -310,6 +344,18 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to update user data")
 		return
 	}
+	// An email set by an administrator replaces any self-service change in progress and, like a
+	// confirmed change, signs the user out everywhere
+	if user.Email != before.Email {
+		db.DB.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND canceled_at IS NULL", user.ID).
+			Update("canceled_at", time.Now())
+		if err := revokeAllRefreshTokens(db.DB, "user", user.ID); err != nil {
+			log.Error().Err(err).Uint64("user_id", user.ID).Msg("UpdateUser: failed to revoke refresh tokens after email change")
+		}
+	}
+	auth.Principals.Invalidate(user.ID)
+	audit.Record(r, "user.update", audit.TargetUser, user.ID, before, user)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -348,6 +394,7 @@ func CreateSkill(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to create skill")
 		return
 	}
+	audit.Record(r, "skill.create", audit.TargetSkill, skill.ID, nil, skill)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -406,6 +453,7 @@ func CreateSkillCategory(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to create category")
 		return
 	}
+	audit.Record(r, "skill_category.create", audit.TargetSkillCategory, category.ID, nil, category)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -461,129 +509,15 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Start transaction
-	tx := db.DB.Begin()
-	if tx.Error != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to start transaction")
-		return
-	}
-
-	// Delete related data in correct order
-
-	// 1. Delete child record if exists
-	if err := tx.Where("client_id = ?", id).Delete(&models.Child{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete child records")
-		return
-	}
-
-	// 2. Find portfolio and delete its children (photos, educations, languages, diplomas)
-	var portfolio models.Portfolio
-	if err := tx.Where("psychologist_id = ?", id).First(&portfolio).Error; err == nil {
-		if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(&models.Photo{}).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete photos")
-			return
-		}
-		if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(&models.Education{}).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete educations")
-			return
-		}
-		if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(&models.Language{}).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete languages")
-			return
-		}
-		if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(&models.Diploma{}).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete diplomas")
-			return
-		}
-		if err := tx.Delete(&portfolio).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete portfolio")
-			return
-		}
-	}
-
-	// 3. Delete blog posts
-	if err := tx.Where("psychologist_id = ?", id).Delete(&models.BlogPost{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete blog posts")
-		return
-	}
-
-	// 4. Delete reviews and ratings
-	if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(&models.Review{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete reviews")
-		return
-	}
-	if err := tx.Where("psychologist_id = ?", id).Delete(&models.Rating{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete ratings")
-		return
-	}
-
-	// 5. Delete psychologist skills
-	if err := tx.Where("psychologist_id = ?", id).Delete(&models.PsychologistSkills{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete skills")
-		return
-	}
-
-	// 6. Delete availabilities
-	if err := tx.Where("psychologist_id = ?", id).Delete(&models.Availability{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete availabilities")
-		return
-	}
-
-	// 7. Delete schedule templates
-	if err := tx.Where("psychologist_id = ?", id).Delete(&models.ScheduleTemplate{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete schedule templates")
-		return
-	}
-
-	// 8. Delete sessions (appointments)
-	if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(&models.Session{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete sessions")
-		return
-	}
-
-	// 9. Delete conversations and messages (chat history)
-	var convIDs []uint64
-	tx.Model(&models.Conversation{}).
-		Where("client_id = ? OR psychologist_id = ?", id, id).
-		Pluck("id", &convIDs)
-	if len(convIDs) > 0 {
-		if err := tx.Where("conversation_id IN ?", convIDs).Delete(&models.Message{}).Error; err != nil {
-			tx.Rollback()
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete messages")
-			return
-		}
-	}
-	if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(&models.Conversation{}).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete conversations")
-		return
-	}
-
-	// 10. Finally delete user
-	if err := tx.Delete(&user).Error; err != nil {
-		tx.Rollback()
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteUserData(tx, &user)
+	}); err != nil {
+		log.Error().Err(err).Int("user_id", id).Msg("DeleteUser: failed to delete user data")
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete user")
 		return
 	}
-
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to commit transaction")
-		return
-	}
+	auth.Principals.Invalidate(user.ID)
+	audit.Record(r, "user.delete", audit.TargetUser, user.ID, user, nil)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -642,6 +576,7 @@ func CreatePlan(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to create plan")
 		return
 	}
+	audit.Record(r, "plan.create", audit.TargetPlan, plan.ID, nil, plan)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -686,6 +621,7 @@ func UpdatePlan(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the fields
+	before := plan
 	plan.Name = updatedPlan.Name
 	plan.Description = updatedPlan.Description
 	plan.Price = updatedPlan.Price
@@ -696,6 +632,7 @@ func UpdatePlan(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to update plan")
 		return
 	}
+	audit.Record(r, "plan.update", audit.TargetPlan, plan.ID, before, plan)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -748,6 +685,7 @@ func DeletePlan(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete plan")
 		return
 	}
+	audit.Record(r, "plan.delete", audit.TargetPlan, plan.ID, plan, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -787,6 +725,7 @@ func DeleteSkill(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete skill")
 		return
 	}
+	audit.Record(r, "skill.delete", audit.TargetSkill, skill.ID, skill, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -832,6 +771,7 @@ func DeleteSkillCategory(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to delete category")
 		return
 	}
+	audit.Record(r, "skill_category.delete", audit.TargetSkillCategory, category.ID, category, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -875,6 +815,7 @@ func UpdateSkill(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Оновлюємо дані
+	before := skill
 	skill.Name = updatedSkill.Name
 	skill.CategoryID = updatedSkill.CategoryID
 
@@ -882,6 +823,7 @@ func UpdateSkill(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to update skill")
 		return
 	}
+	audit.Record(r, "skill.update", audit.TargetSkill, skill.ID, before, skill)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -925,12 +867,14 @@ func UpdateSkillCategory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Оновлюємо назву
+	before := category
 	category.Name = updatedCategory.Name
 
 	if err := db.DB.Save(&category).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to update category")
 		return
 	}
+	audit.Record(r, "skill_category.update", audit.TargetSkillCategory, category.ID, before, category)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -939,9 +883,9 @@ func UpdateSkillCategory(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// CreateAdmin creates a new administrator (requires admin or master role)
+// CreateAdmin creates a new administrator (requires admins.manage, master role)
 // @Summary      Create administrator
-// @Description  Add a new administrator (admin or master role only)
+// @Description  Add a new administrator (master role only)
 // @Tags         Actions for administrators
 // @Accept       json
 // @Produce      json
@@ -988,6 +932,7 @@ func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create administrator")
 		return
 	}
+	audit.Record(r, "admin.create", audit.TargetAdministrator, newAdmin.ID, nil, newAdmin)
 
 	newAdmin.Password = "" // Don't return password in response
 	json.NewEncoder(w).Encode(newAdmin)
@@ -995,7 +940,7 @@ func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 
 // UpdateAdmin updates administrator details
 // @Summary      Update administrator
-// @Description  Update administrator details by ID (admin or master role only)
+// @Description  Update administrator details by ID (master role only)
 // @Tags         Actions for administrators
 // @Accept       json
 // @Produce      json
@@ -1044,6 +989,7 @@ func UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update fields
+	before := admin
 	admin.FirstName = updates.FirstName
 	admin.LastName = updates.LastName
 	admin.Email = updates.Email
@@ -1059,6 +1005,7 @@ func UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update administrator")
 		return
 	}
+	audit.Record(r, "admin.update", audit.TargetAdministrator, admin.ID, before, admin)
 
 	admin.Password = "" // Don't return password
 	json.NewEncoder(w).Encode(admin)
@@ -1066,7 +1013,7 @@ func UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 
 // DeleteAdmin deletes an administrator
 // @Summary      Delete administrator
-// @Description  Delete administrator by ID (admin or master role only)
+// @Description  Delete administrator by ID (master role only)
 // @Tags         Actions for administrators
 // @Produce      json
 // @Param        id path int true "Administrator ID"
@@ -1101,6 +1048,7 @@ func DeleteAdmin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to delete administrator")
 		return
 	}
+	audit.Record(r, "admin.delete", audit.TargetAdministrator, admin.ID, admin, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
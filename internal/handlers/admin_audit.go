@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+// auditQuery applies the filters of GET /api/admin/audit to a query
+func auditQuery(r *http.Request) (*gorm.DB, string, string) {
+	q := r.URL.Query()
+	query := db.DB.Model(&models.AuditEvent{})
+
+	if raw := q.Get("actorId"); raw != "" {
+		actorID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, "INVALID_ID", "Invalid actor ID"
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if targetType := q.Get("targetType"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := q.Get("targetId"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if action := q.Get("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if raw := q.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, "INVALID_DATE", "Invalid 'from' date, expected RFC 3339"
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if raw := q.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, "INVALID_DATE", "Invalid 'to' date, expected RFC 3339"
+		}
+		query = query.Where("created_at <= ?", to)
+	}
+	return query, "", ""
+}
+
+// GetAuditEvents godoc
+// @Summary      Audit log
+// @Description  Lists administrative actions, newest first. Filters by actor, target, action and time range; format=csv downloads every matching event as CSV.
+// @Tags         Actions for administrators
+// @Produce      json
+// @Produce      text/csv
+// @Param        actorId    query string false "Administrator ID"
+// @Param        targetType query string false "Target type (user, skill, plan, administrator, news, review, setting, ...)"
+// @Param        targetId   query string false "Target ID"
+// @Param        action     query string false "Action, e.g. user.update"
+// @Param        from       query string false "From (RFC 3339)"
+// @Param        to         query string false "To (RFC 3339)"
+// @Param        page       query int    false "Page (default 1)"
+// @Param        limit      query int    false "Page size (default 50, max 500)"
+// @Param        format     query string false "json (default) or csv"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,500 {object} map[string]interface{}
+// @Router       /api/admin/audit [get]
+// @Security     BearerAuth
+func GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query, code, message := auditQuery(r)
+	if query == nil {
+		utils.WriteError(w, http.StatusBadRequest, code, message)
+		return
+	}
+	query = query.Order("created_at DESC").Order("id DESC")
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeAuditCSV(w, query)
+		return
+	}
+
+	page := 1
+	if raw := r.URL.Query().Get("page"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			page = v
+		}
+	}
+	limit := auditDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if limit > auditMaxLimit {
+		limit = auditMaxLimit
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve audit events")
+		return
+	}
+
+	var events []models.AuditEvent
+	if err := query.Limit(limit).Offset((page - 1) * limit).Find(&events).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve audit events")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    events,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// writeAuditCSV streams every event matched by the query as a CSV file
+func writeAuditCSV(w http.ResponseWriter, query *gorm.DB) {
+	rows, err := query.Rows()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve audit events")
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102-150405")+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "created_at", "actor_id", "actor_username", "action", "target_type", "target_id", "changes", "ip", "request_id"})
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := db.DB.ScanRows(rows, &event); err != nil {
+			log.Error().Err(err).Msg("GetAuditEvents: failed to scan audit event")
+			break
+		}
+		out.Write([]string{
+			strconv.FormatUint(event.ID, 10),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatUint(event.ActorID, 10),
+			event.ActorUsername,
+			event.Action,
+			event.TargetType,
+			event.TargetID,
+			string(event.Changes),
+			event.IP,
+			event.RequestID,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Error().Err(err).Msg("GetAuditEvents: failed to write CSV")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"user-api/internal/audit"
 	"user-api/internal/db"
 	"user-api/internal/models"
 	"user-api/internal/utils"
@@ -68,6 +69,7 @@ func CreateNews(w http.ResponseWriter, r *http.Request) {
 	db.DB.Preload("Author").First(&news, news.ID)
 
 	log.Info().Uint64("news_id", news.ID).Str("title", news.Title).Bool("show_on_home", news.ShowOnHome).Msg("News created")
+	audit.Record(r, "news.create", audit.TargetNews, news.ID, nil, news)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -207,6 +209,7 @@ func UpdateNews(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Оновлюємо поля
+	before := news
 	news.Title = updatedNews.Title
 	news.Content = updatedNews.Content
 	news.Summary = updatedNews.Summary
@@ -221,6 +224,7 @@ func UpdateNews(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Info().Uint64("news_id", news.ID).Bool("show_on_home", news.ShowOnHome).Msg("News updated")
+	audit.Record(r, "news.update", audit.TargetNews, news.ID, before, news)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -266,6 +270,7 @@ func DeleteNews(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Info().Uint64("news_id", news.ID).Msg("News deleted")
+	audit.Record(r, "news.delete", audit.TargetNews, news.ID, news, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -281,26 +286,13 @@ func DeleteNews(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        limit query int false "Limit number of results"
 // @Param        offset query int false "Offset for pagination"
-// @Param        public query bool false "Filter by public status"
 // @Success      200 {array} models.News
 // @Failure      500 {object} map[string]interface{}
 // @Router       /api/news [get]
 func GetPublicNews(w http.ResponseWriter, r *http.Request) {
 	query := db.DB.Model(&models.News{}).
 		Preload("Author").
-		Where("published = ?", true) // Тільки опубліковані новини
-
-	// Фільтрація за публічністю (якщо користувач не авторизований)
-	userContext := r.Context().Value("user")
-	if userContext == nil {
-		// Якщо користувач не авторизований - показуємо тільки публічні
-		query = query.Where("is_public = ?", true)
-	} else {
-		// Якщо авторизований, можна показувати і приватні
-		if public := r.URL.Query().Get("public"); public == "true" {
-			query = query.Where("is_public = ?", true)
-		}
-	}
+		Where("published = ? AND is_public = ?", true, true) // Маршрут без автентифікації: лише опубліковані публічні новини
 
 	// Пагінація
 	if limit := r.URL.Query().Get("limit"); limit != "" {
@@ -348,14 +340,8 @@ func GetPublicNewsItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := db.DB.Preload("Author").Where("published = ?", true)
-
-	// Перевіряємо чи користувач авторизований
-	userContext := r.Context().Value("user")
-	if userContext == nil {
-		// Якщо не авторизований - тільки публічні новини
-		query = query.Where("is_public = ?", true)
-	}
+	// Маршрут без автентифікації: лише опубліковані публічні новини
+	query := db.DB.Preload("Author").Where("published = ? AND is_public = ?", true, true)
 
 	var news models.News
 	if err := query.First(&news, id).Error; err != nil {
@@ -383,13 +369,8 @@ func GetPublicNewsItem(w http.ResponseWriter, r *http.Request) {
 // @Failure      500 {object} map[string]interface{}
 // @Router       /api/news/count [get]
 func GetNewsCount(w http.ResponseWriter, r *http.Request) {
-	query := db.DB.Model(&models.News{}).Where("published = ?", true)
-
-	// Якщо користувач не авторизований
-	userContext := r.Context().Value("user")
-	if userContext == nil {
-		query = query.Where("is_public = ?", true)
-	}
+	// Маршрут без автентифікації: рахуємо лише опубліковані публічні новини
+	query := db.DB.Model(&models.News{}).Where("published = ? AND is_public = ?", true, true)
 
 	var count int64
 	if err := query.Count(&count).Error; err != nil {
@@ -416,16 +397,10 @@ func GetHomeNews(w http.ResponseWriter, r *http.Request) {
 
 	query := db.DB.Model(&models.News{}).
 		Preload("Author").
-		Where("published = ? AND show_on_home = ?", true, true).
+		Where("published = ? AND is_public = ? AND show_on_home = ?", true, true, true).
 		Order("created_at DESC").
 		Limit(4)
 
-	// Якщо користувач не авторизований - тільки публічні новини
-	userContext := r.Context().Value("user")
-	if userContext == nil {
-		query = query.Where("is_public = ?", true)
-	}
-
 	if err := query.Find(&news).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve home news")
 		return
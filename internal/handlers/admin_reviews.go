@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"user-api/internal/audit"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// GetAllReviews godoc
+// @Summary      List reviews for moderation
+// @Description  Returns all reviews, newest first. Optional filter by psychologist.
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        psychologistId query int false "Psychologist ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,500 {object} map[string]interface{}
+// @Router       /api/admin/reviews [get]
+// @Security     BearerAuth
+func GetAllReviews(w http.ResponseWriter, r *http.Request) {
+	query := db.DB.Model(&models.Review{})
+
+	if raw := r.URL.Query().Get("psychologistId"); raw != "" {
+		psychologistID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid psychologist ID")
+			return
+		}
+		query = query.Where("psychologist_id = ?", psychologistID)
+	}
+
+	var reviews []models.Review
+	if err := query.Order("created_at DESC").Find(&reviews).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve reviews")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    reviews,
+	})
+}
+
+// DeleteReview godoc
+// @Summary      Delete a review
+// @Description  Removes a review (moderation) and recalculates the psychologist's rating
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        id path int true "Review ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,404,500 {object} map[string]interface{}
+// @Router       /api/admin/reviews/{id} [delete]
+// @Security     BearerAuth
+func DeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid review ID")
+		return
+	}
+
+	var review models.Review
+	if err := db.DB.First(&review, reviewID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Review not found")
+		return
+	}
+
+	if err := db.DB.Delete(&review).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to delete review")
+		return
+	}
+
+	updatePsychologistRating(review.PsychologistID)
+
+	log.Info().Uint64("review_id", review.ID).Msg("DeleteReview: review removed")
+	audit.Record(r, "review.delete", audit.TargetReview, review.ID, review, nil)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Review deleted",
+	})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// apiKeyPrefix starts every personal API key so leaked keys are easy to recognise
+	apiKeyPrefix = "nhk_"
+	// apiKeyDisplayChars is how much of the key is kept in plain text to tell keys apart
+	apiKeyDisplayChars = 12
+	// apiKeyTouchInterval limits last-used updates to one write per key per interval
+	apiKeyTouchInterval = time.Minute
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked and expired API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// CreateAPIKeyRequest is the body of POST /api/users/self/api-keys
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 = api_keys.default_ttl_days
+}
+
+// apiKeyResponse is an API key as listed to its owner (never with the key itself)
+type apiKeyResponse struct {
+	models.APIKey
+	Scopes []string `json:"scopes"`
+}
+
+func newAPIKeyResponse(key models.APIKey) apiKeyResponse {
+	return apiKeyResponse{APIKey: key, Scopes: key.ScopeList()}
+}
+
+// apiKeyLimits returns the [api_keys] settings: active keys per user, default and maximum lifetime in days
+func apiKeyLimits() (maxPerUser, defaultDays, maxDays int) {
+	section := cfg.Section("api_keys")
+	return section.Key("max_per_user").MustInt(10), section.Key("default_ttl_days").MustInt(90), section.Key("max_ttl_days").MustInt(365)
+}
+
+// GetMyAPIKeys godoc
+// @Summary      List my API keys
+// @Description  Returns the personal API keys of the current user that are not revoked (expired keys included), newest first
+// @Tags         Actions for users
+// @Produce      json
+// @Success      200 {array} map[string]interface{}
+// @Failure      401,500 {object} map[string]interface{}
+// @Router       /api/users/self/api-keys [get]
+// @Security     BearerAuth
+func GetMyAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var keys []models.APIKey
+	if err := db.DB.Where("user_id = ? AND revoked_at IS NULL", principal.UserID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load API keys")
+		return
+	}
+
+	result := make([]apiKeyResponse, len(keys))
+	for i, key := range keys {
+		result[i] = newAPIKeyResponse(key)
+	}
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Creates a personal API key for integrations (Authorization: ApiKey <key>). The key is returned only in this response. Scopes: sessions:read, sessions:write, availability:read, availability:write.
+// @Tags         Actions for users
+// @Accept       json
+// @Produce      json
+// @Param        body body CreateAPIKeyRequest true "Key name, scopes and lifetime"
+// @Success      201 {object} map[string]interface{}
+// @Failure      400,401,403,409,500 {object} map[string]interface{}
+// @Router       /api/users/self/api-keys [post]
+// @Security     BearerAuth
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Scopes) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "name and scopes are required")
+		return
+	}
+	if len(req.Name) > 100 {
+		utils.WriteError(w, http.StatusBadRequest, "NAME_TOO_LONG", "name must be at most 100 characters")
+		return
+	}
+	seen := make(map[string]bool, len(req.Scopes))
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !auth.IsAPIKeyScope(scope) {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_SCOPE", "Unknown scope: "+scope)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	maxPerUser, defaultDays, maxDays := apiKeyLimits()
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultDays
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxDays {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_EXPIRY", "expiresInDays must be between 1 and "+strconv.Itoa(maxDays))
+		return
+	}
+
+	var active int64
+	db.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", principal.UserID, time.Now()).Count(&active)
+	if active >= int64(maxPerUser) {
+		utils.WriteError(w, http.StatusConflict, "API_KEY_LIMIT", "Revoke an API key before creating a new one")
+		return
+	}
+
+	secret, err := generateToken(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate API key")
+		return
+	}
+	plain := apiKeyPrefix + secret
+	key := models.APIKey{
+		UserID:    principal.UserID,
+		Name:      req.Name,
+		Prefix:    plain[:apiKeyDisplayChars],
+		KeyHash:   hashToken(plain),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+	}
+	if err := db.DB.Create(&key).Error; err != nil {
+		log.Error().Err(err).Uint64("user_id", principal.UserID).Msg("CreateAPIKey: failed to store API key")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create API key")
+		return
+	}
+	log.Info().Uint64("user_id", principal.UserID).Uint64("key_id", key.ID).Str("scopes", key.Scopes).Msg("CreateAPIKey: API key created")
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"key":    plain,
+		"apiKey": newAPIKeyResponse(key),
+	})
+}
+
+// RevokeMyAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Revokes one of the current user's API keys; requests with it are rejected right away
+// @Tags         Actions for users
+// @Produce      json
+// @Param        id path int true "API key ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,500 {object} map[string]interface{}
+// @Router       /api/users/self/api-keys/{id} [delete]
+// @Security     BearerAuth
+func RevokeMyAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid API key ID")
+		return
+	}
+
+	res := db.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, principal.UserID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to revoke API key")
+		return
+	}
+	if res.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "API_KEY_NOT_FOUND", "API key not found")
+		return
+	}
+	log.Info().Uint64("user_id", principal.UserID).Uint64("key_id", id).Msg("RevokeMyAPIKey: API key revoked")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
+
+// AuthenticateAPIKey looks up an active API key and records its use (at most once per apiKeyTouchInterval).
+// Used by middleware.RequireUserOrAPIKey.
+func AuthenticateAPIKey(plain, ip string) (*models.APIKey, error) {
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	var key models.APIKey
+	if err := db.DB.Where("key_hash = ? AND revoked_at IS NULL AND expires_at > ?", hashToken(plain), now).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != ip {
+		if err := db.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error; err != nil {
+			log.Warn().Err(err).Uint64("key_id", key.ID).Msg("AuthenticateAPIKey: failed to record last use")
+		}
+	}
+	return &key, nil
+}
@@ -3,8 +3,12 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"user-api/internal/auth"
 	"user-api/internal/db"
+	"user-api/internal/keyring"
+	"user-api/internal/loginguard"
 	"user-api/internal/models"
+	"user-api/internal/tokens"
 	"user-api/internal/utils"
 
 	"strings"
@@ -23,6 +27,7 @@ type Credentials struct {
 type Claims struct {
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	DeviceID uint64 `json:"did,omitempty"` // set on admin refresh tokens only
 	jwt.RegisteredClaims
 }
 
@@ -43,69 +48,38 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	account := loginguard.AccountKey("admin", creds.Username)
+	if !allowLoginAttempt(w, r, account) {
+		return
+	}
+
 	var admin models.Administrator
 	if err := db.DB.Where("username = ?", creds.Username).First(&admin).Error; err != nil {
 		log.Warn().Str("username", creds.Username).Msg("Admin login failed: admin not found")
+		recordLoginFailure(r, account, "", "")
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(creds.Password)); err != nil {
 		log.Warn().Str("username", creds.Username).Msg("Admin login failed: invalid password")
+		recordLoginFailure(r, account, admin.Email, admin.FirstName)
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	recordLoginSuccess(account)
 
-	// Generate access token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: admin.Username,
-		Role:     admin.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	if stage := mfaStage(admin.TOTPEnabled); stage != "" {
+		respondMFAChallenge(w, "admin", admin.ID, stage)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := token.SignedString(jwtKey)
+	accessToken, err := issueAdminTokens(w, r, &admin)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate refresh token for admin
-	refreshTokenClaims := &Claims{
-		Username: admin.Username,
-		Role:     admin.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7 days
-		},
-	}
-
-	refreshTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	refreshToken, err := refreshTokenJWT.SignedString(jwtKey)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to generate admin refresh token")
-		// Continue without refresh token for now
-	} else {
-		// Save refresh token to admin record
-		admin.RefreshToken = refreshToken
-		if err := db.DB.Save(&admin).Error; err != nil {
-			log.Error().Err(err).Msg("Failed to save admin refresh token")
-		} else {
-			// Set refresh token cookie
-			http.SetCookie(w, &http.Cookie{
-				Name:     "admin_refresh_token",
-				Value:    refreshToken,
-				HttpOnly: true,
-				Path:     "/",
-				MaxAge:   7 * 24 * 3600, // 7 days
-				Secure:   false,         // set to true for HTTPS
-				SameSite: http.SameSiteLaxMode,
-			})
-		}
-	}
-
 	log.Info().Str("username", admin.Username).Msg("Admin login successful")
 
 	w.Header().Set("Content-Type", "application/json")
@@ -135,18 +109,26 @@ func UserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	account := loginguard.AccountKey("user", creds.Username)
+	if !allowLoginAttempt(w, r, account) {
+		return
+	}
+
 	var user models.User
 	if err := db.DB.Where("email = ?", creds.Username).First(&user).Error; err != nil {
 		log.Warn().Str("email", creds.Username).Msg("User login failed: user not found")
+		recordLoginFailure(r, account, "", "")
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
 		log.Warn().Str("email", creds.Username).Msg("User login failed: invalid password")
+		recordLoginFailure(r, account, user.Email, user.FirstName)
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	recordLoginSuccess(account)
 
 	if user.Status == "Blocked" {
 		log.Warn().Str("email", creds.Username).Msg("User login failed: account blocked")
@@ -154,85 +136,153 @@ func UserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate access token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: user.Email,
-		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	if stage := mfaStage(user.TOTPEnabled); stage != "" {
+		respondMFAChallenge(w, "user", user.ID, stage)
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := token.SignedString(jwtUserKey)
+
+	accessToken, err := issueUserTokens(w, r, &user)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate refresh token
-	refreshToken, err := utils.GenerateRefreshToken(&user)
+	log.Info().Str("email", creds.Username).Msg("User login successful")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken})
+}
+
+// issueAdminTokens generates the admin access token, registers the device's refresh token and sets its cookie.
+// Shared by password login and the second step of two-factor login.
+func issueAdminTokens(w http.ResponseWriter, r *http.Request, admin *models.Administrator) (string, error) {
+	accessToken, err := signAdminAccessToken(admin)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to generate refresh token")
+		return "", err
+	}
+
+	// Generate refresh token for this device
+	refreshToken, err := createRefreshToken(r, "admin", admin.ID, func(deviceID uint64) (string, error) {
+		return signAdminRefreshToken(admin, deviceID)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create admin refresh token")
 		// Continue without refresh token for now
 	} else {
-		// Save refresh token to DB
-		user.RefreshToken = refreshToken
-		if err := db.DB.Save(&user).Error; err != nil {
-			log.Error().Err(err).Msg("Failed to save refresh token")
-		} else {
-			// Set refresh token cookie
-			http.SetCookie(w, &http.Cookie{
-				Name:     "refresh_token",
-				Value:    refreshToken,
-				HttpOnly: true,
-				Path:     "/",
-				MaxAge:   7 * 24 * 3600, // 7 days
-				Secure:   false,         // set to true for HTTPS
-				SameSite: http.SameSiteLaxMode,
-			})
-		}
+		setRefreshCookie(w, adminRefreshCookieName, refreshToken)
 	}
 
-	log.Info().Str("email", creds.Username).Msg("User login successful")
+	return accessToken, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken})
+// signAdminAccessToken signs a 24h admin access token
+func signAdminAccessToken(admin *models.Administrator) (string, error) {
+	claims := &Claims{
+		Username: admin.Username,
+		Role:     admin.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		},
+	}
+	return keyring.Admin.Sign(claims)
+}
+
+// signAdminRefreshToken signs an admin refresh token bound to a device. It uses its own derived key,
+// so a refresh token is never accepted as an admin access token.
+func signAdminRefreshToken(admin *models.Administrator, deviceID uint64) (string, error) {
+	jti, err := utils.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims := &Claims{
+		Username: admin.Username,
+		Role:     admin.Role,
+		DeviceID: deviceID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshTokenTTL())),
+		},
+	}
+	return adminRefreshKeys.Sign(claims)
+}
+
+// issueUserTokens generates the user access token, registers the device's refresh token and sets its cookie.
+// Shared by password login, Google login and the second step of two-factor login.
+func issueUserTokens(w http.ResponseWriter, r *http.Request, user *models.User) (string, error) {
+	// Generate access token
+	accessToken, err := tokens.Default.IssueAccess(user)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate refresh token for this device
+	refreshToken, err := createRefreshToken(r, "user", user.ID, func(deviceID uint64) (string, error) {
+		return tokens.Default.IssueRefresh(user, deviceID)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create refresh token")
+		// Continue without refresh token for now
+	} else {
+		setRefreshCookie(w, userRefreshCookieName, refreshToken)
+	}
+
+	return accessToken, nil
 }
 
 // RefreshToken godoc
 // @Summary      Refresh access token
-// @Description  Refreshes access token using refresh token
+// @Description  Refreshes access token using refresh token. The refresh token is rotated; reusing an old one signs the device out.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]interface{}
-// @Failure      401 {object} map[string]interface{}
+// @Failure      401,403 {object} map[string]interface{}
 // @Router       /api/auth/refresh [post]
 func RefreshToken(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh_token")
+	cookie, err := r.Cookie(userRefreshCookieName)
 	if err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, "NO_REFRESH_TOKEN", "No refresh token")
 		return
 	}
 	refreshToken := cookie.Value
 
-	// Validate refresh token (JWT or random string)
-	claims, err := utils.ParseRefreshToken(refreshToken)
+	// Validate refresh token signature and expiry
+	claims, err := tokens.Default.ParseRefresh(refreshToken)
 	if err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid refresh token")
 		return
 	}
 
-	// Check if user exists and refresh token matches the one in DB
+	// Check the token against the device store and rotate it. The account is loaded only once the
+	// device is accepted, and a blocked or inactive account gets no new tokens.
 	var user models.User
-	if err := db.DB.Where("email = ?", claims.Username).First(&user).Error; err != nil || user.RefreshToken != refreshToken {
-		utils.WriteError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid refresh token")
+	newRefreshToken, err := rotateRefreshToken(r, "user", claims.UserID(), claims.DeviceID, refreshToken, func(deviceID uint64) (string, error) {
+		if err := db.DB.First(&user, claims.UserID()).Error; err != nil {
+			return "", errRefreshTokenInvalid
+		}
+		if err := accountStatusError(user.Status); err != nil {
+			return "", err
+		}
+		return tokens.Default.IssueRefresh(&user, deviceID)
+	})
+	if err != nil {
+		clearRefreshCookie(w, userRefreshCookieName)
+		switch err {
+		case errRefreshTokenReused:
+			utils.WriteError(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token was already used, please log in again")
+		case errAccountBlocked:
+			utils.WriteError(w, http.StatusForbidden, "ACCOUNT_BLOCKED", "Your account has been blocked")
+		case errAccountInactive:
+			utils.WriteError(w, http.StatusForbidden, "ACCOUNT_DISABLED", "Your account is disabled")
+		default:
+			utils.WriteError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid refresh token")
+		}
 		return
 	}
+	setRefreshCookie(w, userRefreshCookieName, newRefreshToken)
 
 	// Generate new access token
-	accessToken, err := utils.GenerateAccessToken(&user)
+	accessToken, err := tokens.Default.IssueAccess(&user)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate access token")
 		return
@@ -246,16 +296,16 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 // AdminRefreshToken godoc
 // @Summary      Refresh admin access token
-// @Description  Refreshes admin access token using refresh token from cookies
+// @Description  Refreshes admin access token using refresh token from cookies. The refresh token is rotated; reusing an old one signs the device out.
 // @Tags         Admin Auth
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]interface{}
-// @Failure      401 {object} map[string]interface{}
+// @Failure      401,403 {object} map[string]interface{}
 // @Router       /api/admin/refresh [post]
 func AdminRefreshToken(w http.ResponseWriter, r *http.Request) {
 	// Получаем refresh token из cookies
-	refreshCookie, err := r.Cookie("admin_refresh_token")
+	refreshCookie, err := r.Cookie(adminRefreshCookieName)
 	if err != nil {
 		log.Warn().Msg("AdminRefreshToken: No refresh token cookie")
 		http.Error(w, "No refresh token", http.StatusUnauthorized)
@@ -264,9 +314,7 @@ func AdminRefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	refreshToken := refreshCookie.Value
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(refreshToken, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(refreshToken, claims, adminRefreshKeys.Keyfunc)
 
 	if err != nil || !token.Valid {
 		log.Warn().Err(err).Msg("AdminRefreshToken: Invalid refresh token")
@@ -274,33 +322,45 @@ func AdminRefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Проверяем что это админ
-	if claims.Role != "admin" {
+	// Проверяем что это админ (moderator, admin или master)
+	if !auth.IsAdminRole(claims.Role) {
 		log.Warn().Str("role", claims.Role).Msg("AdminRefreshToken: Not an admin")
 		http.Error(w, "Not an admin", http.StatusForbidden)
 		return
 	}
 
-	// Проверяем что админ существует и refresh token совпадает
+	// Проверяем что админ существует
 	var admin models.Administrator
-	if err := db.DB.Where("username = ? AND refresh_token = ?", claims.Username, refreshToken).First(&admin).Error; err != nil {
-		log.Warn().Str("username", claims.Username).Msg("AdminRefreshToken: Admin not found or token mismatch")
+	if err := db.DB.Where("username = ?", claims.Username).First(&admin).Error; err != nil {
+		log.Warn().Str("username", claims.Username).Msg("AdminRefreshToken: Admin not found")
 		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 		return
 	}
 
-	// Генерируем новый access token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	newClaims := &Claims{
-		Username: admin.Username,
-		Role:     admin.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	// Проверяем токен устройства и ротируем его; статус админа перечитываем перед выдачей нового токена
+	newRefreshToken, err := rotateRefreshToken(r, "admin", admin.ID, claims.DeviceID, refreshToken, func(deviceID uint64) (string, error) {
+		if err := db.DB.First(&admin, admin.ID).Error; err != nil {
+			return "", errRefreshTokenInvalid
+		}
+		if err := accountStatusError(admin.Status); err != nil {
+			return "", err
+		}
+		return signAdminRefreshToken(&admin, deviceID)
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("username", admin.Username).Msg("AdminRefreshToken: Refresh token rejected")
+		clearRefreshCookie(w, adminRefreshCookieName)
+		if err == errAccountBlocked || err == errAccountInactive {
+			http.Error(w, "Account is not active", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
 	}
+	setRefreshCookie(w, adminRefreshCookieName, newRefreshToken)
 
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	accessToken, err := newToken.SignedString(jwtKey)
+	// Генерируем новый access token
+	accessToken, err := signAdminAccessToken(&admin)
 	if err != nil {
 		log.Error().Err(err).Msg("AdminRefreshToken: Failed to generate new access token")
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
@@ -338,19 +398,17 @@ func VerifyAdminToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		// Используем тот же ключ что и в AdminLogin
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keyring.Admin.Keyfunc)
 
-	if err != nil || !token.Valid {
+	// Refresh tokens carry a device ID and are never valid as access tokens
+	if err != nil || !token.Valid || claims.DeviceID != 0 {
 		log.Warn().Err(err).Msg("VerifyAdminToken: Invalid token")
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
 	// Проверяем роль админа
-	if claims.Role != "admin" {
+	if !auth.IsAdminRole(claims.Role) {
 		log.Warn().Str("role", claims.Role).Msg("VerifyAdminToken: Not an admin")
 		http.Error(w, "Not an admin", http.StatusForbidden)
 		return
@@ -370,8 +428,9 @@ func VerifyAdminToken(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"valid": true,
 		"user": map[string]interface{}{
-			"username": claims.Username,
-			"role":     claims.Role,
+			"username":    admin.Username,
+			"role":        admin.Role,
+			"permissions": auth.PermissionsFor(admin.Role),
 		},
 	})
 }
@@ -9,6 +9,7 @@ import (
 	"user-api/internal/db"
 	"user-api/internal/hub"
 	"user-api/internal/models"
+	"user-api/internal/tokens"
 	"user-api/internal/utils"
 
 	"github.com/go-chi/chi/v5"
@@ -24,17 +25,12 @@ var wsUpgrader = websocket.Upgrader{
 // StartConversation — POST /api/conversations
 // Only clients can initiate a conversation. Returns existing conversation if already exists.
 func StartConversation(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value("username").(string)
-	role := r.Context().Value("role").(string)
-
-	if role != "client" {
-		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only clients can start conversations")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
-
-	var currentUser models.User
-	if err := db.DB.Where("email = ?", email).First(&currentUser).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+	if !principal.IsClient() {
+		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only clients can start conversations")
 		return
 	}
 
@@ -54,10 +50,10 @@ func StartConversation(w http.ResponseWriter, r *http.Request) {
 
 	// Find existing or create new conversation
 	var conversation models.Conversation
-	result := db.DB.Where("client_id = ? AND psychologist_id = ?", currentUser.ID, req.PsychologistID).First(&conversation)
+	result := db.DB.Where("client_id = ? AND psychologist_id = ?", principal.UserID, req.PsychologistID).First(&conversation)
 	if result.Error != nil {
 		conversation = models.Conversation{
-			ClientID:       currentUser.ID,
+			ClientID:       principal.UserID,
 			PsychologistID: req.PsychologistID,
 		}
 		if err := db.DB.Create(&conversation).Error; err != nil {
@@ -78,12 +74,8 @@ type conversationItem struct {
 // GetMyConversations — GET /api/conversations
 // Returns all conversations for the authenticated user, sorted by last message, with unread counts.
 func GetMyConversations(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value("username").(string)
-	role := r.Context().Value("role").(string)
-
-	var currentUser models.User
-	if err := db.DB.Where("email = ?", email).First(&currentUser).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
@@ -94,10 +86,10 @@ func GetMyConversations(w http.ResponseWriter, r *http.Request) {
 		Preload("Psychologist.Portfolio").
 		Preload("Psychologist.Portfolio.Photos")
 
-	if role == "client" {
-		query = query.Where("client_id = ?", currentUser.ID)
+	if principal.IsClient() {
+		query = query.Where("client_id = ?", principal.UserID)
 	} else {
-		query = query.Where("psychologist_id = ?", currentUser.ID)
+		query = query.Where("psychologist_id = ?", principal.UserID)
 	}
 
 	if err := query.Order("COALESCE(last_message_at, created_at) DESC").Find(&conversations).Error; err != nil {
@@ -110,19 +102,15 @@ func GetMyConversations(w http.ResponseWriter, r *http.Request) {
 		// Count unread messages sent by the other party
 		var unreadCount int64
 		db.DB.Model(&models.Message{}).
-			Where("conversation_id = ? AND sender_id != ? AND is_read = false", conv.ID, currentUser.ID).
+			Where("conversation_id = ? AND sender_id != ? AND is_read = false", conv.ID, principal.UserID).
 			Count(&unreadCount)
 
 		// Strip sensitive fields
 		if conv.Client != nil {
 			conv.Client.Password = ""
-			conv.Client.RefreshToken = ""
-			conv.Client.VerificationToken = ""
 		}
 		if conv.Psychologist != nil {
 			conv.Psychologist.Password = ""
-			conv.Psychologist.RefreshToken = ""
-			conv.Psychologist.VerificationToken = ""
 		}
 
 		result[i] = conversationItem{Conversation: conv, UnreadCount: unreadCount}
@@ -134,26 +122,23 @@ func GetMyConversations(w http.ResponseWriter, r *http.Request) {
 // GetUnreadCount — GET /api/conversations/unread
 // Returns total count of unread messages across all conversations for the current user.
 func GetUnreadCount(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value("username").(string)
-
-	var currentUser models.User
-	if err := db.DB.Where("email = ?", email).First(&currentUser).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
 	var unreadCount int64
-	if currentUser.Role == "client" {
+	if principal.IsClient() {
 		db.DB.Model(&models.Message{}).
 			Joins("JOIN conversations ON conversations.id = messages.conversation_id").
 			Where("conversations.client_id = ? AND messages.sender_id != ? AND messages.is_read = false",
-				currentUser.ID, currentUser.ID).
+				principal.UserID, principal.UserID).
 			Count(&unreadCount)
 	} else {
 		db.DB.Model(&models.Message{}).
 			Joins("JOIN conversations ON conversations.id = messages.conversation_id").
 			Where("conversations.psychologist_id = ? AND messages.sender_id != ? AND messages.is_read = false",
-				currentUser.ID, currentUser.ID).
+				principal.UserID, principal.UserID).
 			Count(&unreadCount)
 	}
 
@@ -163,7 +148,10 @@ func GetUnreadCount(w http.ResponseWriter, r *http.Request) {
 // GetConversationMessages — GET /api/conversations/{id}/messages
 // Returns paginated messages for a conversation the user participates in.
 func GetConversationMessages(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value("username").(string)
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	convID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
@@ -171,18 +159,12 @@ func GetConversationMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var currentUser models.User
-	if err := db.DB.Where("email = ?", email).First(&currentUser).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
-		return
-	}
-
 	var conv models.Conversation
 	if err := db.DB.First(&conv, convID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
 		return
 	}
-	if conv.ClientID != currentUser.ID && conv.PsychologistID != currentUser.ID {
+	if conv.ClientID != principal.UserID && conv.PsychologistID != principal.UserID {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Access denied")
 		return
 	}
@@ -215,14 +197,12 @@ func GetConversationMessages(w http.ResponseWriter, r *http.Request) {
 	for i := range messages {
 		if messages[i].Sender != nil {
 			messages[i].Sender.Password = ""
-			messages[i].Sender.RefreshToken = ""
-			messages[i].Sender.VerificationToken = ""
 		}
 	}
 
 	// Mark incoming messages as read
 	db.DB.Model(&models.Message{}).
-		Where("conversation_id = ? AND sender_id != ? AND is_read = false", convID, currentUser.ID).
+		Where("conversation_id = ? AND sender_id != ? AND is_read = false", convID, principal.UserID).
 		Update("is_read", true)
 
 	utils.WriteJSON(w, http.StatusOK, messages)
@@ -237,11 +217,16 @@ func WSChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := utils.ParseAccessToken(tokenStr)
+	claims, err := tokens.Default.ParseAccess(tokenStr)
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	// The socket sends messages as the user, which an impersonating administrator must not do
+	if claims.Actor != nil {
+		http.Error(w, "Not allowed while impersonating a user", http.StatusForbidden)
+		return
+	}
 
 	convID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
@@ -250,10 +235,14 @@ func WSChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var currentUser models.User
-	if err := db.DB.Where("email = ?", claims.Username).First(&currentUser).Error; err != nil {
+	if err := db.DB.First(&currentUser, claims.UserID()).Error; err != nil {
 		http.Error(w, "User not found", http.StatusUnauthorized)
 		return
 	}
+	if currentUser.Status != "Active" {
+		http.Error(w, "Account is not active", http.StatusForbidden)
+		return
+	}
 
 	var conv models.Conversation
 	if err := db.DB.First(&conv, convID).Error; err != nil {
@@ -298,6 +287,15 @@ func WSChat(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		// Messages over the limit are dropped and only the sender is told
+		if result, err := RateLimiter.Allow(RateLimitChatMessage, "user:"+strconv.FormatUint(currentUser.ID, 10)); err == nil && !result.Allowed {
+			select {
+			case client.Send <- hub.WSMessage{ConversationID: convID, Error: "RATE_LIMITED"}:
+			default:
+			}
+			continue
+		}
+
 		senderID := currentUser.ID
 		msg := models.Message{
 			ConversationID: convID,
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	userRefreshCookieName   = "refresh_token"
+	adminRefreshCookieName  = "admin_refresh_token"
+	adminRefreshPurpose     = "admin_refresh"
+	maxDeviceUserAgentChars = 255
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+	errAccountBlocked      = errors.New("account is blocked")
+	errAccountInactive     = errors.New("account is not active")
+)
+
+// accountStatusError returns nil for an active account and the reason a refresh is refused otherwise
+func accountStatusError(status string) error {
+	switch status {
+	case "Active":
+		return nil
+	case "Blocked":
+		return errAccountBlocked
+	default:
+		return errAccountInactive
+	}
+}
+
+// refreshTokenTTL is the lifetime of refresh tokens and their devices (config: tokens.refresh_ttl)
+func refreshTokenTTL() time.Duration {
+	return tokens.Default.RefreshTTL
+}
+
+// refreshTokenSigner signs a refresh token bound to the given device row
+type refreshTokenSigner func(deviceID uint64) (string, error)
+
+// createRefreshToken registers a new device for the account and returns its first refresh token
+func createRefreshToken(r *http.Request, accountType string, accountID uint64, sign refreshTokenSigner) (string, error) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxDeviceUserAgentChars {
+		userAgent = userAgent[:maxDeviceUserAgentChars]
+	}
+
+	now := time.Now()
+	device := models.RefreshToken{
+		AccountType: accountType,
+		AccountID:   accountID,
+		UserAgent:   userAgent,
+		IP:          utils.ClientIP(r),
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(refreshTokenTTL()),
+	}
+
+	var token string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// The row ID is part of the signed token, so the hash is written after the insert
+		if err := tx.Create(&device).Error; err != nil {
+			return err
+		}
+		var err error
+		if token, err = sign(device.ID); err != nil {
+			return err
+		}
+		return tx.Model(&device).Update("token_hash", hashToken(token)).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateRefreshToken replaces the current token of a device with a new one.
+// A valid but no longer current token means it was stolen or replayed, so the device is revoked.
+func rotateRefreshToken(r *http.Request, accountType string, accountID, deviceID uint64, presented string, sign refreshTokenSigner) (string, error) {
+	var device models.RefreshToken
+	if err := db.DB.Where("id = ? AND account_type = ? AND account_id = ? AND revoked_at IS NULL AND expires_at > ?",
+		deviceID, accountType, accountID, time.Now()).First(&device).Error; err != nil {
+		return "", errRefreshTokenInvalid
+	}
+
+	if device.TokenHash != hashToken(presented) {
+		revokeDevice(device.ID, accountType, accountID)
+		return "", errRefreshTokenReused
+	}
+
+	token, err := sign(device.ID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	// Compare-and-swap on the old hash so the same token cannot be rotated twice
+	result := db.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND token_hash = ? AND revoked_at IS NULL", device.ID, device.TokenHash).
+		Updates(map[string]interface{}{
+			"token_hash":   hashToken(token),
+			"last_used_at": now,
+			"ip":           utils.ClientIP(r),
+			"expires_at":   now.Add(refreshTokenTTL()),
+		})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		revokeDevice(device.ID, accountType, accountID)
+		return "", errRefreshTokenReused
+	}
+	return token, nil
+}
+
+// revokeDevice revokes one device (token family) of an account
+func revokeDevice(deviceID uint64, accountType string, accountID uint64) {
+	log.Warn().Str("account_type", accountType).Uint64("account_id", accountID).Uint64("device_id", deviceID).
+		Msg("Refresh token reuse detected, revoking device")
+	db.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", deviceID).
+		Update("revoked_at", time.Now())
+}
+
+// revokeAllRefreshTokens signs the account out of every device
+func revokeAllRefreshTokens(tx *gorm.DB, accountType string, accountID uint64) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("account_type = ? AND account_id = ? AND revoked_at IS NULL", accountType, accountID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// setRefreshCookie stores a refresh token in an HttpOnly cookie
+func setRefreshCookie(w http.ResponseWriter, name, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    token,
+		HttpOnly: true,
+		Path:     "/",
+		MaxAge:   int(refreshTokenTTL().Seconds()),
+		Secure:   false, // set to true for HTTPS
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearRefreshCookie removes a refresh token cookie from the browser
+func clearRefreshCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		HttpOnly: true,
+		Path:     "/",
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Logout godoc
+// @Summary      Log out the current device
+// @Description  Revokes the refresh token of this device (user or admin cookie) and clears the cookie
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /api/auth/logout [post]
+func Logout(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{userRefreshCookieName, adminRefreshCookieName} {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			continue
+		}
+		// Possession of the current token is enough to revoke its device
+		if err := db.DB.Model(&models.RefreshToken{}).
+			Where("token_hash = ? AND revoked_at IS NULL", hashToken(cookie.Value)).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			log.Error().Err(err).Msg("Logout: failed to revoke refresh token")
+		}
+		clearRefreshCookie(w, name)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// deviceDTO is a signed-in device in GET /api/users/self/devices
+type deviceDTO struct {
+	models.RefreshToken
+	Current bool `json:"current"`
+}
+
+// GetMyDevices godoc
+// @Summary      List signed-in devices
+// @Description  Returns every device with an active refresh token; the device making the request is marked as current
+// @Tags         Users
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      401,500 {object} map[string]interface{}
+// @Router       /api/users/self/devices [get]
+// @Security     BearerAuth
+func GetMyDevices(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var devices []models.RefreshToken
+	if err := db.DB.Where("account_type = ? AND account_id = ? AND revoked_at IS NULL AND expires_at > ?", "user", principal.UserID, time.Now()).
+		Order("last_used_at DESC").Find(&devices).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load devices")
+		return
+	}
+
+	currentHash := ""
+	if cookie, err := r.Cookie(userRefreshCookieName); err == nil {
+		currentHash = hashToken(cookie.Value)
+	}
+
+	result := make([]deviceDTO, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, deviceDTO{RefreshToken: d, Current: d.TokenHash == currentHash})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// RevokeMyDevice godoc
+// @Summary      Sign out a device
+// @Description  Revokes the refresh token of one of the user's devices
+// @Tags         Users
+// @Produce      json
+// @Param        id path int true "Device ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,404,500 {object} map[string]interface{}
+// @Router       /api/users/self/devices/{id} [delete]
+// @Security     BearerAuth
+func RevokeMyDevice(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deviceID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid device ID")
+		return
+	}
+
+	result := db.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND account_type = ? AND account_id = ? AND revoked_at IS NULL", deviceID, "user", principal.UserID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to revoke device")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Device not found")
+		return
+	}
+
+	log.Info().Uint64("user_id", principal.UserID).Uint64("device_id", deviceID).Msg("RevokeMyDevice: device signed out")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Device signed out",
+	})
+}
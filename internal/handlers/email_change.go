@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// emailChangeTTL is how long the confirmation link sent to the new address stays valid
+	emailChangeTTL = 24 * time.Hour
+	// emailChangeUndoWindow is how long after the switch the old address can revert it
+	emailChangeUndoWindow = 48 * time.Hour
+)
+
+// EmailChangeRequest is the body of POST /api/users/self/email
+type EmailChangeRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+// EmailChangeTokenRequest is the body of the confirm and undo endpoints
+type EmailChangeTokenRequest struct {
+	Token string `json:"token"`
+}
+
+var (
+	errInvalidEmailChange = errors.New("invalid or expired email change token")
+	errEmailTaken         = errors.New("email is used by another account")
+	errUndoExpired        = errors.New("email change can no longer be undone")
+)
+
+// RequestEmailChange godoc
+// @Summary      Change own email
+// @Description  Confirms the password, emails a confirmation link to the new address and a notice with an undo link to the current one. The address changes only after confirmation.
+// @Tags         Actions for users
+// @Accept       json
+// @Produce      json
+// @Param        body body EmailChangeRequest true "New email and current password"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,409,500 {object} map[string]interface{}
+// @Router       /api/users/self/email [post]
+// @Security     BearerAuth
+func RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req EmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	req.NewEmail = strings.TrimSpace(req.NewEmail)
+	if req.NewEmail == "" || req.Password == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "newEmail and password are required")
+		return
+	}
+	if addr, err := mail.ParseAddress(req.NewEmail); err != nil || addr.Address != req.NewEmail {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_EMAIL", "Invalid email address")
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not found")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "WRONG_PASSWORD", "Current password is incorrect")
+		return
+	}
+	if strings.EqualFold(req.NewEmail, user.Email) {
+		utils.WriteError(w, http.StatusBadRequest, "SAME_EMAIL", "This is already your email")
+		return
+	}
+	if emailTaken(db.DB, req.NewEmail, user.ID) {
+		utils.WriteError(w, http.StatusConflict, "EMAIL_TAKEN", "This email is used by another account")
+		return
+	}
+
+	confirmToken, err1 := generateToken(32)
+	undoToken, err2 := generateToken(32)
+	if err := errors.Join(err1, err2); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+
+	change := models.EmailChange{
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         req.NewEmail,
+		ConfirmTokenHash: hashToken(confirmToken),
+		UndoTokenHash:    hashToken(undoToken),
+		ExpiresAt:        time.Now().Add(emailChangeTTL),
+		RequestIP:        utils.ClientIP(r),
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the latest request can be confirmed
+		if err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND canceled_at IS NULL", user.ID).
+			Update("canceled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		log.Error().Err(err).Uint64("user_id", user.ID).Msg("RequestEmailChange: failed to save request")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to change email")
+		return
+	}
+
+	sendEmailChangeEmails(&user, req.NewEmail, confirmToken, undoToken)
+	log.Info().Uint64("user_id", user.ID).Msg("RequestEmailChange: confirmation sent to the new address")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "A confirmation link has been sent to the new address",
+	})
+}
+
+// sendEmailChangeEmails emails the confirmation link to the new address and the notice with the
+// undo link to the current one
+func sendEmailChangeEmails(user *models.User, newEmail, confirmToken, undoToken string) {
+	frontendURL := cfg.Section("app").Key("frontend_url").String()
+	confirmURL := fmt.Sprintf("%s/confirm-email-change?token=%s", frontendURL, confirmToken)
+	undoURL := fmt.Sprintf("%s/undo-email-change?token=%s", frontendURL, undoToken)
+	oldEmail, name, userID := user.Email, user.FirstName, user.ID
+
+	go func() {
+		if err := utils.SendEmail(newEmail, "Confirm your new email", cfg.Section("email").Key("email_change_template_path").MustString("./templates/email-change-confirm.html"), []string{
+			"username=" + name,
+			"confirm_link=" + confirmURL,
+			"expires_hours=" + strconv.Itoa(int(emailChangeTTL.Hours())),
+		}); err != nil {
+			log.Error().Err(err).Uint64("user_id", userID).Msg("sendEmailChangeEmails: failed to send confirmation email")
+		}
+		if err := utils.SendEmail(oldEmail, "Your email is being changed", cfg.Section("email").Key("email_change_notice_template_path").MustString("./templates/email-change-notice.html"), []string{
+			"username=" + name,
+			"new_email=" + newEmail,
+			"undo_link=" + undoURL,
+			"undo_hours=" + strconv.Itoa(int(emailChangeUndoWindow.Hours())),
+		}); err != nil {
+			log.Error().Err(err).Uint64("user_id", userID).Msg("sendEmailChangeEmails: failed to send notice to the old address")
+		}
+	}()
+}
+
+// emailTaken reports whether another user already has the address
+func emailTaken(tx *gorm.DB, email string, userID uint64) bool {
+	var count int64
+	tx.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count)
+	return count > 0
+}
+
+// ConfirmEmailChange godoc
+// @Summary      Confirm an email change
+// @Description  Switches the account to the new address with the token from the confirmation email and signs the account out of every device
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body EmailChangeTokenRequest true "Token from the confirmation email"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,409,500 {object} map[string]interface{}
+// @Router       /api/auth/email-change/confirm [post]
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req EmailChangeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_TOKEN", "Token is required")
+		return
+	}
+
+	var change models.EmailChange
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("confirm_token_hash = ? AND confirmed_at IS NULL AND canceled_at IS NULL AND expires_at > ?", hashToken(req.Token), time.Now()).
+			First(&change).Error; err != nil {
+			return errInvalidEmailChange
+		}
+		if emailTaken(tx, change.NewEmail, change.UserID) {
+			return errEmailTaken
+		}
+		// The request was made for the current address; a change made since then invalidates it
+		result := tx.Model(&models.User{}).Where("id = ? AND email = ?", change.UserID, change.OldEmail).Update("email", change.NewEmail)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidEmailChange
+		}
+		if err := tx.Model(&change).Update("confirmed_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeAllRefreshTokens(tx, "user", change.UserID)
+	})
+	switch {
+	case err == errInvalidEmailChange:
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TOKEN", "Invalid or expired token")
+		return
+	case err == errEmailTaken:
+		utils.WriteError(w, http.StatusConflict, "EMAIL_TAKEN", "This email is used by another account")
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("ConfirmEmailChange: failed to change email")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to change email")
+		return
+	}
+	auth.Principals.Invalidate(change.UserID)
+
+	log.Info().Uint64("user_id", change.UserID).Msg("ConfirmEmailChange: email changed, devices signed out")
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Email changed successfully, please sign in again",
+	})
+}
+
+// UndoEmailChange godoc
+// @Summary      Undo an email change
+// @Description  With the token from the notice sent to the old address: cancels a pending change, or within 48 hours of the switch restores the old address and signs the account out of every device
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body EmailChangeTokenRequest true "Token from the notice email"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,409,410,500 {object} map[string]interface{}
+// @Router       /api/auth/email-change/undo [post]
+func UndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req EmailChangeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_TOKEN", "Token is required")
+		return
+	}
+
+	var (
+		change   models.EmailChange
+		reverted bool
+	)
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("undo_token_hash = ? AND canceled_at IS NULL AND reverted_at IS NULL", hashToken(req.Token)).
+			First(&change).Error; err != nil {
+			return errInvalidEmailChange
+		}
+		now := time.Now()
+		if change.ConfirmedAt == nil {
+			return tx.Model(&change).Update("canceled_at", now).Error
+		}
+		if now.Sub(*change.ConfirmedAt) > emailChangeUndoWindow {
+			return errUndoExpired
+		}
+		if emailTaken(tx, change.OldEmail, change.UserID) {
+			return errEmailTaken
+		}
+		// Restore the old address even if the email was changed again since, so that chaining
+		// changes cannot be used to escape the undo
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).Update("email", change.OldEmail).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND canceled_at IS NULL", change.UserID).
+			Update("canceled_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&change).Update("reverted_at", now).Error; err != nil {
+			return err
+		}
+		reverted = true
+		return revokeAllRefreshTokens(tx, "user", change.UserID)
+	})
+	switch {
+	case err == errInvalidEmailChange:
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TOKEN", "Invalid or already used token")
+		return
+	case err == errUndoExpired:
+		utils.WriteError(w, http.StatusGone, "UNDO_EXPIRED", "The email change can no longer be undone, please contact support")
+		return
+	case err == errEmailTaken:
+		utils.WriteError(w, http.StatusConflict, "EMAIL_TAKEN", "The old email is now used by another account, please contact support")
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("UndoEmailChange: failed to undo email change")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to undo email change")
+		return
+	}
+
+	if !reverted {
+		log.Info().Uint64("user_id", change.UserID).Msg("UndoEmailChange: pending email change canceled")
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "The email change has been canceled",
+		})
+		return
+	}
+	auth.Principals.Invalidate(change.UserID)
+
+	log.Warn().Uint64("user_id", change.UserID).Msg("UndoEmailChange: email change reverted, devices signed out")
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Your previous email has been restored and every device signed out. If you did not make this change, reset your password now.",
+	})
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"time"
 
 	"user-api/internal/db"
+	"user-api/internal/keyring"
 	"user-api/internal/models"
+	"user-api/internal/oidc"
+	"user-api/internal/passwordpolicy"
+	"user-api/internal/timezone"
 	"user-api/internal/utils"
 
 	"github.com/go-ini/ini"
@@ -18,8 +23,15 @@ import (
 
 // Global configuration variable
 var cfg *ini.File
-var jwtKey []byte
-var jwtUserKey []byte
+
+// Keys of the pending two-factor tokens, admin refresh tokens and OpenID Connect registration tokens,
+// derived from the JWT key rings so that they rotate with them and never depend on the [auth] secrets alone
+var (
+	mfaUserKeys          *keyring.Ring
+	mfaAdminKeys         *keyring.Ring
+	adminRefreshKeys     *keyring.Ring
+	oidcRegistrationKeys *keyring.Ring
+)
 
 func init() {
 	var err error
@@ -27,8 +39,22 @@ func init() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load config.ini")
 	}
-	jwtKey = []byte(cfg.Section("auth").Key("jwt_admin_secret").String())
-	jwtUserKey = []byte(cfg.Section("auth").Key("jwt_user_secret").String())
+	mfaUserKeys = keyring.User.Derive(mfaPendingPurpose)
+	mfaAdminKeys = keyring.Admin.Derive(mfaPendingPurpose)
+	adminRefreshKeys = keyring.Admin.Derive(adminRefreshPurpose)
+	oidcRegistrationKeys = keyring.User.Derive(oidcRegistrationPurpose)
+	LoginGuard = newLoginGuard(cfg.Section("login_guard"))
+	RateLimiter = newRateLimiter(cfg.Section("rate_limit"))
+	Verification = newVerificationPolicy(cfg.Section("verification"))
+	PasswordPolicy = passwordpolicy.Load(cfg.Section("password_policy"))
+	Sessions = newSessionPolicy(cfg.Section("sessions"))
+	SlotGeneration = newSlotGenerationPolicy(cfg.Section("slot_generation"))
+	if timezone.Default, err = timezone.Load(cfg.Section("app").Key("default_time_zone").MustString("UTC")); err != nil {
+		log.Fatal().Err(err).Msg("Invalid default_time_zone")
+	}
+	if OIDCProviders, err = oidc.LoadProviders(cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid OpenID Connect provider configuration")
+	}
 }
 
 // generateToken creates a secure random token of n bytes, hex-encoded.
@@ -40,26 +66,29 @@ func generateToken(n int) (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// hashToken returns the hex-encoded SHA-256 hash of a token. Used for tokens that are stored
+// in the database but must never be kept in plain text (password reset links, etc.).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // processUserCreation centralizes validation, password hashing, existence check, and DB creation.
+// checkPassword applies PasswordPolicy; it is false only for generated passwords (OAuth sign-ups).
 // Returns true if user was created successfully, false if a response has already been written.
-func processUserCreation(w http.ResponseWriter, user *models.User) bool {
+func processUserCreation(w http.ResponseWriter, user *models.User, checkPassword bool) bool {
 	// Role Validation
 	if user.Role != "client" && user.Role != "psychologist" {
 		log.Warn().Str("role", user.Role).Msg("processUserCreation: invalid role")
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_ROLE", "Role must be 'client' or 'psychologist'")
 		return false
 	}
-	// Password hashing
-	// For OAuth users, generate a random password (they authenticate via Google)
-	if user.GoogleID != "" && user.Password == "" {
-		randomPass, err := generateToken(32)
-		if err != nil {
-			log.Error().Err(err).Msg("processUserCreation: failed to generate random password for OAuth user")
-			utils.WriteError(w, http.StatusInternalServerError, "HASH_ERROR", "Unable to generate password")
-			return false
-		}
-		user.Password = randomPass
+	// Password policy
+	if checkPassword && !checkPasswordPolicy(w, user.Password, user.FirstName, user.LastName, user.Email) {
+		log.Warn().Str("email", user.Email).Msg("processUserCreation: password rejected by policy")
+		return false
 	}
+	// Password hashing
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error().Err(err).Msg("processUserCreation: password hashing failed")
@@ -98,15 +127,19 @@ func processUserCreation(w http.ResponseWriter, user *models.User) bool {
 	return true
 }
 
-// generateAndSaveVerification builds a secure token, saves it on the user, and returns the verification URL.
+// generateAndSaveVerification builds a secure token, saves its hash on the user, and returns the verification URL.
+// A new token replaces the previous one, so only the latest link works.
 func generateAndSaveVerification(user *models.User) (string, error) {
 	token, err := generateToken(32)
 	if err != nil {
 		return "", err
 	}
-	user.VerificationToken = token
+	user.VerificationHash = hashToken(token)
 	user.TokenSentAt = time.Now()
-	if err := db.DB.Save(user).Error; err != nil {
+	if err := db.DB.Model(user).Updates(map[string]interface{}{
+		"verification_hash": user.VerificationHash,
+		"token_sent_at":     user.TokenSentAt,
+	}).Error; err != nil {
 		return "", err
 	}
 	verifyURL := fmt.Sprintf("%s/verify?token=%s",
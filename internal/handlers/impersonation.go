@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ImpersonateUser godoc
+// @Summary      Impersonate a user ("view as user")
+// @Description  Issues a short-lived user access token (tokens.impersonation_ttl, default 15 minutes) with an "act" claim naming the administrator. No refresh token is issued. While impersonating, owner-only actions (password, email, two-factor and device changes, chat messages) answer 403 IMPERSONATION_FORBIDDEN, and every request is recorded in the audit log as user.impersonated_request.
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,404,409,500 {object} map[string]interface{}
+// @Router       /api/admin/users/{id}/impersonate [post]
+// @Security     BearerAuth
+func ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := auth.AdminFromContext(r.Context())
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, id).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+	// Requests of inactive accounts are rejected by RequireUser anyway
+	if user.Status != "Active" {
+		utils.WriteError(w, http.StatusConflict, "USER_NOT_ACTIVE", "Only active users can be impersonated")
+		return
+	}
+
+	accessToken, expiresAt, err := tokens.Default.IssueImpersonation(&user, admin.ID, admin.Username)
+	if err != nil {
+		log.Error().Err(err).Uint64("user_id", user.ID).Msg("ImpersonateUser: failed to sign token")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+	log.Info().Str("admin", admin.Username).Uint64("user_id", user.ID).Msg("ImpersonateUser: impersonation started")
+	audit.Record(r, "user.impersonate", audit.TargetUser, user.ID, nil, map[string]interface{}{"expiresAt": expiresAt})
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"expires_at":   expiresAt,
+		"user": map[string]interface{}{
+			"id":    user.ID,
+			"email": user.Email,
+			"role":  user.Role,
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+	"user-api/internal/keyring"
+	"user-api/internal/utils"
+)
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys that verify user access tokens (RS256 / EdDSA keys only; HMAC secrets are never published). Select the key by the token's kid header.
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} keyring.JWKSet
+// @Router       /.well-known/jwks.json [get]
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, keyring.User.JWKS())
+}
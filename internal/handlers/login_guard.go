@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/audit"
+	"user-api/internal/db"
+	"user-api/internal/loginguard"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+)
+
+// LoginGuard throttles failed logins by account and by client IP (config section [login_guard])
+var LoginGuard *loginguard.Guard
+
+// newLoginGuard builds the login guard from the [login_guard] config section.
+// store = memory (default, single instance) or db (shared by every instance).
+func newLoginGuard(section *ini.Section) *loginguard.Guard {
+	resetAfter := section.Key("reset_after").MustDuration(24 * time.Hour)
+	account := loginguard.Policy{
+		FreeAttempts:     section.Key("account_free_attempts").MustInt(3),
+		BaseDelay:        section.Key("account_base_delay").MustDuration(time.Second),
+		MaxDelay:         section.Key("account_max_delay").MustDuration(5 * time.Minute),
+		LockoutThreshold: section.Key("account_lockout_threshold").MustInt(10),
+		LockoutDuration:  section.Key("account_lockout_duration").MustDuration(30 * time.Minute),
+		ResetAfter:       resetAfter,
+	}
+	ip := loginguard.Policy{
+		FreeAttempts:     section.Key("ip_free_attempts").MustInt(20),
+		BaseDelay:        section.Key("ip_base_delay").MustDuration(time.Second),
+		MaxDelay:         section.Key("ip_max_delay").MustDuration(5 * time.Minute),
+		LockoutThreshold: section.Key("ip_lockout_threshold").MustInt(200),
+		LockoutDuration:  section.Key("ip_lockout_duration").MustDuration(time.Hour),
+		ResetAfter:       resetAfter,
+	}
+
+	var store loginguard.Store
+	switch section.Key("store").MustString("memory") {
+	case "db":
+		store = loginguard.NewDBStore()
+	default:
+		store = loginguard.NewMemoryStore(resetAfter)
+	}
+	return loginguard.New(store, account, ip)
+}
+
+// allowLoginAttempt answers 429 with Retry-After when the account or the client IP is throttled.
+// An empty account checks the IP only. The guard fails open if its store is unavailable.
+func allowLoginAttempt(w http.ResponseWriter, r *http.Request, account string) bool {
+	wait, err := LoginGuard.Check(account, utils.ClientIP(r))
+	if err != nil {
+		log.Error().Err(err).Msg("Login guard check failed")
+		return true
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	log.Warn().Str("account", account).Str("ip", utils.ClientIP(r)).Dur("retry_after", wait).Msg("Login throttled")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.WriteError(w, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", "Too many failed login attempts, please try again later")
+	return false
+}
+
+// recordLoginFailure counts a failed login. When it locks the account out, the owner is emailed
+// (email is empty when the account does not exist).
+func recordLoginFailure(r *http.Request, account, email, name string) {
+	lockedNow, err := LoginGuard.Fail(account, utils.ClientIP(r))
+	if err != nil {
+		log.Error().Err(err).Msg("Login guard failed to record a failed attempt")
+		return
+	}
+	if !lockedNow {
+		return
+	}
+
+	log.Warn().Str("account", account).Msg("Account locked after repeated failed logins")
+	if email == "" {
+		return
+	}
+	status, err := LoginGuard.Status(account)
+	if err != nil || status.LockedUntil == nil {
+		return
+	}
+	lockedUntil := *status.LockedUntil
+	go func() {
+		if err := utils.SendEmail(email, "Your account has been temporarily locked", cfg.Section("email").Key("lockout_template_path").MustString("./templates/account-locked.html"), []string{
+			"username=" + name,
+			"locked_until=" + lockedUntil.UTC().Format("2006-01-02 15:04 MST"),
+			"reset_link=" + cfg.Section("app").Key("frontend_url").String() + "/forgot-password",
+		}); err != nil {
+			log.Error().Err(err).Str("account", account).Msg("Failed to send account lockout email")
+		}
+	}()
+}
+
+// recordLoginSuccess forgets the failed attempts of an account
+func recordLoginSuccess(account string) {
+	if err := LoginGuard.Succeed(account); err != nil {
+		log.Error().Err(err).Str("account", account).Msg("Login guard failed to reset an account")
+	}
+}
+
+// UnlockUser godoc
+// @Summary      Unlock a user account
+// @Description  Clears the failed login attempts and the temporary lockout of a user
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,404,500 {object} map[string]interface{}
+// @Router       /api/admin/users/{id}/unlock [post]
+// @Security     BearerAuth
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, id).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	}
+
+	account := loginguard.AccountKey("user", user.Email)
+	before, err := LoginGuard.Status(account)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to read lockout state")
+		return
+	}
+	if err := LoginGuard.Unlock(account); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to unlock user")
+		return
+	}
+
+	log.Info().Uint64("user_id", user.ID).Msg("UnlockUser: login lockout cleared")
+	audit.Record(r, "user.unlock", audit.TargetUser, user.ID, before, loginguard.Status{})
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "User unlocked",
+	})
+}
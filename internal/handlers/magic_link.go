@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// magicLinkTTL is how long a passwordless login link stays valid
+const magicLinkTTL = 15 * time.Minute
+
+// magicLinkBindingCookie holds the secret that ties a link to the browser that requested it
+const magicLinkBindingCookie = "magic_link_binding"
+
+// MagicLinkRequest is the body of POST /api/auth/magic-link
+type MagicLinkRequest struct {
+	Email         string `json:"email"`
+	BindToBrowser bool   `json:"bindToBrowser"` // the link only works in the browser that requested it
+}
+
+var (
+	errInvalidMagicLink     = errors.New("invalid or expired magic link")
+	errMagicLinkWrongDevice = errors.New("magic link was requested from another browser")
+)
+
+// RequestMagicLink godoc
+// @Summary      Request a passwordless login link
+// @Description  Emails a single-use login link valid for 15 minutes. With bindToBrowser the link only works in the browser that made this request (a cookie is set). The response is identical whether or not the account exists.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body MagicLinkRequest true "Account email"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,403 {object} map[string]interface{}
+// @Router       /api/auth/magic-link [post]
+func RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "email is required")
+		return
+	}
+	if !magicLinkEnabled("client") && !magicLinkEnabled("psychologist") {
+		utils.WriteError(w, http.StatusForbidden, "MAGIC_LINK_DISABLED", "Passwordless login is disabled")
+		return
+	}
+
+	// The binding cookie is set for unknown emails too, so the response does not reveal the account
+	var binding string
+	if req.BindToBrowser {
+		var err error
+		if binding, err = generateToken(32); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     magicLinkBindingCookie,
+			Value:    binding,
+			HttpOnly: true,
+			Path:     "/api/auth/magic-link",
+			MaxAge:   int(magicLinkTTL.Seconds()),
+			Secure:   false, // set to true for HTTPS
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	var user models.User
+	if err := db.DB.Where("email = ? AND status = ?", req.Email, "Active").First(&user).Error; err == nil && magicLinkEnabled(user.Role) {
+		if err := issueMagicLink(&user, binding, utils.ClientIP(r)); err != nil {
+			log.Error().Err(err).Uint64("user_id", user.ID).Msg("RequestMagicLink: failed to issue magic link")
+		}
+	} else {
+		log.Info().Msg("RequestMagicLink: no matching account or role not allowed, responding generically")
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "If an account with this email exists, a sign-in link has been sent",
+	})
+}
+
+// issueMagicLink stores the hashed link token and emails the plain token to the user
+func issueMagicLink(user *models.User, binding, ip string) error {
+	token, err := generateToken(32)
+	if err != nil {
+		return err
+	}
+
+	link := models.MagicLinkToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+		RequestIP: ip,
+	}
+	if binding != "" {
+		link.BindingHash = hashToken(binding)
+	}
+	if err := db.DB.Create(&link).Error; err != nil {
+		return err
+	}
+
+	loginURL := fmt.Sprintf("%s/magic-login?token=%s", cfg.Section("app").Key("frontend_url").String(), token)
+	go func() {
+		if err := utils.SendEmail(user.Email, "Your sign-in link", cfg.Section("email").Key("magic_link_template_path").MustString("./templates/magic-link.html"), []string{
+			"username=" + user.FirstName,
+			"login_link=" + loginURL,
+			"expires_minutes=" + strconv.Itoa(int(magicLinkTTL.Minutes())),
+		}); err != nil {
+			log.Error().Err(err).Uint64("user_id", user.ID).Msg("issueMagicLink: failed to send magic link email")
+		}
+	}()
+	return nil
+}
+
+// ConsumeMagicLink godoc
+// @Summary      Log in with a magic link
+// @Description  Exchanges a token from a magic link email for the same access and refresh tokens as password login (or an MFA challenge when two-factor authentication applies). Each link works once.
+// @Tags         Auth
+// @Produce      json
+// @Param        token query string true "Token from the email link"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,403 {object} map[string]interface{}
+// @Router       /api/auth/magic-link/consume [get]
+func ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_TOKEN", "Token is required")
+		return
+	}
+
+	var link models.MagicLinkToken
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+			First(&link).Error; err != nil {
+			return errInvalidMagicLink
+		}
+		// A link opened in another browser is not consumed, so it still works in the right one
+		if link.BindingHash != "" {
+			cookie, err := r.Cookie(magicLinkBindingCookie)
+			if err != nil || hashToken(cookie.Value) != link.BindingHash {
+				return errMagicLinkWrongDevice
+			}
+		}
+		return tx.Model(&link).Update("used_at", time.Now()).Error
+	})
+	switch {
+	case err == errInvalidMagicLink:
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TOKEN", "Invalid or expired link")
+		return
+	case err == errMagicLinkWrongDevice:
+		utils.WriteError(w, http.StatusForbidden, "WRONG_BROWSER", "Open the link in the browser where you requested it")
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("ConsumeMagicLink: failed to consume link")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to log in")
+		return
+	}
+	if link.BindingHash != "" {
+		http.SetCookie(w, &http.Cookie{Name: magicLinkBindingCookie, Value: "", HttpOnly: true, Path: "/api/auth/magic-link", MaxAge: -1})
+	}
+
+	// The account may have been blocked, or the feature turned off, since the link was sent
+	var user models.User
+	if err := db.DB.First(&user, link.UserID).Error; err != nil || user.Status != "Active" || !magicLinkEnabled(user.Role) {
+		log.Warn().Uint64("user_id", link.UserID).Msg("ConsumeMagicLink: account no longer allowed to use magic links")
+		utils.WriteError(w, http.StatusForbidden, "LOGIN_NOT_ALLOWED", "This account cannot log in with a magic link")
+		return
+	}
+
+	if stage := mfaStage(user.TOTPEnabled); stage != "" {
+		respondMFAChallenge(w, "user", user.ID, stage)
+		return
+	}
+
+	accessToken, err := issueUserTokens(w, r, &user)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+
+	log.Info().Uint64("user_id", user.ID).Msg("ConsumeMagicLink: login successful")
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"access_token": accessToken})
+}
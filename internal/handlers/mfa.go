@@ -0,0 +1,691 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/keyring"
+	"user-api/internal/loginguard"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaPendingPurpose = "mfa_pending"
+	mfaPendingTTL     = 5 * time.Minute
+	recoveryCodeCount = 10
+	// mfaMaxCodeFailures is how many wrong codes one pending token allows before the login must start over
+	mfaMaxCodeFailures = 5
+)
+
+// Login stages returned in the mfa_required response
+const (
+	mfaStageVerify = "verify" // account has 2FA, a code is required
+	mfaStageEnroll = "enroll" // policy requires 2FA but the account has not set it up yet
+)
+
+var (
+	errInvalidMFACode = errors.New("invalid two-factor code")
+	errMFATokenUsed   = errors.New("mfa pending token already used or expired")
+)
+
+// mfaPendingClaims is the short-lived token issued after a correct password when a second factor is still needed.
+// It cannot be used as an access token: it is signed with a key derived for this purpose only.
+type mfaPendingClaims struct {
+	AccountType string `json:"account_type"`
+	AccountID   uint64 `json:"account_id"`
+	Stage       string `json:"stage"`
+	Purpose     string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// MFALoginRequest is the body of POST /api/auth/mfa/setup and /api/auth/mfa/verify
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+// MFACodeRequest is the body of the self-service 2FA endpoints
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+// mfaAccount is the part of a user or administrator record needed for two-factor authentication
+type mfaAccount struct {
+	Type         string
+	ID           uint64
+	Email        string
+	Password     string
+	TOTPSecret   string
+	TOTPEnabled  bool
+	TOTPLastStep int64
+}
+
+// mfaRequiredByPolicy reports whether a master administrator made 2FA mandatory for every account
+func mfaRequiredByPolicy() bool {
+	return getSetting(settingMFARequired, "false") == "true"
+}
+
+// mfaStage returns the second-factor stage a login has to pass, or "" if none is needed
+func mfaStage(enabled bool) string {
+	if enabled {
+		return mfaStageVerify
+	}
+	if mfaRequiredByPolicy() {
+		return mfaStageEnroll
+	}
+	return ""
+}
+
+// mfaKeys returns the pending-token keys of an account type, derived from its JWT key ring
+func mfaKeys(accountType string) *keyring.Ring {
+	if accountType == "admin" {
+		return mfaAdminKeys
+	}
+	return mfaUserKeys
+}
+
+// respondMFAChallenge answers a successful first factor with a pending token instead of access tokens
+func respondMFAChallenge(w http.ResponseWriter, accountType string, id uint64, stage string) {
+	tokenID, err := generateToken(16)
+	if err != nil {
+		log.Error().Err(err).Msg("respondMFAChallenge: failed to generate token ID")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+	expiresAt := time.Now().Add(mfaPendingTTL)
+	// The token ID is stored so the token can be consumed once the login completes
+	pending := models.MFAPendingToken{JTI: tokenID, AccountType: accountType, AccountID: id, ExpiresAt: expiresAt}
+	if err := db.DB.Create(&pending).Error; err != nil {
+		log.Error().Err(err).Msg("respondMFAChallenge: failed to store pending token")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to generate token")
+		return
+	}
+	claims := &mfaPendingClaims{
+		AccountType: accountType,
+		AccountID:   id,
+		Stage:       stage,
+		Purpose:     mfaPendingPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token, err := mfaKeys(accountType).Sign(claims)
+	if err != nil {
+		log.Error().Err(err).Msg("respondMFAChallenge: failed to sign pending token")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "mfa_required",
+		"stage":     stage,
+		"mfa_token": token,
+	})
+}
+
+// parseMFAPendingToken validates a pending token issued by respondMFAChallenge
+func parseMFAPendingToken(tokenStr string) (*mfaPendingClaims, error) {
+	claims := &mfaPendingClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		// The keys depend on the account type, which is read from the unverified claims
+		// and then authenticated by the signature itself.
+		return mfaKeys(claims.AccountType).Keyfunc(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != mfaPendingPurpose || claims.ID == "" || (claims.AccountType != "user" && claims.AccountType != "admin") {
+		return nil, errors.New("not an mfa pending token")
+	}
+	return claims, nil
+}
+
+// consumeMFAPendingToken marks a pending token as used. The conditional update lets only one of
+// several concurrent requests with the same token complete the login.
+func consumeMFAPendingToken(claims *mfaPendingClaims) error {
+	result := db.DB.Model(&models.MFAPendingToken{}).
+		Where("jti = ? AND account_type = ? AND account_id = ? AND used_at IS NULL AND expires_at > ?",
+			claims.ID, claims.AccountType, claims.AccountID, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errMFATokenUsed
+	}
+	return nil
+}
+
+// loadMFAAccount reads the 2FA state of a user or administrator
+func loadMFAAccount(accountType string, id uint64) (*mfaAccount, error) {
+	if accountType == "admin" {
+		var admin models.Administrator
+		if err := db.DB.Where("id = ? AND status = ?", id, "Active").First(&admin).Error; err != nil {
+			return nil, err
+		}
+		return &mfaAccount{"admin", admin.ID, admin.Email, admin.Password, admin.TOTPSecret, admin.TOTPEnabled, admin.TOTPLastStep}, nil
+	}
+	var user models.User
+	if err := db.DB.Where("id = ? AND status <> ?", id, "Blocked").First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &mfaAccount{"user", user.ID, user.Email, user.Password, user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep}, nil
+}
+
+// accountModel returns the GORM model for the account's table
+func (a *mfaAccount) accountModel() interface{} {
+	if a.Type == "admin" {
+		return &models.Administrator{}
+	}
+	return &models.User{}
+}
+
+// update writes 2FA columns of the account
+func (a *mfaAccount) update(tx *gorm.DB, fields map[string]interface{}) error {
+	return tx.Model(a.accountModel()).Where("id = ?", a.ID).Updates(fields).Error
+}
+
+// checkCode validates a TOTP code (rejecting a replay of the last accepted step)
+// or, when allowed, consumes a recovery code.
+func (a *mfaAccount) checkCode(code, recoveryCode string, allowRecovery bool) error {
+	if code != "" && a.TOTPSecret != "" {
+		step, ok := utils.ValidateTOTP(a.TOTPSecret, code, time.Now())
+		if !ok || step <= a.TOTPLastStep {
+			return errInvalidMFACode
+		}
+		// Conditional update so two concurrent requests cannot both use the same code
+		result := db.DB.Model(a.accountModel()).
+			Where("id = ? AND totp_last_step < ?", a.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		a.TOTPLastStep = step
+		return nil
+	}
+
+	if recoveryCode != "" && allowRecovery {
+		normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(recoveryCode), "-", ""))
+		result := db.DB.Model(&models.MFARecoveryCode{}).
+			Where("account_type = ? AND account_id = ? AND code_hash = ? AND used_at IS NULL", a.Type, a.ID, hashToken(normalized)).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		log.Info().Str("account_type", a.Type).Uint64("account_id", a.ID).Msg("MFA: recovery code used")
+		return nil
+	}
+
+	return errInvalidMFACode
+}
+
+// guardKey is the login guard key counting the wrong second-factor codes of the account
+func (a *mfaAccount) guardKey() string {
+	return loginguard.AccountKey("mfa-"+a.Type, strconv.FormatUint(a.ID, 10))
+}
+
+// checkGuardedCode is checkCode behind the login guard. Wrong codes count against the account and the
+// client IP like wrong passwords, so they are slowed down and eventually locked out; codes sent with a
+// pending token (tokenID) also count against the token, which stops working after mfaMaxCodeFailures
+// wrong codes. On failure the error response is written (invalidStatus for a wrong code).
+func (a *mfaAccount) checkGuardedCode(w http.ResponseWriter, r *http.Request, tokenID, code, recoveryCode string, allowRecovery bool, invalidStatus int) bool {
+	key := a.guardKey()
+	if !allowLoginAttempt(w, r, key) {
+		return false
+	}
+	tokenKey := ""
+	if tokenID != "" {
+		tokenKey = loginguard.AccountKey("mfa-token", tokenID)
+		status, err := LoginGuard.Status(tokenKey)
+		if err != nil {
+			log.Error().Err(err).Msg("Login guard check of an MFA token failed")
+		} else if status.Failures >= mfaMaxCodeFailures {
+			utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Too many invalid codes, please sign in again")
+			return false
+		}
+	}
+
+	if err := a.checkCode(code, recoveryCode, allowRecovery); err != nil {
+		log.Warn().Str("account_type", a.Type).Uint64("account_id", a.ID).Msg("MFA: invalid code")
+		recordLoginFailure(r, key, a.Email, a.Email)
+		if tokenKey != "" {
+			if _, err := LoginGuard.Fail(tokenKey, ""); err != nil {
+				log.Error().Err(err).Msg("Login guard failed to count a wrong MFA code")
+			}
+		}
+		utils.WriteError(w, invalidStatus, "INVALID_MFA_CODE", "Invalid two-factor code")
+		return false
+	}
+	recordLoginSuccess(key)
+	if tokenKey != "" {
+		recordLoginSuccess(tokenKey)
+	}
+	return true
+}
+
+// startEnrollment generates and stores a new (not yet enabled) TOTP secret
+func (a *mfaAccount) startEnrollment() (map[string]interface{}, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.update(db.DB, map[string]interface{}{"totp_secret": secret, "totp_enabled": false, "totp_last_step": 0}); err != nil {
+		return nil, err
+	}
+	a.TOTPSecret, a.TOTPEnabled, a.TOTPLastStep = secret, false, 0
+
+	issuer := cfg.Section("auth").Key("totp_issuer").MustString("NeuroHelp")
+	return map[string]interface{}{
+		"secret":     secret,
+		"otpauthUri": utils.TOTPProvisioningURI(issuer, a.Email, secret),
+	}, nil
+}
+
+// finishEnrollment enables 2FA and replaces the recovery codes. The plain codes are returned only once.
+func (a *mfaAccount) finishEnrollment() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_type = ? AND account_id = ?", a.Type, a.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for i := 0; i < recoveryCodeCount; i++ {
+			code, err := generateToken(5)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&models.MFARecoveryCode{
+				AccountType: a.Type,
+				AccountID:   a.ID,
+				CodeHash:    hashToken(code),
+			}).Error; err != nil {
+				return err
+			}
+			codes = append(codes, code[:5]+"-"+code[5:])
+		}
+		return a.update(tx, map[string]interface{}{"totp_enabled": true})
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.TOTPEnabled = true
+	return codes, nil
+}
+
+// disable turns 2FA off and removes the secret and recovery codes
+func (a *mfaAccount) disable() error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_type = ? AND account_id = ?", a.Type, a.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return a.update(tx, map[string]interface{}{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0})
+	})
+}
+
+// MFASetup godoc
+// @Summary      Start mandatory 2FA enrollment during login
+// @Description  Uses the pending token of an "enroll" stage login to generate a TOTP secret for the authenticator app
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body MFALoginRequest true "Pending MFA token"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,429,500 {object} map[string]interface{}
+// @Router       /api/auth/mfa/setup [post]
+func MFASetup(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	claims, err := parseMFAPendingToken(req.MFAToken)
+	if err != nil || claims.Stage != mfaStageEnroll {
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+		return
+	}
+	account, err := loadMFAAccount(claims.AccountType, claims.AccountID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+		return
+	}
+	if account.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+		return
+	}
+	// A new secret must not reset the count of wrong codes
+	if !allowLoginAttempt(w, r, account.guardKey()) {
+		return
+	}
+
+	resp, err := account.startEnrollment()
+	if err != nil {
+		log.Error().Err(err).Msg("MFASetup: failed to start enrollment")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to start 2FA enrollment")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// MFAVerify godoc
+// @Summary      Complete login with a second factor
+// @Description  Exchanges the pending token and a TOTP (or recovery) code for the regular login response; the pending token works for one login only. In the "enroll" stage the code confirms the new authenticator and recovery codes are returned once.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body MFALoginRequest true "Pending MFA token and code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,429,500 {object} map[string]interface{}
+// @Router       /api/auth/mfa/verify [post]
+func MFAVerify(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "code or recoveryCode is required")
+		return
+	}
+	claims, err := parseMFAPendingToken(req.MFAToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+		return
+	}
+	account, err := loadMFAAccount(claims.AccountType, claims.AccountID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+		return
+	}
+
+	// Recovery codes only exist once 2FA is enabled, so they cannot complete an enrollment
+	enrolling := claims.Stage == mfaStageEnroll && !account.TOTPEnabled
+	if !account.checkGuardedCode(w, r, claims.ID, req.Code, req.RecoveryCode, !enrolling, http.StatusUnauthorized) {
+		return
+	}
+	if err := consumeMFAPendingToken(claims); err != nil {
+		if err != errMFATokenUsed {
+			log.Error().Err(err).Msg("MFAVerify: failed to consume pending token")
+		}
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+		return
+	}
+
+	var recoveryCodes []string
+	if enrolling {
+		if recoveryCodes, err = account.finishEnrollment(); err != nil {
+			log.Error().Err(err).Msg("MFAVerify: failed to enable 2FA")
+			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to enable 2FA")
+			return
+		}
+	}
+
+	response := map[string]interface{}{}
+	if account.Type == "admin" {
+		var admin models.Administrator
+		if err := db.DB.First(&admin, account.ID).Error; err != nil {
+			utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+			return
+		}
+		accessToken, err := issueAdminTokens(w, r, &admin)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+			return
+		}
+		response["token"] = accessToken
+		response["user"] = map[string]interface{}{
+			"username": admin.Username,
+			"role":     admin.Role,
+		}
+	} else {
+		var user models.User
+		if err := db.DB.First(&user, account.ID).Error; err != nil {
+			utils.WriteError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid or expired MFA token")
+			return
+		}
+		accessToken, err := issueUserTokens(w, r, &user)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+			return
+		}
+		response["access_token"] = accessToken
+	}
+	if recoveryCodes != nil {
+		response["recoveryCodes"] = recoveryCodes
+	}
+
+	log.Info().Str("account_type", account.Type).Uint64("account_id", account.ID).Msg("MFAVerify: login completed with second factor")
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// selfMFAAccount resolves the 2FA account of the authenticated user or administrator
+func selfMFAAccount(w http.ResponseWriter, r *http.Request, accountType string) (*mfaAccount, bool) {
+	var id uint64
+	if accountType == "admin" {
+		admin, ok := auth.AdminFromContext(r.Context())
+		if !ok {
+			utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+			return nil, false
+		}
+		id = admin.ID
+	} else {
+		principal, ok := principalFromRequest(w, r)
+		if !ok {
+			return nil, false
+		}
+		id = principal.UserID
+	}
+
+	account, err := loadMFAAccount(accountType, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Account not found")
+		return nil, false
+	}
+	return account, true
+}
+
+func enrollSelfMFA(w http.ResponseWriter, r *http.Request, accountType string) {
+	account, ok := selfMFAAccount(w, r, accountType)
+	if !ok {
+		return
+	}
+	if account.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+		return
+	}
+
+	resp, err := account.startEnrollment()
+	if err != nil {
+		log.Error().Err(err).Msg("EnrollMFA: failed to start enrollment")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to start 2FA enrollment")
+		return
+	}
+	if account.Type == "admin" {
+		audit.Record(r, "admin.mfa_enroll", audit.TargetAdministrator, account.ID, nil, nil)
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func verifySelfMFA(w http.ResponseWriter, r *http.Request, accountType string) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "code is required")
+		return
+	}
+	account, ok := selfMFAAccount(w, r, accountType)
+	if !ok {
+		return
+	}
+	if account.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+		return
+	}
+	if account.TOTPSecret == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MFA_NOT_ENROLLED", "Start enrollment first")
+		return
+	}
+	if !account.checkGuardedCode(w, r, "", req.Code, "", false, http.StatusBadRequest) {
+		return
+	}
+
+	codes, err := account.finishEnrollment()
+	if err != nil {
+		log.Error().Err(err).Msg("VerifyMFA: failed to enable 2FA")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to enable 2FA")
+		return
+	}
+
+	log.Info().Str("account_type", account.Type).Uint64("account_id", account.ID).Msg("VerifyMFA: 2FA enabled")
+	if account.Type == "admin" {
+		audit.Record(r, "admin.mfa_enable", audit.TargetAdministrator, account.ID,
+			map[string]bool{"totpEnabled": false}, map[string]bool{"totpEnabled": true})
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+func disableSelfMFA(w http.ResponseWriter, r *http.Request, accountType string) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "password and code are required")
+		return
+	}
+	if mfaRequiredByPolicy() {
+		utils.WriteError(w, http.StatusForbidden, "MFA_REQUIRED_BY_POLICY", "Two-factor authentication is required for all accounts")
+		return
+	}
+	account, ok := selfMFAAccount(w, r, accountType)
+	if !ok {
+		return
+	}
+	if !account.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, "MFA_NOT_ENABLED", "Two-factor authentication is not enabled")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(req.Password)); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid password")
+		return
+	}
+	if !account.checkGuardedCode(w, r, "", req.Code, req.RecoveryCode, true, http.StatusUnauthorized) {
+		return
+	}
+
+	if err := account.disable(); err != nil {
+		log.Error().Err(err).Msg("DisableMFA: failed to disable 2FA")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to disable 2FA")
+		return
+	}
+
+	log.Info().Str("account_type", account.Type).Uint64("account_id", account.ID).Msg("DisableMFA: 2FA disabled")
+	if account.Type == "admin" {
+		audit.Record(r, "admin.mfa_disable", audit.TargetAdministrator, account.ID,
+			map[string]bool{"totpEnabled": true}, map[string]bool{"totpEnabled": false})
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// EnrollUserMFA godoc
+// @Summary      Start 2FA enrollment
+// @Description  Generates a TOTP secret and otpauth URI for the authenticator app. 2FA is enabled after the first code is verified.
+// @Tags         Users
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      401,409,500 {object} map[string]interface{}
+// @Router       /api/users/self/2fa/enroll [post]
+// @Security     BearerAuth
+func EnrollUserMFA(w http.ResponseWriter, r *http.Request) {
+	enrollSelfMFA(w, r, "user")
+}
+
+// VerifyUserMFA godoc
+// @Summary      Confirm 2FA enrollment
+// @Description  Verifies the first TOTP code, enables 2FA and returns single-use recovery codes (shown only once)
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        body body MFACodeRequest true "TOTP code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,409,429,500 {object} map[string]interface{}
+// @Router       /api/users/self/2fa/verify [post]
+// @Security     BearerAuth
+func VerifyUserMFA(w http.ResponseWriter, r *http.Request) {
+	verifySelfMFA(w, r, "user")
+}
+
+// DisableUserMFA godoc
+// @Summary      Disable 2FA
+// @Description  Disables 2FA after confirming the password and a TOTP or recovery code. Not allowed when 2FA is mandatory.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        body body MFACodeRequest true "Password and code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,429,500 {object} map[string]interface{}
+// @Router       /api/users/self/2fa/disable [post]
+// @Security     BearerAuth
+func DisableUserMFA(w http.ResponseWriter, r *http.Request) {
+	disableSelfMFA(w, r, "user")
+}
+
+// EnrollAdminMFA godoc
+// @Summary      Start 2FA enrollment (administrator)
+// @Tags         Actions for administrators
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      401,409,500 {object} map[string]interface{}
+// @Router       /api/admin/self/2fa/enroll [post]
+// @Security     BearerAuth
+func EnrollAdminMFA(w http.ResponseWriter, r *http.Request) {
+	enrollSelfMFA(w, r, "admin")
+}
+
+// VerifyAdminMFA godoc
+// @Summary      Confirm 2FA enrollment (administrator)
+// @Tags         Actions for administrators
+// @Accept       json
+// @Produce      json
+// @Param        body body MFACodeRequest true "TOTP code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,409,429,500 {object} map[string]interface{}
+// @Router       /api/admin/self/2fa/verify [post]
+// @Security     BearerAuth
+func VerifyAdminMFA(w http.ResponseWriter, r *http.Request) {
+	verifySelfMFA(w, r, "admin")
+}
+
+// DisableAdminMFA godoc
+// @Summary      Disable 2FA (administrator)
+// @Tags         Actions for administrators
+// @Accept       json
+// @Produce      json
+// @Param        body body MFACodeRequest true "Password and code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,429,500 {object} map[string]interface{}
+// @Router       /api/admin/self/2fa/disable [post]
+// @Security     BearerAuth
+func DisableAdminMFA(w http.ResponseWriter, r *http.Request) {
+	disableSelfMFA(w, r, "admin")
+}
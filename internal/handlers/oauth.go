@@ -1,15 +1,13 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
-	"user-api/internal/db"
+	"user-api/internal/loginguard"
 	"user-api/internal/models"
 	"user-api/internal/utils"
 
 	"github.com/rs/zerolog/log"
-	"google.golang.org/api/idtoken"
 )
 
 type GoogleAuthRequest struct {
@@ -18,13 +16,13 @@ type GoogleAuthRequest struct {
 
 // GoogleAuth godoc
 // @Summary      Authenticate with Google
-// @Description  Authenticate or check registration status using Google ID token
+// @Description  Authenticate or check registration status using a Google ID token (Google Identity Services). The token is verified against the "google" OpenID Connect provider.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        body body GoogleAuthRequest true "Google ID token"
 // @Success      200 {object} map[string]interface{}
-// @Failure      400,401,500 {object} map[string]interface{}
+// @Failure      400,401,404,409,500 {object} map[string]interface{}
 // @Router       /api/auth/google [post]
 func GoogleAuth(w http.ResponseWriter, r *http.Request) {
 	var req GoogleAuthRequest
@@ -38,100 +36,61 @@ func GoogleAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate Google ID token
-	googleClientID := cfg.Section("google").Key("client_id").String()
-	payload, err := idtoken.Validate(context.Background(), req.IDToken, googleClientID)
-	if err != nil {
-		log.Warn().Err(err).Msg("GoogleAuth: failed to validate Google ID token")
-		utils.WriteError(w, http.StatusUnauthorized, "INVALID_GOOGLE_TOKEN", "Invalid Google token")
+	provider, ok := OIDCProviders["google"]
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, "PROVIDER_NOT_FOUND", "Google login is not configured")
 		return
 	}
 
-	// Extract user info from Google token payload
-	googleID, _ := payload.Claims["sub"].(string)
-	email, _ := payload.Claims["email"].(string)
-	firstName, _ := payload.Claims["given_name"].(string)
-	lastName, _ := payload.Claims["family_name"].(string)
-
-	if googleID == "" || email == "" {
-		log.Warn().Msg("GoogleAuth: missing required fields in Google token")
-		utils.WriteError(w, http.StatusBadRequest, "INCOMPLETE_GOOGLE_DATA", "Google token missing required fields")
+	// The account is not known before the token is validated, so only the client IP is checked here
+	if !allowLoginAttempt(w, r, "") {
 		return
 	}
 
-	// Try to find user by GoogleID
-	var user models.User
-	if err := db.DB.Where("google_id = ?", googleID).First(&user).Error; err == nil {
-		// User found by GoogleID — authenticate
-		loginAndRespond(w, &user)
+	// Validate Google ID token (no nonce: the token was obtained by the frontend directly)
+	claims, err := provider.Verify(r.Context(), req.IDToken, "")
+	if err != nil {
+		log.Warn().Err(err).Msg("GoogleAuth: failed to validate Google ID token")
+		recordLoginFailure(r, "", "", "")
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_GOOGLE_TOKEN", "Invalid Google token")
 		return
 	}
 
-	// Try to find user by email (link existing account)
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err == nil {
-		// User with this email exists but without GoogleID — link account
-		user.GoogleID = googleID
-		if err := db.DB.Save(&user).Error; err != nil {
-			log.Error().Err(err).Msg("GoogleAuth: failed to link Google account")
-			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to link Google account")
-			return
-		}
-		log.Info().Str("email", email).Msg("GoogleAuth: linked Google account to existing user")
-		loginAndRespond(w, &user)
+	if claims.Email == "" {
+		log.Warn().Msg("GoogleAuth: missing required fields in Google token")
+		utils.WriteError(w, http.StatusBadRequest, "INCOMPLETE_GOOGLE_DATA", "Google token missing required fields")
 		return
 	}
 
-	// User not found — registration required
-	log.Info().Str("email", email).Msg("GoogleAuth: new user, registration required")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "registration_required",
-		"googleUser": map[string]string{
-			"email":     email,
-			"firstName": firstName,
-			"lastName":  lastName,
-			"googleId":  googleID,
-		},
-	})
+	completeOIDCLogin(w, r, "google", claims)
 }
 
 // loginAndRespond generates JWT tokens and sends authentication response
-func loginAndRespond(w http.ResponseWriter, user *models.User) {
+func loginAndRespond(w http.ResponseWriter, r *http.Request, user *models.User) {
 	if user.Status == "Blocked" {
-		log.Warn().Str("email", user.Email).Msg("GoogleAuth: login denied — account blocked")
+		log.Warn().Str("email", user.Email).Msg("loginAndRespond: login denied — account blocked")
 		utils.WriteError(w, http.StatusForbidden, "ACCOUNT_BLOCKED", "Your account has been blocked")
 		return
 	}
 
-	accessToken, err := utils.GenerateAccessToken(user)
-	if err != nil {
-		log.Error().Err(err).Msg("GoogleAuth: failed to generate access token")
-		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+	// A password lockout applies to every way of signing in
+	if !allowLoginAttempt(w, r, loginguard.AccountKey("user", user.Email)) {
 		return
 	}
 
-	// Generate refresh token
-	refreshToken, err := utils.GenerateRefreshToken(user)
+	if stage := mfaStage(user.TOTPEnabled); stage != "" {
+		respondMFAChallenge(w, "user", user.ID, stage)
+		return
+	}
+
+	accessToken, err := issueUserTokens(w, r, user)
 	if err != nil {
-		log.Error().Err(err).Msg("GoogleAuth: failed to generate refresh token")
-	} else {
-		user.RefreshToken = refreshToken
-		if err := db.DB.Save(user).Error; err != nil {
-			log.Error().Err(err).Msg("GoogleAuth: failed to save refresh token")
-		} else {
-			http.SetCookie(w, &http.Cookie{
-				Name:     "refresh_token",
-				Value:    refreshToken,
-				HttpOnly: true,
-				Path:     "/",
-				MaxAge:   7 * 24 * 3600,
-				Secure:   false,
-				SameSite: http.SameSiteLaxMode,
-			})
-		}
+		log.Error().Err(err).Msg("loginAndRespond: failed to generate access token")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
 	}
 
-	log.Info().Str("email", user.Email).Msg("GoogleAuth: user authenticated successfully")
+	log.Info().Str("email", user.Email).Msg("loginAndRespond: user authenticated successfully")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/oidc"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OIDCProviders are the configured OpenID Connect providers by name ([oidc.<name>] sections)
+var OIDCProviders map[string]*oidc.Provider
+
+const (
+	// oidcStateTTL is how long the user has to finish signing in at the provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcBindingCookie ties a login attempt to the browser that started it (login CSRF protection)
+	oidcBindingCookie = "oidc_binding"
+	// oidcRegistrationTTL is how long a registration token from registration_required stays valid
+	oidcRegistrationTTL     = 30 * time.Minute
+	oidcRegistrationPurpose = "oidc_registration"
+)
+
+var (
+	errInvalidOIDCState     = errors.New("invalid or expired login state")
+	errOIDCStateWrongDevice = errors.New("login was started in another browser")
+)
+
+// OIDCCallbackRequest is the body of POST /api/auth/oidc/{provider}/callback
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// oidcRegistrationClaims prove to RegisterUser that the provider authenticated this identity
+type oidcRegistrationClaims struct {
+	Provider      string `json:"provider"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Purpose       string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GetOIDCProviders godoc
+// @Summary      List OpenID Connect providers
+// @Description  Names of the providers that can be used with /api/auth/oidc/{provider}/start
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /api/auth/oidc/providers [get]
+func GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(OIDCProviders))
+	for name := range OIDCProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"providers": names})
+}
+
+// OIDCStart godoc
+// @Summary      Start OpenID Connect login
+// @Description  Returns the provider's authorization URL (authorization code flow with PKCE) and sets a cookie binding the login to this browser. After signing in, the provider redirects to the configured redirect_url with code and state, which the frontend posts to the callback endpoint.
+// @Tags         Auth
+// @Produce      json
+// @Param        provider path string true "Provider name"
+// @Success      200 {object} map[string]interface{}
+// @Failure      404,500,502 {object} map[string]interface{}
+// @Router       /api/auth/oidc/{provider}/start [get]
+func OIDCStart(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := OIDCProviders[name]
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, "PROVIDER_NOT_FOUND", "Unknown login provider")
+		return
+	}
+
+	state, err1 := oidc.RandomString(32)
+	nonce, err2 := oidc.RandomString(32)
+	verifier, err3 := oidc.NewVerifier()
+	binding, err4 := generateToken(32)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		log.Error().Err(err).Msg("OIDCStart: failed to generate login secrets")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		log.Error().Err(err).Str("provider", name).Msg("OIDCStart: provider discovery failed")
+		utils.WriteError(w, http.StatusBadGateway, "PROVIDER_UNAVAILABLE", "Login provider is unavailable")
+		return
+	}
+
+	if err := db.DB.Create(&models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		BindingHash:  hashToken(binding),
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}).Error; err != nil {
+		log.Error().Err(err).Msg("OIDCStart: failed to save login state")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to start login")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		HttpOnly: true,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		Secure:   false, // set to true for HTTPS
+		SameSite: http.SameSiteLaxMode,
+	})
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"authorizationUrl": authURL})
+}
+
+// OIDCCallback godoc
+// @Summary      Finish OpenID Connect login
+// @Description  Exchanges the authorization code for an ID token and signs the user in. Answers like Google login: {"status":"authenticated","access_token":...}, an MFA challenge, or {"status":"registration_required", ...} with a registrationToken to pass to /api/register.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "Provider name"
+// @Param        body body OIDCCallbackRequest true "Code and state from the provider redirect"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/auth/oidc/{provider}/callback [post]
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := OIDCProviders[name]
+	if !ok {
+		utils.WriteError(w, http.StatusNotFound, "PROVIDER_NOT_FOUND", "Unknown login provider")
+		return
+	}
+	var req OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Code == "" || req.State == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "code and state are required")
+		return
+	}
+	if !allowLoginAttempt(w, r, "") {
+		return
+	}
+
+	var state models.OIDCLoginState
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state_hash = ? AND provider = ? AND used_at IS NULL AND expires_at > ?", hashToken(req.State), name, time.Now()).
+			First(&state).Error; err != nil {
+			return errInvalidOIDCState
+		}
+		cookie, err := r.Cookie(oidcBindingCookie)
+		if err != nil || hashToken(cookie.Value) != state.BindingHash {
+			return errOIDCStateWrongDevice
+		}
+		return tx.Model(&state).Update("used_at", time.Now()).Error
+	})
+	switch {
+	case err == errInvalidOIDCState:
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_STATE", "Login attempt is invalid or expired, please start again")
+		return
+	case err == errOIDCStateWrongDevice:
+		utils.WriteError(w, http.StatusForbidden, "WRONG_BROWSER", "Finish signing in in the browser where you started")
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("OIDCCallback: failed to consume login state")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to log in")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcBindingCookie, Value: "", HttpOnly: true, Path: "/api/auth/oidc", MaxAge: -1})
+
+	claims, err := provider.Exchange(r.Context(), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Warn().Err(err).Str("provider", name).Msg("OIDCCallback: code exchange or ID token verification failed")
+		recordLoginFailure(r, "", "", "")
+		utils.WriteError(w, http.StatusUnauthorized, "INVALID_OIDC_LOGIN", "Sign-in with the provider failed")
+		return
+	}
+	completeOIDCLogin(w, r, name, claims)
+}
+
+// completeOIDCLogin signs in the user linked to a verified provider identity. An identity seen for the
+// first time is linked to the account with the same email when the provider has verified that email;
+// otherwise the frontend is asked to finish registration.
+func completeOIDCLogin(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.Claims) {
+	if claims.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, "INCOMPLETE_PROVIDER_DATA", "The provider did not return an email address")
+		return
+	}
+
+	var identity models.UserIdentity
+	if err := db.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error; err == nil {
+		var user models.User
+		if err := db.DB.First(&user, identity.UserID).Error; err != nil {
+			log.Error().Err(err).Uint64("user_id", identity.UserID).Msg("completeOIDCLogin: identity without user")
+			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to log in")
+			return
+		}
+		now := time.Now()
+		db.DB.Model(&identity).Updates(map[string]interface{}{"email": claims.Email, "last_login_at": now})
+		loginAndRespond(w, r, &user)
+		return
+	}
+
+	var user models.User
+	if err := db.DB.Where("email = ?", claims.Email).First(&user).Error; err == nil {
+		// Linking on an unverified email would let anyone who controls a provider account with the
+		// victim's address take over the local account
+		if !bool(claims.EmailVerified) {
+			log.Warn().Str("provider", provider).Uint64("user_id", user.ID).Msg("completeOIDCLogin: email not verified by provider, not linking")
+			utils.WriteError(w, http.StatusConflict, "ACCOUNT_EXISTS", "An account with this email already exists, sign in with your password")
+			return
+		}
+		now := time.Now()
+		identity = models.UserIdentity{UserID: user.ID, Provider: provider, Subject: claims.Subject, Email: claims.Email, LastLoginAt: &now}
+		if err := db.DB.Create(&identity).Error; err != nil {
+			log.Error().Err(err).Msg("completeOIDCLogin: failed to link identity")
+			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to link account")
+			return
+		}
+		log.Info().Str("provider", provider).Uint64("user_id", user.ID).Msg("completeOIDCLogin: linked provider identity to existing user")
+		loginAndRespond(w, r, &user)
+		return
+	}
+
+	registrationToken, err := issueOIDCRegistrationToken(provider, claims)
+	if err != nil {
+		log.Error().Err(err).Msg("completeOIDCLogin: failed to sign registration token")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to generate token")
+		return
+	}
+
+	// The "googleUser" object keeps the shape the frontend already handles for every provider;
+	// googleId carries the provider's subject
+	log.Info().Str("provider", provider).Msg("completeOIDCLogin: new user, registration required")
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":            "registration_required",
+		"provider":          provider,
+		"registrationToken": registrationToken,
+		"googleUser": map[string]string{
+			"email":     claims.Email,
+			"firstName": claims.GivenName,
+			"lastName":  claims.FamilyName,
+			"googleId":  claims.Subject,
+		},
+	})
+}
+
+func issueOIDCRegistrationToken(provider string, claims *oidc.Claims) (string, error) {
+	now := time.Now()
+	return oidcRegistrationKeys.Sign(&oidcRegistrationClaims{
+		Provider:      provider,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Purpose:       oidcRegistrationPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   claims.Subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcRegistrationTTL)),
+		},
+	})
+}
+
+// parseOIDCRegistrationToken validates a token issued by completeOIDCLogin
+func parseOIDCRegistrationToken(tokenStr string) (*oidcRegistrationClaims, error) {
+	claims := &oidcRegistrationClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, oidcRegistrationKeys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != oidcRegistrationPurpose || claims.Provider == "" || claims.Subject == "" {
+		return nil, errors.New("not a registration token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"user-api/internal/passwordpolicy"
+	"user-api/internal/utils"
+)
+
+// PasswordPolicy validates every password a user chooses (config section [password_policy])
+var PasswordPolicy *passwordpolicy.Policy
+
+// checkPasswordPolicy writes a 400 response with the violated rule's code and returns false
+// if the password does not satisfy PasswordPolicy. personal are the name and email of the account.
+func checkPasswordPolicy(w http.ResponseWriter, password string, personal ...string) bool {
+	violation := PasswordPolicy.Check(password, personal...)
+	if violation == nil {
+		return true
+	}
+	utils.WriteErrorParams(w, http.StatusBadRequest, violation.Code, violation.Message, violation.Params)
+	return false
+}
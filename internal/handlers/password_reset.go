@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ForgotPasswordRequest is the body of POST /api/auth/password/forgot
+type ForgotPasswordRequest struct {
+	Email       string `json:"email"`
+	AccountType string `json:"accountType"` // "user" (default) or "admin"
+}
+
+// ResetPasswordRequest is the body of POST /api/auth/password/reset
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+var (
+	errInvalidResetToken = errors.New("invalid or expired reset token")
+	errResetCooldown     = errors.New("a reset link was sent recently")
+)
+
+// passwordResetTTL returns how long a reset link stays valid (config: auth.password_reset_ttl_minutes, default 60).
+func passwordResetTTL() time.Duration {
+	return time.Duration(cfg.Section("auth").Key("password_reset_ttl_minutes").MustInt(60)) * time.Minute
+}
+
+// passwordResetCooldown returns the minimum time between two reset emails to the same account
+// (config: auth.password_reset_cooldown_minutes, default 5).
+func passwordResetCooldown() time.Duration {
+	return time.Duration(cfg.Section("auth").Key("password_reset_cooldown_minutes").MustInt(5)) * time.Minute
+}
+
+// ForgotPassword godoc
+// @Summary      Request a password reset link
+// @Description  Sends a single-use password reset link to the account email. An account gets at most one email per auth.password_reset_cooldown_minutes (default 5). The response is identical whether or not the account exists or an email was sent.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body ForgotPasswordRequest true "Account email"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,429 {object} map[string]interface{}
+// @Router       /api/auth/password/forgot [post]
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "email is required")
+		return
+	}
+	if req.AccountType == "" {
+		req.AccountType = "user"
+	}
+	if req.AccountType != "user" && req.AccountType != "admin" {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ACCOUNT_TYPE", "accountType must be 'user' or 'admin'")
+		return
+	}
+
+	var (
+		accountID uint64
+		name      string
+		found     bool
+	)
+	if req.AccountType == "admin" {
+		var admin models.Administrator
+		if err := db.DB.Where("email = ? AND status = ?", req.Email, "Active").First(&admin).Error; err == nil {
+			accountID, name, found = admin.ID, admin.FirstName, true
+		}
+	} else {
+		var user models.User
+		if err := db.DB.Where("email = ? AND status <> ?", req.Email, "Blocked").First(&user).Error; err == nil {
+			accountID, name, found = user.ID, user.FirstName, true
+		}
+	}
+
+	if found {
+		err := issuePasswordReset(req.AccountType, accountID, name, req.Email, utils.ClientIP(r))
+		if err == errResetCooldown {
+			log.Info().Str("account_type", req.AccountType).Uint64("account_id", accountID).Msg("ForgotPassword: cooldown active, email not sent")
+		} else if err != nil {
+			log.Error().Err(err).Str("account_type", req.AccountType).Uint64("account_id", accountID).Msg("ForgotPassword: failed to issue reset token")
+		}
+	} else {
+		log.Info().Str("account_type", req.AccountType).Msg("ForgotPassword: no matching account, responding generically")
+	}
+
+	// Same response in every case so the endpoint cannot be used to enumerate accounts
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "If an account with this email exists, a password reset link has been sent",
+	})
+}
+
+// issuePasswordReset stores a hashed reset token and emails the plain token to the account owner.
+// It returns errResetCooldown without sending anything when the account got a token within the cooldown.
+// The email is sent asynchronously so response time does not reveal whether the account exists.
+func issuePasswordReset(accountType string, accountID uint64, name, email, ip string) error {
+	token, err := generateToken(32)
+	if err != nil {
+		return err
+	}
+
+	ttl := passwordResetTTL()
+	reset := models.PasswordResetToken{
+		AccountType: accountType,
+		AccountID:   accountID,
+		TokenHash:   hashToken(token),
+		ExpiresAt:   time.Now().Add(ttl),
+		RequestIP:   ip,
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the account row so parallel requests see each other's tokens and send a single email
+		var account interface{} = &models.User{}
+		if accountType == "admin" {
+			account = &models.Administrator{}
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(account, accountID).Error; err != nil {
+			return err
+		}
+		var recent int64
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("account_type = ? AND account_id = ? AND created_at > ?", accountType, accountID, time.Now().Add(-passwordResetCooldown())).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return errResetCooldown
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	path := "/reset-password"
+	if accountType == "admin" {
+		path = "/admin/reset-password"
+	}
+	resetURL := fmt.Sprintf("%s%s?token=%s", cfg.Section("app").Key("frontend_url").String(), path, token)
+
+	go func() {
+		if err := utils.SendEmail(email, "Password reset", cfg.Section("email").Key("reset_template_path").MustString("./templates/reset-password.html"), []string{
+			"username=" + name,
+			"reset_link=" + resetURL,
+			"expires_minutes=" + strconv.Itoa(int(ttl.Minutes())),
+		}); err != nil {
+			log.Error().Err(err).Str("account_type", accountType).Uint64("account_id", accountID).Msg("issuePasswordReset: failed to send reset email")
+		}
+	}()
+	return nil
+}
+
+// ResetPassword godoc
+// @Summary      Reset password with a reset token
+// @Description  Sets a new password using a single-use token from the reset email and signs the account out of every device
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        body body ResetPasswordRequest true "Reset token and new password"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,500 {object} map[string]interface{}
+// @Router       /api/auth/password/reset [post]
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "token and newPassword are required")
+		return
+	}
+	personal, ok := resetAccountPersonalInfo(req.Token)
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TOKEN", "Invalid or expired token")
+		return
+	}
+	if !checkPasswordPolicy(w, req.NewPassword, personal...) {
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "HASH_ERROR", "Failed to hash password")
+		return
+	}
+
+	var reset models.PasswordResetToken
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(req.Token), time.Now()).
+			First(&reset).Error; err != nil {
+			return errInvalidResetToken
+		}
+
+		now := time.Now()
+		// Consume this token and every other outstanding token of the same account
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("account_type = ? AND account_id = ? AND used_at IS NULL", reset.AccountType, reset.AccountID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		var result *gorm.DB
+		if reset.AccountType == "admin" {
+			result = tx.Model(&models.Administrator{}).Where("id = ?", reset.AccountID).Update("password", string(hashed))
+		} else {
+			result = tx.Model(&models.User{}).Where("id = ?", reset.AccountID).Update("password", string(hashed))
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		// Sign the account out of every device
+		return revokeAllRefreshTokens(tx, reset.AccountType, reset.AccountID)
+	})
+	if err == errInvalidResetToken {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TOKEN", "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("ResetPassword: failed to reset password")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to reset password")
+		return
+	}
+
+	log.Info().Str("account_type", reset.AccountType).Uint64("account_id", reset.AccountID).Msg("ResetPassword: password reset successfully")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Password has been reset successfully",
+	})
+}
+
+// resetAccountPersonalInfo returns the name and email of the account a valid reset token belongs to,
+// for the password policy. The token is checked again, under lock, when it is consumed.
+func resetAccountPersonalInfo(token string) ([]string, bool) {
+	var reset models.PasswordResetToken
+	if err := db.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+		First(&reset).Error; err != nil {
+		return nil, false
+	}
+	if reset.AccountType == "admin" {
+		var admin models.Administrator
+		if err := db.DB.First(&admin, reset.AccountID).Error; err != nil {
+			return nil, false
+		}
+		return []string{admin.Username, admin.FirstName, admin.LastName, admin.Email}, true
+	}
+	var user models.User
+	if err := db.DB.First(&user, reset.AccountID).Error; err != nil {
+		return nil, false
+	}
+	return []string{user.FirstName, user.LastName, user.Email}, true
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+)
+
+// LoadPrincipal loads the fields of a user that RequireUser keeps in the request context
+func LoadPrincipal(userID uint64) (*auth.AuthPrincipal, error) {
+	var user models.User
+	if err := db.DB.Select("id", "email", "role", "status", "plan_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &auth.AuthPrincipal{
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+		Status: user.Status,
+		PlanID: user.PlanID,
+	}, nil
+}
+
+// principalFromRequest returns the user authenticated by RequireUser, writing 401 when there is none
+func principalFromRequest(w http.ResponseWriter, r *http.Request) (*auth.AuthPrincipal, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return nil, false
+	}
+	return principal, true
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"user-api/internal/ratelimit"
+
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+)
+
+// Rate limit policies used by the routes and the chat
+const (
+	RateLimitRegister       = "register"
+	RateLimitSearch         = "search"
+	RateLimitUpload         = "upload"
+	RateLimitChatMessage    = "chat_message"
+	RateLimitMagicLink      = "magic_link"
+	RateLimitVerifyResend   = "verify_resend"
+	RateLimitPasswordForgot = "password_forgot"
+)
+
+// defaultRateLimitPolicies apply when a policy is missing from the [rate_limit] config section
+var defaultRateLimitPolicies = map[string]string{
+	RateLimitRegister:       "5/1h",
+	RateLimitSearch:         "60/1m",
+	RateLimitUpload:         "30/1h",
+	RateLimitChatMessage:    "20/10s",
+	RateLimitMagicLink:      "5/15m",
+	RateLimitVerifyResend:   "5/1h",
+	RateLimitPasswordForgot: "5/1h",
+}
+
+// RateLimiter holds the named rate limit policies (config section [rate_limit])
+var RateLimiter *ratelimit.Limiter
+
+// newRateLimiter builds the rate limiter from the [rate_limit] config section.
+// Every key except "store" is a policy "<requests>/<period>"; store = memory (default) or db.
+func newRateLimiter(section *ini.Section) *ratelimit.Limiter {
+	specs := make(map[string]string, len(defaultRateLimitPolicies))
+	for name, spec := range defaultRateLimitPolicies {
+		specs[name] = spec
+	}
+	for _, key := range section.Keys() {
+		if key.Name() != "store" {
+			specs[key.Name()] = key.String()
+		}
+	}
+
+	policies := make([]ratelimit.Policy, 0, len(specs))
+	for name, spec := range specs {
+		policy, err := ratelimit.ParsePolicy(name, spec)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid [rate_limit] configuration")
+		}
+		policies = append(policies, policy)
+	}
+
+	var store ratelimit.Store
+	switch section.Key("store").MustString("memory") {
+	case "db":
+		store = ratelimit.NewDBStore()
+	default:
+		store = ratelimit.NewMemoryStore()
+	}
+	return ratelimit.New(store, policies...)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+	"user-api/internal/auth"
 	"user-api/internal/db"
 	"user-api/internal/models"
 	"user-api/internal/utils"
@@ -39,13 +40,13 @@ type RegisterRequest struct {
 	// Skills for psychologist
 	SkillIDs []uint64 `json:"skillIds"`
 
-	// Google OAuth field
-	GoogleID *string `json:"googleId"`
+	// OpenID Connect registration: the registrationToken from a "registration_required" login response
+	RegistrationToken *string `json:"registrationToken"`
 }
 
 // RegisterUser godoc
 // @Summary      Register user
-// @Description  Add new user (client or psychologist) without authentication
+// @Description  Add new user (client or psychologist) without authentication. The password must satisfy the password policy (codes PASSWORD_TOO_SHORT, PASSWORD_TOO_LONG, PASSWORD_TOO_SIMPLE, PASSWORD_CONTAINS_PERSONAL_INFO, PASSWORD_BREACHED)
 // @Tags         Actions for users
 // @Accept       json
 // @Produce      json
@@ -63,23 +64,65 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	user := req.User // Get user data from the request
 
-	// If registering via Google OAuth, set GoogleID on user
-	isOAuth := req.GoogleID != nil && *req.GoogleID != ""
-	if isOAuth {
-		user.GoogleID = *req.GoogleID
+	// If registering via an OpenID Connect provider, the token proves which identity to link
+	var identity *oidcRegistrationClaims
+	if req.RegistrationToken != nil && *req.RegistrationToken != "" {
+		claims, err := parseOIDCRegistrationToken(*req.RegistrationToken)
+		if err != nil {
+			log.Warn().Err(err).Msg("RegisterUser: invalid registration token")
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_REGISTRATION_TOKEN", "Registration token is invalid or expired, please sign in with the provider again")
+			return
+		}
+		if claims.Email != user.Email {
+			utils.WriteError(w, http.StatusBadRequest, "EMAIL_MISMATCH", "Email must match the provider account")
+			return
+		}
+		var linked int64
+		db.DB.Model(&models.UserIdentity{}).Where("provider = ? AND subject = ?", claims.Provider, claims.Subject).Count(&linked)
+		if linked > 0 {
+			utils.WriteError(w, http.StatusConflict, "IDENTITY_ALREADY_LINKED", "This provider account is already linked to another user")
+			return
+		}
+		identity = claims
+	}
+	isOAuth := identity != nil
+
+	// OAuth users authenticate with their provider, so they get a random password
+	generatedPassword := isOAuth && user.Password == ""
+	if generatedPassword {
+		randomPass, err := generateToken(32)
+		if err != nil {
+			log.Error().Err(err).Msg("RegisterUser: failed to generate random password for OAuth user")
+			utils.WriteError(w, http.StatusInternalServerError, "HASH_ERROR", "Unable to generate password")
+			return
+		}
+		user.Password = randomPass
 	}
 
 	// Validate and create the user
-	if !processUserCreation(w, &user) {
+	if !processUserCreation(w, &user, !generatedPassword) {
 		return // Error has already been written in processUserCreation
 	}
 
-	// For OAuth users: auto-verify and activate
 	if isOAuth {
-		user.Verified = true
-		user.Status = "Active"
-		if err := db.DB.Save(&user).Error; err != nil {
-			log.Error().Err(err).Msg("RegisterUser: failed to activate OAuth user")
+		if err := db.DB.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error; err != nil {
+			log.Warn().Err(err).Str("provider", identity.Provider).Msg("RegisterUser: provider identity already linked")
+			db.DB.Delete(&user)
+			utils.WriteError(w, http.StatusConflict, "IDENTITY_ALREADY_LINKED", "This provider account is already linked to another user")
+			return
+		}
+		// Auto-verify and activate when the provider has verified the email
+		if identity.EmailVerified {
+			user.Verified = true
+			user.Status = "Active"
+			if err := db.DB.Save(&user).Error; err != nil {
+				log.Error().Err(err).Msg("RegisterUser: failed to activate OAuth user")
+			}
 		}
 	}
 
@@ -191,33 +234,11 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	log.Info().Str("email", user.Email).Str("role", user.Role).Bool("oauth", isOAuth).Msg("RegisterUser: user successfully registered")
 
-	// Skip email verification for OAuth users (already verified by Google)
-	if !isOAuth {
-		verifyURL, err := generateAndSaveVerification(&user)
-		if err != nil {
+	// Skip email verification for OAuth users whose provider already verified the email
+	if !user.Verified {
+		if err := sendVerificationEmail(&user, false); err != nil {
 			log.Error().Err(err).Msg("RegisterUser: failed to generate or save verification token")
 		}
-
-		// Send registration email
-		if err := utils.SendTemplatedEmail(utils.SendTemplatedEmailParams{
-			Vars: []string{
-				"username=" + user.FirstName,
-				"email=" + user.Email,
-				"verify_link=" + verifyURL,
-			},
-			TemplatePath: cfg.Section("email").Key("template_path").String(),
-			ToEmail:      user.Email,
-			SMTPHost:     cfg.Section("email").Key("smtp_host").String(),
-			SMTPPort:     cfg.Section("email").Key("smtp_port").String(),
-			SMTPUser:     cfg.Section("email").Key("smtp_user").String(),
-			SMTPPass:     cfg.Section("email").Key("smtp_pass").String(),
-			FromEmail:    cfg.Section("email").Key("from_email").String(),
-			SendType:     utils.SendSMTP,
-		}); err != nil {
-			log.Error().Err(err).Msg("RegisterUser: failed to send registration email")
-		} else {
-			log.Info().Str("email", user.Email).Msg("RegisterUser: registration email sent")
-		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -230,7 +251,7 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 // VerifyEmail godoc
 // @Summary      Verify user email
-// @Description  Confirm registration by token
+// @Description  Confirm registration by token. Links expire after verification.token_ttl (default 24h); only the latest link sent to the user works.
 // @Tags         Actions for users
 // @Accept       json
 // @Produce      json
@@ -245,21 +266,24 @@ func VerifyEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var user models.User
-	if err := db.DB.Where("verification_token = ?", token).First(&user).Error; err != nil {
+	if err := db.DB.Where("verification_hash = ?", hashToken(token)).First(&user).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "INVALID_TOKEN", "Invalid or expired token")
 		return
 	}
-	if time.Since(user.TokenSentAt) > 24*time.Hour {
+	if time.Since(user.TokenSentAt) > Verification.TokenTTL {
 		utils.WriteError(w, http.StatusGone, "TOKEN_EXPIRED", "Token has expired")
 		return
 	}
-	user.Verified = true
-	user.VerificationToken = ""
-	user.Status = "Active"
-	if err := db.DB.Save(&user).Error; err != nil {
+	updates := map[string]interface{}{"verified": true, "verification_hash": ""}
+	// A blocked account stays blocked after verifying its email
+	if user.Status == "Disabled" {
+		updates["status"] = "Active"
+	}
+	if err := db.DB.Model(&user).Updates(updates).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to verify email")
 		return
 	}
+	auth.Principals.Invalidate(user.ID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
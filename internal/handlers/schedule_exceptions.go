@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/schedule"
+	"user-api/internal/sessionstate"
+	"user-api/internal/timezone"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ScheduleExceptionRequest is the body of POST /api/users/schedule-exceptions
+type ScheduleExceptionRequest struct {
+	Kind                string  `json:"kind"`      // off, override or extra
+	StartDate           string  `json:"startDate"` // "2025-08-01"
+	EndDate             string  `json:"endDate"`   // defaults to startDate
+	StartTime           *string `json:"startTime"` // "HH:MM"; leave out for a whole day off
+	EndTime             *string `json:"endTime"`
+	SlotDurationMinutes int     `json:"slotDurationMinutes"`
+	Reason              string  `json:"reason"`
+}
+
+// CreateScheduleException godoc
+// @Summary      Create a schedule exception
+// @Description  Allows a psychologist to change the weekly schedule on some dates: "off" blocks whole days (vacations, holidays) or startTime-endTime, "override" works only startTime-endTime instead of the templates, "extra" adds startTime-endTime. Dates and times are in the psychologist's time zone. Open slots in the time taken away are deleted; active sessions in it are listed in affectedSessions so they can be rescheduled.
+// @Tags         Schedule
+// @Accept       json
+// @Produce      json
+// @Param        body body ScheduleExceptionRequest true "Exception"
+// @Success      201 {object} map[string]interface{}
+// @Failure      400,401,403,500 {object} map[string]interface{}
+// @Router       /api/users/schedule-exceptions [post]
+// @Security     BearerAuth
+func CreateScheduleException(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "psychologist" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can manage schedule exceptions")
+		return
+	}
+
+	var req ScheduleExceptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
+		return
+	}
+	if req.EndDate == "" {
+		req.EndDate = req.StartDate
+	}
+	if req.SlotDurationMinutes <= 0 {
+		req.SlotDurationMinutes = 60
+	}
+	exception := models.ScheduleException{
+		PsychologistID:      principal.UserID,
+		Kind:                req.Kind,
+		StartDate:           req.StartDate,
+		EndDate:             req.EndDate,
+		StartTime:           req.StartTime,
+		EndTime:             req.EndTime,
+		SlotDurationMinutes: req.SlotDurationMinutes,
+		Reason:              req.Reason,
+	}
+	if err := schedule.Validate(exception); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_EXCEPTION", err.Error())
+		return
+	}
+
+	loc := psychologistLocation(db.DB, principal.UserID)
+	var removed int64
+	var affected []models.Session
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := conflicts.LockPsychologist(tx, principal.UserID); err != nil {
+			return err
+		}
+		if err := tx.Create(&exception).Error; err != nil {
+			return err
+		}
+		blocked := schedule.Blocked(exception, loc)
+		for _, b := range blocked {
+			result := tx.Where("psychologist_id = ? AND status = 'available' AND start_time < ? AND end_time > ?", principal.UserID, b.End, b.Start).
+				Delete(&models.Availability{})
+			if result.Error != nil {
+				return result.Error
+			}
+			removed += result.RowsAffected
+		}
+		var err error
+		affected, err = sessionsInRanges(tx, principal.UserID, blocked)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Uint64("psychologist_id", principal.UserID).Msg("Failed to create schedule exception")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create schedule exception")
+		return
+	}
+	log.Info().Uint64("exception_id", exception.ID).Uint64("psychologist_id", principal.UserID).Int64("removed_slots", removed).
+		Int("affected_sessions", len(affected)).Msg("Schedule exception created")
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":          true,
+		"data":             exception,
+		"removedSlots":     removed,
+		"affectedSessions": toSessionDTOs(affected, viewerLocation(r, principal.UserID)),
+	})
+}
+
+// GetMyScheduleExceptions godoc
+// @Summary      Get my schedule exceptions
+// @Description  Lists the psychologist's schedule exceptions that have not ended yet (all with ?all=true), each with the active sessions in the time it takes away
+// @Tags         Schedule
+// @Produce      json
+// @Param        all query bool false "Include past exceptions"
+// @Success      200 {array} map[string]interface{}
+// @Failure      401,403,500 {object} map[string]interface{}
+// @Router       /api/users/schedule-exceptions [get]
+// @Security     BearerAuth
+func GetMyScheduleExceptions(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "psychologist" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can view schedule exceptions")
+		return
+	}
+
+	loc := psychologistLocation(db.DB, principal.UserID)
+	query := db.DB.Where("psychologist_id = ?", principal.UserID)
+	if r.URL.Query().Get("all") != "true" {
+		query = query.Where("end_date >= ?", time.Now().In(loc).Format(schedule.DateLayout))
+	}
+	var exceptions []models.ScheduleException
+	if err := query.Order("start_date, start_time").Find(&exceptions).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to get schedule exceptions")
+		return
+	}
+
+	viewer := viewerLocation(r, principal.UserID)
+	result := make([]map[string]interface{}, len(exceptions))
+	for i, exception := range exceptions {
+		affected, err := sessionsInRanges(db.DB, principal.UserID, schedule.Blocked(exception, loc))
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to get schedule exceptions")
+			return
+		}
+		result[i] = map[string]interface{}{
+			"exception":        exception,
+			"affectedSessions": toSessionDTOs(affected, viewer),
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// DeleteScheduleException godoc
+// @Summary      Delete a schedule exception
+// @Description  Removes an exception. Slots deleted when it was created are not restored; generate them again from the templates.
+// @Tags         Schedule
+// @Produce      json
+// @Param        id path int true "Exception ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,404,500 {object} map[string]interface{}
+// @Router       /api/users/schedule-exceptions/{id} [delete]
+// @Security     BearerAuth
+func DeleteScheduleException(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	exceptionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid exception ID")
+		return
+	}
+
+	result := db.DB.Where("id = ? AND psychologist_id = ?", exceptionID, principal.UserID).Delete(&models.ScheduleException{})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to delete schedule exception")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Schedule exception not found")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// sessionsInRanges returns the active sessions of the psychologist overlapping any of the ranges
+func sessionsInRanges(tx *gorm.DB, psychologistID uint64, ranges []timezone.Range) ([]models.Session, error) {
+	sessions := []models.Session{}
+	if len(ranges) == 0 {
+		return sessions, nil
+	}
+	overlap := db.DB.Where("start_time < ? AND end_time > ?", ranges[0].End, ranges[0].Start)
+	for _, rg := range ranges[1:] {
+		overlap = overlap.Or("start_time < ? AND end_time > ?", rg.End, rg.Start)
+	}
+	err := tx.Preload("Client").
+		Where("psychologist_id = ? AND status IN ?", psychologistID, sessionstate.Active()).
+		Where(overlap).
+		Order("start_time").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// toSessionDTOs converts sessions for a response in the viewer's zone loc
+func toSessionDTOs(sessions []models.Session, loc *time.Location) []sessionDTO {
+	dtos := make([]sessionDTO, len(sessions))
+	for i, s := range sessions {
+		dtos[i] = toSessionDTO(s, loc)
+	}
+	return dtos
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Cancellation policy used when a psychologist has no portfolio, and the limits of the portfolio settings
+const (
+	defaultFreeCancelHours    = 24
+	defaultNoShowGraceMinutes = 15
+	maxFreeCancelHours        = 30 * 24
+	maxNoShowGraceMinutes     = 24 * 60
+)
+
+var errNoShowTooEarly = errors.New("the no-show grace period has not passed")
+
+// cancellationPolicy is a psychologist's cancellation and no-show policy
+type cancellationPolicy struct {
+	FreeWindow  time.Duration // client cancellations closer to the start are late
+	NoShowGrace time.Duration // how long after the start a no-show can be marked
+}
+
+// cancellationPolicyFor returns the policy of the psychologist's portfolio, or the default one
+func cancellationPolicyFor(tx *gorm.DB, psychologistID uint64) cancellationPolicy {
+	policy := cancellationPolicy{
+		FreeWindow:  defaultFreeCancelHours * time.Hour,
+		NoShowGrace: defaultNoShowGraceMinutes * time.Minute,
+	}
+	var portfolio models.Portfolio
+	if err := tx.Select("free_cancel_hours", "no_show_grace_minutes").
+		Where("psychologist_id = ?", psychologistID).First(&portfolio).Error; err == nil {
+		policy.FreeWindow = time.Duration(portfolio.FreeCancelHours) * time.Hour
+		policy.NoShowGrace = time.Duration(portfolio.NoShowGraceMinutes) * time.Minute
+	}
+	return policy
+}
+
+// applyCancellationPolicy copies the cancellation policy fields of a portfolio update request, writing
+// an error response and returning false if they are out of range
+func applyCancellationPolicy(w http.ResponseWriter, portfolio *models.Portfolio, freeCancelHours, noShowGraceMinutes *int) bool {
+	if freeCancelHours != nil && (*freeCancelHours < 0 || *freeCancelHours > maxFreeCancelHours) {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_CANCELLATION_POLICY", "freeCancelHours must be between 0 and 720")
+		return false
+	}
+	if noShowGraceMinutes != nil && (*noShowGraceMinutes < 0 || *noShowGraceMinutes > maxNoShowGraceMinutes) {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_CANCELLATION_POLICY", "noShowGraceMinutes must be between 0 and 1440")
+		return false
+	}
+	if freeCancelHours != nil {
+		portfolio.FreeCancelHours = *freeCancelHours
+	}
+	if noShowGraceMinutes != nil {
+		portfolio.NoShowGraceMinutes = *noShowGraceMinutes
+	}
+	return true
+}
+
+// MarkNoShow godoc
+// @Summary      Mark a session as no-show
+// @Description  Allows the psychologist to record that the client did not attend. Possible once the no-show grace period of the psychologist's portfolio (noShowGraceMinutes) has passed since the start.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Param        body body SessionStatusRequest false "Optional reason"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/no-show [put]
+// @Security     BearerAuth
+func MarkNoShow(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "psychologist" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can mark no-shows")
+		return
+	}
+	changeSessionStatus(w, r, principal.UserID, func(sessionstate.Actor) string { return sessionstate.NoShow }, "Session marked as no-show")
+}
+
+// clientStatsDTO sums up the sessions of one client with the psychologist
+type clientStatsDTO struct {
+	ClientID      uint64     `json:"clientId"`
+	ClientName    string     `json:"clientName" gorm:"-"`
+	Total         int64      `json:"totalSessions"`
+	Completed     int64      `json:"completed"`
+	FreeCancels   int64      `json:"freeCancels"`
+	LateCancels   int64      `json:"lateCancels"`
+	NoShows       int64      `json:"noShows"`
+	LastSessionAt *time.Time `json:"lastSessionAt"`
+}
+
+// GetClientSessionStats godoc
+// @Summary      Get per-client session statistics
+// @Description  Returns, for every client of the psychologist, the number of sessions, completed sessions, free and late cancellations by the client, and no-shows
+// @Tags         Sessions
+// @Produce      json
+// @Param        clientId query int false "Only this client"
+// @Success      200 {array} clientStatsDTO
+// @Failure      400,401,403,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/clients/stats [get]
+// @Security     BearerAuth
+func GetClientSessionStats(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "psychologist" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists have client statistics")
+		return
+	}
+
+	query := db.DB.Model(&models.Session{}).
+		Select(`client_id, COUNT(*) AS total, SUM(status = ?) AS completed,
+			SUM(status = ? AND cancellation = ?) AS free_cancels, SUM(status = ? AND cancellation = ?) AS late_cancels,
+			SUM(status = ?) AS no_shows, MAX(start_time) AS last_session_at`,
+			sessionstate.Completed,
+			sessionstate.CanceledByClient, sessionstate.CancellationFree,
+			sessionstate.CanceledByClient, sessionstate.CancellationLate,
+			sessionstate.NoShow).
+		Where("psychologist_id = ? AND client_id IS NOT NULL", principal.UserID).
+		Group("client_id").
+		Order("client_id")
+	if raw := r.URL.Query().Get("clientId"); raw != "" {
+		clientID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid client ID")
+			return
+		}
+		query = query.Where("client_id = ?", clientID)
+	}
+
+	stats := []clientStatsDTO{}
+	if err := query.Scan(&stats).Error; err != nil {
+		log.Error().Err(err).Uint64("psychologist_id", principal.UserID).Msg("GetClientSessionStats: failed to count sessions")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load client statistics")
+		return
+	}
+
+	if len(stats) > 0 {
+		ids := make([]uint64, len(stats))
+		for i, row := range stats {
+			ids[i] = row.ClientID
+		}
+		var clients []models.User
+		db.DB.Select("id", "first_name", "last_name").Where("id IN ?", ids).Find(&clients)
+		names := make(map[uint64]string, len(clients))
+		for _, client := range clients {
+			names[client.ID] = client.FirstName + " " + client.LastName
+		}
+		for i := range stats {
+			stats[i].ClientName = names[stats[i].ClientID]
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, stats)
+}
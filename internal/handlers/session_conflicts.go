@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// maxBufferMinutes limits the buffer a psychologist keeps between sessions
+const maxBufferMinutes = 4 * 60
+
+// bufferFor returns the free time the psychologist keeps between sessions (portfolio bufferMinutes)
+func bufferFor(tx *gorm.DB, psychologistID uint64) time.Duration {
+	var portfolio models.Portfolio
+	if err := tx.Select("buffer_minutes").Where("psychologist_id = ?", psychologistID).First(&portfolio).Error; err != nil {
+		return 0
+	}
+	return time.Duration(portfolio.BufferMinutes) * time.Minute
+}
+
+// reserveCalendar locks the psychologist's calendar for the rest of the transaction and checks that the
+// range of q is free, keeping the psychologist's buffer. Returns a *conflicts.Error when it is not.
+func reserveCalendar(tx *gorm.DB, q conflicts.Query) error {
+	if err := conflicts.LockPsychologist(tx, q.PsychologistID); err != nil {
+		return err
+	}
+	q.Buffer = bufferFor(tx, q.PsychologistID)
+	return conflicts.Check(tx, q)
+}
+
+// writeConflictError writes the 409 response listing the conflicts if err is a *conflicts.Error,
+// and reports whether it did
+func writeConflictError(w http.ResponseWriter, err error) bool {
+	var conflictErr *conflicts.Error
+	if !errors.As(err, &conflictErr) {
+		return false
+	}
+	utils.WriteErrorParams(w, http.StatusConflict, "TIME_CONFLICT", "The psychologist has another session or slot at this time",
+		map[string]interface{}{"conflicts": conflictErr.Conflicts})
+	return true
+}
+
+// applyBufferMinutes copies the bufferMinutes field of a portfolio update request, writing an error
+// response and returning false if it is out of range
+func applyBufferMinutes(w http.ResponseWriter, portfolio *models.Portfolio, bufferMinutes *int) bool {
+	if bufferMinutes == nil {
+		return true
+	}
+	if *bufferMinutes < 0 || *bufferMinutes > maxBufferMinutes {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_BUFFER", "bufferMinutes must be between 0 and 240")
+		return false
+	}
+	portfolio.BufferMinutes = *bufferMinutes
+	return true
+}
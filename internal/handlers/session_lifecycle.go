@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxSessionReasonLength is the size of session_events.reason
+const maxSessionReasonLength = 500
+
+var (
+	errSessionNotFound     = errors.New("session not found")
+	errSessionAccessDenied = errors.New("not a participant of the session")
+)
+
+// SessionStatusRequest is the optional body of the session status endpoints
+type SessionStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+// sessionActorFor returns the role the user has in the session, or false if the user takes no part in it
+func sessionActorFor(session *models.Session, userID uint64) (sessionstate.Actor, bool) {
+	if session.PsychologistID == userID {
+		return sessionstate.ActorPsychologist, true
+	}
+	if session.ClientID != nil && *session.ClientID == userID {
+		return sessionstate.ActorClient, true
+	}
+	return "", false
+}
+
+// recordSessionEvent adds a row to the history of a session
+func recordSessionEvent(tx *gorm.DB, sessionID uint64, from, to string, actor sessionstate.Actor, actorID *uint64, reason string) error {
+	return tx.Create(&models.SessionEvent{
+		SessionID:  sessionID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorType:  string(actor),
+		ActorID:    actorID,
+		Reason:     reason,
+	}).Error
+}
+
+// transitionSession moves a session, locked by the caller's transaction, to a new status and records
+// the change. A cancellation is classified against the psychologist's cancellation policy and gives the
+// availability slot back, a confirmation needs the time to be free, a no-show waits for the policy's grace
+// period, and a session that can no longer move drops its pending reschedule proposal. Returns sessionstate
+// errors when the state machine does not allow the change, and a *conflicts.Error when the time is taken.
+func transitionSession(tx *gorm.DB, session *models.Session, to string, actor sessionstate.Actor, actorID *uint64, reason string) error {
+	if err := sessionstate.Check(session.Status, to, actor); err != nil {
+		return err
+	}
+	from := session.Status
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	// The calendar may have changed since the request was made
+	if to == sessionstate.Confirmed {
+		q := conflicts.Query{PsychologistID: session.PsychologistID, Start: session.StartTime, End: session.EndTime, IgnoreSessionID: session.ID}
+		if session.AvailabilityID != nil {
+			q.IgnoreSlotID = *session.AvailabilityID
+		}
+		if err := reserveCalendar(tx, q); err != nil {
+			return err
+		}
+	}
+	if to == sessionstate.NoShow {
+		policy := cancellationPolicyFor(tx, session.PsychologistID)
+		if now.Before(session.StartTime.Add(policy.NoShowGrace)) {
+			return errNoShowTooEarly
+		}
+	}
+	if sessionstate.IsCanceled(to) {
+		policy := cancellationPolicyFor(tx, session.PsychologistID)
+		cancellation := sessionstate.ClassifyCancellation(from, session.StartTime, now, policy.FreeWindow)
+		updates["canceled_by"], updates["canceled_at"], updates["cancellation"] = actorID, now, cancellation
+		session.CanceledBy, session.CanceledAt, session.Cancellation = actorID, &now, &cancellation
+	}
+	if err := tx.Model(&models.Session{}).Where("id = ?", session.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if sessionstate.IsCanceled(to) && session.AvailabilityID != nil {
+		if err := tx.Model(&models.Availability{}).Where("id = ?", *session.AvailabilityID).Update("status", "available").Error; err != nil {
+			return err
+		}
+	}
+	// A session that has started or ended can no longer move
+	if to == sessionstate.InProgress || sessionstate.IsFinal(to) {
+		var resolvedBy uint64
+		if actorID != nil {
+			resolvedBy = *actorID
+		}
+		if err := cancelPendingReschedules(tx, session.ID, resolvedBy); err != nil {
+			return err
+		}
+	}
+	if err := recordSessionEvent(tx, session.ID, from, to, actor, actorID, reason); err != nil {
+		return err
+	}
+	session.Status = to
+	return nil
+}
+
+// parseSessionStatusRequest reads the session ID from the URL and the optional body of a status change.
+// On failure it writes the error response and returns false.
+func parseSessionStatusRequest(w http.ResponseWriter, r *http.Request) (uint64, SessionStatusRequest, bool) {
+	var req SessionStatusRequest
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
+		return 0, req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
+		return 0, req, false
+	}
+	if len(req.Reason) > maxSessionReasonLength {
+		utils.WriteError(w, http.StatusBadRequest, "REASON_TOO_LONG", "reason must be at most 500 characters")
+		return 0, req, false
+	}
+	return sessionID, req, true
+}
+
+// changeSessionStatus applies a status change to the session in the URL on behalf of the current user.
+// target picks the new status from the user's role in the session.
+func changeSessionStatus(w http.ResponseWriter, r *http.Request, userID uint64, target func(sessionstate.Actor) string, message string) {
+	sessionID, req, ok := parseSessionStatusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var session models.Session
+	var from, to string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, sessionID).Error; err != nil {
+			return errSessionNotFound
+		}
+		actor, ok := sessionActorFor(&session, userID)
+		if !ok {
+			return errSessionAccessDenied
+		}
+		from, to = session.Status, target(actor)
+		return transitionSession(tx, &session, to, actor, &userID, req.Reason)
+	})
+	switch {
+	case err == nil:
+	case writeConflictError(w, err):
+		return
+	case errors.Is(err, errSessionNotFound):
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	case errors.Is(err, errSessionAccessDenied):
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this session")
+		return
+	case errors.Is(err, sessionstate.ErrActorNotAllowed):
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You can't move this session to "+to)
+		return
+	case errors.Is(err, sessionstate.ErrInvalidTransition):
+		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "Session is "+from+" and can't move to "+to)
+		return
+	case errors.Is(err, errNoShowTooEarly):
+		utils.WriteError(w, http.StatusConflict, "TOO_EARLY", "A no-show can be marked only after the grace period past the start time")
+		return
+	default:
+		log.Error().Err(err).Uint64("session_id", sessionID).Str("to", to).Msg("changeSessionStatus: failed to change status")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update session")
+		return
+	}
+	log.Info().Uint64("session_id", session.ID).Uint64("user_id", userID).Str("from", from).Str("to", to).Msg("Session status changed")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": message,
+		"data":    toSessionDTO(session, viewerLocation(r, userID)),
+	})
+}
+
+// StartSession godoc
+// @Summary      Start a session
+// @Description  Allows the psychologist to mark a confirmed or rescheduled session as in progress
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Param        body body SessionStatusRequest false "Optional reason"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/start [put]
+// @Security     BearerAuth
+func StartSession(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "psychologist" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can start sessions")
+		return
+	}
+	changeSessionStatus(w, r, principal.UserID, func(sessionstate.Actor) string { return sessionstate.InProgress }, "Session started")
+}
+
+// sessionEventDTO is one entry of a session history
+type sessionEventDTO struct {
+	models.SessionEvent
+	ActorName string `json:"actorName,omitempty"`
+}
+
+// GetSessionHistory godoc
+// @Summary      Get session history
+// @Description  Returns every status change of a session, oldest first: from and to status, actor (client, psychologist or system), reason and time. Available to both participants.
+// @Tags         Sessions
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Success      200 {array} sessionEventDTO
+// @Failure      400,401,403,404,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/history [get]
+// @Security     BearerAuth
+func GetSessionHistory(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
+		return
+	}
+
+	var session models.Session
+	if err := db.DB.First(&session, sessionID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+	if _, ok := sessionActorFor(&session, principal.UserID); !ok {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this session")
+		return
+	}
+
+	var events []models.SessionEvent
+	if err := db.DB.Where("session_id = ?", session.ID).Order("created_at ASC, id ASC").Find(&events).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load session history")
+		return
+	}
+
+	// Only the two participants can appear as actors
+	names := make(map[uint64]string, 2)
+	var people []models.User
+	ids := []uint64{session.PsychologistID}
+	if session.ClientID != nil {
+		ids = append(ids, *session.ClientID)
+	}
+	db.DB.Select("id", "first_name", "last_name").Where("id IN ?", ids).Find(&people)
+	for _, person := range people {
+		names[person.ID] = person.FirstName + " " + person.LastName
+	}
+
+	result := make([]sessionEventDTO, len(events))
+	for i, event := range events {
+		result[i] = sessionEventDTO{SessionEvent: event}
+		if event.ActorID != nil {
+			result[i].ActorName = names[*event.ActorID]
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, result)
+}
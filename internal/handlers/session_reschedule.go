@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+	"user-api/internal/timezone"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionPolicy holds the session booking rules (config section [sessions])
+type SessionPolicy struct {
+	// RescheduleApproval makes a reschedule a proposal that the other participant must approve
+	RescheduleApproval bool
+}
+
+// Sessions is the session policy in use
+var Sessions SessionPolicy
+
+func newSessionPolicy(section *ini.Section) SessionPolicy {
+	return SessionPolicy{
+		RescheduleApproval: section.Key("reschedule_requires_approval").MustBool(true),
+	}
+}
+
+var (
+	errRescheduleNotFound = errors.New("no pending reschedule")
+	errReschedulePending  = errors.New("a reschedule is already pending")
+	errRescheduleOwn      = errors.New("the requester cannot approve their own reschedule")
+	errScheduleEnforced   = errors.New("psychologist accepts slot bookings only")
+	errTimeInPast         = errors.New("time is in the past")
+)
+
+// RescheduleSessionRequest is the body of PUT /api/users/sessions/{id}/reschedule.
+// Either AvailabilityID or StartTime and EndTime (RFC3339) must be given.
+type RescheduleSessionRequest struct {
+	AvailabilityID *uint64 `json:"availabilityId"`
+	StartTime      string  `json:"startTime"`
+	EndTime        string  `json:"endTime"`
+	Reason         string  `json:"reason"`
+}
+
+// rescheduleTarget is the time a session moves to
+type rescheduleTarget struct {
+	AvailabilityID *uint64
+	Start, End     time.Time
+}
+
+// RescheduleSession godoc
+// @Summary      Reschedule a session
+// @Description  Moves a session to another availability slot of the same psychologist, or to a free time range when the psychologist does not enforce the schedule. Old and new slot are swapped in one transaction. When sessions.reschedule_requires_approval is set, the move is a proposal (202) that the other participant approves or declines; the proposed slot is reserved meanwhile. A client moving their own pending request needs no approval. Both participants are notified by email.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Param        body body RescheduleSessionRequest true "New slot or time range"
+// @Success      200,202 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/reschedule [put]
+// @Security     BearerAuth
+func RescheduleSession(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
+		return
+	}
+
+	var req RescheduleSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
+		return
+	}
+	if len(req.Reason) > maxSessionReasonLength {
+		utils.WriteError(w, http.StatusBadRequest, "REASON_TOO_LONG", "reason must be at most 500 characters")
+		return
+	}
+	var target rescheduleTarget
+	switch {
+	case req.AvailabilityID != nil && req.StartTime == "" && req.EndTime == "":
+		target.AvailabilityID = req.AvailabilityID
+	case req.AvailabilityID == nil && req.StartTime != "" && req.EndTime != "":
+		if target.Start, err = time.Parse(time.RFC3339, req.StartTime); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "startTime must be RFC3339")
+			return
+		}
+		if target.End, err = time.Parse(time.RFC3339, req.EndTime); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "endTime must be RFC3339")
+			return
+		}
+		if !target.End.After(target.Start) {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_RANGE", "endTime must be after startTime")
+			return
+		}
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "Give either availabilityId or startTime and endTime")
+		return
+	}
+
+	var session models.Session
+	var proposal *models.SessionReschedule
+	var from string
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, sessionID).Error; err != nil {
+			return errSessionNotFound
+		}
+		actor, ok := sessionActorFor(&session, principal.UserID)
+		if !ok {
+			return errSessionAccessDenied
+		}
+		from = session.Status
+		to := rescheduledStatus(&session, actor)
+		if to != session.Status {
+			if err := sessionstate.Check(session.Status, to, actor); err != nil {
+				return err
+			}
+		}
+		var pending int64
+		tx.Model(&models.SessionReschedule{}).Where("session_id = ? AND status = 'pending'", session.ID).Count(&pending)
+		if pending > 0 {
+			return errReschedulePending
+		}
+		if err := reserveRescheduleTarget(tx, &session, &target); err != nil {
+			return err
+		}
+
+		if Sessions.RescheduleApproval && !(session.Status == sessionstate.Pending && actor == sessionstate.ActorClient) {
+			proposal = &models.SessionReschedule{
+				SessionID:      session.ID,
+				RequestedBy:    principal.UserID,
+				RequesterType:  string(actor),
+				AvailabilityID: target.AvailabilityID,
+				StartTime:      target.Start,
+				EndTime:        target.End,
+				Reason:         req.Reason,
+				Status:         "pending",
+			}
+			return tx.Create(proposal).Error
+		}
+		return applyReschedule(tx, &session, target, to, actor, principal.UserID, req.Reason)
+	})
+	if writeRescheduleError(w, err, sessionID) {
+		return
+	}
+
+	if proposal != nil {
+		log.Info().Uint64("session_id", session.ID).Uint64("user_id", principal.UserID).Uint64("proposal_id", proposal.ID).Msg("RescheduleSession: reschedule proposed")
+		notifyReschedule(&session, proposal.StartTime, proposal.EndTime, principal.UserID, true)
+		utils.WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+			"success":    true,
+			"message":    "Reschedule proposed. Waiting for the other participant's approval.",
+			"data":       toSessionDTO(session, viewerLocation(r, principal.UserID)),
+			"reschedule": proposal,
+		})
+		return
+	}
+
+	log.Info().Uint64("session_id", session.ID).Uint64("user_id", principal.UserID).Str("from", from).Str("to", session.Status).Msg("RescheduleSession: session rescheduled")
+	notifyReschedule(&session, session.StartTime, session.EndTime, principal.UserID, false)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Session rescheduled",
+		"data":    toSessionDTO(session, viewerLocation(r, principal.UserID)),
+	})
+}
+
+// ApproveReschedule godoc
+// @Summary      Approve a reschedule
+// @Description  The other participant accepts the pending reschedule proposal of a session; the session moves to the proposed time
+// @Tags         Sessions
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/reschedule/approve [put]
+// @Security     BearerAuth
+func ApproveReschedule(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
+		return
+	}
+
+	var session models.Session
+	var proposal models.SessionReschedule
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		actor, err := lockPendingReschedule(tx, sessionID, principal.UserID, &session, &proposal)
+		if err != nil {
+			return err
+		}
+		if string(actor) == proposal.RequesterType {
+			return errRescheduleOwn
+		}
+		requester := sessionstate.Actor(proposal.RequesterType)
+		to := rescheduledStatus(&session, requester)
+		if to != session.Status {
+			if err := sessionstate.Check(session.Status, to, requester); err != nil {
+				return err
+			}
+		}
+		// A free time range was not reserved, so it must still be free
+		if proposal.AvailabilityID == nil {
+			if err := reserveCalendar(tx, rescheduleQuery(&session, proposal.StartTime, proposal.EndTime)); err != nil {
+				return err
+			}
+		}
+		if err := resolveReschedule(tx, &proposal, "approved", principal.UserID); err != nil {
+			return err
+		}
+		target := rescheduleTarget{AvailabilityID: proposal.AvailabilityID, Start: proposal.StartTime, End: proposal.EndTime}
+		return applyReschedule(tx, &session, target, to, requester, proposal.RequestedBy, proposal.Reason)
+	})
+	if writeRescheduleError(w, err, sessionID) {
+		return
+	}
+	log.Info().Uint64("session_id", session.ID).Uint64("user_id", principal.UserID).Uint64("proposal_id", proposal.ID).Msg("ApproveReschedule: session rescheduled")
+	notifyReschedule(&session, session.StartTime, session.EndTime, principal.UserID, false)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Session rescheduled",
+		"data":    toSessionDTO(session, viewerLocation(r, principal.UserID)),
+	})
+}
+
+// DeclineReschedule godoc
+// @Summary      Decline a reschedule
+// @Description  The other participant declines the pending reschedule proposal, or its author withdraws it. The session keeps its time and the reserved slot is released.
+// @Tags         Sessions
+// @Produce      json
+// @Param        id path int true "Session ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/{id}/reschedule/decline [put]
+// @Security     BearerAuth
+func DeclineReschedule(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
+		return
+	}
+
+	var session models.Session
+	var proposal models.SessionReschedule
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		actor, err := lockPendingReschedule(tx, sessionID, principal.UserID, &session, &proposal)
+		if err != nil {
+			return err
+		}
+		status := "declined"
+		if string(actor) == proposal.RequesterType {
+			status = "canceled"
+		}
+		return resolveReschedule(tx, &proposal, status, principal.UserID)
+	})
+	if writeRescheduleError(w, err, sessionID) {
+		return
+	}
+	log.Info().Uint64("session_id", session.ID).Uint64("user_id", principal.UserID).Str("status", proposal.Status).Msg("DeclineReschedule: reschedule closed")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Reschedule " + proposal.Status,
+		"data":    toSessionDTO(session, viewerLocation(r, principal.UserID)),
+	})
+}
+
+// rescheduledStatus returns the status a session has after the actor moves it: a client moving their own
+// pending request keeps it pending, any other move makes the session rescheduled
+func rescheduledStatus(session *models.Session, actor sessionstate.Actor) string {
+	if session.Status == sessionstate.Pending && actor == sessionstate.ActorClient {
+		return sessionstate.Pending
+	}
+	return sessionstate.Rescheduled
+}
+
+// reserveRescheduleTarget checks that the target is free and books the target slot. For a slot, target
+// times are filled from the slot.
+func reserveRescheduleTarget(tx *gorm.DB, session *models.Session, target *rescheduleTarget) error {
+	if target.AvailabilityID != nil {
+		var slot models.Availability
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND psychologist_id = ? AND status = 'available'", *target.AvailabilityID, session.PsychologistID).
+			First(&slot).Error; err != nil {
+			return errSlotUnavailable
+		}
+		if !slot.StartTime.After(time.Now()) {
+			return errTimeInPast
+		}
+		target.Start, target.End = slot.StartTime, slot.EndTime
+		return tx.Model(&slot).Update("status", "booked").Error
+	}
+
+	if !target.Start.After(time.Now()) {
+		return errTimeInPast
+	}
+	var portfolio models.Portfolio
+	if err := tx.Where("psychologist_id = ?", session.PsychologistID).First(&portfolio).Error; err == nil && portfolio.ScheduleEnforced {
+		return errScheduleEnforced
+	}
+	return reserveCalendar(tx, rescheduleQuery(session, target.Start, target.End))
+}
+
+// rescheduleQuery is the conflict check for moving a session to a free time range; the session does not
+// conflict with itself
+func rescheduleQuery(session *models.Session, start, end time.Time) conflicts.Query {
+	q := conflicts.Query{PsychologistID: session.PsychologistID, Start: start, End: end, IgnoreSessionID: session.ID}
+	if session.AvailabilityID != nil {
+		q.IgnoreSlotID = *session.AvailabilityID
+	}
+	return q
+}
+
+// applyReschedule moves a locked session to the target (already reserved), releases its previous slot
+// and records the move in the session history
+func applyReschedule(tx *gorm.DB, session *models.Session, target rescheduleTarget, to string, actor sessionstate.Actor, actorID uint64, reason string) error {
+	if session.AvailabilityID != nil && (target.AvailabilityID == nil || *target.AvailabilityID != *session.AvailabilityID) {
+		if err := tx.Model(&models.Availability{}).Where("id = ?", *session.AvailabilityID).Update("status", "available").Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&models.Session{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+		"availability_id": target.AvailabilityID,
+		"start_time":      target.Start,
+		"end_time":        target.End,
+		"status":          to,
+	}).Error; err != nil {
+		return err
+	}
+	start := target.Start
+	if err := tx.Create(&models.SessionEvent{
+		SessionID:  session.ID,
+		FromStatus: session.Status,
+		ToStatus:   to,
+		ActorType:  string(actor),
+		ActorID:    &actorID,
+		Reason:     reason,
+		StartTime:  &start,
+	}).Error; err != nil {
+		return err
+	}
+	session.AvailabilityID, session.StartTime, session.EndTime, session.Status = target.AvailabilityID, target.Start, target.End, to
+	return nil
+}
+
+// lockPendingReschedule locks a session and its pending reschedule proposal and returns the user's role in the session
+func lockPendingReschedule(tx *gorm.DB, sessionID, userID uint64, session *models.Session, proposal *models.SessionReschedule) (sessionstate.Actor, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(session, sessionID).Error; err != nil {
+		return "", errSessionNotFound
+	}
+	actor, ok := sessionActorFor(session, userID)
+	if !ok {
+		return "", errSessionAccessDenied
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("session_id = ? AND status = 'pending'", session.ID).First(proposal).Error; err != nil {
+		return "", errRescheduleNotFound
+	}
+	return actor, nil
+}
+
+// resolveReschedule closes a pending proposal. A slot reserved by a proposal that is not approved is released.
+func resolveReschedule(tx *gorm.DB, proposal *models.SessionReschedule, status string, resolvedBy uint64) error {
+	now := time.Now()
+	if err := tx.Model(proposal).Updates(map[string]interface{}{
+		"status":      status,
+		"resolved_by": resolvedBy,
+		"resolved_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	if status != "approved" && proposal.AvailabilityID != nil {
+		if err := tx.Model(&models.Availability{}).Where("id = ?", *proposal.AvailabilityID).Update("status", "available").Error; err != nil {
+			return err
+		}
+	}
+	proposal.Status, proposal.ResolvedBy, proposal.ResolvedAt = status, &resolvedBy, &now
+	return nil
+}
+
+// cancelPendingReschedules closes the pending proposal of a session that can no longer move
+func cancelPendingReschedules(tx *gorm.DB, sessionID, actorID uint64) error {
+	var proposals []models.SessionReschedule
+	if err := tx.Where("session_id = ? AND status = 'pending'", sessionID).Find(&proposals).Error; err != nil {
+		return err
+	}
+	for i := range proposals {
+		if err := resolveReschedule(tx, &proposals[i], "canceled", actorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRescheduleError writes the response for a failed reschedule transaction and reports whether there was an error
+func writeRescheduleError(w http.ResponseWriter, err error, sessionID uint64) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeConflictError(w, err):
+	case errors.Is(err, errSessionNotFound):
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+	case errors.Is(err, errSessionAccessDenied):
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this session")
+	case errors.Is(err, errRescheduleNotFound):
+		utils.WriteError(w, http.StatusNotFound, "RESCHEDULE_NOT_FOUND", "This session has no pending reschedule")
+	case errors.Is(err, errRescheduleOwn):
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "The other participant must approve the reschedule")
+	case errors.Is(err, errReschedulePending):
+		utils.WriteError(w, http.StatusConflict, "RESCHEDULE_PENDING", "This session already has a pending reschedule")
+	case errors.Is(err, errSlotUnavailable):
+		utils.WriteError(w, http.StatusConflict, "SLOT_NOT_FOUND_OR_BOOKED", "This time slot is no longer available")
+	case errors.Is(err, errScheduleEnforced):
+		utils.WriteError(w, http.StatusConflict, "SCHEDULE_ENFORCED", "This psychologist requires booking through available slots only")
+	case errors.Is(err, errTimeInPast):
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "The new time must be in the future")
+	case errors.Is(err, sessionstate.ErrActorNotAllowed), errors.Is(err, sessionstate.ErrInvalidTransition):
+		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "This session can no longer be rescheduled")
+	default:
+		log.Error().Err(err).Uint64("session_id", sessionID).Msg("Failed to reschedule session")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to reschedule session")
+	}
+	return true
+}
+
+// notifyReschedule emails both participants about a move (proposal or done) made by actorID
+func notifyReschedule(session *models.Session, start, end time.Time, actorID uint64, proposal bool) {
+	ids := []uint64{session.PsychologistID}
+	if session.ClientID != nil {
+		ids = append(ids, *session.ClientID)
+	}
+	var people []models.User
+	if err := db.DB.Where("id IN ?", ids).Find(&people).Error; err != nil {
+		log.Error().Err(err).Uint64("session_id", session.ID).Msg("notifyReschedule: failed to load participants")
+		return
+	}
+	var actorName string
+	for _, person := range people {
+		if person.ID == actorID {
+			actorName = person.FirstName + " " + person.LastName
+		}
+	}
+
+	subject, templateKey, templateDefault := "Your session was rescheduled", "session_rescheduled_template_path", "./templates/session-rescheduled.html"
+	if proposal {
+		subject, templateKey, templateDefault = "A new time is proposed for your session", "session_reschedule_request_template_path", "./templates/session-reschedule-request.html"
+	}
+	templatePath := cfg.Section("email").Key(templateKey).MustString(templateDefault)
+	sessionsURL := cfg.Section("app").Key("frontend_url").String() + "/profile"
+	sessionID := session.ID
+
+	go func() {
+		for _, person := range people {
+			// Each participant gets the time in their own zone
+			loc := timezone.Resolve(person.TimeZone)
+			if err := utils.SendEmail(person.Email, subject, templatePath, []string{
+				"username=" + person.FirstName,
+				"actor_name=" + actorName,
+				"start_time=" + start.In(loc).Format("2006-01-02 15:04 MST"),
+				"end_time=" + end.In(loc).Format("15:04 MST"),
+				"sessions_link=" + sessionsURL,
+			}); err != nil {
+				log.Error().Err(err).Uint64("session_id", sessionID).Uint64("user_id", person.ID).Msg("notifyReschedule: failed to send email")
+			}
+		}
+	}()
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/recurrence"
+	"user-api/internal/sessionstate"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errSeriesConflict  = errors.New("some occurrences of the series are not available")
+	errNotInSeries     = errors.New("session is not part of a series")
+	errNothingToCancel = errors.New("no occurrence left to cancel")
+)
+
+// BookSeriesRequest is the body of POST /api/users/sessions/series. The first occurrence is either an
+// availability slot (AvailabilityID) or a free time range with a psychologist (PsychologistID, StartTime,
+// EndTime). The series repeats Count times or until Until (RFC3339, or YYYY-MM-DD in the client's time zone).
+type BookSeriesRequest struct {
+	AvailabilityID *uint64 `json:"availabilityId"`
+	PsychologistID uint64  `json:"psychologistId"`
+	StartTime      string  `json:"startTime"`
+	EndTime        string  `json:"endTime"`
+	Frequency      string  `json:"frequency"` // weekly or biweekly
+	Count          int     `json:"count"`
+	Until          string  `json:"until"`
+	ClientNotes    string  `json:"clientNotes"`
+	// SkipConflicts books the available occurrences instead of failing when some are taken
+	SkipConflicts bool `json:"skipConflicts"`
+}
+
+// seriesConflict is an occurrence that cannot be booked
+type seriesConflict struct {
+	StartTime time.Time            `json:"startTime"`
+	Reason    string               `json:"reason"`              // slot_unavailable or time_conflict
+	Conflicts []conflicts.Conflict `json:"conflicts,omitempty"` // what is in the way of a free time range
+}
+
+// BookSessionSeries godoc
+// @Summary      Book a recurring session series
+// @Description  Allows a client to book a weekly or biweekly series, bounded by a count or an end date (at most 52 occurrences). Starting from an availability slot, every occurrence books the slot of the same psychologist at the same wall clock time in the psychologist's time zone; starting from a free time range, every occurrence is a pending request. All occurrences are reserved in one transaction. If some are not available the request fails with 409 SERIES_CONFLICT listing them in params.conflicts, unless skipConflicts is set, in which case the others are booked and the conflicts are returned.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param        body body BookSeriesRequest true "First occurrence and repeat rule"
+// @Success      201 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/series [post]
+// @Security     BearerAuth
+func BookSessionSeries(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if principal.Role != "client" {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only clients can book sessions")
+		return
+	}
+	clientID := principal.UserID
+
+	var req BookSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON format")
+		return
+	}
+	rule := recurrence.Rule{Frequency: req.Frequency, Count: req.Count}
+	if req.Until != "" {
+		until, err := parseSeriesUntil(req.Until, viewerLocation(r, principal.UserID))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "until must be RFC3339 or YYYY-MM-DD")
+			return
+		}
+		rule.Until = &until
+	}
+
+	series := models.SessionSeries{ClientID: principal.UserID, Frequency: req.Frequency}
+	var freeTime bool
+	switch {
+	case req.AvailabilityID != nil:
+		var slot models.Availability
+		if err := db.DB.First(&slot, *req.AvailabilityID).Error; err != nil {
+			utils.WriteError(w, http.StatusNotFound, "SLOT_NOT_FOUND_OR_BOOKED", "This time slot is no longer available")
+			return
+		}
+		series.PsychologistID, series.StartTime, series.EndTime = slot.PsychologistID, slot.StartTime, slot.EndTime
+	case req.PsychologistID != 0 && req.StartTime != "" && req.EndTime != "":
+		var err error
+		if series.StartTime, err = time.Parse(time.RFC3339, req.StartTime); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "startTime must be RFC3339")
+			return
+		}
+		if series.EndTime, err = time.Parse(time.RFC3339, req.EndTime); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "endTime must be RFC3339")
+			return
+		}
+		if !series.EndTime.After(series.StartTime) {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_RANGE", "endTime must be after startTime")
+			return
+		}
+		var portfolio models.Portfolio
+		if err := db.DB.Where("psychologist_id = ?", req.PsychologistID).First(&portfolio).Error; err != nil {
+			utils.WriteError(w, http.StatusNotFound, "PSYCHOLOGIST_NOT_FOUND", "Psychologist not found")
+			return
+		}
+		if portfolio.ScheduleEnforced {
+			utils.WriteError(w, http.StatusConflict, "SCHEDULE_ENFORCED", "This psychologist requires booking through available slots only")
+			return
+		}
+		series.PsychologistID, freeTime = req.PsychologistID, true
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "Give either availabilityId or psychologistId, startTime and endTime")
+		return
+	}
+	if !series.StartTime.After(time.Now()) {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME", "The first session must be in the future")
+		return
+	}
+	if err := rule.Validate(series.StartTime); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_RECURRENCE", err.Error())
+		return
+	}
+	if rule.Count > 0 {
+		series.Count = &rule.Count
+	}
+	series.Until = rule.Until
+
+	series.StartTime, series.EndTime = series.StartTime.UTC(), series.EndTime.UTC()
+	duration := series.EndTime.Sub(series.StartTime)
+	// Occurrences repeat at the same wall clock time of the psychologist, across daylight saving changes
+	loc := psychologistLocation(db.DB, series.PsychologistID)
+	var sessions []models.Session
+	var skipped []seriesConflict
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var buffer time.Duration
+		if freeTime {
+			if err := conflicts.LockPsychologist(tx, series.PsychologistID); err != nil {
+				return err
+			}
+			buffer = bufferFor(tx, series.PsychologistID)
+		}
+		var slots []*models.Availability
+		for _, start := range rule.Expand(series.StartTime.In(loc)) {
+			start = start.UTC()
+			end := start.Add(duration)
+			if freeTime {
+				found, err := conflicts.Find(tx, conflicts.Query{PsychologistID: series.PsychologistID, Start: start, End: end, Buffer: buffer})
+				if err != nil {
+					return err
+				}
+				if len(found) > 0 {
+					skipped = append(skipped, seriesConflict{StartTime: start, Reason: "time_conflict", Conflicts: found})
+					continue
+				}
+				slots = append(slots, nil)
+			} else {
+				var slot models.Availability
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("psychologist_id = ? AND start_time = ? AND end_time = ? AND status = 'available'", series.PsychologistID, start, end).
+					First(&slot).Error; err != nil {
+					skipped = append(skipped, seriesConflict{StartTime: start, Reason: "slot_unavailable"})
+					continue
+				}
+				slots = append(slots, &slot)
+			}
+			sessions = append(sessions, models.Session{
+				PsychologistID: series.PsychologistID,
+				ClientID:       &clientID,
+				StartTime:      start,
+				EndTime:        end,
+			})
+		}
+		if len(sessions) == 0 || (len(skipped) > 0 && !req.SkipConflicts) {
+			return errSeriesConflict
+		}
+
+		if err := tx.Create(&series).Error; err != nil {
+			return err
+		}
+		for i := range sessions {
+			sessions[i].SeriesID = &series.ID
+			if freeTime {
+				notes := req.ClientNotes
+				sessions[i].Status, sessions[i].ClientNotes = sessionstate.Pending, &notes
+			} else {
+				if err := tx.Model(slots[i]).Update("status", "booked").Error; err != nil {
+					return err
+				}
+				sessions[i].AvailabilityID, sessions[i].Status = &slots[i].ID, sessionstate.Confirmed
+			}
+			if err := tx.Create(&sessions[i]).Error; err != nil {
+				return err
+			}
+			if err := recordSessionEvent(tx, sessions[i].ID, "", sessions[i].Status, sessionstate.ActorClient, &clientID, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errSeriesConflict) {
+		utils.WriteErrorParams(w, http.StatusConflict, "SERIES_CONFLICT", "Some sessions of the series are not available",
+			map[string]interface{}{"conflicts": skipped})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Uint64("client_id", principal.UserID).Msg("BookSessionSeries: transaction failed")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to book the series")
+		return
+	}
+	log.Info().Uint64("series_id", series.ID).Uint64("client_id", principal.UserID).Int("sessions", len(sessions)).Int("conflicts", len(skipped)).Msg("Session series booked")
+
+	viewer := viewerLocation(r, principal.UserID)
+	dtos := make([]sessionDTO, len(sessions))
+	for i, s := range sessions {
+		dtos[i] = toSessionDTO(s, viewer)
+	}
+	if skipped == nil {
+		skipped = []seriesConflict{}
+	}
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Session series booked",
+		"data": map[string]interface{}{
+			"series":    series,
+			"sessions":  dtos,
+			"conflicts": skipped,
+		},
+	})
+}
+
+// parseSeriesUntil accepts an RFC3339 time or a date in loc; a date includes the whole day
+func parseSeriesUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// GetSessionSeries godoc
+// @Summary      Get a session series
+// @Description  Returns a recurring series and all its occurrences, each with its own status. Available to both participants.
+// @Tags         Sessions
+// @Produce      json
+// @Param        id path int true "Series ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,500 {object} map[string]interface{}
+// @Router       /api/users/sessions/series/{id} [get]
+// @Security     BearerAuth
+func GetSessionSeries(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
+		return
+	}
+	seriesID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid series ID")
+		return
+	}
+
+	var series models.SessionSeries
+	if err := db.DB.First(&series, seriesID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Series not found")
+		return
+	}
+	if series.ClientID != principal.UserID && series.PsychologistID != principal.UserID {
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this series")
+		return
+	}
+
+	var sessions []models.Session
+	if err := db.DB.Where("series_id = ?", series.ID).Order("start_time ASC").Find(&sessions).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load the series")
+		return
+	}
+	loc := viewerLocation(r, principal.UserID)
+	dtos := make([]sessionDTO, len(sessions))
+	for i, s := range sessions {
+		dtos[i] = toSessionDTO(s, loc)
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"series":   series,
+		"sessions": dtos,
+	})
+}
+
+// cancelFollowingOccurrences cancels the session in the URL and every later occurrence of its series that
+// can still be canceled. Each occurrence is classified and recorded like a single cancellation.
+func cancelFollowingOccurrences(w http.ResponseWriter, r *http.Request, userID uint64) {
+	sessionID, req, ok := parseSessionStatusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var canceled []models.Session
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, sessionID).Error; err != nil {
+			return errSessionNotFound
+		}
+		actor, ok := sessionActorFor(&session, userID)
+		if !ok {
+			return errSessionAccessDenied
+		}
+		if session.SeriesID == nil {
+			return errNotInSeries
+		}
+		var occurrences []models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("series_id = ? AND start_time >= ? AND status IN ?", *session.SeriesID, session.StartTime,
+				[]string{sessionstate.Pending, sessionstate.Confirmed, sessionstate.Rescheduled}).
+			Order("start_time ASC").Find(&occurrences).Error; err != nil {
+			return err
+		}
+		if len(occurrences) == 0 {
+			return errNothingToCancel
+		}
+		for i := range occurrences {
+			if err := transitionSession(tx, &occurrences[i], sessionstate.CanceledBy(actor), actor, &userID, req.Reason); err != nil {
+				return err
+			}
+		}
+		canceled = occurrences
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errSessionNotFound):
+		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	case errors.Is(err, errSessionAccessDenied):
+		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this session")
+		return
+	case errors.Is(err, errNotInSeries):
+		utils.WriteError(w, http.StatusConflict, "NOT_IN_SERIES", "This session is not part of a series")
+		return
+	case errors.Is(err, errNothingToCancel):
+		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "No session of the series is left to cancel")
+		return
+	default:
+		log.Error().Err(err).Uint64("session_id", sessionID).Msg("cancelFollowingOccurrences: failed to cancel")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to cancel sessions")
+		return
+	}
+	log.Info().Uint64("session_id", sessionID).Uint64("user_id", userID).Int("canceled", len(canceled)).Msg("Series occurrences canceled")
+
+	loc := viewerLocation(r, userID)
+	dtos := make([]sessionDTO, len(canceled))
+	for i, s := range canceled {
+		dtos[i] = toSessionDTO(s, loc)
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": strconv.Itoa(len(canceled)) + " sessions canceled",
+		"data":    dtos,
+	})
+}
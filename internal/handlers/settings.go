@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm/clause"
+)
+
+// Keys of platform settings stored in the system_settings table
+const (
+	settingMFARequired = "mfa.required"
+	// settingMagicLinkPrefix + role ("client", "psychologist") enables passwordless login for that role
+	settingMagicLinkPrefix = "magic_link."
+)
+
+// magicLinkRoles are the user roles magic-link login can be enabled for
+var magicLinkRoles = []string{"client", "psychologist"}
+
+// getSetting returns the stored value of a platform setting or def when it is not set
+func getSetting(key, def string) string {
+	var setting models.SystemSetting
+	if err := db.DB.Where("`key` = ?", key).First(&setting).Error; err != nil {
+		return def
+	}
+	return setting.Value
+}
+
+// setSetting creates or updates a platform setting
+func setSetting(key, value string, adminID uint64) error {
+	setting := models.SystemSetting{Key: key, Value: value, UpdatedBy: &adminID}
+	return db.DB.Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&setting).Error
+}
+
+// GetMFASettings godoc
+// @Summary      Get two-factor authentication policy
+// @Description  Returns whether two-factor authentication is mandatory for all accounts
+// @Tags         Actions for administrators
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /api/admin/settings/mfa [get]
+// @Security     BearerAuth
+func GetMFASettings(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"required": mfaRequiredByPolicy(),
+	})
+}
+
+// UpdateMFASettings godoc
+// @Summary      Update two-factor authentication policy
+// @Description  Makes two-factor authentication mandatory (or optional) for every user and administrator. Master role only.
+// @Tags         Actions for administrators
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,500 {object} map[string]interface{}
+// @Router       /api/admin/settings/mfa [put]
+// @Security     BearerAuth
+func UpdateMFASettings(w http.ResponseWriter, r *http.Request) {
+	currentAdmin, ok := auth.AdminFromContext(r.Context())
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+		return
+	}
+
+	var req struct {
+		Required *bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Required == nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "required (boolean) is mandatory")
+		return
+	}
+
+	value := "false"
+	if *req.Required {
+		value = "true"
+	}
+	before := getSetting(settingMFARequired, "false")
+	if err := setSetting(settingMFARequired, value, currentAdmin.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update setting")
+		return
+	}
+
+	log.Info().Str("admin", currentAdmin.Username).Bool("required", *req.Required).Msg("UpdateMFASettings: 2FA policy changed")
+	audit.Record(r, "settings.update", audit.TargetSetting, settingMFARequired,
+		map[string]string{"value": before}, map[string]string{"value": value})
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"required": *req.Required,
+	})
+}
+
+// magicLinkEnabled reports whether users with the given role may log in with a magic link (off by default)
+func magicLinkEnabled(role string) bool {
+	return getSetting(settingMagicLinkPrefix+role, "false") == "true"
+}
+
+// GetMagicLinkSettings godoc
+// @Summary      Get magic-link login policy
+// @Description  Returns for which user roles passwordless login by email link is enabled
+// @Tags         Actions for administrators
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /api/admin/settings/magic-link [get]
+// @Security     BearerAuth
+func GetMagicLinkSettings(w http.ResponseWriter, r *http.Request) {
+	roles := make(map[string]bool, len(magicLinkRoles))
+	for _, role := range magicLinkRoles {
+		roles[role] = magicLinkEnabled(role)
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"roles": roles,
+	})
+}
+
+// UpdateMagicLinkSettings godoc
+// @Summary      Update magic-link login policy
+// @Description  Turns passwordless login by email link on or off per user role, e.g. {"roles": {"client": true, "psychologist": false}}. Roles that are left out keep their setting.
+// @Tags         Actions for administrators
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,500 {object} map[string]interface{}
+// @Router       /api/admin/settings/magic-link [put]
+// @Security     BearerAuth
+func UpdateMagicLinkSettings(w http.ResponseWriter, r *http.Request) {
+	currentAdmin, ok := auth.AdminFromContext(r.Context())
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+		return
+	}
+
+	var req struct {
+		Roles map[string]bool `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Roles) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "roles (object of role to boolean) is mandatory")
+		return
+	}
+	for role := range req.Roles {
+		if role != "client" && role != "psychologist" {
+			utils.WriteError(w, http.StatusBadRequest, "INVALID_ROLE", "Role must be 'client' or 'psychologist'")
+			return
+		}
+	}
+
+	for role, enabled := range req.Roles {
+		key := settingMagicLinkPrefix + role
+		value := "false"
+		if enabled {
+			value = "true"
+		}
+		before := getSetting(key, "false")
+		if before == value {
+			continue
+		}
+		if err := setSetting(key, value, currentAdmin.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update setting")
+			return
+		}
+		log.Info().Str("admin", currentAdmin.Username).Str("role", role).Bool("enabled", enabled).Msg("UpdateMagicLinkSettings: magic-link policy changed")
+		audit.Record(r, "settings.update", audit.TargetSetting, key,
+			map[string]string{"value": before}, map[string]string{"value": value})
+	}
+
+	GetMagicLinkSettings(w, r)
+}
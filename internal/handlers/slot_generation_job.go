@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"user-api/internal/conflicts"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/schedule"
+	"user-api/internal/utils"
+
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SlotGenerationPolicy controls the background job that keeps availability slots generated from the
+// psychologists' weekly templates
+type SlotGenerationPolicy struct {
+	Interval   time.Duration // how often the job runs; 0 disables it
+	WeeksAhead int           // slots are kept generated this many weeks ahead
+	LeaseTTL   time.Duration // a run that stops renewing its lease for this long is taken over by another instance
+}
+
+// SlotGeneration is the active slot generation policy (config section [slot_generation])
+var SlotGeneration SlotGenerationPolicy
+
+// slotGenerationJob is the name of the job in job_leases and job_runs
+const slotGenerationJob = "slot_generation"
+
+// jobRunRetention is how long the status of finished runs is kept
+const jobRunRetention = 30 * 24 * time.Hour
+
+// errJobLeaseLost stops a run whose lease was taken over by another instance
+var errJobLeaseLost = errors.New("job lease lost to another instance")
+
+// jobInstance identifies this process as the owner of job leases
+var jobInstance = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// newSlotGenerationPolicy builds the policy from the [slot_generation] config section
+func newSlotGenerationPolicy(section *ini.Section) SlotGenerationPolicy {
+	policy := SlotGenerationPolicy{
+		Interval:   section.Key("interval").MustDuration(time.Hour),
+		WeeksAhead: section.Key("weeks_ahead").MustInt(8),
+		LeaseTTL:   section.Key("lease_ttl").MustDuration(10 * time.Minute),
+	}
+	if policy.WeeksAhead < 1 || policy.WeeksAhead*7 > schedule.MaxDays {
+		log.Fatal().Msg("Invalid [slot_generation] configuration: weeks_ahead must be between 1 and 52")
+	}
+	if policy.LeaseTTL <= 0 {
+		log.Fatal().Msg("Invalid [slot_generation] configuration: lease_ttl must be positive")
+	}
+	return policy
+}
+
+// StartSlotGenerator runs RunSlotGeneration every SlotGeneration.Interval until ctx is done.
+// Several instances may run it at once: only the holder of the job lease generates slots.
+func StartSlotGenerator(ctx context.Context) {
+	if SlotGeneration.Interval <= 0 {
+		log.Info().Msg("Slot generator disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(SlotGeneration.Interval)
+		defer ticker.Stop()
+		for {
+			run, err := RunSlotGeneration(time.Now())
+			if err != nil {
+				log.Error().Err(err).Msg("Slot generator failed")
+			} else if run != nil {
+				log.Info().Int("psychologists", run.Processed).Int("generated", run.Generated).
+					Int64("removed_stale", run.RemovedStale).Msg("Slot generator finished")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunSlotGeneration deletes unbooked slots that have ended and generates the slots of every active
+// psychologist with active templates (or override and extra exceptions) from tomorrow to
+// SlotGeneration.WeeksAhead weeks ahead, in the psychologist's time zone. Existing slots are kept, so
+// running it again only fills the days that came into range. The run is recorded in job_runs.
+// It returns a nil run when another instance holds the job lease.
+func RunSlotGeneration(now time.Time) (*models.JobRun, error) {
+	acquired, err := acquireJobLease(slotGenerationJob, now)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	defer releaseJobLease(slotGenerationJob)
+
+	run := &models.JobRun{Job: slotGenerationJob, Instance: jobInstance, Status: "running", StartedAt: now}
+	if err := db.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+
+	err = generateRollingSlots(run, now)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	switch {
+	case err != nil:
+		run.Status, run.Error = "failed", err.Error()
+	case run.Failed > 0:
+		run.Status, run.Error = "failed", fmt.Sprintf("Generation failed for %d of %d psychologists, see the logs", run.Failed, run.Processed)
+	default:
+		run.Status = "succeeded"
+	}
+	if saveErr := db.DB.Save(run).Error; saveErr != nil {
+		log.Error().Err(saveErr).Uint64("run_id", run.ID).Msg("RunSlotGeneration: failed to save run status")
+	}
+	db.DB.Where("job = ? AND started_at < ?", slotGenerationJob, now.Add(-jobRunRetention)).Delete(&models.JobRun{})
+	return run, err
+}
+
+// generateRollingSlots does the work of a run, counting it in run
+func generateRollingSlots(run *models.JobRun, now time.Time) error {
+	res := db.DB.Where("status = ? AND end_time <= ?", "available", now).Delete(&models.Availability{})
+	if res.Error != nil {
+		return res.Error
+	}
+	run.RemovedStale = res.RowsAffected
+
+	var psychologists []uint64
+	err := db.DB.Model(&models.User{}).
+		Where("role = ? AND status = ?", "psychologist", "Active").
+		Where("id IN (?) OR id IN (?)",
+			db.DB.Model(&models.ScheduleTemplate{}).Select("psychologist_id").Where("is_active = true"),
+			db.DB.Model(&models.ScheduleException{}).Select("psychologist_id").
+				Where("kind <> ? AND end_date >= ?", schedule.KindOff, now.UTC().Format(schedule.DateLayout))).
+		Order("id").Pluck("id", &psychologists).Error
+	if err != nil {
+		return err
+	}
+
+	for _, psychologistID := range psychologists {
+		// Завтрашній день і далі в часовому поясі психолога; сьогоднішні слоти створено попередніми запусками
+		loc := psychologistLocation(db.DB, psychologistID)
+		local := now.In(loc)
+		startDate := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, time.UTC)
+		endDate := startDate.AddDate(0, 0, 7*SlotGeneration.WeeksAhead-1)
+
+		var result slotGeneration
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := conflicts.LockPsychologist(tx, psychologistID); err != nil {
+				return err
+			}
+			var err error
+			result, err = generateSlots(tx, psychologistID, startDate, endDate, loc)
+			return err
+		})
+		run.Processed++
+		if err != nil {
+			log.Error().Err(err).Uint64("psychologist_id", psychologistID).Msg("RunSlotGeneration: failed to generate slots")
+			run.Failed++
+		} else {
+			run.Generated += result.Generated
+		}
+
+		renewed, err := renewJobLease(slotGenerationJob, time.Now())
+		if err != nil {
+			return err
+		}
+		if !renewed {
+			return errJobLeaseLost
+		}
+	}
+	return nil
+}
+
+// acquireJobLease takes the lease of a job for SlotGeneration.LeaseTTL if it is free or expired
+func acquireJobLease(name string, now time.Time) (bool, error) {
+	if err := db.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.JobLease{Name: name, ExpiresAt: now}).Error; err != nil {
+		return false, err
+	}
+	res := db.DB.Model(&models.JobLease{}).
+		Where("name = ? AND (expires_at <= ? OR owner = ?)", name, now, jobInstance).
+		Updates(map[string]interface{}{"owner": jobInstance, "expires_at": now.Add(SlotGeneration.LeaseTTL)})
+	return res.RowsAffected == 1, res.Error
+}
+
+// renewJobLease extends the lease held by this instance; false means another instance owns it now
+func renewJobLease(name string, now time.Time) (bool, error) {
+	res := db.DB.Model(&models.JobLease{}).
+		Where("name = ? AND owner = ?", name, jobInstance).
+		Update("expires_at", now.Add(SlotGeneration.LeaseTTL))
+	return res.RowsAffected == 1, res.Error
+}
+
+// releaseJobLease lets the next run start on any instance at once
+func releaseJobLease(name string) {
+	if err := db.DB.Model(&models.JobLease{}).
+		Where("name = ? AND owner = ?", name, jobInstance).
+		Update("expires_at", time.Now()).Error; err != nil {
+		log.Error().Err(err).Str("job", name).Msg("Failed to release job lease")
+	}
+}
+
+// GetSlotGenerationStatus godoc
+// @Summary      Slot generation status
+// @Description  Shows the configuration of the background job that keeps availability slots generated from the weekly templates, the instance holding its lease and the latest runs, newest first
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        limit query int false "Number of runs (default 20, max 100)"
+// @Success      200 {object} map[string]interface{}
+// @Failure      500 {object} map[string]interface{}
+// @Router       /api/admin/jobs/slot-generation [get]
+// @Security     BearerAuth
+func GetSlotGenerationStatus(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	var runs []models.JobRun
+	if err := db.DB.Where("job = ?", slotGenerationJob).Order("started_at DESC").Order("id DESC").
+		Limit(limit).Find(&runs).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve job runs")
+		return
+	}
+	// The lease is reported only while it is held
+	var lease *models.JobLease
+	var leases []models.JobLease
+	if err := db.DB.Where("name = ? AND expires_at > ?", slotGenerationJob, time.Now()).Limit(1).Find(&leases).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Unable to retrieve job lease")
+		return
+	}
+	if len(leases) == 1 {
+		lease = &leases[0]
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"enabled":    SlotGeneration.Interval > 0,
+		"interval":   SlotGeneration.Interval.String(),
+		"weeksAhead": SlotGeneration.WeeksAhead,
+		"lease":      lease,
+		"runs":       runs,
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/timezone"
+	"user-api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// viewerLocation returns the zone to show times in: the ?tz= query parameter when it names a known
+// zone, otherwise the viewer's own zone (userID is 0 for anonymous requests)
+func viewerLocation(r *http.Request, userID uint64) *time.Location {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		if loc, err := timezone.Load(tz); err == nil {
+			return loc
+		}
+	}
+	if userID == 0 {
+		return timezone.Default
+	}
+	var user models.User
+	db.DB.Select("time_zone").Where("id = ?", userID).Limit(1).Find(&user)
+	return timezone.Resolve(user.TimeZone)
+}
+
+// psychologistLocation returns the zone a psychologist's schedule is kept in: the portfolio zone,
+// then the psychologist's own zone
+func psychologistLocation(tx *gorm.DB, psychologistID uint64) *time.Location {
+	var portfolio models.Portfolio
+	tx.Select("time_zone").Where("psychologist_id = ?", psychologistID).Limit(1).Find(&portfolio)
+	var user models.User
+	tx.Select("time_zone").Where("id = ?", psychologistID).Limit(1).Find(&user)
+	return timezone.Resolve(portfolio.TimeZone, user.TimeZone)
+}
+
+// applyTimeZone copies a time zone given in a request to zone, writing an error response and returning
+// false if it is not an IANA zone. An empty name resets the zone to the default.
+func applyTimeZone(w http.ResponseWriter, zone *string, name *string) bool {
+	if name == nil {
+		return true
+	}
+	if _, err := timezone.Load(*name); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_TIME_ZONE", "timeZone must be an IANA time zone such as Europe/Kyiv")
+		return false
+	}
+	*zone = *name
+	return true
+}
+
+// localRange is a time range on the viewer's wall clock, sent next to the UTC times
+type localRange struct {
+	StartTimeLocal string `json:"startTimeLocal"`
+	EndTimeLocal   string `json:"endTimeLocal"`
+	TimeZone       string `json:"timeZone"`
+}
+
+func newLocalRange(start, end time.Time, loc *time.Location) localRange {
+	return localRange{
+		StartTimeLocal: start.In(loc).Format(time.RFC3339),
+		EndTimeLocal:   end.In(loc).Format(time.RFC3339),
+		TimeZone:       loc.String(),
+	}
+}
+
+// availabilityDTO is an availability slot with UTC times and the viewer's local times
+type availabilityDTO struct {
+	models.Availability
+	localRange
+}
+
+func toAvailabilityDTOs(slots []models.Availability, loc *time.Location) []availabilityDTO {
+	dtos := make([]availabilityDTO, len(slots))
+	for i, slot := range slots {
+		slot.StartTime, slot.EndTime = slot.StartTime.UTC(), slot.EndTime.UTC()
+		dtos[i] = availabilityDTO{Availability: slot, localRange: newLocalRange(slot.StartTime, slot.EndTime, loc)}
+	}
+	return dtos
+}
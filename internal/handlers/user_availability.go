@@ -2,34 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
+	"user-api/internal/conflicts"
 	"user-api/internal/db"
 	"user-api/internal/models"
 	"user-api/internal/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
+// errSlotBooked stops the deletion of a slot that has a session
+var errSlotBooked = errors.New("slot is booked")
+
 // CreateAvailabilitySlot godoc
 // @Summary      Create an availability slot
-// @Description  Allows a psychologist to add a new availability slot to their schedule
+// @Description  Allows a psychologist to add a new availability slot to their schedule. A slot overlapping an open slot or an active session (widened by the portfolio's bufferMinutes) is rejected with 409 TIME_CONFLICT listing them in params.conflicts.
 // @Tags         Availability
 // @Accept       json
 // @Produce      json
 // @Param        slot body models.Availability true "Availability Slot"
 // @Success      201 {object} map[string]interface{}
-// @Failure      400,401,403,500 {object} map[string]interface{}
+// @Failure      400,401,403,409,500 {object} map[string]interface{}
 // @Router       /api/users/availability [post]
 // @Security     BearerAuth
 func CreateAvailabilitySlot(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can create availability slots")
 		return
 	}
@@ -62,13 +68,22 @@ func CreateAvailabilitySlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	availability := models.Availability{
-		PsychologistID: user.ID,
-		StartTime:      startTime,
-		EndTime:        endTime,
+		PsychologistID: principal.UserID,
+		StartTime:      startTime.UTC(),
+		EndTime:        endTime.UTC(),
 		Status:         "available",
 	}
 
-	if err := db.DB.Create(&availability).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveCalendar(tx, conflicts.Query{PsychologistID: principal.UserID, Start: startTime, End: endTime}); err != nil {
+			return err
+		}
+		return tx.Create(&availability).Error
+	})
+	if writeConflictError(w, err) {
+		return
+	}
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to create availability slot")
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create availability slot")
 		return
@@ -76,16 +91,17 @@ func CreateAvailabilitySlot(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
-		"data":    availability,
+		"data":    toAvailabilityDTOs([]models.Availability{availability}, viewerLocation(r, principal.UserID))[0],
 	})
 }
 
 // GetPsychologistAvailability godoc
 // @Summary      Get psychologist's availability
-// @Description  Get all available slots for a specific psychologist
+// @Description  Get all available slots for a specific psychologist. Times are in UTC; startTimeLocal and endTimeLocal are in the zone given by ?tz= (IANA name, the server default otherwise).
 // @Tags         Availability
 // @Produce      json
 // @Param        psychologistId path int true "Psychologist ID"
+// @Param        tz query string false "IANA time zone of the viewer"
 // @Success      200 {array} models.Availability
 // @Failure      400,500 {object} map[string]interface{}
 // @Router       /api/users/availability/{psychologistId} [get]
@@ -105,15 +121,16 @@ func GetPsychologistAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, availability)
+	utils.WriteJSON(w, http.StatusOK, toAvailabilityDTOs(availability, viewerLocation(r, 0)))
 }
 
 // GetPsychologistScheduleInfo godoc
 // @Summary      Get psychologist schedule info
-// @Description  Returns schedule_enforced flag and available slots (used by client booking page)
+// @Description  Returns schedule_enforced flag, the psychologist's time zone and available slots (used by client booking page). Slot times are in UTC; startTimeLocal and endTimeLocal are in the zone given by ?tz=.
 // @Tags         Availability
 // @Produce      json
 // @Param        id path int true "Psychologist ID"
+// @Param        tz query string false "IANA time zone of the viewer"
 // @Success      200 {object} map[string]interface{}
 // @Router       /api/users/{id}/schedule-info [get]
 func GetPsychologistScheduleInfo(w http.ResponseWriter, r *http.Request) {
@@ -141,13 +158,14 @@ func GetPsychologistScheduleInfo(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"scheduleEnforced": portfolio.ScheduleEnforced,
-		"availability":     availability,
+		"availability":     toAvailabilityDTOs(availability, viewerLocation(r, 0)),
+		"timeZone":         psychologistLocation(db.DB, psychologistID).String(),
 	})
 }
 
 // DeleteAvailabilitySlot godoc
 // @Summary      Delete an availability slot
-// @Description  Allows a psychologist to delete an unbooked availability slot
+// @Description  Allows a psychologist to delete an unbooked availability slot. A slot generated from the weekly templates or schedule exceptions would be generated again, so its time is blocked with an "off" schedule exception, returned as exception (null for a slot added by hand); deleting the exception restores the slot on the next generation.
 // @Tags         Availability
 // @Produce      json
 // @Param        slotId path int true "Slot ID"
@@ -156,7 +174,7 @@ func GetPsychologistScheduleInfo(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/availability/{slotId} [delete]
 // @Security     BearerAuth
 func DeleteAvailabilitySlot(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
@@ -167,20 +185,38 @@ func DeleteAvailabilitySlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var slot models.Availability
-	if err := db.DB.Where("id = ? AND psychologist_id = ?", slotID, user.ID).First(&slot).Error; err != nil {
+	var exception *models.ScheduleException
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := conflicts.LockPsychologist(tx, principal.UserID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND psychologist_id = ?", slotID, principal.UserID).First(&slot).Error; err != nil {
+			return err
+		}
+		if slot.Status == "booked" {
+			return errSlotBooked
+		}
+		if err := tx.Delete(&slot).Error; err != nil {
+			return err
+		}
+		var err error
+		exception, err = blockDeletedSlot(tx, slot)
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
 		utils.WriteError(w, http.StatusNotFound, "SLOT_NOT_FOUND", "Availability slot not found or you don't have permission")
 		return
-	}
-
-	if slot.Status == "booked" {
+	case errors.Is(err, errSlotBooked):
 		utils.WriteError(w, http.StatusConflict, "SLOT_BOOKED", "Cannot delete a booked slot. Please cancel the session instead.")
 		return
-	}
-
-	if err := db.DB.Delete(&slot).Error; err != nil {
+	case err != nil:
+		log.Error().Err(err).Uint64("slot_id", slotID).Msg("Failed to delete availability slot")
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to delete availability slot")
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Slot deleted"})
+	// A slot of the weekly schedule would be generated again; the "off" exception keeps its time free
+	// until the psychologist deletes the exception
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Slot deleted", "exception": exception})
 }
@@ -24,18 +24,11 @@ import (
 // @Router       /api/users/blog [post]
 // @Security     BearerAuth
 func CreateBlogPost(w http.ResponseWriter, r *http.Request) {
-    email, ok := r.Context().Value("email").(string)
-    if !ok || email == "" {
-        utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
-
-    var user models.User
-    if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-        utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-        return
-    }
-    if user.Role != "psychologist" {
+    if principal.Role != "psychologist" {
         utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can add blog posts")
         return
     }
@@ -45,7 +38,7 @@ func CreateBlogPost(w http.ResponseWriter, r *http.Request) {
         utils.WriteError(w, http.StatusBadRequest, "INVALID_FORMAT", "Invalid request format")
         return
     }
-    post.PsychologistID = user.ID
+    post.PsychologistID = principal.UserID
 
     if err := db.DB.Create(&post).Error; err != nil {
         utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create blog post")
@@ -133,9 +126,8 @@ func GetBlogPost(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/blog/post/{blog_id} [put]
 // @Security     BearerAuth
 func UpdateBlogPost(w http.ResponseWriter, r *http.Request) {
-    email, ok := r.Context().Value("email").(string)
-    if !ok || email == "" {
-        utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
 
@@ -145,20 +137,14 @@ func UpdateBlogPost(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var user models.User
-    if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-        utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-        return
-    }
-
-    if user.Role != "psychologist" {
+    if principal.Role != "psychologist" {
         utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can edit blog posts")
         return
     }
 
     // Find blog post and verify ownership
     var post models.BlogPost
-    if err := db.DB.Where("id = ? AND psychologist_id = ?", blogID, user.ID).First(&post).Error; err != nil {
+    if err := db.DB.Where("id = ? AND psychologist_id = ?", blogID, principal.UserID).First(&post).Error; err != nil {
         utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Blog post not found or access denied")
         return
     }
@@ -201,9 +187,8 @@ func UpdateBlogPost(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/blog/post/{blog_id} [delete]
 // @Security     BearerAuth
 func DeleteBlogPost(w http.ResponseWriter, r *http.Request) {
-    email, ok := r.Context().Value("email").(string)
-    if !ok || email == "" {
-        utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
 
@@ -213,20 +198,14 @@ func DeleteBlogPost(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var user models.User
-    if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-        utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-        return
-    }
-
-    if user.Role != "psychologist" {
+    if principal.Role != "psychologist" {
         utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can delete blog posts")
         return
     }
 
     // Find blog post and verify ownership
     var post models.BlogPost
-    if err := db.DB.Where("id = ? AND psychologist_id = ?", blogID, user.ID).First(&post).Error; err != nil {
+    if err := db.DB.Where("id = ? AND psychologist_id = ?", blogID, principal.UserID).First(&post).Error; err != nil {
         utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Blog post not found or access denied")
         return
     }
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"user-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// deleteUserData deletes a user together with every row that belongs to it, inside tx.
+// Both the administrator's DeleteUser and the purge of unverified accounts use it, so a table
+// added for users only has to be listed here.
+func deleteUserData(tx *gorm.DB, user *models.User) error {
+	id := user.ID
+
+	if err := tx.Where("client_id = ?", id).Delete(&models.Child{}).Error; err != nil {
+		return fmt.Errorf("delete child records: %w", err)
+	}
+
+	// Портфоліо разом з фото, освітою, мовами та дипломами
+	var portfolio models.Portfolio
+	if err := tx.Where("psychologist_id = ?", id).Limit(1).Find(&portfolio).Error; err != nil {
+		return fmt.Errorf("find portfolio: %w", err)
+	}
+	if portfolio.ID != 0 {
+		for _, model := range []interface{}{&models.Photo{}, &models.Education{}, &models.Language{}, &models.Diploma{}} {
+			if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(model).Error; err != nil {
+				return fmt.Errorf("delete portfolio records: %w", err)
+			}
+		}
+		if err := tx.Delete(&portfolio).Error; err != nil {
+			return fmt.Errorf("delete portfolio: %w", err)
+		}
+	}
+
+	if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(&models.Review{}).Error; err != nil {
+		return fmt.Errorf("delete reviews: %w", err)
+	}
+	for _, model := range []interface{}{&models.BlogPost{}, &models.Rating{}, &models.PsychologistSkills{},
+		&models.Availability{}, &models.ScheduleTemplate{}, &models.ScheduleException{}} {
+		if err := tx.Where("psychologist_id = ?", id).Delete(model).Error; err != nil {
+			return fmt.Errorf("delete psychologist records: %w", err)
+		}
+	}
+
+	// Сесії з історією та серії
+	userSessions := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Session{}).Select("id").
+		Where("client_id = ? OR psychologist_id = ?", id, id)
+	for _, model := range []interface{}{&models.SessionEvent{}, &models.SessionReschedule{}} {
+		if err := tx.Where("session_id IN (?)", userSessions).Delete(model).Error; err != nil {
+			return fmt.Errorf("delete session history: %w", err)
+		}
+	}
+	for _, model := range []interface{}{&models.Session{}, &models.SessionSeries{}} {
+		if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(model).Error; err != nil {
+			return fmt.Errorf("delete sessions: %w", err)
+		}
+	}
+
+	// Розмови та повідомлення
+	conversations := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Conversation{}).Select("id").
+		Where("client_id = ? OR psychologist_id = ?", id, id)
+	if err := tx.Where("conversation_id IN (?)", conversations).Delete(&models.Message{}).Error; err != nil {
+		return fmt.Errorf("delete messages: %w", err)
+	}
+	if err := tx.Where("client_id = ? OR psychologist_id = ?", id, id).Delete(&models.Conversation{}).Error; err != nil {
+		return fmt.Errorf("delete conversations: %w", err)
+	}
+
+	// Облікові дані: зовнішні входи, API-ключі, токени та коди відновлення 2FA
+	for _, model := range []interface{}{&models.UserIdentity{}, &models.APIKey{}, &models.EmailChange{}, &models.MagicLinkToken{}} {
+		if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+			return fmt.Errorf("delete credentials: %w", err)
+		}
+	}
+	for _, model := range []interface{}{&models.RefreshToken{}, &models.PasswordResetToken{},
+		&models.MFARecoveryCode{}, &models.MFAPendingToken{}} {
+		if err := tx.Where("account_type = ? AND account_id = ?", "user", id).Delete(model).Error; err != nil {
+			return fmt.Errorf("delete account tokens: %w", err)
+		}
+	}
+
+	if err := tx.Delete(user).Error; err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	return nil
+}
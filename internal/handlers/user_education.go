@@ -33,19 +33,12 @@ type AddEducationRequest struct {
 // @Router       /api/users/portfolio/education [post]
 // @Security     BearerAuth
 func AddEducation(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage education")
 		return
 	}
@@ -62,7 +55,7 @@ func AddEducation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var portfolio models.Portfolio
-	if err := db.DB.Where("psychologist_id = ?", user.ID).First(&portfolio).Error; err != nil {
+	if err := db.DB.Where("psychologist_id = ?", principal.UserID).First(&portfolio).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Portfolio not found")
 		return
 	}
@@ -116,19 +109,12 @@ type UpdateEducationRequest struct {
 // @Router       /api/users/portfolio/education/{education_id} [put]
 // @Security     BearerAuth
 func UpdateEducation(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage education")
 		return
 	}
@@ -147,7 +133,7 @@ func UpdateEducation(w http.ResponseWriter, r *http.Request) {
 
 	var education models.Education
 	if err := db.DB.Joins("JOIN portfolios ON educations.portfolio_id = portfolios.id").
-		Where("educations.id = ? AND portfolios.psychologist_id = ?", educationID, user.ID).
+		Where("educations.id = ? AND portfolios.psychologist_id = ?", educationID, principal.UserID).
 		First(&education).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Education not found or access denied")
 		return
@@ -196,19 +182,12 @@ func UpdateEducation(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/portfolio/education/{education_id} [delete]
 // @Security     BearerAuth
 func DeleteEducation(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
-		return
-	}
-
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage education")
 		return
 	}
@@ -221,7 +200,7 @@ func DeleteEducation(w http.ResponseWriter, r *http.Request) {
 
 	var education models.Education
 	if err := db.DB.Joins("JOIN portfolios ON educations.portfolio_id = portfolios.id").
-		Where("educations.id = ? AND portfolios.psychologist_id = ?", educationID, user.ID).
+		Where("educations.id = ? AND portfolios.psychologist_id = ?", educationID, principal.UserID).
 		First(&education).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Education not found or access denied")
 		return
@@ -23,23 +23,27 @@ import (
 
 // UpdateSelfPortfolioRequest defines the structure for updating a psychologist's portfolio.
 type UpdateSelfPortfolioRequest struct {
-	Description  *string  `json:"description"`
-	Experience   *int     `json:"experience"`
-	Education    *string  `json:"education"`
-	ContactEmail *string  `json:"contactEmail"`
-	ContactPhone *string  `json:"contactPhone"`
-	City         *string  `json:"city"`
-	Address      *string  `json:"address"`
-	DateOfBirth  *string  `json:"dateOfBirth"`
-	Gender       *string  `json:"gender"`
-	Telegram     *string  `json:"telegram"`
-	FacebookURL  *string  `json:"facebookURL"`
-	InstagramURL *string  `json:"instagramURL"`
-	VideoURL     *string  `json:"videoUrl"`
-	Rate             *float64 `json:"rate"`
-	ClientAgeMin     *int     `json:"clientAgeMin"`
-	ClientAgeMax     *int     `json:"clientAgeMax"`
-	ScheduleEnforced *bool    `json:"scheduleEnforced"`
+	Description        *string  `json:"description"`
+	Experience         *int     `json:"experience"`
+	Education          *string  `json:"education"`
+	ContactEmail       *string  `json:"contactEmail"`
+	ContactPhone       *string  `json:"contactPhone"`
+	City               *string  `json:"city"`
+	Address            *string  `json:"address"`
+	DateOfBirth        *string  `json:"dateOfBirth"`
+	Gender             *string  `json:"gender"`
+	Telegram           *string  `json:"telegram"`
+	FacebookURL        *string  `json:"facebookURL"`
+	InstagramURL       *string  `json:"instagramURL"`
+	VideoURL           *string  `json:"videoUrl"`
+	Rate               *float64 `json:"rate"`
+	ClientAgeMin       *int     `json:"clientAgeMin"`
+	ClientAgeMax       *int     `json:"clientAgeMax"`
+	ScheduleEnforced   *bool    `json:"scheduleEnforced"`
+	FreeCancelHours    *int     `json:"freeCancelHours"`
+	NoShowGraceMinutes *int     `json:"noShowGraceMinutes"`
+	BufferMinutes      *int     `json:"bufferMinutes"`
+	TimeZone           *string  `json:"timeZone"`
 }
 
 // UpdateSelfPortfolio godoc
@@ -54,19 +58,12 @@ type UpdateSelfPortfolioRequest struct {
 // @Router       /api/users/self/portfolio [put]
 // @Security     BearerAuth
 func UpdateSelfPortfolio(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can have a portfolio")
 		return
 	}
@@ -78,7 +75,7 @@ func UpdateSelfPortfolio(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var portfolio models.Portfolio
-	if err := db.DB.Where("psychologist_id = ?", user.ID).FirstOrCreate(&portfolio, models.Portfolio{PsychologistID: user.ID}).Error; err != nil {
+	if err := db.DB.Where("psychologist_id = ?", principal.UserID).FirstOrCreate(&portfolio, models.Portfolio{PsychologistID: principal.UserID}).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Could not find or create portfolio")
 		return
 	}
@@ -112,6 +109,15 @@ func UpdateSelfPortfolio(w http.ResponseWriter, r *http.Request) {
 	if req.ScheduleEnforced != nil {
 		portfolio.ScheduleEnforced = *req.ScheduleEnforced
 	}
+	if !applyCancellationPolicy(w, &portfolio, req.FreeCancelHours, req.NoShowGraceMinutes) {
+		return
+	}
+	if !applyBufferMinutes(w, &portfolio, req.BufferMinutes) {
+		return
+	}
+	if !applyTimeZone(w, &portfolio.TimeZone, req.TimeZone) {
+		return
+	}
 
 	// Обработка даты рождения
 	if req.DateOfBirth != nil {
@@ -154,14 +160,13 @@ func UpdateSelfPortfolio(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/portfolio/photo [post]
 // @Security     BearerAuth
 func UploadPortfolioPhoto(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
 	var user models.User
-	if err := db.DB.Preload("Portfolio").Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.DB.Preload("Portfolio").First(&user, principal.UserID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		return
 	}
@@ -285,19 +290,12 @@ func generateUniqueID() (string, error) {
 // @Router       /api/users/portfolio/photo/{photo_id} [delete]
 // @Security     BearerAuth
 func DeletePortfolioPhoto(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can delete photos")
 		return
 	}
@@ -311,7 +309,7 @@ func DeletePortfolioPhoto(w http.ResponseWriter, r *http.Request) {
 	// Знайти фото та перевірити, що воно належить користувачу
 	var photo models.Photo
 	if err := db.DB.Joins("JOIN portfolios ON photos.portfolio_id = portfolios.id").
-		Where("photos.id = ? AND portfolios.psychologist_id = ?", photoID, user.ID).
+		Where("photos.id = ? AND portfolios.psychologist_id = ?", photoID, principal.UserID).
 		First(&photo).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Photo not found or access denied")
 		return
@@ -361,19 +359,12 @@ type AddLanguageRequest struct {
 // @Router       /api/users/portfolio/language [post]
 // @Security     BearerAuth
 func AddLanguage(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage languages")
 		return
 	}
@@ -385,7 +376,7 @@ func AddLanguage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var portfolio models.Portfolio
-	if err := db.DB.Where("psychologist_id = ?", user.ID).First(&portfolio).Error; err != nil {
+	if err := db.DB.Where("psychologist_id = ?", principal.UserID).First(&portfolio).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Portfolio not found")
 		return
 	}
@@ -429,19 +420,12 @@ type UpdateLanguageRequest struct {
 // @Router       /api/users/portfolio/language/{language_id} [put]
 // @Security     BearerAuth
 func UpdateLanguage(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
-		return
-	}
-
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage languages")
 		return
 	}
@@ -460,7 +444,7 @@ func UpdateLanguage(w http.ResponseWriter, r *http.Request) {
 
 	var language models.Language
 	if err := db.DB.Joins("JOIN portfolios ON languages.portfolio_id = portfolios.id").
-		Where("languages.id = ? AND portfolios.psychologist_id = ?", languageID, user.ID).
+		Where("languages.id = ? AND portfolios.psychologist_id = ?", languageID, principal.UserID).
 		First(&language).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Language not found or access denied")
 		return
@@ -498,19 +482,12 @@ func UpdateLanguage(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/portfolio/language/{language_id} [delete]
 // @Security     BearerAuth
 func DeleteLanguage(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only psychologists can manage languages")
 		return
 	}
@@ -523,7 +500,7 @@ func DeleteLanguage(w http.ResponseWriter, r *http.Request) {
 
 	var language models.Language
 	if err := db.DB.Joins("JOIN portfolios ON languages.portfolio_id = portfolios.id").
-		Where("languages.id = ? AND portfolios.psychologist_id = ?", languageID, user.ID).
+		Where("languages.id = ? AND portfolios.psychologist_id = ?", languageID, principal.UserID).
 		First(&language).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Language not found or access denied")
 		return
@@ -553,9 +530,7 @@ func DeleteLanguage(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/{user_id}/portfolio/languages [get]
 // @Security     BearerAuth
 func GetLanguages(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	if _, ok := principalFromRequest(w, r); !ok {
 		return
 	}
 
@@ -604,9 +579,7 @@ func GetLanguages(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/{user_id}/portfolio/educations [get]
 // @Security     BearerAuth
 func GetEducations(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	if _, ok := principalFromRequest(w, r); !ok {
 		return
 	}
 
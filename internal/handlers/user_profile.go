@@ -38,8 +38,6 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 
 	// Очищуємо конфіденційні дані
 	user.Password = ""
-	user.RefreshToken = ""
-	user.VerificationToken = ""
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
@@ -55,21 +53,18 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/self [get]
 // @Security     BearerAuth
 func GetSelfProfile(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
 	var user models.User
-	if err := db.DB.Preload("Portfolio").Preload("Portfolio.Photos").Preload("Portfolio.Educations").Preload("Skills").Preload("Skills.Category").Preload("Child").Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.DB.Preload("Portfolio").Preload("Portfolio.Photos").Preload("Portfolio.Educations").Preload("Skills").Preload("Skills.Category").Preload("Child").First(&user, principal.UserID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		return
 	}
 
 	user.Password = ""
-	user.RefreshToken = ""
-	user.VerificationToken = ""
 
 	// Форматуємо навички для фронтенду
 	var skills []map[string]interface{}
@@ -90,6 +85,7 @@ func GetSelfProfile(w http.ResponseWriter, r *http.Request) {
 		"role":      user.Role,
 		"status":    user.Status,
 		"verified":  user.Verified,
+		"timeZone":  user.TimeZone,
 		"createdAt": user.CreatedAt,
 		"updatedAt": user.UpdatedAt,
 		"skills":    skills,
@@ -115,6 +111,7 @@ func GetSelfProfile(w http.ResponseWriter, r *http.Request) {
 			"clientAgeMin": user.Portfolio.ClientAgeMin,
 			"clientAgeMax": user.Portfolio.ClientAgeMax,
 			"photos":       user.Portfolio.Photos,
+			"timeZone":     user.Portfolio.TimeZone,
 		}
 		response["portfolio"] = portfolioData
 
@@ -153,25 +150,18 @@ func GetSelfProfile(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/self/child [get]
 // @Security     BearerAuth
 func GetSelfChild(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-		return
-	}
-
-	if user.Role != "client" {
+	if principal.Role != "client" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only clients can access child data")
 		return
 	}
 
 	var child models.Child
-	if err := db.DB.Where("client_id = ?", user.ID).First(&child).Error; err != nil {
+	if err := db.DB.Where("client_id = ?", principal.UserID).First(&child).Error; err != nil {
 		// No child record — return empty
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -205,19 +195,12 @@ func GetSelfChild(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/self/child [put]
 // @Security     BearerAuth
 func UpdateSelfChild(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
-		return
-	}
-
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if user.Role != "client" {
+	if principal.Role != "client" {
 		utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only clients can manage child data")
 		return
 	}
@@ -233,11 +216,11 @@ func UpdateSelfChild(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var child models.Child
-	result := db.DB.Where("client_id = ?", user.ID).First(&child)
+	result := db.DB.Where("client_id = ?", principal.UserID).First(&child)
 	if result.Error != nil {
 		// Create new child record
 		child = models.Child{
-			ClientID: user.ID,
+			ClientID: principal.UserID,
 			Gender:   "notspecified",
 		}
 	}
@@ -279,7 +262,7 @@ func UpdateSelfChild(w http.ResponseWriter, r *http.Request) {
 
 // ClientSelfUpdate godoc
 // @Summary      Update own profile
-// @Description  Allows a client to update their personal information
+// @Description  Allows a client to update their personal information, including the IANA time zone (timeZone) times are shown in; an empty timeZone resets it to the server default
 // @Tags         Actions for users
 // @Accept       json
 // @Produce      json
@@ -289,14 +272,13 @@ func UpdateSelfChild(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/self/updateuser [put]
 // @Security     BearerAuth
 func ClientSelfUpdate(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
 	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		return
 	}
@@ -306,6 +288,7 @@ func ClientSelfUpdate(w http.ResponseWriter, r *http.Request) {
 		FirstName string  `json:"firstName"`
 		LastName  string  `json:"lastName"`
 		Phone     *string `json:"phone"`
+		TimeZone  *string `json:"timeZone"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_FORMAT", "Invalid request format")
@@ -316,6 +299,9 @@ func ClientSelfUpdate(w http.ResponseWriter, r *http.Request) {
 	user.FirstName = updateData.FirstName
 	user.LastName = updateData.LastName
 	user.Phone = updateData.Phone
+	if !applyTimeZone(w, &user.TimeZone, updateData.TimeZone) {
+		return
+	}
 
 	if err := db.DB.Save(&user).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update user")
@@ -332,7 +318,7 @@ func ClientSelfUpdate(w http.ResponseWriter, r *http.Request) {
 
 // ChangePassword godoc
 // @Summary      Change password
-// @Description  Allows authenticated user to change their password
+// @Description  Allows authenticated user to change their password. The new password must satisfy the password policy (codes PASSWORD_TOO_SHORT, PASSWORD_TOO_LONG, PASSWORD_TOO_SIMPLE, PASSWORD_CONTAINS_PERSONAL_INFO, PASSWORD_BREACHED)
 // @Tags         Users
 // @Accept       json
 // @Produce      json
@@ -341,9 +327,8 @@ func ClientSelfUpdate(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/self/password [put]
 // @Security     BearerAuth
 func ChangePassword(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
@@ -359,13 +344,9 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "oldPassword and newPassword are required")
 		return
 	}
-	if len(req.NewPassword) < 8 {
-		utils.WriteError(w, http.StatusBadRequest, "PASSWORD_TOO_SHORT", "Password must be at least 8 characters")
-		return
-	}
 
 	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not found")
 		return
 	}
@@ -374,6 +355,9 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusUnauthorized, "WRONG_PASSWORD", "Current password is incorrect")
 		return
 	}
+	if !checkPasswordPolicy(w, req.NewPassword, user.FirstName, user.LastName, user.Email) {
+		return
+	}
 
 	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -27,9 +27,8 @@ import (
 // @Router       /api/reviews/{psychologist_id} [post]
 // @Security     BearerAuth
 func CreateReview(w http.ResponseWriter, r *http.Request) {
-    email, ok := r.Context().Value("email").(string)
-    if !ok || email == "" {
-        utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
 
@@ -39,13 +38,7 @@ func CreateReview(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var client models.User
-    if err := db.DB.Where("email = ?", email).First(&client).Error; err != nil {
-        utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
-        return
-    }
-
-    if client.Role != "client" {
+    if !principal.IsClient() {
         utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Only clients can create reviews")
         return
     }
@@ -59,7 +52,7 @@ func CreateReview(w http.ResponseWriter, r *http.Request) {
 
     // Check if client already reviewed this psychologist
     var existingReview models.Review
-    if err := db.DB.Where("client_id = ? AND psychologist_id = ?", client.ID, psychologistID).First(&existingReview).Error; err == nil {
+    if err := db.DB.Where("client_id = ? AND psychologist_id = ?", principal.UserID, psychologistID).First(&existingReview).Error; err == nil {
         utils.WriteError(w, http.StatusBadRequest, "ALREADY_REVIEWED", "You have already reviewed this psychologist")
         return
     }
@@ -82,7 +75,7 @@ func CreateReview(w http.ResponseWriter, r *http.Request) {
 
     // Create review
     review := models.Review{
-        ClientID:       client.ID,
+        ClientID:       principal.UserID,
         PsychologistID: psychologistID,
         Rating:         reviewData.Rating,
         Comment:        &reviewData.Comment, // Додайте & для отримання вказівника
@@ -6,12 +6,16 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+	"user-api/internal/conflicts"
 	"user-api/internal/db"
 	"user-api/internal/models"
+	"user-api/internal/schedule"
+	"user-api/internal/timezone"
 	"user-api/internal/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 // CreateScheduleTemplate godoc
@@ -25,11 +29,11 @@ import (
 // @Router       /api/users/schedule-templates [post]
 // @Security     BearerAuth
 func CreateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can manage schedule templates")
 		return
 	}
@@ -54,7 +58,7 @@ func CreateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	template := models.ScheduleTemplate{
-		PsychologistID:      user.ID,
+		PsychologistID:      principal.UserID,
 		DayOfWeek:           req.DayOfWeek,
 		StartTime:           req.StartTime,
 		EndTime:             req.EndTime,
@@ -82,17 +86,17 @@ func CreateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/schedule-templates [get]
 // @Security     BearerAuth
 func GetMyScheduleTemplates(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can view schedule templates")
 		return
 	}
 
 	var templates []models.ScheduleTemplate
-	if err := db.DB.Where("psychologist_id = ?", user.ID).Order("day_of_week, start_time").Find(&templates).Error; err != nil {
+	if err := db.DB.Where("psychologist_id = ?", principal.UserID).Order("day_of_week, start_time").Find(&templates).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to get schedule templates")
 		return
 	}
@@ -110,7 +114,7 @@ func GetMyScheduleTemplates(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/schedule-templates/{id} [put]
 // @Security     BearerAuth
 func UpdateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
@@ -121,7 +125,7 @@ func UpdateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var template models.ScheduleTemplate
-	if err := db.DB.Where("id = ? AND psychologist_id = ?", templateID, user.ID).First(&template).Error; err != nil {
+	if err := db.DB.Where("id = ? AND psychologist_id = ?", templateID, principal.UserID).First(&template).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Template not found")
 		return
 	}
@@ -167,7 +171,7 @@ func UpdateScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/schedule-templates/{id} [delete]
 // @Security     BearerAuth
 func DeleteScheduleTemplate(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
@@ -177,7 +181,7 @@ func DeleteScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := db.DB.Where("id = ? AND psychologist_id = ?", templateID, user.ID).Delete(&models.ScheduleTemplate{})
+	result := db.DB.Where("id = ? AND psychologist_id = ?", templateID, principal.UserID).Delete(&models.ScheduleTemplate{})
 	if result.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to delete template")
 		return
@@ -192,7 +196,7 @@ func DeleteScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 
 // GenerateSlotsFromTemplates godoc
 // @Summary      Generate availability slots from templates
-// @Description  Generates availability slots for a date range based on active weekly templates
+// @Description  Generates availability slots for a date range based on active weekly templates and schedule exceptions (no slots in time off, override hours instead of the templates, extra hours on top of them; time off is counted in excluded). Slots that already exist are left as they are; slots overlapping other slots or active sessions (widened by the portfolio's bufferMinutes) are skipped and listed in conflicts. Dates and template times are read in the psychologist's time zone (portfolio timeZone, then the user's own), so slots keep their wall clock time across daylight saving changes; times are stored in UTC.
 // @Tags         Schedule
 // @Accept       json
 // @Produce      json
@@ -200,11 +204,11 @@ func DeleteScheduleTemplate(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/schedule-templates/generate [post]
 // @Security     BearerAuth
 func GenerateSlotsFromTemplates(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can generate slots")
 		return
 	}
@@ -238,12 +242,10 @@ func GenerateSlotsFromTemplates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var templates []models.ScheduleTemplate
-	if err := db.DB.Where("psychologist_id = ? AND is_active = true", user.ID).Find(&templates).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to load templates")
-		return
-	}
-	if len(templates) == 0 {
+	var templates, exceptions int64
+	db.DB.Model(&models.ScheduleTemplate{}).Where("psychologist_id = ? AND is_active = true", principal.UserID).Count(&templates)
+	db.DB.Model(&models.ScheduleException{}).Where("psychologist_id = ? AND kind <> ?", principal.UserID, schedule.KindOff).Count(&exceptions)
+	if templates == 0 && exceptions == 0 {
 		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"success":   true,
 			"generated": 0,
@@ -252,76 +254,198 @@ func GenerateSlotsFromTemplates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// dayOfWeek: 0=Пн..6=Нд → відповідає time.Weekday: Mon=1..Sun=0
-	// Маппінг: наш 0=Пн → time.Monday(1), наш 6=Нд → time.Sunday(0)
-	toTimeWeekday := func(d int) time.Weekday {
-		if d == 6 {
-			return time.Sunday
+	// Дати і час шаблонів — у часовому поясі психолога
+	loc := psychologistLocation(db.DB, principal.UserID)
+	var result slotGeneration
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := conflicts.LockPsychologist(tx, principal.UserID); err != nil {
+			return err
 		}
-		return time.Weekday(d + 1)
+		var err error
+		result, err = generateSlots(tx, principal.UserID, startDate, endDate, loc)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Uint64("psychologist_id", principal.UserID).Msg("Failed to generate slots")
+		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to generate slots")
+		return
 	}
 
-	var generated int
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":   true,
+		"generated": result.Generated,
+		"excluded":  result.Excluded,
+		"conflicts": result.Conflicts,
+		"timeZone":  loc.String(),
+		"message": fmt.Sprintf("Generated %d availability slots, skipped %d conflicting and %d in time off",
+			result.Generated, len(result.Conflicts), result.Excluded),
+	})
+}
+
+// slotGeneration is the outcome of generating slots
+type slotGeneration struct {
+	Generated int
+	// Excluded counts template slots in time off (schedule exceptions)
+	Excluded  int
+	Conflicts []generatedSlotConflict
+}
+
+// templateWeekday maps a template dayOfWeek (0=Пн..6=Нд) to time.Weekday (Sun=0..Sat=6)
+func templateWeekday(d int) time.Weekday {
+	if d == 6 {
+		return time.Sunday
+	}
+	return time.Weekday(d + 1)
+}
+
+// generateSlots creates the slots of the psychologist's active templates and schedule exceptions for the
+// calendar dates startDate to endDate (midnight UTC) in the psychologist's zone loc. Slots that already
+// exist are left as they are, slots in time off are excluded and slots overlapping other slots or active
+// sessions are returned as conflicts. The caller holds the psychologist lock in tx.
+func generateSlots(tx *gorm.DB, psychologistID uint64, startDate, endDate time.Time, loc *time.Location) (slotGeneration, error) {
+	result := slotGeneration{Conflicts: []generatedSlotConflict{}}
+	var templates []models.ScheduleTemplate
+	if err := tx.Where("psychologist_id = ? AND is_active = true", psychologistID).Find(&templates).Error; err != nil {
+		return result, err
+	}
+	var exceptions []models.ScheduleException
+	if err := tx.Where("psychologist_id = ? AND start_date <= ? AND end_date >= ?", psychologistID,
+		endDate.Format(schedule.DateLayout), startDate.Format(schedule.DateLayout)).Find(&exceptions).Error; err != nil {
+		return result, err
+	}
+	buffer := bufferFor(tx, psychologistID)
+
 	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		day := schedule.PlanDay(d, exceptions, loc)
+		candidates := scheduledSlots(templates, day, d, loc)
+
+		for _, slotRange := range candidates {
+			if day.IsOff(slotRange.Start, slotRange.End) {
+				result.Excluded++
+				continue
+			}
+			// Слот не повинен перетинатися з іншими слотами та сесіями
+			found, err := conflicts.Find(tx, conflicts.Query{PsychologistID: psychologistID, Start: slotRange.Start, End: slotRange.End, Buffer: buffer})
+			if err != nil {
+				return result, err
+			}
+			switch {
+			case len(found) == 0:
+				slot := models.Availability{
+					PsychologistID: psychologistID,
+					StartTime:      slotRange.Start,
+					EndTime:        slotRange.End,
+					Status:         "available",
+				}
+				if err := tx.Create(&slot).Error; err != nil {
+					return result, err
+				}
+				result.Generated++
+			case !sameTimeConflict(found, slotRange.Start, slotRange.End):
+				// A slot generated before is not a conflict
+				result.Conflicts = append(result.Conflicts, generatedSlotConflict{StartTime: slotRange.Start, EndTime: slotRange.End, Conflicts: found})
+			}
+		}
+	}
+	return result, nil
+}
+
+// scheduledSlots returns the slots the weekly templates and the schedule exceptions planned in day give
+// the calendar date d (midnight UTC) in loc, before time off and conflicts are taken out
+func scheduledSlots(templates []models.ScheduleTemplate, day schedule.Day, d time.Time, loc *time.Location) []timezone.Range {
+	var candidates []timezone.Range
+	if day.Templates {
 		for _, tmpl := range templates {
-			if toTimeWeekday(tmpl.DayOfWeek) != d.Weekday() {
+			if templateWeekday(tmpl.DayOfWeek) != d.Weekday() {
 				continue
 			}
 
-			// Парсимо час шаблону
-			slotStart, err := time.Parse("15:04:05", tmpl.StartTime)
+			from, err := timezone.ParseClock(tmpl.StartTime)
 			if err != nil {
-				slotStart, err = time.Parse("15:04", tmpl.StartTime)
-				if err != nil {
-					log.Warn().Str("time", tmpl.StartTime).Msg("Cannot parse template start_time")
-					continue
-				}
+				log.Warn().Str("time", tmpl.StartTime).Msg("Cannot parse template start_time")
+				continue
 			}
-			slotEnd, err := time.Parse("15:04:05", tmpl.EndTime)
+			to, err := timezone.ParseClock(tmpl.EndTime)
 			if err != nil {
-				slotEnd, err = time.Parse("15:04", tmpl.EndTime)
-				if err != nil {
-					log.Warn().Str("time", tmpl.EndTime).Msg("Cannot parse template end_time")
-					continue
-				}
+				log.Warn().Str("time", tmpl.EndTime).Msg("Cannot parse template end_time")
+				continue
 			}
 
+			// Слоти йдуть за годинником психолога, тому переходи на літній/зимовий час їх не зсувають
 			duration := time.Duration(tmpl.SlotDurationMinutes) * time.Minute
-			current := time.Date(d.Year(), d.Month(), d.Day(),
-				slotStart.Hour(), slotStart.Minute(), 0, 0, time.Local)
-			dayEnd := time.Date(d.Year(), d.Month(), d.Day(),
-				slotEnd.Hour(), slotEnd.Minute(), 0, 0, time.Local)
-
-			for current.Add(duration).Before(dayEnd) || current.Add(duration).Equal(dayEnd) {
-				slotEndTime := current.Add(duration)
-
-				// Перевіряємо чи слот вже існує
-				var count int64
-				db.DB.Model(&models.Availability{}).
-					Where("psychologist_id = ? AND start_time = ?", user.ID, current).
-					Count(&count)
-				if count == 0 {
-					slot := models.Availability{
-						PsychologistID: user.ID,
-						StartTime:      current,
-						EndTime:        slotEndTime,
-						Status:         "available",
-					}
-					if err := db.DB.Create(&slot).Error; err != nil {
-						log.Error().Err(err).Msg("Failed to create generated slot")
-					} else {
-						generated++
-					}
-				}
+			candidates = append(candidates, timezone.DaySlots(d, from, to, duration, loc)...)
+		}
+	}
+	return append(candidates, day.Slots...)
+}
 
-				current = current.Add(duration)
-			}
+// blockDeletedSlot keeps a deleted slot from coming back: when the slot is one the schedule generates,
+// it adds an "off" schedule exception for its time, which generateSlots and the slot generator respect.
+// It returns nil for a slot added by hand or a time already off. The caller holds the psychologist lock.
+func blockDeletedSlot(tx *gorm.DB, slot models.Availability) (*models.ScheduleException, error) {
+	loc := psychologistLocation(tx, slot.PsychologistID)
+	start, end := slot.StartTime.In(loc), slot.EndTime.In(loc)
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	var templates []models.ScheduleTemplate
+	if err := tx.Where("psychologist_id = ? AND is_active = true", slot.PsychologistID).Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	var exceptions []models.ScheduleException
+	day := date.Format(schedule.DateLayout)
+	if err := tx.Where("psychologist_id = ? AND start_date <= ? AND end_date >= ?", slot.PsychologistID, day, day).
+		Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+	plan := schedule.PlanDay(date, exceptions, loc)
+	if plan.IsOff(slot.StartTime, slot.EndTime) || !sameTimeRange(scheduledSlots(templates, plan, date, loc), slot.StartTime, slot.EndTime) {
+		return nil, nil
+	}
+
+	// Кінець слота опівночі (або пізніше) обмежуємо кінцем дня: 24:00 не є часом доби
+	from, to := start.Format("15:04"), end.Format("15:04")
+	if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+		to = "23:59"
+	}
+	exception := models.ScheduleException{
+		PsychologistID: slot.PsychologistID,
+		Kind:           schedule.KindOff,
+		StartDate:      day,
+		EndDate:        day,
+		StartTime:      &from,
+		EndTime:        &to,
+		Reason:         "Slot deleted",
+	}
+	if err := tx.Create(&exception).Error; err != nil {
+		return nil, err
+	}
+	return &exception, nil
+}
+
+// sameTimeRange reports whether one of the ranges is exactly start-end
+func sameTimeRange(ranges []timezone.Range, start, end time.Time) bool {
+	for _, r := range ranges {
+		if r.Start.Equal(start) && r.End.Equal(end) {
+			return true
 		}
 	}
+	return false
+}
 
-	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
-		"success":   true,
-		"generated": generated,
-		"message":   fmt.Sprintf("Generated %d availability slots", generated),
-	})
+// generatedSlotConflict is a template slot that was not generated because its time is taken
+type generatedSlotConflict struct {
+	StartTime time.Time            `json:"startTime"`
+	EndTime   time.Time            `json:"endTime"`
+	Conflicts []conflicts.Conflict `json:"conflicts"`
+}
+
+// sameTimeConflict reports whether one of the conflicts has exactly the given time, as a slot generated
+// earlier (or the session booked from it) does
+func sameTimeConflict(found []conflicts.Conflict, start, end time.Time) bool {
+	for _, c := range found {
+		if c.StartTime.Equal(start) && c.EndTime.Equal(end) {
+			return true
+		}
+	}
+	return false
 }
@@ -2,32 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
+	"user-api/internal/conflicts"
 	"user-api/internal/db"
 	"user-api/internal/models"
+	"user-api/internal/sessionstate"
 	"user-api/internal/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// getUserFromCtx читає email з контексту і повертає User з БД.
-// Правильний паттерн цього проєкту: middleware кладе тільки рядки (email, username, role).
-func getUserFromCtx(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
-		return nil, false
-	}
-	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not found")
-		return nil, false
-	}
-	return &user, true
-}
+// errSlotUnavailable is returned when an availability slot is missing or already booked
+var errSlotUnavailable = errors.New("availability slot not found or booked")
 
 // sessionPersonDTO — вкладений об'єкт особи у відповіді сесії
 type sessionPersonDTO struct {
@@ -42,26 +34,43 @@ type sessionDTO struct {
 	PsychologistID uint64            `json:"psychologistId"`
 	ClientID       *uint64           `json:"clientId"`
 	AvailabilityID *uint64           `json:"availabilityId"`
+	SeriesID       *uint64           `json:"seriesId,omitempty"`
 	StartTime      string            `json:"startTime"`
 	EndTime        string            `json:"endTime"`
 	Status         string            `json:"status"`
 	ClientNotes    *string           `json:"clientNotes"`
+	CanceledBy     *uint64           `json:"canceledBy,omitempty"`
+	CanceledAt     *string           `json:"canceledAt,omitempty"`
+	Cancellation   *string           `json:"cancellation,omitempty"`
 	CreatedAt      string            `json:"createdAt"`
 	Psychologist   *sessionPersonDTO `json:"psychologist,omitempty"`
 	Client         *sessionPersonDTO `json:"client,omitempty"`
+
+	// startTimeLocal, endTimeLocal and timeZone of the viewer
+	localRange
+	PendingReschedule *models.SessionReschedule `json:"pendingReschedule,omitempty"`
 }
 
-func toSessionDTO(s models.Session) sessionDTO {
+// toSessionDTO converts a session for the response; times are in UTC, with local times in the viewer's zone loc
+func toSessionDTO(s models.Session, loc *time.Location) sessionDTO {
 	dto := sessionDTO{
 		ID:             s.ID,
 		PsychologistID: s.PsychologistID,
 		ClientID:       s.ClientID,
 		AvailabilityID: s.AvailabilityID,
-		StartTime:      s.StartTime.Format(time.RFC3339),
-		EndTime:        s.EndTime.Format(time.RFC3339),
+		SeriesID:       s.SeriesID,
+		StartTime:      s.StartTime.UTC().Format(time.RFC3339),
+		EndTime:        s.EndTime.UTC().Format(time.RFC3339),
+		localRange:     newLocalRange(s.StartTime, s.EndTime, loc),
 		Status:         s.Status,
 		ClientNotes:    s.ClientNotes,
-		CreatedAt:      s.CreatedAt.Format(time.RFC3339),
+		CanceledBy:     s.CanceledBy,
+		Cancellation:   s.Cancellation,
+		CreatedAt:      s.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if s.CanceledAt != nil {
+		canceledAt := s.CanceledAt.UTC().Format(time.RFC3339)
+		dto.CanceledAt = &canceledAt
 	}
 	if s.Psychologist.ID != 0 {
 		dto.Psychologist = &sessionPersonDTO{
@@ -91,14 +100,15 @@ func toSessionDTO(s models.Session) sessionDTO {
 // @Router       /api/users/sessions/book/{slotId} [post]
 // @Security     BearerAuth
 func BookSession(w http.ResponseWriter, r *http.Request) {
-	client, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if client.Role != "client" {
+	if principal.Role != "client" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only clients can book sessions")
 		return
 	}
+	clientID := principal.UserID
 
 	slotID, err := strconv.ParseUint(chi.URLParam(r, "slotId"), 10, 64)
 	if err != nil {
@@ -106,43 +116,34 @@ func BookSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx := db.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	var session models.Session
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var slot models.Availability
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND status = 'available'", slotID).First(&slot).Error; err != nil {
+			return errSlotUnavailable
 		}
-	}()
-
-	var slot models.Availability
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ? AND status = 'available'", slotID).First(&slot).Error; err != nil {
-		tx.Rollback()
+		if err := tx.Model(&slot).Update("status", "booked").Error; err != nil {
+			return err
+		}
+		session = models.Session{
+			PsychologistID: slot.PsychologistID,
+			ClientID:       &clientID,
+			AvailabilityID: &slot.ID,
+			StartTime:      slot.StartTime,
+			EndTime:        slot.EndTime,
+			Status:         sessionstate.Confirmed,
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return recordSessionEvent(tx, session.ID, "", session.Status, sessionstate.ActorClient, &clientID, "")
+	})
+	if err == errSlotUnavailable {
 		utils.WriteError(w, http.StatusNotFound, "SLOT_NOT_FOUND_OR_BOOKED", "This time slot is no longer available")
 		return
 	}
-
-	if err := tx.Model(&slot).Update("status", "booked").Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to update slot status")
-		return
-	}
-
-	session := models.Session{
-		PsychologistID: slot.PsychologistID,
-		ClientID:       &client.ID,
-		AvailabilityID: &slot.ID,
-		StartTime:      slot.StartTime,
-		EndTime:        slot.EndTime,
-		Status:         "confirmed",
-	}
-
-	if err := tx.Create(&session).Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create session")
-		return
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Error().Err(err).Msg("Transaction commit failed for booking session")
+	if err != nil {
+		log.Error().Err(err).Msg("Transaction failed for booking session")
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to finalize booking")
 		return
 	}
@@ -150,28 +151,30 @@ func BookSession(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
 		"message": "Session booked successfully",
-		"data":    toSessionDTO(session),
+		"data":    toSessionDTO(session, viewerLocation(r, principal.UserID)),
 	})
 }
 
 // RequestFreeTimeSession godoc
 // @Summary      Request a free-time session
-// @Description  Allows a client to request a session at any time (schedule_enforced=false)
+// @Description  Allows a client to request a session at any time (schedule_enforced=false). A time overlapping an open slot or an active session of the psychologist (widened by the portfolio's bufferMinutes) is rejected with 409 TIME_CONFLICT listing them in params.conflicts.
 // @Tags         Sessions
 // @Accept       json
 // @Produce      json
 // @Success      201 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
 // @Router       /api/users/sessions/request [post]
 // @Security     BearerAuth
 func RequestFreeTimeSession(w http.ResponseWriter, r *http.Request) {
-	client, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if client.Role != "client" {
+	if principal.Role != "client" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only clients can request sessions")
 		return
 	}
+	clientID := principal.UserID
 
 	var req struct {
 		PsychologistID uint64 `json:"psychologistId"`
@@ -212,14 +215,26 @@ func RequestFreeTimeSession(w http.ResponseWriter, r *http.Request) {
 	notes := req.ClientNotes
 	session := models.Session{
 		PsychologistID: req.PsychologistID,
-		ClientID:       &client.ID,
+		ClientID:       &clientID,
 		StartTime:      startTime,
 		EndTime:        endTime,
-		Status:         "pending",
+		Status:         sessionstate.Pending,
 		ClientNotes:    &notes,
 	}
 
-	if err := db.DB.Create(&session).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveCalendar(tx, conflicts.Query{PsychologistID: req.PsychologistID, Start: startTime, End: endTime}); err != nil {
+			return err
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return recordSessionEvent(tx, session.ID, "", session.Status, sessionstate.ActorClient, &clientID, "")
+	})
+	if writeConflictError(w, err) {
+		return
+	}
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to create free-time session request")
 		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create session request")
 		return
@@ -228,13 +243,13 @@ func RequestFreeTimeSession(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
 		"message": "Session request sent. Waiting for psychologist confirmation.",
-		"data":    toSessionDTO(session),
+		"data":    toSessionDTO(session, viewerLocation(r, principal.UserID)),
 	})
 }
 
 // GetMySessions godoc
 // @Summary      Get my sessions
-// @Description  Get all sessions for the logged-in user (client or psychologist)
+// @Description  Get all sessions for the logged-in user (client or psychologist), with the pending reschedule proposal of each session if there is one
 // @Tags         Sessions
 // @Produce      json
 // @Success      200 {array} sessionDTO
@@ -242,7 +257,7 @@ func RequestFreeTimeSession(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/users/sessions/my [get]
 // @Security     BearerAuth
 func GetMySessions(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
@@ -250,14 +265,14 @@ func GetMySessions(w http.ResponseWriter, r *http.Request) {
 	var sessions []models.Session
 	var dbErr error
 
-	if user.Role == "psychologist" {
+	if principal.Role == "psychologist" {
 		dbErr = db.DB.Preload("Client").
-			Where("psychologist_id = ?", user.ID).
+			Where("psychologist_id = ?", principal.UserID).
 			Order("start_time DESC").
 			Find(&sessions).Error
 	} else {
 		dbErr = db.DB.Preload("Psychologist").
-			Where("client_id = ?", user.ID).
+			Where("client_id = ?", principal.UserID).
 			Order("start_time DESC").
 			Find(&sessions).Error
 	}
@@ -267,9 +282,24 @@ func GetMySessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ids := make([]uint64, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	var proposals []models.SessionReschedule
+	if len(ids) > 0 {
+		db.DB.Where("session_id IN ? AND status = 'pending'", ids).Find(&proposals)
+	}
+	pending := make(map[uint64]*models.SessionReschedule, len(proposals))
+	for i := range proposals {
+		pending[proposals[i].SessionID] = &proposals[i]
+	}
+
+	loc := viewerLocation(r, principal.UserID)
 	dtos := make([]sessionDTO, len(sessions))
 	for i, s := range sessions {
-		dtos[i] = toSessionDTO(s)
+		dtos[i] = toSessionDTO(s, loc)
+		dtos[i].PendingReschedule = pending[s.ID]
 	}
 
 	utils.WriteJSON(w, http.StatusOK, dtos)
@@ -277,148 +307,78 @@ func GetMySessions(w http.ResponseWriter, r *http.Request) {
 
 // CancelSession godoc
 // @Summary      Cancel a session
-// @Description  Allows client or psychologist to cancel a session
+// @Description  Allows client or psychologist to cancel a session. The session becomes canceled_by_client or canceled_by_psychologist, records who canceled it and when, and its availability slot is released. The cancellation is free, or late when it comes within the free cancellation window (freeCancelHours of the psychologist's portfolio) before the start; withdrawing a pending request is always free.
 // @Tags         Sessions
+// @Accept       json
 // @Produce      json
 // @Param        id path int true "Session ID"
+// @Param        scope query string false "this (default) or following: also cancel the later sessions of the series"
+// @Param        body body SessionStatusRequest false "Optional reason"
 // @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
 // @Router       /api/users/sessions/{id}/cancel [put]
 // @Security     BearerAuth
 func CancelSession(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-
-	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
-		return
-	}
-
-	var session models.Session
-	if err := db.DB.First(&session, sessionID).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
-		return
-	}
-
-	clientMatch := session.ClientID != nil && *session.ClientID == user.ID
-	psychologistMatch := session.PsychologistID == user.ID
-	if !clientMatch && !psychologistMatch {
-		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "You don't have access to this session")
-		return
-	}
-
-	if session.Status == "canceled" || session.Status == "completed" {
-		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "Session is already "+session.Status)
+	switch r.URL.Query().Get("scope") {
+	case "", "this":
+	case "following":
+		cancelFollowingOccurrences(w, r, principal.UserID)
 		return
-	}
-
-	tx := db.DB.Begin()
-	if err := tx.Model(&session).Update("status", "canceled").Error; err != nil {
-		tx.Rollback()
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to cancel session")
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_SCOPE", "scope must be this or following")
 		return
 	}
-
-	if session.AvailabilityID != nil {
-		tx.Model(&models.Availability{}).
-			Where("id = ?", *session.AvailabilityID).
-			Update("status", "available")
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to finalize cancellation")
-		return
-	}
-
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Session canceled"})
+	changeSessionStatus(w, r, principal.UserID, sessionstate.CanceledBy, "Session canceled")
 }
 
 // ConfirmSession godoc
 // @Summary      Confirm a pending session
-// @Description  Allows a psychologist to confirm a pending free-time session request
+// @Description  Allows a psychologist to confirm a pending free-time session request. The time must still be free: overlapping sessions or open slots (widened by the portfolio's bufferMinutes) give 409 TIME_CONFLICT listing them in params.conflicts.
 // @Tags         Sessions
+// @Accept       json
 // @Produce      json
 // @Param        id path int true "Session ID"
+// @Param        body body SessionStatusRequest false "Optional reason"
 // @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
 // @Router       /api/users/sessions/{id}/confirm [put]
 // @Security     BearerAuth
 func ConfirmSession(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can confirm sessions")
 		return
 	}
-
-	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
-		return
-	}
-
-	var session models.Session
-	if err := db.DB.Where("id = ? AND psychologist_id = ?", sessionID, user.ID).First(&session).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
-		return
-	}
-
-	if session.Status != "pending" {
-		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "Only pending sessions can be confirmed")
-		return
-	}
-
-	if err := db.DB.Model(&session).Update("status", "confirmed").Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to confirm session")
-		return
-	}
-
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Session confirmed"})
+	changeSessionStatus(w, r, principal.UserID, func(sessionstate.Actor) string { return sessionstate.Confirmed }, "Session confirmed")
 }
 
 // CompleteSession godoc
 // @Summary      Mark session as completed
-// @Description  Allows a psychologist to mark a session as completed
+// @Description  Allows a psychologist to mark a confirmed, rescheduled or in-progress session as completed
 // @Tags         Sessions
+// @Accept       json
 // @Produce      json
 // @Param        id path int true "Session ID"
+// @Param        body body SessionStatusRequest false "Optional reason"
 // @Success      200 {object} map[string]interface{}
+// @Failure      400,401,403,404,409,500 {object} map[string]interface{}
 // @Router       /api/users/sessions/{id}/complete [put]
 // @Security     BearerAuth
 func CompleteSession(w http.ResponseWriter, r *http.Request) {
-	user, ok := getUserFromCtx(w, r)
+	principal, ok := principalFromRequest(w, r)
 	if !ok {
 		return
 	}
-	if user.Role != "psychologist" {
+	if principal.Role != "psychologist" {
 		utils.WriteError(w, http.StatusForbidden, "ACCESS_DENIED", "Only psychologists can complete sessions")
 		return
 	}
-
-	sessionID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid session ID")
-		return
-	}
-
-	var session models.Session
-	if err := db.DB.Where("id = ? AND psychologist_id = ?", sessionID, user.ID).First(&session).Error; err != nil {
-		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
-		return
-	}
-
-	if session.Status != "confirmed" {
-		utils.WriteError(w, http.StatusConflict, "INVALID_STATUS", "Only confirmed sessions can be completed")
-		return
-	}
-
-	if err := db.DB.Model(&session).Update("status", "completed").Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to complete session")
-		return
-	}
-
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Session completed"})
+	changeSessionStatus(w, r, principal.UserID, func(sessionstate.Actor) string { return sessionstate.Completed }, "Session completed")
 }
@@ -24,14 +24,13 @@ import (
 // @Router       /api/users/self/skills [put]
 // @Security     BearerAuth
 func SetSpecialistSkills(w http.ResponseWriter, r *http.Request) {
-	email, ok := r.Context().Value("email").(string)
-	if !ok || email == "" {
-		utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+	principal, ok := principalFromRequest(w, r)
+	if !ok {
 		return
 	}
 
 	var user models.User
-	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		return
 	}
@@ -89,17 +89,7 @@ type RatingSearchResult struct {
 // @Failure      400,500 {object} map[string]interface{}
 // @Router       /api/users/search/specialists [post]
 func SearchSpecialists(w http.ResponseWriter, r *http.Request) {
-	email, _ := r.Context().Value("email").(string)
-	var currentUser models.User
-	if err := db.DB.Select("id, status, role").Where("email = ?", email).First(&currentUser).Error; err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
-		return
-	}
-	if currentUser.Role == "client" && currentUser.Status == "Disabled" {
-		utils.WriteError(w, http.StatusForbidden, "ACCOUNT_DISABLED", "Your account is disabled")
-		return
-	}
-
+	// Disabled and blocked accounts are already rejected by RequireUser
 	var req SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "INVALID_FORMAT", "Invalid request format")
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/audit"
+	"user-api/internal/db"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VerificationPolicy controls verification links and the cleanup of accounts that never verify their email
+type VerificationPolicy struct {
+	TokenTTL       time.Duration // how long a verification link stays valid
+	ResendCooldown time.Duration // minimum time between two emails to the same account
+	ReminderAfter  time.Duration // unverified accounts get one reminder after this long
+	PurgeAfter     time.Duration // unverified accounts are deleted after this long (and after the reminder)
+	SweepInterval  time.Duration // how often the sweeper runs; 0 disables it
+}
+
+// Verification is the active verification policy (config section [verification])
+var Verification VerificationPolicy
+
+// sweepBatchSize caps the accounts handled per sweep step, the rest waits for the next run
+const sweepBatchSize = 200
+
+// newVerificationPolicy builds the policy from the [verification] config section
+func newVerificationPolicy(section *ini.Section) VerificationPolicy {
+	day := 24 * time.Hour
+	policy := VerificationPolicy{
+		TokenTTL:       section.Key("token_ttl").MustDuration(24 * time.Hour),
+		ResendCooldown: section.Key("resend_cooldown").MustDuration(5 * time.Minute),
+		ReminderAfter:  time.Duration(section.Key("reminder_after_days").MustInt(3)) * day,
+		PurgeAfter:     time.Duration(section.Key("purge_after_days").MustInt(14)) * day,
+		SweepInterval:  section.Key("sweep_interval").MustDuration(time.Hour),
+	}
+	if policy.PurgeAfter <= policy.ReminderAfter {
+		log.Fatal().Msg("Invalid [verification] configuration: purge_after_days must be greater than reminder_after_days")
+	}
+	return policy
+}
+
+// sendVerificationEmail issues a new verification link (invalidating the previous one) and emails it in the background.
+// The reminder variant also tells the user when the account will be deleted.
+func sendVerificationEmail(user *models.User, reminder bool) error {
+	verifyURL, err := generateAndSaveVerification(user)
+	if err != nil {
+		return err
+	}
+
+	subject := "Confirm your email"
+	templatePath := cfg.Section("email").Key("template_path").String()
+	vars := []string{
+		"username=" + user.FirstName,
+		"email=" + user.Email,
+		"verify_link=" + verifyURL,
+	}
+	if reminder {
+		subject = "Please confirm your email"
+		templatePath = cfg.Section("email").Key("verify_reminder_template_path").MustString("./templates/verify-reminder.html")
+		purgeDate := time.Now().Add(Verification.PurgeAfter - Verification.ReminderAfter)
+		vars = append(vars, "purge_date="+purgeDate.Format("2006-01-02"))
+	}
+	go func(email string, userID uint64) {
+		if err := utils.SendEmail(email, subject, templatePath, vars); err != nil {
+			log.Error().Err(err).Uint64("user_id", userID).Msg("sendVerificationEmail: failed to send email")
+		}
+	}(user.Email, user.ID)
+	return nil
+}
+
+// ResendVerificationRequest is the body of POST /api/verify/resend
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// ResendVerification godoc
+// @Summary      Resend the verification email
+// @Description  Sends a new verification link to an unverified account; earlier links stop working. An account gets at most one email per verification.resend_cooldown (default 5 minutes). The response is identical whether or not the account exists or an email was sent.
+// @Tags         Actions for users
+// @Accept       json
+// @Produce      json
+// @Param        body body ResendVerificationRequest true "Account email"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,429 {object} map[string]interface{}
+// @Router       /api/verify/resend [post]
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+		return
+	}
+	if req.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MISSING_FIELDS", "email is required")
+		return
+	}
+
+	var user models.User
+	if err := db.DB.Where("email = ? AND verified = ? AND status = ?", req.Email, false, "Disabled").First(&user).Error; err == nil {
+		// Claim the cooldown slot atomically, so parallel requests send a single email
+		now := time.Now()
+		res := db.DB.Model(&models.User{}).
+			Where("id = ? AND token_sent_at <= ?", user.ID, now.Add(-Verification.ResendCooldown)).
+			Update("token_sent_at", now)
+		if res.Error != nil {
+			log.Error().Err(res.Error).Uint64("user_id", user.ID).Msg("ResendVerification: failed to claim cooldown")
+		} else if res.RowsAffected == 1 {
+			if err := sendVerificationEmail(&user, false); err != nil {
+				log.Error().Err(err).Uint64("user_id", user.ID).Msg("ResendVerification: failed to issue verification link")
+			}
+		} else {
+			log.Info().Uint64("user_id", user.ID).Msg("ResendVerification: cooldown active, email not sent")
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "If an unverified account with this email exists, a new verification link has been sent",
+	})
+}
+
+// AdminResendVerification godoc
+// @Summary      Resend the verification email (admin)
+// @Description  Sends a new verification link to an unverified user regardless of the resend cooldown; earlier links stop working
+// @Tags         Actions for administrators
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400,404,409,500 {object} map[string]interface{}
+// @Router       /api/admin/users/{id}/verification/resend [post]
+// @Security     BearerAuth
+func AdminResendVerification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, id).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+	if user.Verified {
+		utils.WriteError(w, http.StatusConflict, "ALREADY_VERIFIED", "User has already verified the email")
+		return
+	}
+
+	before := map[string]interface{}{"tokenSentAt": user.TokenSentAt}
+	if err := sendVerificationEmail(&user, false); err != nil {
+		log.Error().Err(err).Uint64("user_id", user.ID).Msg("AdminResendVerification: failed to issue verification link")
+		utils.WriteError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to issue verification link")
+		return
+	}
+	audit.Record(r, "user.verification_resend", audit.TargetUser, user.ID, before, map[string]interface{}{"tokenSentAt": user.TokenSentAt})
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+// StartVerificationSweeper runs SweepUnverifiedAccounts every Verification.SweepInterval until ctx is done.
+// Several instances may run it at once: every account is claimed with a conditional update or a row lock.
+func StartVerificationSweeper(ctx context.Context) {
+	if Verification.SweepInterval <= 0 {
+		log.Info().Msg("Verification sweeper disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(Verification.SweepInterval)
+		defer ticker.Stop()
+		for {
+			reminded, purged, err := SweepUnverifiedAccounts(time.Now())
+			if err != nil {
+				log.Error().Err(err).Msg("Verification sweeper failed")
+			} else if reminded > 0 || purged > 0 {
+				log.Info().Int("reminded", reminded).Int("purged", purged).Msg("Verification sweeper finished")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// SweepUnverifiedAccounts sends one reminder to accounts still unverified after Verification.ReminderAfter
+// and deletes accounts still unverified after Verification.PurgeAfter. An account is deleted only once the
+// reminder is at least PurgeAfter-ReminderAfter old, so every user gets the full notice period.
+// Accounts activated by an administrator (status other than Disabled) are left alone.
+func SweepUnverifiedAccounts(now time.Time) (reminded, purged int, err error) {
+	var toRemind []models.User
+	if err = db.DB.Where("verified = ? AND status = ? AND reminded_at IS NULL AND created_at <= ?",
+		false, "Disabled", now.Add(-Verification.ReminderAfter)).
+		Limit(sweepBatchSize).Find(&toRemind).Error; err != nil {
+		return 0, 0, err
+	}
+	for i := range toRemind {
+		user := &toRemind[i]
+		res := db.DB.Model(&models.User{}).Where("id = ? AND reminded_at IS NULL", user.ID).Update("reminded_at", now)
+		if res.Error != nil {
+			return reminded, purged, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // claimed by another instance
+		}
+		user.RemindedAt = &now
+		if err := sendVerificationEmail(user, true); err != nil {
+			log.Error().Err(err).Uint64("user_id", user.ID).Msg("SweepUnverifiedAccounts: failed to issue reminder")
+			continue
+		}
+		reminded++
+	}
+
+	var toPurge []uint64
+	if err = db.DB.Model(&models.User{}).
+		Where("verified = ? AND status = ? AND created_at <= ? AND reminded_at <= ?",
+			false, "Disabled", now.Add(-Verification.PurgeAfter), now.Add(-(Verification.PurgeAfter-Verification.ReminderAfter))).
+		Limit(sweepBatchSize).Pluck("id", &toPurge).Error; err != nil {
+		return reminded, purged, err
+	}
+	for _, id := range toPurge {
+		deleted, err := purgeUnverifiedUser(id)
+		if err != nil {
+			return reminded, purged, err
+		}
+		if deleted {
+			log.Info().Uint64("user_id", id).Msg("SweepUnverifiedAccounts: unverified account deleted")
+			purged++
+		}
+	}
+	return reminded, purged, nil
+}
+
+// purgeUnverifiedUser deletes an account that never verified its email, with the rows created for it.
+// The user row is locked and re-checked first, so a concurrent verification wins over the purge.
+func purgeUnverifiedUser(id uint64) (bool, error) {
+	deleted := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND verified = ? AND status = ?", id, false, "Disabled").
+			First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+
+		if err := deleteUserData(tx, &user); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
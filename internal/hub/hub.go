@@ -16,6 +16,7 @@ type WSMessage struct {
 	SenderName     string    `json:"senderName"`
 	Content        string    `json:"content"`
 	CreatedAt      time.Time `json:"createdAt"`
+	Error          string    `json:"error,omitempty"` // set on messages sent back to the sender only (e.g. RATE_LIMITED)
 }
 
 // Client represents an active WebSocket connection
@@ -0,0 +1,112 @@
+package keyring
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/rs/zerolog/log"
+)
+
+// legacyKeyID is the ID of the key built from the old single-secret settings in [auth]
+const legacyKeyID = "default"
+
+// User signs user access tokens, UserRefresh user refresh tokens, Admin administrator tokens
+var (
+	User        *Ring
+	UserRefresh *Ring
+	Admin       *Ring
+)
+
+func init() {
+	cfg, err := ini.Load("config.ini")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config.ini")
+	}
+	if User, err = Load(cfg, "user", "jwt_user_secret"); err != nil {
+		log.Fatal().Err(err).Msg("Invalid user JWT key ring")
+	}
+	if UserRefresh, err = Load(cfg, "user_refresh", "jwt_user_refresh_secret"); err != nil {
+		log.Fatal().Err(err).Msg("Invalid user refresh JWT key ring")
+	}
+	if Admin, err = Load(cfg, "admin", "jwt_admin_secret"); err != nil {
+		log.Fatal().Err(err).Msg("Invalid admin JWT key ring")
+	}
+}
+
+// Load builds the ring "name" from config. Keys are child sections of [jwt_keys.<name>]:
+//
+//	[jwt_keys.user]
+//	active = 2026-10
+//
+//	[jwt_keys.user.2026-10]
+//	alg              = RS256            ; HS256, RS256 or EdDSA
+//	private_key_file = ./keys/user.pem  ; or public_key_file (verify only), or secret for HS256
+//	expires          = 2027-01-01T00:00:00Z
+//	legacy           = false            ; also accept tokens without a kid header
+//
+// Without key sections the ring holds one HS256 key from [auth] <legacySecret>, which also accepts
+// tokens issued before key IDs were introduced.
+func Load(cfg *ini.File, name, legacySecret string) (*Ring, error) {
+	section := cfg.Section("jwt_keys." + name)
+	children := section.ChildSections()
+	if len(children) == 0 {
+		secret := cfg.Section("auth").Key(legacySecret).String()
+		if secret == "" {
+			return nil, fmt.Errorf("ring %q: no keys configured and [auth] %s is empty", name, legacySecret)
+		}
+		key := NewHMACKey(legacyKeyID, []byte(secret))
+		key.Legacy = true
+		return NewRing(legacyKeyID, key)
+	}
+
+	keys := make([]*Key, 0, len(children))
+	for _, child := range children {
+		key, err := loadKey(strings.TrimPrefix(child.Name(), section.Name()+"."), child)
+		if err != nil {
+			return nil, fmt.Errorf("ring %q: %w", name, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewRing(section.Key("active").String(), keys...)
+}
+
+func loadKey(id string, section *ini.Section) (*Key, error) {
+	alg := section.Key("alg").MustString("HS256")
+
+	var key *Key
+	if alg == "HS256" {
+		secret := section.Key("secret").String()
+		if secret == "" {
+			return nil, fmt.Errorf("key %q: secret is required for HS256", id)
+		}
+		key = NewHMACKey(id, []byte(secret))
+	} else {
+		path := section.Key("private_key_file").String()
+		if path == "" {
+			path = section.Key("public_key_file").String()
+		}
+		if path == "" {
+			return nil, fmt.Errorf("key %q: private_key_file or public_key_file is required for %s", id, alg)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		if key, err = NewKeyFromPEM(id, alg, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if raw := section.Key("expires").String(); raw != "" {
+		expires, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid expires %q, expected RFC 3339", id, raw)
+		}
+		key.ExpiresAt = expires
+	}
+	key.Legacy = section.Key("legacy").MustBool(false)
+	return key, nil
+}
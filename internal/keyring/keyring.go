@@ -0,0 +1,201 @@
+// Package keyring holds the JWT signing keys. Every token is signed by the active key of a ring
+// and carries its key ID in the "kid" header; older keys keep verifying tokens until they expire,
+// so a key can be rotated without signing everyone out.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	errUnknownKey = errors.New("unknown signing key")
+	errExpiredKey = errors.New("signing key expired")
+)
+
+// Key is one signing or verification key of a ring
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	ExpiresAt time.Time // the key stops verifying tokens after this time (zero: never)
+	Legacy    bool      // also verifies tokens issued before key IDs existed (no kid header)
+
+	signKey   interface{} // nil for verification-only keys
+	verifyKey interface{}
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewKeyFromPEM creates an RS256 or EdDSA key from a PEM block. A private key can sign and verify,
+// a public key only verifies.
+func NewKeyFromPEM(id, alg string, data []byte) (*Key, error) {
+	switch alg {
+	case "RS256":
+		key := &Key{ID: id, Method: jwt.SigningMethodRS256}
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.signKey, key.verifyKey = private, &private.PublicKey
+			return key, nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		key.verifyKey = public
+		return key, nil
+	case "EdDSA":
+		key := &Key{ID: id, Method: jwt.SigningMethodEdDSA}
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			edPrivate := private.(ed25519.PrivateKey)
+			key.signKey, key.verifyKey = edPrivate, edPrivate.Public()
+			return key, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		key.verifyKey = public
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q (use HS256, RS256 or EdDSA)", id, alg)
+	}
+}
+
+// CanSign reports whether the key holds a private part (or a secret)
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Ring is a set of keys with one active signing key
+type Ring struct {
+	active *Key
+	keys   map[string]*Key
+	now    func() time.Time
+}
+
+// NewRing creates a ring; active is the ID of the key used to sign new tokens
+func NewRing(active string, keys ...*Key) (*Ring, error) {
+	r := &Ring{keys: make(map[string]*Key, len(keys)), now: time.Now}
+	for _, k := range keys {
+		if _, exists := r.keys[k.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID %q", k.ID)
+		}
+		r.keys[k.ID] = k
+	}
+	r.active = r.keys[active]
+	if r.active == nil {
+		return nil, fmt.Errorf("active key %q is not in the ring", active)
+	}
+	if !r.active.CanSign() {
+		return nil, fmt.Errorf("active key %q has no private key", active)
+	}
+	return r, nil
+}
+
+// SetClock replaces the time source (used by tests)
+func (r *Ring) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// Active returns the signing key
+func (r *Ring) Active() *Key {
+	return r.active
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (r *Ring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.signKey)
+}
+
+// Keyfunc selects the verification key of a token by its kid header; use it with jwt.Parse.
+// The token algorithm must match the key, so a public key can never be used as an HMAC secret.
+func (r *Ring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	var key *Key
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = r.keys[kid]
+	} else {
+		for _, k := range r.keys {
+			if k.Legacy {
+				key = k
+				break
+			}
+		}
+	}
+	if key == nil {
+		return nil, errUnknownKey
+	}
+	if !key.ExpiresAt.IsZero() && r.now().After(key.ExpiresAt) {
+		return nil, errExpiredKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), key.ID)
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS returns the public keys of the ring that are still valid. HMAC secrets are never published.
+func (r *Ring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	now := r.now()
+	for _, k := range r.keys {
+		if !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt) {
+			continue
+		}
+		switch public := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, rsaJWK(k, public))
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, ed25519JWK(k, public))
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// Derive returns an HS256 ring for the service's own short-lived tokens (two-factor challenges,
+// registration tokens) that must never pass as tokens of this ring. Every key that can sign yields a
+// secret derived from its private part and purpose, with the same ID, expiry and legacy flag, so the
+// derived keys rotate with the ring.
+func (r *Ring) Derive(purpose string) *Ring {
+	derived := &Ring{keys: make(map[string]*Key, len(r.keys)), now: r.now}
+	for id, k := range r.keys {
+		material := k.secret()
+		if material == nil {
+			continue
+		}
+		mac := hmac.New(sha256.New, material)
+		mac.Write([]byte(purpose))
+		key := NewHMACKey(id, mac.Sum(nil))
+		key.ExpiresAt, key.Legacy = k.ExpiresAt, k.Legacy
+		derived.keys[id] = key
+	}
+	derived.active = derived.keys[r.active.ID]
+	return derived
+}
+
+// secret returns the private key material of a signing key, nil for verification-only keys
+func (k *Key) secret() []byte {
+	switch private := k.signKey.(type) {
+	case []byte:
+		return private
+	case *rsa.PrivateKey:
+		return x509.MarshalPKCS1PrivateKey(private)
+	case ed25519.PrivateKey:
+		return private
+	default:
+		return nil
+	}
+}
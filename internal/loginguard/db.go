@@ -0,0 +1,78 @@
+package loginguard
+
+import (
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps entries in the login_attempts table so that every instance sees the same counters
+type DBStore struct{}
+
+// NewDBStore creates a database store (uses the global db.DB connection)
+func NewDBStore() *DBStore {
+	return &DBStore{}
+}
+
+// Get returns the entry of a key
+func (s *DBStore) Get(key string) (Entry, error) {
+	var row models.LoginAttempt
+	err := db.DB.Where("`key` = ?", key).Limit(1).Find(&row).Error
+	if err != nil {
+		return Entry{}, err
+	}
+	return toEntry(row), nil
+}
+
+// Update applies fn to the entry of a key inside a transaction holding a row lock
+func (s *DBStore) Update(key string, fn func(*Entry)) (Entry, error) {
+	var entry Entry
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists, then lock it; concurrent inserts of the same key are ignored
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+		var row models.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		entry = toEntry(row)
+		fn(&entry)
+
+		return tx.Model(&models.LoginAttempt{}).Where("`key` = ?", key).Updates(map[string]interface{}{
+			"failures":      entry.Failures,
+			"blocked_until": nullableTime(entry.BlockedUntil),
+			"locked_out":    entry.LockedOut,
+			"last_failure":  nullableTime(entry.LastFailure),
+			"updated_at":    time.Now(),
+		}).Error
+	})
+	return entry, err
+}
+
+// Delete removes a key
+func (s *DBStore) Delete(key string) error {
+	return db.DB.Where("`key` = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func toEntry(row models.LoginAttempt) Entry {
+	entry := Entry{Failures: row.Failures, LockedOut: row.LockedOut}
+	if row.BlockedUntil != nil {
+		entry.BlockedUntil = *row.BlockedUntil
+	}
+	if row.LastFailure != nil {
+		entry.LastFailure = *row.LastFailure
+	}
+	return entry
+}
+
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,182 @@
+// Package loginguard tracks failed login attempts per account and per client IP.
+// Repeated failures are slowed down with exponential backoff and, past a threshold,
+// the key is locked out for a fixed period.
+package loginguard
+
+import (
+	"strings"
+	"time"
+)
+
+// Entry is the failed-attempt state of one key (an account or a client IP)
+type Entry struct {
+	Failures     int       `json:"failures"`
+	BlockedUntil time.Time `json:"blockedUntil"`
+	LockedOut    bool      `json:"lockedOut"` // the lockout threshold was reached, not just a backoff delay
+	LastFailure  time.Time `json:"lastFailure"`
+}
+
+// Store keeps entries. Update must apply fn atomically, so several instances can share one store.
+type Store interface {
+	Get(key string) (Entry, error) // zero Entry for unknown keys
+	Update(key string, fn func(*Entry)) (Entry, error)
+	Delete(key string) error
+}
+
+// Policy describes how failures of one kind of key are throttled
+type Policy struct {
+	FreeAttempts     int           // failures allowed without any delay
+	BaseDelay        time.Duration // delay after the first throttled failure, doubled on each next one
+	MaxDelay         time.Duration // cap of the backoff delay
+	LockoutThreshold int           // failures that lock the key out (0 disables lockout)
+	LockoutDuration  time.Duration
+	ResetAfter       time.Duration // failures older than this are forgotten
+}
+
+// delay returns the backoff delay after the given number of failures
+func (p Policy) delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Status is the state of a key as seen at a given time
+type Status struct {
+	Failures    int        `json:"failures"`
+	Locked      bool       `json:"locked"`
+	LockedUntil *time.Time `json:"lockedUntil"`
+	RetryAfter  int        `json:"retryAfterSeconds"`
+}
+
+// Guard applies the account and IP policies on top of a store
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+// New creates a guard
+func New(store Store, account, ip Policy) *Guard {
+	return &Guard{store: store, account: account, ip: ip, now: time.Now}
+}
+
+// SetClock replaces the time source (used by tests)
+func (g *Guard) SetClock(now func() time.Time) {
+	g.now = now
+}
+
+// AccountKey returns the key of an account, e.g. AccountKey("user", "a@b.c")
+func AccountKey(accountType, identifier string) string {
+	return accountType + ":" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller has to wait before trying again; 0 means the attempt is allowed.
+// An empty account skips the account check (e.g. when the account is not known yet).
+func (g *Guard) Check(account, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range g.keys(account, ip) {
+		entry, err := g.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := entry.BlockedUntil.Sub(g.now()); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt. lockedNow is true when this failure locked the account out,
+// so the caller can notify the owner exactly once.
+func (g *Guard) Fail(account, ip string) (lockedNow bool, err error) {
+	now := g.now()
+	if ip != "" {
+		if _, err := g.store.Update(ipKey(ip), func(e *Entry) { g.ip.apply(e, now) }); err != nil {
+			return false, err
+		}
+	}
+	if account != "" {
+		if _, err := g.store.Update(account, func(e *Entry) { lockedNow = g.account.apply(e, now) }); err != nil {
+			return false, err
+		}
+	}
+	return lockedNow, nil
+}
+
+// Succeed forgets the failures of an account after a successful login
+func (g *Guard) Succeed(account string) error {
+	return g.store.Delete(account)
+}
+
+// Status returns the current state of an account
+func (g *Guard) Status(account string) (Status, error) {
+	entry, err := g.store.Get(account)
+	if err != nil {
+		return Status{}, err
+	}
+	now := g.now()
+	status := Status{Failures: entry.Failures}
+	if g.account.ResetAfter > 0 && !entry.LastFailure.IsZero() && now.Sub(entry.LastFailure) > g.account.ResetAfter {
+		status.Failures = 0
+	}
+	if entry.BlockedUntil.After(now) {
+		until := entry.BlockedUntil
+		status.Locked = entry.LockedOut
+		status.LockedUntil = &until
+		status.RetryAfter = int(until.Sub(now).Seconds()) + 1
+	}
+	return status, nil
+}
+
+// Unlock clears the state of an account (admin action)
+func (g *Guard) Unlock(account string) error {
+	return g.store.Delete(account)
+}
+
+func (g *Guard) keys(account, ip string) []string {
+	keys := make([]string, 0, 2)
+	if account != "" {
+		keys = append(keys, account)
+	}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+// apply counts one failure at time now and reports whether it started a lockout
+func (p Policy) apply(e *Entry, now time.Time) bool {
+	expired := p.ResetAfter > 0 && !e.LastFailure.IsZero() && now.Sub(e.LastFailure) > p.ResetAfter
+	if expired || (e.LockedOut && !e.BlockedUntil.After(now)) {
+		// Start over once the failures are old or a lockout has been served
+		*e = Entry{}
+	}
+
+	e.Failures++
+	e.LastFailure = now
+
+	if p.LockoutThreshold > 0 && e.Failures >= p.LockoutThreshold {
+		lockedNow := !e.LockedOut
+		e.LockedOut = true
+		e.BlockedUntil = now.Add(p.LockoutDuration)
+		return lockedNow
+	}
+	if delay := p.delay(e.Failures); delay > 0 {
+		e.BlockedUntil = now.Add(delay)
+	}
+	return false
+}
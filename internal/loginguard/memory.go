@@ -0,0 +1,65 @@
+package loginguard
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many updates the memory store handles between sweeps of idle entries
+const pruneEvery = 1000
+
+// MemoryStore keeps entries in process memory. It is the default store and only suits a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	maxIdle time.Duration
+	updates int
+}
+
+// NewMemoryStore creates a memory store that drops entries idle for longer than maxIdle
+func NewMemoryStore(maxIdle time.Duration) *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), maxIdle: maxIdle}
+}
+
+// Get returns the entry of a key
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+// Update applies fn to the entry of a key under the store lock
+func (s *MemoryStore) Update(key string, fn func(*Entry)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[key]
+	fn(&entry)
+	s.entries[key] = entry
+
+	s.updates++
+	if s.updates%pruneEvery == 0 {
+		s.prune(time.Now())
+	}
+	return entry, nil
+}
+
+// Delete removes a key
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// prune drops entries that are neither blocked nor recently failed; the caller holds the lock
+func (s *MemoryStore) prune(now time.Time) {
+	if s.maxIdle <= 0 {
+		return
+	}
+	for key, entry := range s.entries {
+		if !entry.BlockedUntil.After(now) && now.Sub(entry.LastFailure) > s.maxIdle {
+			delete(s.entries, key)
+		}
+	}
+}
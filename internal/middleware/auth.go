@@ -1,18 +1,22 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 	"strings"
+	"time"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
 	"user-api/internal/handlers"
+	"user-api/internal/keyring"
 	"user-api/internal/models"
+	"user-api/internal/tokens"
 	"user-api/internal/db"
 	"user-api/internal/utils"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog/log"
 	"github.com/go-ini/ini"
-	"encoding/json"
 )
 
 var cfg *ini.File
@@ -23,8 +27,11 @@ func init() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load config.ini")
 	}
+	auth.Principals = auth.NewPrincipalCache(cfg.Section("auth").Key("principal_cache_ttl").MustDuration(30 * time.Second))
 }
 
+// RequireAdmin validates the admin JWT, loads the active administrator and stores it in the context
+// (see auth.AdminFromContext). Route permissions are checked separately by RequirePermission.
 func RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenHeader := r.Header.Get("Authorization")
@@ -36,31 +43,59 @@ func RequireAdmin(next http.Handler) http.Handler {
 
 		tokenStr := strings.TrimPrefix(tokenHeader, "Bearer ")
 		claims := &handlers.Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(cfg.Section("auth").Key("jwt_admin_secret").String()), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenStr, claims, keyring.Admin.Keyfunc)
 
-		if err != nil || !token.Valid || claims.Role != "admin" {
-			log.Warn().Str("error", err.Error()).Str("role", claims.Role).Msg("RequireAdmin: Invalid token or insufficient privileges")
-			http.Error(w, "Forbidden", http.StatusForbidden)
+		// Refresh tokens carry a device ID and are never valid as access tokens
+		if err != nil || !token.Valid || claims.DeviceID != 0 {
+			log.Warn().Err(err).Msg("RequireAdmin: Invalid token")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		log.Info().Str("username", claims.Username).Msg("RequireAdmin: Authorized admin access")
-
 		// Після перевірки токена:
 		var admin models.Administrator
-		if err := db.DB.Where("role = ?", claims.Username).First(&admin).Error; err != nil {
-			log.Warn().Err(err).Msg("RequireAdmin: Failed to load admin from DB")
+		if err := db.DB.Where("username = ? AND status = ?", claims.Username, "Active").First(&admin).Error; err != nil {
+			log.Warn().Err(err).Str("username", claims.Username).Msg("RequireAdmin: Failed to load admin from DB")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		ctx := context.WithValue(r.Context(), "admin", &admin)
-		next.ServeHTTP(w, r.WithContext(ctx))
+
+		// The role is taken from the database so a demotion applies to already issued tokens
+		if !auth.IsAdminRole(admin.Role) {
+			log.Warn().Str("username", admin.Username).Str("role", admin.Role).Msg("RequireAdmin: Unknown administrator role")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		log.Info().Str("username", admin.Username).Str("role", admin.Role).Msg("RequireAdmin: Authorized admin access")
+
+		next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), &admin)))
 	})
 }
 
-// RequireUser checks for a valid JWT token and ensures the user is active.
+// RequirePermission allows the request only if the administrator loaded by RequireAdmin
+// has the given permission (e.g. "users.delete").
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			admin, ok := auth.AdminFromContext(r.Context())
+			if !ok {
+				utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+				return
+			}
+			if !auth.Can(admin.Role, permission) {
+				log.Warn().Str("username", admin.Username).Str("role", admin.Role).Str("permission", permission).
+					Msg("RequirePermission: Access denied")
+				utils.WriteError(w, http.StatusForbidden, "FORBIDDEN", "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser checks for a valid JWT token, loads the user (see auth.Principals) and ensures it is active.
+// Handlers read the user with auth.PrincipalFromContext.
 func RequireUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenHeader := r.Header.Get("Authorization")
@@ -77,65 +112,133 @@ func RequireUser(next http.Handler) http.Handler {
 		}
 
 		token := tokenParts[1]
-		claims, err := utils.ParseAccessToken(token)
+		claims, err := tokens.Default.ParseAccess(token)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		// Add user info to context
-		ctx := context.WithValue(r.Context(), "username", claims.Username)
-		ctx = context.WithValue(ctx, "email", claims.Username) // Добавляем email тоже
-		ctx = context.WithValue(ctx, "role", claims.Role)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		principal, err := auth.Principals.Get(claims.UserID(), handlers.LoadPrincipal)
+		if err != nil {
+			log.Warn().Err(err).Uint64("user_id", claims.UserID()).Msg("RequireUser: Failed to load user")
+			utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+			return
+		}
+
+		if !requireActive(w, principal) {
+			return
+		}
+
+		if claims.Actor != nil {
+			serveImpersonated(w, r, next, principal, claims.Actor)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 	})
 }
 
-// Псевдокод для login handler
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Warn().Err(err).Msg("LoginHandler: Invalid request payload")
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+// requireActive writes 403 unless the account is active. The status is checked on every request
+// so blocking a user does not wait for the token to expire.
+func requireActive(w http.ResponseWriter, principal *auth.AuthPrincipal) bool {
+	switch principal.Status {
+	case "Active":
+		return true
+	case "Blocked":
+		utils.WriteError(w, http.StatusForbidden, "ACCOUNT_BLOCKED", "Your account has been blocked")
+	default:
+		utils.WriteError(w, http.StatusForbidden, "ACCOUNT_DISABLED", "Your account is disabled")
 	}
+	return false
+}
 
-	// Validate user credentials (this is just pseudocode, implement your own logic)
-	if user.Email == "" || user.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
-		return
+// RequireUserOrAPIKey accepts a personal API key ("Authorization: ApiKey <key>") as well as the Bearer JWT
+// handled by RequireUser. Requests with a key carry its scopes in the principal; guard every route with RequireScope.
+func RequireUserOrAPIKey(next http.Handler) http.Handler {
+	requireUser := RequireUser(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plain, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+		if !ok {
+			requireUser.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := handlers.AuthenticateAPIKey(strings.TrimSpace(plain), utils.ClientIP(r))
+		if err != nil {
+			utils.WriteError(w, http.StatusUnauthorized, "INVALID_API_KEY", "Invalid, revoked or expired API key")
+			return
+		}
+
+		principal, err := auth.Principals.Get(key.UserID, handlers.LoadPrincipal)
+		if err != nil {
+			log.Warn().Err(err).Uint64("user_id", key.UserID).Msg("RequireUserOrAPIKey: Failed to load user")
+			utils.WriteError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+			return
+		}
+		if !requireActive(w, principal) {
+			return
+		}
+
+		// The cached principal is shared between requests, so the key goes on a copy
+		withKey := *principal
+		withKey.APIKeyID = key.ID
+		withKey.Scopes = key.ScopeList()
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), &withKey)))
+	})
+}
+
+// RequireScope lets API key requests through only when the key has the scope; JWT requests always pass
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				utils.WriteError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+				return
+			}
+			if !principal.HasScope(scope) {
+				utils.WriteError(w, http.StatusForbidden, "INSUFFICIENT_SCOPE", "The API key lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	// Check if user exists and password matches
-	var dbUser models.User
-	if err := db.DB.Where("email = ?", user.Email).First(&dbUser).Error; err != nil {
-		log.Warn().Err(err).Msg("LoginHandler: User not found")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// serveImpersonated serves a request made with an impersonation token. The administrator must still be
+// active and allowed to impersonate; every request is written to the audit log with its response status.
+func serveImpersonated(w http.ResponseWriter, r *http.Request, next http.Handler, principal *auth.AuthPrincipal, actor *tokens.Actor) {
+	var admin models.Administrator
+	if err := db.DB.Where("id = ? AND status = ?", actor.AdminID(), "Active").First(&admin).Error; err != nil ||
+		!auth.Can(admin.Role, auth.PermUsersImpersonate) {
+		log.Warn().Uint64("admin_id", actor.AdminID()).Uint64("user_id", principal.UserID).Msg("RequireUser: impersonation no longer allowed")
+		utils.WriteError(w, http.StatusUnauthorized, "IMPERSONATION_REVOKED", "Impersonation is no longer allowed")
 		return
 	}
 
-	accessToken, _ := utils.GenerateAccessToken(&dbUser)
-	refreshToken, _ := utils.GenerateRefreshToken(&dbUser)
+	// The cached principal is shared between requests, so the impersonator goes on a copy
+	impersonated := *principal
+	impersonated.Impersonator = &auth.Impersonator{AdminID: admin.ID, Username: admin.Username}
 
-	// Update refresh token in DB
-	dbUser.RefreshToken = refreshToken
-	if err := db.DB.Save(&dbUser).Error; err != nil {
-		log.Error().Err(err).Msg("LoginHandler: Failed to save refresh token")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	next.ServeHTTP(ww, r.WithContext(auth.WithPrincipal(r.Context(), &impersonated)))
 
-	// Set refresh token cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		HttpOnly: true,
-		Path:     "/api/auth/refresh",
-		MaxAge:   7 * 24 * 3600,
-	})
+	log.Info().Str("admin", admin.Username).Uint64("user_id", principal.UserID).Str("method", r.Method).
+		Str("path", r.URL.Path).Int("status", ww.Status()).Msg("RequireUser: impersonated request")
+	audit.Record(r.WithContext(auth.WithAdmin(r.Context(), &admin)), "user.impersonated_request", audit.TargetUser, principal.UserID,
+		nil, map[string]interface{}{"method": r.Method, "path": r.URL.Path, "status": ww.Status()})
+}
 
-	// Respond with access token
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"access_token": accessToken,
+// DenyImpersonation rejects the request when an administrator is impersonating the user.
+// It guards actions that only the account owner may take (password, email, sign-in methods, chat messages).
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok && principal.IsImpersonated() {
+			log.Warn().Str("admin", principal.Impersonator.Username).Uint64("user_id", principal.UserID).
+				Str("path", r.URL.Path).Msg("DenyImpersonation: action blocked while impersonating")
+			utils.WriteError(w, http.StatusForbidden, "IMPERSONATION_FORBIDDEN", "This action is not allowed while impersonating a user")
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/handlers"
+	"user-api/internal/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RateLimit throttles a route with a named policy from the [rate_limit] config section.
+// Requests are counted per user when RequireUser has run before it, otherwise per client IP.
+// Every response carries the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers.
+func RateLimit(policy string) func(http.Handler) http.Handler {
+	p, ok := handlers.RateLimiter.Policy(policy)
+	if !ok {
+		log.Fatal().Str("policy", policy).Msg("RateLimit: unknown rate limit policy")
+	}
+	policyHeader := strconv.Itoa(p.Limit) + ";w=" + strconv.Itoa(int(p.Period.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + utils.ClientIP(r)
+			if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+				key = "user:" + strconv.FormatUint(principal.UserID, 10)
+			}
+
+			result, err := handlers.RateLimiter.Allow(policy, key)
+			if err != nil {
+				// Fail open: a broken limiter store must not take the API down
+				log.Error().Err(err).Str("policy", policy).Msg("RateLimit: limiter unavailable")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			w.Header().Set("RateLimit-Policy", policyHeader)
+
+			if !result.Allowed {
+				log.Warn().Str("policy", policy).Str("key", key).Msg("RateLimit: request throttled")
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				utils.WriteError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests, please try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
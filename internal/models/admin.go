@@ -14,7 +14,9 @@ type Administrator struct {
 	Phone        *string `gorm:"type:varchar(20)"`
 	Status       string  `gorm:"type:enum('Active', 'Disabled');not null;default:Active"`
 	Role         string  `gorm:"type:enum('admin', 'moderator', 'master');not null;default:'admin'"`
-	RefreshToken string  `gorm:"type:text"`
+	TOTPSecret   string  `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabled  bool    `gorm:"not null;default:false"`
+	TOTPLastStep int64   `gorm:"not null;default:0" json:"-"`
 
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a personal API key of a user, used by integrations with "Authorization: ApiKey <key>".
+// Only the SHA-256 hash of the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     uint64     `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"` // start of the key, to recognise it in the list
+	KeyHash    string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"-"` // space-separated, e.g. "sessions:read availability:write"
+	LastUsedAt *time.Time `gorm:"" json:"lastUsedAt"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"lastUsedIp"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt  *time.Time `gorm:"" json:"-"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// ScopeList returns the scopes of the key
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
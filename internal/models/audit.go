@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent records one mutating action performed by an administrator
+type AuditEvent struct {
+	ID            uint64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	ActorID       uint64          `gorm:"not null;index" json:"actorId"`
+	ActorUsername string          `gorm:"type:varchar(100);not null" json:"actorUsername"`
+	Action        string          `gorm:"type:varchar(64);not null;index" json:"action"`
+	TargetType    string          `gorm:"type:varchar(64);not null;index:idx_audit_target" json:"targetType"`
+	TargetID      string          `gorm:"type:varchar(64);index:idx_audit_target" json:"targetId"`
+	Changes       json.RawMessage `gorm:"type:json" json:"changes" swaggertype:"object"`
+	IP            string          `gorm:"type:varchar(45)" json:"ip"`
+	RequestID     string          `gorm:"type:varchar(64)" json:"requestId"`
+	CreatedAt     time.Time       `gorm:"autoCreateTime;index" json:"createdAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// EmailChange is a self-service email change. The address is switched only after the link sent to
+// the new address is confirmed; the link sent to the old address cancels the request, or reverts
+// the switch for 48 hours after it. Only SHA-256 hashes of both tokens are stored.
+type EmailChange struct {
+	ID               uint64     `gorm:"primaryKey;autoIncrement"`
+	UserID           uint64     `gorm:"not null;index"`
+	OldEmail         string     `gorm:"type:varchar(255);not null"`
+	NewEmail         string     `gorm:"type:varchar(255);not null"`
+	ConfirmTokenHash string     `gorm:"type:char(64);uniqueIndex;not null"`
+	UndoTokenHash    string     `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt        time.Time  `gorm:"not null"` // the confirmation link expires, the undo link does not
+	ConfirmedAt      *time.Time `gorm:""`
+	CanceledAt       *time.Time `gorm:""` // superseded by a newer request or canceled from the old address
+	RevertedAt       *time.Time `gorm:""`
+	RequestIP        string     `gorm:"type:varchar(45)"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+}
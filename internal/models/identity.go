@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID provider. The (provider, subject)
+// pair is what the provider guarantees to be stable; the email is kept for display only.
+type UserIdentity struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint64     `gorm:"not null;index" json:"-"`
+	Provider    string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject     string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email       string     `gorm:"type:varchar(255)" json:"email"`
+	LastLoginAt *time.Time `gorm:"" json:"lastLoginAt"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// OIDCLoginState is one authorization code login in progress. It is created when the user is sent
+// to the provider and consumed by the callback. Only hashes of the state and of the browser binding
+// cookie are stored; the nonce and PKCE verifier never leave the server.
+type OIDCLoginState struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement"`
+	StateHash    string     `gorm:"type:char(64);uniqueIndex;not null"`
+	BindingHash  string     `gorm:"type:char(64);not null"`
+	Provider     string     `gorm:"type:varchar(50);not null"`
+	Nonce        string     `gorm:"type:varchar(64);not null"`
+	CodeVerifier string     `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time  `gorm:"not null"`
+	UsedAt       *time.Time `gorm:""`
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+}
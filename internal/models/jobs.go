@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// JobLease lets one instance at a time run a background job. An instance owns the lease of a job
+// until ExpiresAt and renews it while the job runs; an expired lease may be taken by any instance.
+type JobLease struct {
+	Name      string    `gorm:"type:varchar(64);primaryKey" json:"name"`
+	Owner     string    `gorm:"type:varchar(128);not null;default:''" json:"owner"`
+	ExpiresAt time.Time `gorm:"type:datetime(6);not null" json:"expiresAt"`
+}
+
+// JobRun is the status of one run of a background job, shown to administrators
+type JobRun struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Job          string     `gorm:"type:varchar(64);not null;index:idx_job_runs_job" json:"job"`
+	Instance     string     `gorm:"type:varchar(128);not null" json:"instance"`
+	Status       string     `gorm:"type:enum('running','succeeded','failed');not null;default:'running'" json:"status"`
+	StartedAt    time.Time  `gorm:"type:datetime(6);not null;index:idx_job_runs_job" json:"startedAt"`
+	FinishedAt   *time.Time `gorm:"type:datetime(6)" json:"finishedAt"`
+	Processed    int        `gorm:"not null;default:0" json:"processed"`    // psychologists handled
+	Failed       int        `gorm:"not null;default:0" json:"failed"`       // psychologists that failed
+	Generated    int        `gorm:"not null;default:0" json:"generated"`    // slots created
+	RemovedStale int64      `gorm:"not null;default:0" json:"removedStale"` // unbooked slots in the past deleted
+	Error        string     `gorm:"type:text" json:"error"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginAttempt is the failed-login state of one account or client IP.
+// Used by the database store of the login guard so that several instances share the counters.
+type LoginAttempt struct {
+	Key          string     `gorm:"type:varchar(191);primaryKey" json:"key"`
+	Failures     int        `gorm:"not null;default:0" json:"failures"`
+	BlockedUntil *time.Time `json:"blockedUntil"`
+	LockedOut    bool       `gorm:"not null;default:false" json:"lockedOut"`
+	LastFailure  *time.Time `json:"lastFailure"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime;index" json:"updatedAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MagicLinkToken is a single-use, expiring passwordless login link. Only SHA-256 hashes are stored:
+// of the token in the link and, when the link is bound to the requesting browser, of the binding cookie.
+type MagicLinkToken struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement"`
+	UserID      uint64     `gorm:"not null;index"`
+	TokenHash   string     `gorm:"type:char(64);uniqueIndex;not null"`
+	BindingHash string     `gorm:"type:char(64)"` // empty when the link works in any browser
+	ExpiresAt   time.Time  `gorm:"not null"`
+	UsedAt      *time.Time `gorm:""`
+	RequestIP   string     `gorm:"type:varchar(45)"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
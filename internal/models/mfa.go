@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MFARecoveryCode is a hashed one-time recovery code for an account with two-factor authentication enabled
+type MFARecoveryCode struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement"`
+	AccountType string     `gorm:"type:enum('user', 'admin');not null;index:idx_mfa_recovery_account"`
+	AccountID   uint64     `gorm:"not null;index:idx_mfa_recovery_account"`
+	CodeHash    string     `gorm:"type:char(64);not null"`
+	UsedAt      *time.Time `gorm:""`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
+
+// MFAPendingToken records a pending two-factor token (by its JWT ID) so that it completes only one login
+type MFAPendingToken struct {
+	JTI         string     `gorm:"primaryKey;type:char(32)"`
+	AccountType string     `gorm:"type:enum('user', 'admin');not null;index:idx_mfa_pending_account"`
+	AccountID   uint64     `gorm:"not null;index:idx_mfa_pending_account"`
+	ExpiresAt   time.Time  `gorm:"not null"`
+	UsedAt      *time.Time `gorm:""`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
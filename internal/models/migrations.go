@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// SchemaMigration marks a one-time data migration as applied, so it never runs again on later boots
+type SchemaMigration struct {
+	Name      string    `gorm:"type:varchar(100);primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
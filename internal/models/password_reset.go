@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use, expiring token issued by the "forgot password" flow.
+// Only the SHA-256 hash of the token is stored; the plain token exists only in the email link.
+type PasswordResetToken struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement"`
+	AccountType string     `gorm:"type:enum('user', 'admin');not null;index:idx_password_reset_account"`
+	AccountID   uint64     `gorm:"not null;index:idx_password_reset_account"`
+	TokenHash   string     `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt   time.Time  `gorm:"not null"`
+	UsedAt      *time.Time `gorm:""`
+	RequestIP   string     `gorm:"type:varchar(45)"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of one rate limit key.
+// Used by the database store of the rate limiter so that several instances share the limits.
+type RateLimitBucket struct {
+	Key        string     `gorm:"type:varchar(191);primaryKey" json:"key"`
+	Tokens     float64    `gorm:"not null;default:0" json:"tokens"`
+	RefilledAt *time.Time `gorm:"type:datetime(6);index" json:"refilledAt"` // nil for a new (full) bucket
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RefreshToken is one signed-in device of a user or administrator (a refresh token family).
+// The token is rotated on every refresh and only the SHA-256 hash of the current one is stored;
+// presenting an older token of the same family revokes the whole device.
+type RefreshToken struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountType string     `gorm:"type:enum('user', 'admin');not null;index:idx_refresh_token_account" json:"-"`
+	AccountID   uint64     `gorm:"not null;index:idx_refresh_token_account" json:"-"`
+	TokenHash   string     `gorm:"type:char(64);index;not null" json:"-"`
+	UserAgent   string     `gorm:"type:varchar(255)" json:"userAgent"`
+	IP          string     `gorm:"type:varchar(45)" json:"ip"`
+	LastUsedAt  time.Time  `gorm:"not null" json:"lastUsedAt"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt   *time.Time `gorm:"" json:"-"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
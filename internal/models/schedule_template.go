@@ -15,3 +15,20 @@ type ScheduleTemplate struct {
 
 	Psychologist *User `gorm:"foreignKey:PsychologistID" json:"psychologist,omitempty"`
 }
+
+// ScheduleException changes a psychologist's weekly schedule from StartDate to EndDate ("YYYY-MM-DD"):
+// "off" blocks the whole days or StartTime-EndTime, "override" replaces the weekly templates with
+// StartTime-EndTime, and "extra" adds StartTime-EndTime on top of them. Dates and times are on the wall
+// clock of the psychologist's time zone.
+type ScheduleException struct {
+	ID                  uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	PsychologistID      uint64    `gorm:"not null;index" json:"psychologistId"`
+	Kind                string    `gorm:"type:enum('off', 'override', 'extra');not null" json:"kind"`
+	StartDate           string    `gorm:"type:varchar(10);not null;index" json:"startDate"`
+	EndDate             string    `gorm:"type:varchar(10);not null;index" json:"endDate"`
+	StartTime           *string   `gorm:"type:varchar(8)" json:"startTime"` // "HH:MM"; none for a whole day off
+	EndTime             *string   `gorm:"type:varchar(8)" json:"endTime"`
+	SlotDurationMinutes int       `gorm:"default:60;not null" json:"slotDurationMinutes"`
+	Reason              string    `gorm:"type:varchar(255)" json:"reason"`
+	CreatedAt           time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
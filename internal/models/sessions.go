@@ -10,16 +10,64 @@ type Session struct {
 	PsychologistID uint64  `gorm:"" json:"psychologistId"`
 	ClientID       *uint64 `json:"clientId"`
 	AvailabilityID *uint64 `gorm:"" json:"availabilityId"`
+	SeriesID       *uint64 `gorm:"index" json:"seriesId"` // set for occurrences of a recurring series
 	StartTime      time.Time `gorm:"not null" json:"startTime"`
 	EndTime        time.Time `gorm:"not null" json:"endTime"`
-	Status         string    `gorm:"type:enum('pending', 'confirmed', 'completed', 'canceled');not null" json:"status"`
+	Status         string    `gorm:"type:varchar(32);not null;index" json:"status"` // see package sessionstate
 	ClientNotes    *string   `gorm:"type:text" json:"clientNotes"`
+	CanceledBy     *uint64    `json:"canceledBy"`
+	CanceledAt     *time.Time `json:"canceledAt"`
+	Cancellation   *string    `gorm:"type:varchar(16)" json:"cancellation"` // free or late, see sessionstate.ClassifyCancellation
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
 
 	Psychologist User `gorm:"foreignKey:PsychologistID" json:"psychologist,omitempty"`
 	Client       User `gorm:"foreignKey:ClientID" json:"client,omitempty"`
 }
 
+// SessionSeries is a recurring appointment of a client with a psychologist. Every occurrence is a
+// Session pointing to the series and keeps its own status.
+type SessionSeries struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PsychologistID uint64     `gorm:"not null;index" json:"psychologistId"`
+	ClientID       uint64     `gorm:"not null;index" json:"clientId"`
+	Frequency      string     `gorm:"type:enum('weekly', 'biweekly');not null" json:"frequency"`
+	Count          *int       `json:"count"` // either Count or Until bounds the series
+	Until          *time.Time `json:"until"`
+	StartTime      time.Time  `gorm:"not null" json:"startTime"` // first occurrence
+	EndTime        time.Time  `gorm:"not null" json:"endTime"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// SessionEvent records one status change of a session, or a move to another time: who made it, when and why
+type SessionEvent struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID  uint64     `gorm:"not null;index" json:"sessionId"`
+	FromStatus string     `gorm:"type:varchar(32)" json:"fromStatus"` // empty for the event that created the session
+	ToStatus   string     `gorm:"type:varchar(32);not null" json:"toStatus"`
+	ActorType  string     `gorm:"type:varchar(16);not null" json:"actorType"` // client, psychologist or system
+	ActorID    *uint64    `json:"actorId"`
+	Reason     string     `gorm:"type:varchar(500)" json:"reason"`
+	StartTime  *time.Time `json:"startTime,omitempty"` // new start time, for reschedules
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+// SessionReschedule is a proposal to move a session that waits for the other participant's approval.
+// A proposed availability slot is reserved (booked) until the proposal is resolved.
+type SessionReschedule struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID      uint64     `gorm:"not null;index" json:"sessionId"`
+	RequestedBy    uint64     `gorm:"not null" json:"requestedBy"`
+	RequesterType  string     `gorm:"type:varchar(16);not null" json:"requesterType"` // client or psychologist
+	AvailabilityID *uint64    `json:"availabilityId"`
+	StartTime      time.Time  `gorm:"not null" json:"startTime"`
+	EndTime        time.Time  `gorm:"not null" json:"endTime"`
+	Reason         string     `gorm:"type:varchar(500)" json:"reason"`
+	Status         string     `gorm:"type:enum('pending', 'approved', 'declined', 'canceled');default:'pending';not null;index" json:"status"`
+	ResolvedBy     *uint64    `json:"resolvedBy"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
 // Availability represents a psychologist's availability slot
 type Availability struct {
 	ID             uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
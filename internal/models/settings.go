@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// SystemSetting is a key/value platform setting managed by administrators (e.g. "mfa.required")
+type SystemSetting struct {
+	Key       string    `gorm:"primaryKey;type:varchar(100)" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	UpdatedBy *uint64   `json:"updatedBy"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -45,6 +45,14 @@ type Portfolio struct {
 	ClientAgeMax   *int        `gorm:"type:int;comment:Maximum client age"`
 	Rate             *float64 `gorm:"type:decimal(10,2);comment:Hourly rate in currency"`
 	ScheduleEnforced bool     `gorm:"default:false" json:"scheduleEnforced"`
+	// Cancellation policy: client cancellations closer than FreeCancelHours to the start are late,
+	// and a no-show can be marked NoShowGraceMinutes after the start
+	FreeCancelHours    int `gorm:"default:24" json:"freeCancelHours"`
+	NoShowGraceMinutes int `gorm:"default:15" json:"noShowGraceMinutes"`
+	// Free time kept before and after every session (open slots may still be back to back)
+	BufferMinutes int `gorm:"default:0" json:"bufferMinutes"`
+	// IANA time zone of the schedule templates; empty means the psychologist's own zone
+	TimeZone string `gorm:"type:varchar(64);not null;default:''" json:"timeZone"`
 	CreatedAt        time.Time `gorm:"autoCreateTime"`
 	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
 	Educations     []Education `gorm:"foreignKey:PortfolioID;constraint:OnDelete:RESTRICT"`
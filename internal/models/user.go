@@ -5,32 +5,36 @@ import (
 )
 
 type User struct {
-	ID                uint64         `gorm:"primaryKey;autoIncrement"`
-	Email             string         `gorm:"type:varchar(255);unique;not null"`
-	Password          string         `gorm:"type:varchar(255);not null"`
-	Role              string         `gorm:"type:enum('client', 'psychologist');not null"`
-	FirstName         string         `gorm:"type:varchar(100);not null"`
-	LastName          string         `gorm:"type:varchar(100);not null"`
-	Phone             *string        `gorm:"type:varchar(20)"`
-	Status            string         `gorm:"type:enum('Active', 'Disabled', 'Blocked');not null;default:'Disabled'"`
-	PlanID            *uint64        `gorm:""`
-	CreatedAt         time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt         time.Time      `gorm:"autoUpdateTime"`
-	Verified          bool           `gorm:"not null;default:false"`
-	VerificationToken string         `gorm:"type:varchar(64);index"`
-	TokenSentAt       time.Time      `gorm:"autoCreateTime"`
-	Portfolio         Portfolio      `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
-	Child             Child          `gorm:"foreignKey:ClientID;constraint:OnDelete:RESTRICT"`
-	Skills            []Skill        `gorm:"many2many:psychologist_skills;joinForeignKey:PsychologistID;joinReferences:SkillID"`
-	Reviews           []Review       `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
-	BlogPosts         []BlogPost     `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
-	Sessions          []Session      `gorm:"foreignKey:PsychologistID;constraint:OnDelete:SET NULL"`
-	ClientSessions    []Session      `gorm:"foreignKey:ClientID;constraint:OnDelete:SET NULL"`
-	MessagesSent      []Message      `gorm:"foreignKey:SenderID;constraint:OnDelete:SET NULL"`
-	Availability      []Availability `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
-	Rating            Rating         `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
-	RefreshToken      string         `gorm:"type:varchar(512);"`
-	GoogleID          string         `gorm:"type:varchar(255);index"`
+	ID               uint64         `gorm:"primaryKey;autoIncrement"`
+	Email            string         `gorm:"type:varchar(255);unique;not null"`
+	Password         string         `gorm:"type:varchar(255);not null"`
+	Role             string         `gorm:"type:enum('client', 'psychologist');not null"`
+	FirstName        string         `gorm:"type:varchar(100);not null"`
+	LastName         string         `gorm:"type:varchar(100);not null"`
+	Phone            *string        `gorm:"type:varchar(20)"`
+	Status           string         `gorm:"type:enum('Active', 'Disabled', 'Blocked');not null;default:'Disabled'"`
+	PlanID           *uint64        `gorm:""`
+	CreatedAt        time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime"`
+	Verified         bool           `gorm:"not null;default:false"`
+	VerificationHash string         `gorm:"type:char(64);index" json:"-"`
+	TokenSentAt      time.Time      `gorm:"autoCreateTime"`
+	RemindedAt       *time.Time     `gorm:"" json:"-"`
+	Portfolio        Portfolio      `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
+	Child            Child          `gorm:"foreignKey:ClientID;constraint:OnDelete:RESTRICT"`
+	Skills           []Skill        `gorm:"many2many:psychologist_skills;joinForeignKey:PsychologistID;joinReferences:SkillID"`
+	Reviews          []Review       `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
+	BlogPosts        []BlogPost     `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
+	Sessions         []Session      `gorm:"foreignKey:PsychologistID;constraint:OnDelete:SET NULL"`
+	ClientSessions   []Session      `gorm:"foreignKey:ClientID;constraint:OnDelete:SET NULL"`
+	MessagesSent     []Message      `gorm:"foreignKey:SenderID;constraint:OnDelete:SET NULL"`
+	Availability     []Availability `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
+	Rating           Rating         `gorm:"foreignKey:PsychologistID;constraint:OnDelete:RESTRICT"`
+	TOTPSecret       string         `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabled      bool           `gorm:"not null;default:false"`
+	TOTPLastStep     int64          `gorm:"not null;default:0" json:"-"`
+	// IANA time zone the user sees times in; empty means the server default
+	TimeZone string `gorm:"type:varchar(64);not null;default:''"`
 }
 
 type Photo struct {
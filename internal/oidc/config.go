@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// googleIssuer is used for the legacy [google] section
+const googleIssuer = "https://accounts.google.com"
+
+// LoadProviders builds the providers configured as child sections of [oidc]:
+//
+//	[oidc.keycloak]
+//	issuer        = https://sso.example.com/realms/main
+//	client_id     = neurohelp
+//	client_secret = secret
+//	redirect_url  = https://neurohelp.example.com/oauth/callback/keycloak
+//	scopes        = email,profile
+//
+// A provider named "google" is also created from the older [google] client_id / client_secret
+// when there is no [oidc.google] section.
+func LoadProviders(cfg *ini.File) (map[string]*Provider, error) {
+	providers := make(map[string]*Provider)
+	section := cfg.Section("oidc")
+	for _, child := range section.ChildSections() {
+		name := strings.TrimPrefix(child.Name(), section.Name()+".")
+		config := Config{
+			Name:          name,
+			Issuer:        child.Key("issuer").String(),
+			ClientID:      child.Key("client_id").String(),
+			ClientSecret:  child.Key("client_secret").String(),
+			RedirectURL:   child.Key("redirect_url").String(),
+			Scopes:        child.Key("scopes").Strings(","),
+			IssuerAliases: child.Key("issuer_aliases").Strings(","),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %q: issuer and client_id are required", name)
+		}
+		if name == "google" && len(config.IssuerAliases) == 0 {
+			config.IssuerAliases = []string{"accounts.google.com"}
+		}
+		providers[name] = NewProvider(config, nil)
+	}
+
+	if _, ok := providers["google"]; !ok {
+		legacy := cfg.Section("google")
+		if clientID := legacy.Key("client_id").String(); clientID != "" {
+			providers["google"] = NewProvider(Config{
+				Name:          "google",
+				Issuer:        googleIssuer,
+				ClientID:      clientID,
+				ClientSecret:  legacy.Key("client_secret").String(),
+				RedirectURL:   legacy.Key("redirect_url").String(),
+				Scopes:        []string{"email", "profile"},
+				IssuerAliases: []string{"accounts.google.com"},
+			}, nil)
+		}
+	}
+	return providers, nil
+}
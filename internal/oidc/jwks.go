@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// supportedAlgs are the ID token signature algorithms accepted from providers
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+const (
+	// jwksTTL is how long fetched keys are trusted before the set is fetched again
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits refetches triggered by unknown key IDs, so forged tokens cannot
+	// make us hammer the provider
+	jwksMinRefresh = 30 * time.Second
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// jwk is one key of a provider's JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the provider's verification keys by key ID. A token signed with a key ID that is
+// not in the cache triggers a refetch, which picks up keys the provider rotated in.
+type keySet struct {
+	client *http.Client
+	uri    func(ctx context.Context) (string, error)
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, uri func(ctx context.Context) (string, error)) *keySet {
+	return &keySet{client: client, uri: uri, now: time.Now}
+}
+
+// key returns the verification key for a token, refreshing the set when needed
+func (s *keySet) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := s.keys == nil || s.now().Sub(s.fetchedAt) >= jwksTTL
+	if _, known := s.keys[kid]; stale || (!known && s.now().Sub(s.fetchedAt) >= jwksMinRefresh) {
+		if err := s.refresh(ctx); err != nil && s.keys == nil {
+			return nil, err
+		}
+	}
+
+	key, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		// Providers with a single key may omit the kid header
+		for _, k := range s.keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, errUnknownKey
+	}
+	if !algMatchesKey(token.Method.Alg(), key) {
+		return nil, fmt.Errorf("signing method %q does not match key %q", token.Method.Alg(), kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	uri, err := s.uri(ctx)
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	// Remember the attempt even if it fails, so a broken endpoint is not retried on every token
+	s.fetchedAt = s.now()
+	if err := getJSON(ctx, s.client, uri, &doc); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if public, err := k.publicKey(); err == nil {
+			keys[k.Kid] = public
+		}
+	}
+	s.keys = keys
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(public.X, public.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return public, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// algMatchesKey prevents using a key with another algorithm family than it was published for
+func algMatchesKey(alg string, key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" || alg == "RS384" || alg == "RS512"
+	case *ecdsa.PublicKey:
+		return alg == "ES256" || alg == "ES384" || alg == "ES512"
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// hashPrefixChars is the length of the bucket prefix, as in the Have I Been Pwned range API
+	hashPrefixChars = 5
+	// reloadCheckInterval limits how often the file modification time is checked
+	reloadCheckInterval = time.Minute
+)
+
+// BreachedList is a local list of SHA-1 hashes of known-breached passwords, in the format of the
+// Have I Been Pwned password files: one uppercase hex hash per line, optionally followed by ":count".
+// Hashes are bucketed by their first 5 characters, the same k-anonymity split the range API uses,
+// so the file can be replaced by a filtered export without code changes. The file is reloaded
+// when its modification time changes; until it exists the check is skipped.
+type BreachedList struct {
+	path string
+
+	mu        sync.RWMutex
+	buckets   map[string]map[string]struct{}
+	modTime   time.Time
+	checkedAt time.Time
+	missing   bool // the file was not found on the last check (logged once)
+}
+
+// NewBreachedList loads the list at path
+func NewBreachedList(path string) *BreachedList {
+	list := &BreachedList{path: path}
+	list.reload(time.Now())
+	return list
+}
+
+// Contains reports whether the password is on the list
+func (b *BreachedList) Contains(password string) bool {
+	now := time.Now()
+	b.mu.RLock()
+	stale := now.Sub(b.checkedAt) >= reloadCheckInterval
+	b.mu.RUnlock()
+	if stale {
+		b.reload(now)
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, found := b.buckets[hash[:hashPrefixChars]][hash[hashPrefixChars:]]
+	return found
+}
+
+// Size returns the number of hashes loaded
+func (b *BreachedList) Size() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return countHashes(b.buckets)
+}
+
+// reload reads the file again if its modification time changed
+func (b *BreachedList) reload(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkedAt = now
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		if !b.missing {
+			log.Warn().Err(err).Str("path", b.path).Msg("Breached password list not found, breached password check disabled")
+		}
+		b.missing = true
+		b.buckets = nil
+		b.modTime = time.Time{}
+		return
+	}
+	b.missing = false
+	if info.ModTime().Equal(b.modTime) {
+		return
+	}
+
+	buckets, err := readBreachedFile(b.path)
+	if err != nil {
+		// Keep the previous list rather than dropping the check on a partial write
+		log.Error().Err(err).Str("path", b.path).Msg("Failed to read breached password list")
+		return
+	}
+	b.buckets = buckets
+	b.modTime = info.ModTime()
+	log.Info().Str("path", b.path).Int("hashes", countHashes(buckets)).Msg("Breached password list loaded")
+}
+
+func readBreachedFile(path string) (map[string]map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buckets := make(map[string]map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if len(line) != sha1.Size*2 {
+			continue
+		}
+		hash := strings.ToUpper(line)
+		prefix := hash[:hashPrefixChars]
+		if buckets[prefix] == nil {
+			buckets[prefix] = make(map[string]struct{})
+		}
+		buckets[prefix][hash[hashPrefixChars:]] = struct{}{}
+	}
+	return buckets, scanner.Err()
+}
+
+func countHashes(buckets map[string]map[string]struct{}) int {
+	size := 0
+	for _, bucket := range buckets {
+		size += len(bucket)
+	}
+	return size
+}
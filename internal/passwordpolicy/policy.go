@@ -0,0 +1,127 @@
+// Package passwordpolicy validates new passwords: length, character classes, personal information
+// and a local list of known-breached passwords (see BreachedList).
+package passwordpolicy
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-ini/ini"
+)
+
+// Error codes returned in utils.ErrorResponse when a password is rejected
+const (
+	CodeTooShort     = "PASSWORD_TOO_SHORT"
+	CodeTooLong      = "PASSWORD_TOO_LONG"
+	CodeTooSimple    = "PASSWORD_TOO_SIMPLE"
+	CodePersonalInfo = "PASSWORD_CONTAINS_PERSONAL_INFO"
+	CodeBreached     = "PASSWORD_BREACHED"
+)
+
+// minPersonalTokenChars ignores very short name or email parts ("Li", "jo") in the personal information check
+const minPersonalTokenChars = 3
+
+// Violation is the first rule a password breaks. Params hold the values the frontend needs to
+// build a localised message (e.g. minLength).
+type Violation struct {
+	Code    string
+	Message string
+	Params  map[string]interface{}
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Policy is the password policy (config section [password_policy])
+type Policy struct {
+	MinLength          int  // in characters
+	MaxLength          int  // in bytes: bcrypt ignores everything past 72 bytes
+	MinCharClasses     int  // of lowercase, uppercase, digits and symbols
+	ForbidPersonalInfo bool // reject passwords containing the user's name or email
+	Breached           *BreachedList
+}
+
+// Load reads the [password_policy] config section. A missing breached list file disables that check.
+func Load(section *ini.Section) *Policy {
+	policy := &Policy{
+		MinLength:          section.Key("min_length").MustInt(10),
+		MaxLength:          section.Key("max_length").MustInt(72),
+		MinCharClasses:     section.Key("min_char_classes").MustInt(3),
+		ForbidPersonalInfo: section.Key("forbid_personal_info").MustBool(true),
+	}
+	if path := section.Key("breached_list_path").String(); path != "" {
+		policy.Breached = NewBreachedList(path)
+	}
+	return policy
+}
+
+// Check returns the first rule the password breaks, or nil. personal are values the password must
+// not contain, such as the first name, last name and email of the account.
+func (p *Policy) Check(password string, personal ...string) *Violation {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &Violation{CodeTooShort, "Password must be at least " + strconv.Itoa(p.MinLength) + " characters",
+			map[string]interface{}{"minLength": p.MinLength}}
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return &Violation{CodeTooLong, "Password must be at most " + strconv.Itoa(p.MaxLength) + " bytes",
+			map[string]interface{}{"maxLength": p.MaxLength}}
+	}
+	if charClasses(password) < p.MinCharClasses {
+		return &Violation{CodeTooSimple, "Password must mix at least " + strconv.Itoa(p.MinCharClasses) +
+			" of: lowercase letters, uppercase letters, digits, symbols", map[string]interface{}{"minCharClasses": p.MinCharClasses}}
+	}
+	if p.ForbidPersonalInfo && containsPersonalInfo(password, personal) {
+		return &Violation{CodePersonalInfo, "Password must not contain your name or email", nil}
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return &Violation{CodeBreached, "This password has appeared in a data breach; choose another one", nil}
+	}
+	return nil
+}
+
+// charClasses counts the character classes used in s
+func charClasses(s string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			count++
+		}
+	}
+	return count
+}
+
+// containsPersonalInfo reports whether the password contains one of the values, or a word of one
+// (an email is split into its local part words, e.g. "anna.koval@example.com" gives "anna" and "koval")
+func containsPersonalInfo(password string, personal []string) bool {
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if at := strings.LastIndex(value, "@"); at >= 0 {
+			value = value[:at]
+		}
+		tokens := strings.FieldsFunc(value, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		tokens = append(tokens, value)
+		for _, token := range tokens {
+			if utf8.RuneCountInString(token) >= minPersonalTokenChars && strings.Contains(lowered, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
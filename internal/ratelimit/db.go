@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps buckets in the rate_limit_buckets table so that every instance shares the limits
+type DBStore struct{}
+
+// NewDBStore creates a database store (uses the global db.DB connection)
+func NewDBStore() *DBStore {
+	return &DBStore{}
+}
+
+// Take removes a token from the bucket of key inside a transaction holding a row lock
+func (s *DBStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	var result Result
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// A new row is created empty and treated as a full bucket (nil RefilledAt)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RateLimitBucket{Key: key}).Error; err != nil {
+			return err
+		}
+		var row models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		bucket := Bucket{Tokens: row.Tokens}
+		if row.RefilledAt != nil {
+			bucket.RefilledAt = *row.RefilledAt
+		}
+		result = policy.take(&bucket, now)
+
+		return tx.Model(&models.RateLimitBucket{}).Where("`key` = ?", key).Updates(map[string]interface{}{
+			"tokens":      bucket.Tokens,
+			"refilled_at": bucket.RefilledAt,
+		}).Error
+	})
+	return result, err
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many calls the memory store handles between sweeps of idle buckets
+const pruneEvery = 1000
+
+// MemoryStore keeps buckets in process memory. It is the default store and only suits a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+	periods map[string]time.Duration
+	calls   int
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*Bucket), periods: make(map[string]time.Duration)}
+}
+
+// Take removes a token from the bucket of key
+func (s *MemoryStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &Bucket{}
+		s.buckets[key] = b
+		s.periods[key] = policy.Period
+	}
+	result := policy.take(b, now)
+
+	s.calls++
+	if s.calls%pruneEvery == 0 {
+		s.prune(now)
+	}
+	return result, nil
+}
+
+// prune drops buckets that have had time to refill completely (they are equal to new ones)
+func (s *MemoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.RefilledAt) > s.periods[key] {
+			delete(s.buckets, key)
+			delete(s.periods, key)
+		}
+	}
+}
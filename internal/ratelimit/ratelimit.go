@@ -0,0 +1,119 @@
+// Package ratelimit implements token-bucket rate limiting with named policies.
+// A policy "N/period" allows bursts of N requests and refills N tokens per period.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a named token bucket configuration
+type Policy struct {
+	Name   string
+	Limit  int           // bucket capacity (burst)
+	Period time.Duration // time to refill the whole bucket
+}
+
+// ParsePolicy parses a policy spec like "5/1h" or "30/1m"
+func ParsePolicy(name, spec string) (Policy, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), "/", 2)
+	if len(parts) != 2 {
+		return Policy{}, fmt.Errorf("rate limit policy %q: expected <requests>/<period>, got %q", name, spec)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("rate limit policy %q: invalid request count %q", name, parts[0])
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("rate limit policy %q: invalid period %q", name, parts[1])
+	}
+	return Policy{Name: name, Limit: limit, Period: period}, nil
+}
+
+// Bucket is the stored state of one key
+type Bucket struct {
+	Tokens     float64
+	RefilledAt time.Time // zero for a new (full) bucket
+}
+
+// Result describes the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// take refills the bucket for the time elapsed since the last call and removes one token if available
+func (p Policy) take(b *Bucket, now time.Time) Result {
+	rate := float64(p.Limit) / p.Period.Seconds() // tokens per second
+	if b.RefilledAt.IsZero() {
+		b.Tokens = float64(p.Limit)
+	} else if elapsed := now.Sub(b.RefilledAt).Seconds(); elapsed > 0 {
+		b.Tokens += elapsed * rate
+		if b.Tokens > float64(p.Limit) {
+			b.Tokens = float64(p.Limit)
+		}
+	}
+	b.RefilledAt = now
+
+	result := Result{Limit: p.Limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = seconds((float64(p.Limit) - b.Tokens) / rate)
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps buckets. Take must be atomic, so several instances can share one store.
+type Store interface {
+	Take(key string, policy Policy, now time.Time) (Result, error)
+}
+
+// Limiter applies named policies on top of a store
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+	now      func() time.Time
+}
+
+// New creates a limiter with the given policies
+func New(store Store, policies ...Policy) *Limiter {
+	l := &Limiter{store: store, policies: make(map[string]Policy, len(policies)), now: time.Now}
+	for _, p := range policies {
+		l.policies[p.Name] = p
+	}
+	return l
+}
+
+// SetClock replaces the time source (used by tests)
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// Policy returns a policy by name
+func (l *Limiter) Policy(name string) (Policy, bool) {
+	p, ok := l.policies[name]
+	return p, ok
+}
+
+// Allow takes a token for key under the named policy. Each policy has its own buckets.
+func (l *Limiter) Allow(policy, key string) (Result, error) {
+	p, ok := l.policies[policy]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown rate limit policy %q", policy)
+	}
+	return l.store.Take(policy+":"+key, p, l.now())
+}
@@ -0,0 +1,75 @@
+// Package recurrence expands the repeat rule of a session series into the start times of its occurrences.
+package recurrence
+
+import (
+	"errors"
+	"time"
+)
+
+// Frequencies
+const (
+	Weekly   = "weekly"
+	Biweekly = "biweekly"
+)
+
+// MaxOccurrences caps the size of one series
+const MaxOccurrences = 52
+
+var (
+	// ErrFrequency is returned for a frequency other than weekly or biweekly
+	ErrFrequency = errors.New("frequency must be weekly or biweekly")
+	// ErrBounds is returned unless exactly one of count and until is set, or when until is before the start
+	ErrBounds = errors.New("give either a count or an end date after the start")
+	// ErrTooMany is returned when the rule yields more than MaxOccurrences occurrences
+	ErrTooMany = errors.New("too many occurrences")
+)
+
+// Rule says how often a series repeats and when it stops: after Count occurrences or on Until
+type Rule struct {
+	Frequency string
+	Count     int
+	Until     *time.Time
+}
+
+// Validate checks the rule against the start of the first occurrence
+func (r Rule) Validate(start time.Time) error {
+	if r.Frequency != Weekly && r.Frequency != Biweekly {
+		return ErrFrequency
+	}
+	if (r.Count > 0) == (r.Until != nil) || r.Count < 0 {
+		return ErrBounds
+	}
+	if r.Until != nil && r.Until.Before(start) {
+		return ErrBounds
+	}
+	if r.Count > MaxOccurrences || len(r.expand(start, MaxOccurrences+1)) > MaxOccurrences {
+		return ErrTooMany
+	}
+	return nil
+}
+
+// Expand returns the start times of the occurrences, the first one being start itself.
+// The rule must be valid.
+func (r Rule) Expand(start time.Time) []time.Time {
+	return r.expand(start, MaxOccurrences)
+}
+
+func (r Rule) expand(start time.Time, limit int) []time.Time {
+	days := 7
+	if r.Frequency == Biweekly {
+		days = 14
+	}
+	var times []time.Time
+	for i := 0; i < limit; i++ {
+		if r.Count > 0 && i >= r.Count {
+			break
+		}
+		// AddDate keeps the wall clock time in start's location
+		t := start.AddDate(0, 0, i*days)
+		if r.Until != nil && t.After(*r.Until) {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
@@ -0,0 +1,182 @@
+// Package schedule applies schedule exceptions (days off, partial blocks, changed and extra hours) to a
+// psychologist's weekly templates. All dates and clock times are on the psychologist's wall clock; the
+// ranges returned are in UTC.
+package schedule
+
+import (
+	"errors"
+	"time"
+	"user-api/internal/models"
+	"user-api/internal/timezone"
+)
+
+// Exception kinds
+const (
+	KindOff      = "off"
+	KindOverride = "override"
+	KindExtra    = "extra"
+)
+
+// DateLayout is the layout of StartDate and EndDate
+const DateLayout = "2006-01-02"
+
+// MaxDays caps the length of one exception
+const MaxDays = 366
+
+var (
+	// ErrKind is returned for a kind other than off, override or extra
+	ErrKind = errors.New("kind must be off, override or extra")
+	// ErrDates is returned for malformed dates, an end before the start or more than MaxDays days
+	ErrDates = errors.New("startDate and endDate must be YYYY-MM-DD, in order and at most 366 days apart")
+	// ErrHours is returned for malformed or reversed hours, or missing hours of an override or extra exception
+	ErrHours = errors.New("startTime and endTime must be HH:MM with startTime first; only a whole day off may leave them out")
+	// ErrSlotDuration is returned for a slot duration that does not fit the hours
+	ErrSlotDuration = errors.New("slotDurationMinutes must be positive and fit between startTime and endTime")
+)
+
+// Validate checks an exception
+func Validate(ex models.ScheduleException) error {
+	if ex.Kind != KindOff && ex.Kind != KindOverride && ex.Kind != KindExtra {
+		return ErrKind
+	}
+	start, err := time.Parse(DateLayout, ex.StartDate)
+	if err != nil {
+		return ErrDates
+	}
+	end, err := time.Parse(DateLayout, ex.EndDate)
+	if err != nil || end.Before(start) || end.Sub(start) >= MaxDays*24*time.Hour {
+		return ErrDates
+	}
+	if ex.StartTime == nil && ex.EndTime == nil && ex.Kind == KindOff {
+		return nil
+	}
+	from, to, ok := hours(ex)
+	if !ok || from >= to {
+		return ErrHours
+	}
+	if ex.Kind != KindOff && (ex.SlotDurationMinutes <= 0 || ex.SlotDurationMinutes > to-from) {
+		return ErrSlotDuration
+	}
+	return nil
+}
+
+// hours returns the clock times of the exception in minutes since midnight
+func hours(ex models.ScheduleException) (from, to int, ok bool) {
+	if ex.StartTime == nil || ex.EndTime == nil {
+		return 0, 0, false
+	}
+	from, err := timezone.ParseClock(*ex.StartTime)
+	if err != nil {
+		return 0, 0, false
+	}
+	to, err = timezone.ParseClock(*ex.EndTime)
+	if err != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// Days returns the calendar dates the exception covers, as midnight UTC. The exception must be valid.
+func Days(ex models.ScheduleException) []time.Time {
+	start, _ := time.Parse(DateLayout, ex.StartDate)
+	end, _ := time.Parse(DateLayout, ex.EndDate)
+	var days []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// covers reports whether the exception includes the calendar date
+func covers(ex models.ScheduleException, date time.Time) bool {
+	day := date.Format(DateLayout)
+	return ex.StartDate <= day && day <= ex.EndDate
+}
+
+// dayRange returns the range [from, to) minutes of a calendar date in loc. The end of the day (24:00) is
+// the next midnight; a wall clock time skipped by a daylight saving change resolves as time.Date does.
+func dayRange(date time.Time, from, to int, loc *time.Location) timezone.Range {
+	at := func(minutes int) time.Time {
+		if minutes >= 24*60 {
+			t, _ := timezone.At(date.AddDate(0, 0, 1), 0, loc)
+			return t
+		}
+		t, _ := timezone.At(date, minutes, loc)
+		return t
+	}
+	return timezone.Range{Start: at(from).UTC(), End: at(to).UTC()}
+}
+
+// Blocked returns the time the exception takes away from the weekly schedule: the whole days or hours of
+// an "off" exception and the hours outside an "override" one. Existing slots in these ranges are removed
+// and sessions in them are affected. An "extra" exception blocks nothing. The exception must be valid.
+func Blocked(ex models.ScheduleException, loc *time.Location) []timezone.Range {
+	if ex.Kind == KindExtra {
+		return nil
+	}
+	from, to, partial := hours(ex)
+	var ranges []timezone.Range
+	for _, day := range Days(ex) {
+		switch {
+		case ex.Kind == KindOff && partial:
+			ranges = append(ranges, dayRange(day, from, to, loc))
+		case ex.Kind == KindOff:
+			ranges = append(ranges, dayRange(day, 0, 24*60, loc))
+		default:
+			if from > 0 {
+				ranges = append(ranges, dayRange(day, 0, from, loc))
+			}
+			if to < 24*60 {
+				ranges = append(ranges, dayRange(day, to, 24*60, loc))
+			}
+		}
+	}
+	return ranges
+}
+
+// Day is the effective schedule of one calendar date
+type Day struct {
+	// Templates is false when an override replaces the weekly templates
+	Templates bool
+	// Slots are the slots added by override and extra exceptions
+	Slots []timezone.Range
+	// Off are the ranges blocked by off exceptions; no slot may overlap them
+	Off []timezone.Range
+}
+
+// PlanDay applies the exceptions to one calendar date (midnight UTC) of a psychologist in loc.
+// Exceptions that do not cover the date are ignored.
+func PlanDay(date time.Time, exceptions []models.ScheduleException, loc *time.Location) Day {
+	plan := Day{Templates: true}
+	for _, ex := range exceptions {
+		if !covers(ex, date) || Validate(ex) != nil {
+			continue
+		}
+		from, to, partial := hours(ex)
+		switch ex.Kind {
+		case KindOff:
+			if partial {
+				plan.Off = append(plan.Off, dayRange(date, from, to, loc))
+			} else {
+				plan.Off = append(plan.Off, dayRange(date, 0, 24*60, loc))
+			}
+		case KindOverride, KindExtra:
+			if ex.Kind == KindOverride {
+				plan.Templates = false
+			}
+			length := time.Duration(ex.SlotDurationMinutes) * time.Minute
+			plan.Slots = append(plan.Slots, timezone.DaySlots(date, from, to, length, loc)...)
+		}
+	}
+	return plan
+}
+
+// IsOff reports whether a slot overlaps a range blocked on the day
+func (d Day) IsOff(start, end time.Time) bool {
+	for _, r := range d.Off {
+		if start.Before(r.End) && end.After(r.Start) {
+			return true
+		}
+	}
+	return false
+}
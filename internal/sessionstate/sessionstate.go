@@ -0,0 +1,137 @@
+// Package sessionstate defines the lifecycle of a consultation session: its statuses, who may move
+// a session from one status to another, and which statuses are final.
+package sessionstate
+
+import (
+	"errors"
+	"time"
+)
+
+// Session statuses
+const (
+	Pending                = "pending"     // requested at a free time, waiting for the psychologist
+	Confirmed              = "confirmed"   // booked or accepted by the psychologist
+	Rescheduled            = "rescheduled" // moved to another time; behaves like confirmed
+	InProgress             = "in_progress"
+	Completed              = "completed"
+	CanceledByClient       = "canceled_by_client"
+	CanceledByPsychologist = "canceled_by_psychologist"
+	NoShow                 = "no_show" // the client did not attend
+	// Canceled is a session canceled before who canceled was recorded; it is never set any more
+	Canceled = "canceled"
+)
+
+// Cancellation classes, measured against the psychologist's free cancellation window
+const (
+	CancellationFree = "free"
+	CancellationLate = "late"
+)
+
+// Actor is who changes a session's status
+type Actor string
+
+const (
+	ActorClient       Actor = "client"
+	ActorPsychologist Actor = "psychologist"
+	ActorSystem       Actor = "system" // background jobs
+)
+
+var (
+	// ErrInvalidTransition is returned when no actor may move a session between the two statuses
+	ErrInvalidTransition = errors.New("invalid session status transition")
+	// ErrActorNotAllowed is returned when the transition exists but not for this actor
+	ErrActorNotAllowed = errors.New("actor may not perform this session status transition")
+)
+
+// transitions lists, for every status, the statuses it can move to and who may do it.
+// Final statuses have no entry.
+var transitions = map[string]map[string][]Actor{
+	// A client moving their own request keeps it pending; a psychologist proposing another time answers it
+	Pending: {
+		Confirmed:              {ActorPsychologist},
+		Rescheduled:            {ActorPsychologist},
+		CanceledByClient:       {ActorClient},
+		CanceledByPsychologist: {ActorPsychologist, ActorSystem},
+	},
+	Confirmed: {
+		Rescheduled:            {ActorClient, ActorPsychologist},
+		InProgress:             {ActorPsychologist, ActorSystem},
+		Completed:              {ActorPsychologist, ActorSystem},
+		CanceledByClient:       {ActorClient},
+		CanceledByPsychologist: {ActorPsychologist},
+		NoShow:                 {ActorPsychologist},
+	},
+	Rescheduled: {
+		Rescheduled:            {ActorClient, ActorPsychologist},
+		InProgress:             {ActorPsychologist, ActorSystem},
+		Completed:              {ActorPsychologist, ActorSystem},
+		CanceledByClient:       {ActorClient},
+		CanceledByPsychologist: {ActorPsychologist},
+		NoShow:                 {ActorPsychologist},
+	},
+	InProgress: {
+		Completed: {ActorPsychologist, ActorSystem},
+		NoShow:    {ActorPsychologist},
+	},
+}
+
+// Check returns nil if actor may move a session from one status to the other
+func Check(from, to string, actor Actor) error {
+	actors, ok := transitions[from][to]
+	if !ok {
+		return ErrInvalidTransition
+	}
+	for _, allowed := range actors {
+		if allowed == actor {
+			return nil
+		}
+	}
+	return ErrActorNotAllowed
+}
+
+// Next returns the statuses actor may move a session to from the given status
+func Next(from string, actor Actor) []string {
+	var next []string
+	for _, to := range statusOrder {
+		if Check(from, to, actor) == nil {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// IsFinal reports whether a session in this status can no longer change
+func IsFinal(status string) bool {
+	_, ok := transitions[status]
+	return !ok
+}
+
+// IsCanceled reports whether the status is one of the cancellations
+func IsCanceled(status string) bool {
+	return status == CanceledByClient || status == CanceledByPsychologist || status == Canceled
+}
+
+// CanceledBy returns the cancellation status for the actor
+func CanceledBy(actor Actor) string {
+	if actor == ActorClient {
+		return CanceledByClient
+	}
+	return CanceledByPsychologist
+}
+
+// ClassifyCancellation tells whether canceling a session in status from at the given time is free or late.
+// A request that was never confirmed can always be withdrawn for free.
+func ClassifyCancellation(from string, start, at time.Time, freeWindow time.Duration) string {
+	if from == Pending || start.Sub(at) >= freeWindow {
+		return CancellationFree
+	}
+	return CancellationLate
+}
+
+// Active returns the statuses of sessions that still hold their time
+func Active() []string {
+	return []string{Pending, Confirmed, Rescheduled, InProgress}
+}
+
+// statusOrder keeps Next deterministic
+var statusOrder = []string{Pending, Confirmed, Rescheduled, InProgress, Completed, CanceledByClient, CanceledByPsychologist, NoShow}
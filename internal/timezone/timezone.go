@@ -0,0 +1,95 @@
+// Package timezone resolves the IANA time zones of users and psychologists and turns wall clock times of
+// a zone into absolute times. Times are stored and compared in UTC; a zone is only needed to expand
+// schedules ("Monday 09:00" in the psychologist's zone) and to show times to a viewer.
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// The zone database is embedded so that zones load in containers without /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// ErrUnknown is returned for a name that is not an IANA time zone
+var ErrUnknown = errors.New("unknown time zone")
+
+// Default is the zone of users who have not chosen one ([app] default_time_zone)
+var Default = time.UTC
+
+// Load returns the named IANA zone, or Default for an empty name. "Local" is rejected because it
+// depends on the server.
+func Load(name string) (*time.Location, error) {
+	if name == "" {
+		return Default, nil
+	}
+	if name == "Local" || strings.HasPrefix(name, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrUnknown, name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknown, name)
+	}
+	return loc, nil
+}
+
+// Resolve returns the first of the names that is a known zone, or Default. It is used for settings
+// that fall back to each other, such as the portfolio zone and then the user's own zone.
+func Resolve(names ...string) *time.Location {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if loc, err := Load(name); err == nil {
+			return loc
+		}
+	}
+	return Default
+}
+
+// ParseClock parses a wall clock time "HH:MM" or "HH:MM:SS" into minutes since midnight
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04:05", value)
+	if err != nil {
+		if t, err = time.Parse("15:04", value); err != nil {
+			return 0, fmt.Errorf("invalid time of day %q", value)
+		}
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// At returns the time of the given calendar day (year, month and day of date) at minutes past midnight
+// on the wall clock of loc. It reports false when that wall clock time is skipped by a daylight saving
+// change. A time repeated when clocks go back resolves to one of its two instants.
+func At(date time.Time, minutes int, loc *time.Location) (time.Time, bool) {
+	hour, minute := minutes/60, minutes%60
+	t := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc)
+	return t, t.Hour() == hour && t.Minute() == minute && t.Day() == date.Day()
+}
+
+// Range is a time range in UTC
+type Range struct {
+	Start, End time.Time
+}
+
+// DaySlots splits the wall clock range [from, to) (minutes past midnight) of one calendar day in loc into
+// slots of the given length. Slots start on the wall clock (09:00, 10:00, ... in loc whatever the offset
+// is that day) and last the given length in real time. Slots starting at a wall clock time skipped by a
+// daylight saving change are left out.
+func DaySlots(date time.Time, from, to int, length time.Duration, loc *time.Location) []Range {
+	step := int(length / time.Minute)
+	if step <= 0 {
+		return nil
+	}
+	var slots []Range
+	for m := from; m+step <= to; m += step {
+		start, ok := At(date, m, loc)
+		if !ok {
+			continue
+		}
+		slots = append(slots, Range{Start: start.UTC(), End: start.Add(length).UTC()})
+	}
+	return slots
+}
@@ -0,0 +1,194 @@
+// Package tokens issues and parses user access and refresh tokens. Every login path and
+// middleware.RequireUser go through it, so TTLs, issuer/audience and claims are defined in one place.
+package tokens
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"user-api/internal/keyring"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-ini/ini"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// AccessClaims are the claims of a user access token. The subject is the user ID.
+type AccessClaims struct {
+	Username string `json:"username"` // account email
+	Role     string `json:"role"`
+	Actor    *Actor `json:"act,omitempty"` // set when an administrator impersonates the user
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user ID from the subject claim
+func (c *AccessClaims) UserID() uint64 {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return id
+}
+
+// Actor is the "act" claim (RFC 8693) of an impersonation token: the administrator acting as the user
+type Actor struct {
+	Subject  string `json:"sub"` // administrator ID
+	Username string `json:"username"`
+}
+
+// AdminID returns the administrator ID from the actor subject
+func (a *Actor) AdminID() uint64 {
+	id, _ := strconv.ParseUint(a.Subject, 10, 64)
+	return id
+}
+
+// RefreshClaims are the claims of a user refresh token
+type RefreshClaims struct {
+	Username string `json:"username"`
+	DeviceID uint64 `json:"did"` // row in refresh_tokens this token belongs to
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user ID from the subject claim
+func (c *RefreshClaims) UserID() uint64 {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return id
+}
+
+// Config holds the token settings (config section [tokens])
+type Config struct {
+	Issuer          string
+	AccessAudience  string
+	RefreshAudience string
+	AccessTTL       time.Duration
+	RefreshTTL      time.Duration
+	ImpersonateTTL  time.Duration
+}
+
+// Service signs access tokens with one key ring and refresh tokens with another
+type Service struct {
+	Config
+	access  *keyring.Ring
+	refresh *keyring.Ring
+	now     func() time.Time
+}
+
+// Default is the service used by the handlers and the middleware
+var Default *Service
+
+func init() {
+	cfg, err := ini.Load("config.ini")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config.ini")
+	}
+	Default = New(LoadConfig(cfg.Section("tokens")), keyring.User, keyring.UserRefresh)
+}
+
+// LoadConfig reads the [tokens] config section
+func LoadConfig(section *ini.Section) Config {
+	return Config{
+		Issuer:          section.Key("issuer").MustString("neurohelp"),
+		AccessAudience:  section.Key("access_audience").MustString("neurohelp-api"),
+		RefreshAudience: section.Key("refresh_audience").MustString("neurohelp-refresh"),
+		AccessTTL:       section.Key("access_ttl").MustDuration(24 * time.Hour),
+		RefreshTTL:      section.Key("refresh_ttl").MustDuration(7 * 24 * time.Hour),
+		ImpersonateTTL:  section.Key("impersonation_ttl").MustDuration(15 * time.Minute),
+	}
+}
+
+// New creates a token service
+func New(config Config, access, refresh *keyring.Ring) *Service {
+	return &Service{Config: config, access: access, refresh: refresh, now: time.Now}
+}
+
+// SetClock replaces the time source (used by tests)
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// IssueAccess signs an access token for a user
+func (s *Service) IssueAccess(user *models.User) (string, error) {
+	return s.access.Sign(&AccessClaims{
+		Username:         user.Email,
+		Role:             user.Role,
+		RegisteredClaims: s.registered(user.ID, s.AccessAudience, s.now(), s.AccessTTL, ""),
+	})
+}
+
+// IssueImpersonation signs a short-lived access token for a user with the administrator as actor.
+// There is no refresh token: the administrator asks for a new token when it expires.
+func (s *Service) IssueImpersonation(user *models.User, adminID uint64, adminUsername string) (string, time.Time, error) {
+	jti, err := utils.NewTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := s.now()
+	token, err := s.access.Sign(&AccessClaims{
+		Username:         user.Email,
+		Role:             user.Role,
+		Actor:            &Actor{Subject: strconv.FormatUint(adminID, 10), Username: adminUsername},
+		RegisteredClaims: s.registered(user.ID, s.AccessAudience, now, s.ImpersonateTTL, jti),
+	})
+	return token, now.Add(s.ImpersonateTTL), err
+}
+
+// IssueRefresh signs a refresh token for a device (refresh_tokens row)
+func (s *Service) IssueRefresh(user *models.User, deviceID uint64) (string, error) {
+	jti, err := utils.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	return s.refresh.Sign(&RefreshClaims{
+		Username:         user.Email,
+		DeviceID:         deviceID,
+		RegisteredClaims: s.registered(user.ID, s.RefreshAudience, s.now(), s.RefreshTTL, jti),
+	})
+}
+
+// ParseAccess validates an access token: signature, expiry, issuer and audience
+func (s *Service) ParseAccess(tokenStr string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	if !s.parse(tokenStr, claims, s.access, s.AccessAudience) || claims.UserID() == 0 ||
+		(claims.Actor != nil && claims.Actor.AdminID() == 0) {
+		return nil, ErrInvalidAccessToken
+	}
+	return claims, nil
+}
+
+// ParseRefresh validates a refresh token: signature, expiry, issuer and audience
+func (s *Service) ParseRefresh(tokenStr string) (*RefreshClaims, error) {
+	claims := &RefreshClaims{}
+	if !s.parse(tokenStr, claims, s.refresh, s.RefreshAudience) || claims.UserID() == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	return claims, nil
+}
+
+type registeredClaims interface {
+	jwt.Claims
+	VerifyIssuer(cmp string, req bool) bool
+	VerifyAudience(cmp string, req bool) bool
+}
+
+func (s *Service) parse(tokenStr string, claims registeredClaims, ring *keyring.Ring, audience string) bool {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, ring.Keyfunc)
+	if err != nil || !token.Valid {
+		return false
+	}
+	return claims.VerifyIssuer(s.Issuer, true) && claims.VerifyAudience(audience, true)
+}
+
+func (s *Service) registered(userID uint64, audience string, now time.Time, ttl time.Duration, jti string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    s.Issuer,
+		Subject:   strconv.FormatUint(userID, 10),
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+}
@@ -27,6 +27,7 @@ type SendTemplatedEmailParams struct {
 	SMTPUser     string
 	SMTPPass     string
 	FromEmail    string
+	Subject      string
 	SendType     EmailSendType
 }
 
@@ -63,9 +64,14 @@ func SendTemplatedEmail(params SendTemplatedEmailParams) error {
 		return err
 	}
 
+	subject := params.Subject
+	if subject == "" {
+		subject = "Notification"
+	}
+
 	message := "From: " + params.FromEmail + "\n" +
 		"To: " + params.ToEmail + "\n" +
-		"Subject: Notification\n" +
+		"Subject: " + subject + "\n" +
 		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" +
 		body.String()
 
@@ -88,3 +94,19 @@ func SendTemplatedEmail(params SendTemplatedEmailParams) error {
 	}
 	return err
 }
+
+// SendEmail sends a templated email using the SMTP settings from the [email] section of config.ini
+func SendEmail(toEmail, subject, templatePath string, vars []string) error {
+	return SendTemplatedEmail(SendTemplatedEmailParams{
+		Vars:         vars,
+		TemplatePath: templatePath,
+		ToEmail:      toEmail,
+		SMTPHost:     cfg.Section("email").Key("smtp_host").String(),
+		SMTPPort:     cfg.Section("email").Key("smtp_port").String(),
+		SMTPUser:     cfg.Section("email").Key("smtp_user").String(),
+		SMTPPass:     cfg.Section("email").Key("smtp_pass").String(),
+		FromEmail:    cfg.Section("email").Key("from_email").String(),
+		Subject:      subject,
+		SendType:     SendSMTP,
+	})
+}
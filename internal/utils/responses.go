@@ -6,8 +6,9 @@ import (
 )
 
 type ErrorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Params  map[string]interface{} `json:"params,omitempty"` // values for localised messages, e.g. minLength
 }
 
 // WriteError writes an error response to the http.ResponseWriter
@@ -20,6 +21,17 @@ func WriteError(w http.ResponseWriter, status int, code string, message string)
 	})
 }
 
+// WriteErrorParams writes an error response with the values the frontend needs to localise the message
+func WriteErrorParams(w http.ResponseWriter, status int, code string, message string, params map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:    code,
+		Message: message,
+		Params:  params,
+	})
+}
+
 // WriteJSON writes a JSON response to the http.ResponseWriter
 func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -75,6 +75,24 @@ func (suite *AdminHandlersTestSuite) SetupSuite() {
 		&models.Message{},            // Добавляем модель Messagesage
 		&models.Availability{},       // Добавляем модель Availabilitylity
 		&models.Photo{},              // Добавляем модель Photo (если есть)сть)
+		&models.SessionEvent{},
+		&models.SessionReschedule{},
+		&models.SessionSeries{},
+		&models.Conversation{},
+		&models.Rating{},
+		&models.Education{},
+		&models.Language{},
+		&models.Diploma{},
+		&models.ScheduleTemplate{},
+		&models.ScheduleException{},
+		&models.UserIdentity{},
+		&models.APIKey{},
+		&models.EmailChange{},
+		&models.MagicLinkToken{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.MFARecoveryCode{},
+		&models.MFAPendingToken{},
 	)
 	suite.Require().NoError(err)
 
@@ -103,6 +121,9 @@ func (suite *AdminHandlersTestSuite) SetupTest() {
 	suite.db.Exec("TRUNCATE TABLE categories")
 	suite.db.Exec("TRUNCATE TABLE administrators")
 	suite.db.Exec("TRUNCATE TABLE plans")
+	for _, table := range []string{"user_identities", "api_keys", "email_changes", "magic_link_tokens", "refresh_tokens", "password_reset_tokens", "mfa_recovery_codes", "mfa_pending_tokens"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
 
 	// Enable foreign key checks
 	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
@@ -541,7 +562,7 @@ func (suite *AdminHandlersTestSuite) TestCreateUser_Success() {
 		"lastName":  "Doe",
 		"email":     "john.doe@example.com",
 		"role":      "client",
-		"password":  "password123",
+		"password":  "Correct-Horse-42",
 		"status":    "Active",
 		"verified":  true,
 	}
@@ -715,6 +736,53 @@ func (suite *AdminHandlersTestSuite) TestDeleteUser_Success() {
 	assert.Error(suite.T(), err) // Should be "record not found" error
 }
 
+func (suite *AdminHandlersTestSuite) TestDeleteUser_RemovesAccountData() {
+	user := suite.createTestUser()
+	other := &models.User{FirstName: "Other", LastName: "User", Email: "other@example.com", Password: "hashedpassword", Role: "client", Status: "Active"}
+	suite.Require().NoError(suite.db.Create(other).Error)
+
+	expires := time.Now().Add(time.Hour)
+	for _, id := range []uint64{user.ID, other.ID} {
+		suffix := strconv.FormatUint(id, 10)
+		hash := fmt.Sprintf("%064d", id)
+		suite.Require().NoError(suite.db.Create(&models.UserIdentity{UserID: id, Provider: "google", Subject: "subject-" + suffix}).Error)
+		suite.Require().NoError(suite.db.Create(&models.APIKey{UserID: id, Name: "key", Prefix: "uak_" + suffix, KeyHash: hash, Scopes: "sessions:read", ExpiresAt: expires}).Error)
+		suite.Require().NoError(suite.db.Create(&models.EmailChange{UserID: id, OldEmail: "old@example.com", NewEmail: "new@example.com",
+			ConfirmTokenHash: hash, UndoTokenHash: fmt.Sprintf("u%063d", id), ExpiresAt: expires}).Error)
+		suite.Require().NoError(suite.db.Create(&models.MagicLinkToken{UserID: id, TokenHash: hash, ExpiresAt: expires}).Error)
+		suite.Require().NoError(suite.db.Create(&models.RefreshToken{AccountType: "user", AccountID: id, TokenHash: hash, LastUsedAt: time.Now(), ExpiresAt: expires}).Error)
+		suite.Require().NoError(suite.db.Create(&models.PasswordResetToken{AccountType: "user", AccountID: id, TokenHash: hash, ExpiresAt: expires}).Error)
+		suite.Require().NoError(suite.db.Create(&models.MFARecoveryCode{AccountType: "user", AccountID: id, CodeHash: hash}).Error)
+		suite.Require().NoError(suite.db.Create(&models.MFAPendingToken{JTI: fmt.Sprintf("%032d", id), AccountType: "user", AccountID: id, ExpiresAt: expires}).Error)
+	}
+	// An administrator with the same ID keeps its tokens
+	suite.Require().NoError(suite.db.Create(&models.RefreshToken{AccountType: "admin", AccountID: user.ID, TokenHash: fmt.Sprintf("a%063d", user.ID),
+		LastUsedAt: time.Now(), ExpiresAt: expires}).Error)
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/admin/users/%d", user.ID), nil)
+	w := httptest.NewRecorder()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.FormatUint(user.ID, 10))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	count := func(model interface{}, query string, args ...interface{}) int64 {
+		var n int64
+		suite.db.Model(model).Where(query, args...).Count(&n)
+		return n
+	}
+	for _, model := range []interface{}{&models.UserIdentity{}, &models.APIKey{}, &models.EmailChange{}, &models.MagicLinkToken{}} {
+		assert.Equal(suite.T(), int64(0), count(model, "user_id = ?", user.ID), "%T", model)
+		assert.Equal(suite.T(), int64(1), count(model, "user_id = ?", other.ID), "%T", model)
+	}
+	for _, model := range []interface{}{&models.RefreshToken{}, &models.PasswordResetToken{}, &models.MFARecoveryCode{}, &models.MFAPendingToken{}} {
+		assert.Equal(suite.T(), int64(0), count(model, "account_type = ? AND account_id = ?", "user", user.ID), "%T", model)
+		assert.Equal(suite.T(), int64(1), count(model, "account_type = ? AND account_id = ?", "user", other.ID), "%T", model)
+	}
+	assert.Equal(suite.T(), int64(1), count(&models.RefreshToken{}, "account_type = ? AND account_id = ?", "admin", user.ID))
+}
+
 func (suite *AdminHandlersTestSuite) TestDeleteUser_NotFound() {
 	req := httptest.NewRequest("DELETE", "/api/admin/users/999", nil)
 	w := httptest.NewRecorder()
@@ -0,0 +1,64 @@
+package unit_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/internal/auth"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions_Hierarchy(t *testing.T) {
+	// Moderators handle news and reviews only
+	assert.True(t, auth.Can(auth.RoleModerator, auth.PermNewsManage))
+	assert.True(t, auth.Can(auth.RoleModerator, auth.PermReviewsDelete))
+	assert.False(t, auth.Can(auth.RoleModerator, auth.PermPlansManage))
+	assert.False(t, auth.Can(auth.RoleModerator, auth.PermAdminsRead))
+	assert.False(t, auth.Can(auth.RoleModerator, auth.PermUsersDelete))
+
+	// Admins manage users and plans but not other administrators
+	assert.True(t, auth.Can(auth.RoleAdmin, auth.PermUsersDelete))
+	assert.True(t, auth.Can(auth.RoleAdmin, auth.PermPlansManage))
+	assert.True(t, auth.Can(auth.RoleAdmin, auth.PermNewsManage))
+	assert.False(t, auth.Can(auth.RoleAdmin, auth.PermAdminsManage))
+
+	// Master can do everything
+	assert.True(t, auth.Can(auth.RoleMaster, auth.PermAdminsManage))
+	assert.True(t, auth.Can(auth.RoleMaster, auth.PermSettingsManage))
+	assert.ElementsMatch(t, auth.PermissionsFor(auth.RoleMaster),
+		append(auth.PermissionsFor(auth.RoleAdmin), auth.PermAdminsManage, auth.PermSettingsManage))
+
+	assert.False(t, auth.IsAdminRole("client"))
+	assert.False(t, auth.Can("client", auth.PermUsersRead))
+}
+
+func TestRequirePermission(t *testing.T) {
+	handler := authmw.RequirePermission(auth.PermUsersDelete)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name     string
+		admin    *models.Administrator
+		expected int
+	}{
+		{"no admin in context", nil, http.StatusUnauthorized},
+		{"moderator", &models.Administrator{Username: "mod", Role: auth.RoleModerator}, http.StatusForbidden},
+		{"admin", &models.Administrator{Username: "adm", Role: auth.RoleAdmin}, http.StatusNoContent},
+		{"master", &models.Administrator{Username: "root", Role: auth.RoleMaster}, http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/api/admin/users/1", nil)
+			if tc.admin != nil {
+				req = req.WithContext(auth.WithAdmin(req.Context(), tc.admin))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	assert.True(t, auth.IsAPIKeyScope(auth.ScopeSessionsRead))
+	assert.False(t, auth.IsAPIKeyScope("sessions:delete"))
+	assert.Contains(t, auth.APIKeyScopes(), auth.ScopeAvailabilityWrite)
+
+	jwt := &auth.AuthPrincipal{UserID: 1}
+	assert.True(t, jwt.HasScope(auth.ScopeSessionsWrite), "JWT requests are not limited by scopes")
+
+	key := &auth.AuthPrincipal{UserID: 1, APIKeyID: 3, Scopes: []string{auth.ScopeSessionsRead}}
+	assert.True(t, key.HasScope(auth.ScopeSessionsRead))
+	assert.False(t, key.HasScope(auth.ScopeSessionsWrite))
+
+	noScopes := &auth.AuthPrincipal{UserID: 1, APIKeyID: 4}
+	assert.False(t, noScopes.HasScope(auth.ScopeSessionsRead))
+}
+
+type APIKeysTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	user    *models.User
+}
+
+func (suite *APIKeysTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.APIKey{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Group(func(r chi.Router) {
+		r.Use(AuthAs("psy@example.com"))
+		r.Get("/api/users/self/api-keys", handlers.GetMyAPIKeys)
+		r.Post("/api/users/self/api-keys", handlers.CreateAPIKey)
+		r.Delete("/api/users/self/api-keys/{id}", handlers.RevokeMyAPIKey)
+	})
+	suite.router.Group(func(r chi.Router) {
+		r.Use(authmw.RequireUserOrAPIKey)
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+		r.With(authmw.RequireScope(auth.ScopeSessionsRead)).Get("/api/users/sessions/my", ok)
+		r.With(authmw.RequireScope(auth.ScopeAvailabilityWrite)).Post("/api/users/availability", ok)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *APIKeysTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *APIKeysTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"api_keys", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	auth.Principals = auth.NewPrincipalCache(time.Minute)
+	suite.user = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+}
+
+// createKey creates a key through the API and returns the plain key and its ID
+func (suite *APIKeysTestSuite) createKey(scopes ...string) (string, uint64) {
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/users/self/api-keys", map[string]interface{}{"name": "calendar sync", "scopes": scopes})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var body struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID     uint64   `json:"id"`
+			Scopes []string `json:"scopes"`
+		} `json:"apiKey"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	suite.Require().ElementsMatch(scopes, body.APIKey.Scopes)
+	return body.Key, body.APIKey.ID
+}
+
+func (suite *APIKeysTestSuite) callWithKey(method, url, key string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *APIKeysTestSuite) TestCreate_StoresOnlyHash() {
+	key, id := suite.createKey(auth.ScopeSessionsRead)
+
+	var stored models.APIKey
+	suite.Require().NoError(suite.db.First(&stored, id).Error)
+	assert.Equal(suite.T(), sha256Hex(key), stored.KeyHash)
+	assert.Equal(suite.T(), key[:len(stored.Prefix)], stored.Prefix)
+	assert.WithinDuration(suite.T(), time.Now().AddDate(0, 0, 90), stored.ExpiresAt, time.Minute)
+
+	// The list never contains the key
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/users/self/api-keys", nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), key)
+	assert.NotContains(suite.T(), w.Body.String(), stored.KeyHash)
+}
+
+func (suite *APIKeysTestSuite) TestCreate_Validation() {
+	cases := []struct {
+		body   map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"name": "x"}, http.StatusBadRequest},
+		{map[string]interface{}{"name": "x", "scopes": []string{"users:delete"}}, http.StatusBadRequest},
+		{map[string]interface{}{"name": "x", "scopes": []string{"sessions:read"}, "expiresInDays": 1000}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w, req := suite.helpers.MakeJSONRequest("POST", "/api/users/self/api-keys", c.body)
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), c.status, w.Code, w.Body.String())
+	}
+
+	// Test config allows 3 active keys
+	for i := 0; i < 3; i++ {
+		suite.createKey(auth.ScopeSessionsRead)
+	}
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/users/self/api-keys", map[string]interface{}{"name": "x", "scopes": []string{"sessions:read"}})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *APIKeysTestSuite) TestScopesAndLastUse() {
+	key, id := suite.createKey(auth.ScopeSessionsRead)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.callWithKey("GET", "/api/users/sessions/my", key).Code)
+	w := suite.callWithKey("POST", "/api/users/availability", key)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "INSUFFICIENT_SCOPE")
+
+	var stored models.APIKey
+	suite.Require().NoError(suite.db.First(&stored, id).Error)
+	assert.NotNil(suite.T(), stored.LastUsedAt)
+
+	// Bearer tokens keep working on the same routes, without scope limits
+	token, err := tokens.Default.IssueAccess(suite.user)
+	suite.Require().NoError(err)
+	req := httptest.NewRequest("POST", "/api/users/availability", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+}
+
+func (suite *APIKeysTestSuite) TestRevokedExpiredAndBlocked() {
+	key, id := suite.createKey(auth.ScopeSessionsRead)
+
+	w, req := suite.helpers.MakeJSONRequest("DELETE", fmt.Sprintf("/api/users/self/api-keys/%d", id), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	w = suite.callWithKey("GET", "/api/users/sessions/my", key)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "INVALID_API_KEY")
+
+	expired, id := suite.createKey(auth.ScopeSessionsRead)
+	suite.db.Model(&models.APIKey{}).Where("id = ?", id).Update("expires_at", time.Now().Add(-time.Minute))
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.callWithKey("GET", "/api/users/sessions/my", expired).Code)
+
+	active, _ := suite.createKey(auth.ScopeSessionsRead)
+	suite.db.Model(suite.user).Update("status", "Blocked")
+	auth.Principals.Invalidate(suite.user.ID)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.callWithKey("GET", "/api/users/sessions/my", active).Code)
+}
+
+func TestAPIKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeysTestSuite))
+}
@@ -0,0 +1,197 @@
+package unit_tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"user-api/internal/audit"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestAuditDiff_OnlyChangedFieldsAndRedaction(t *testing.T) {
+	before := models.User{ID: 7, FirstName: "Old", LastName: "Same", Password: "hash-1"}
+	after := models.User{ID: 7, FirstName: "New", LastName: "Same", Password: "hash-2"}
+
+	changes := audit.Diff(before, after)
+
+	assert.Equal(t, audit.FieldChange{Before: "Old", After: "New"}, changes["FirstName"])
+	assert.NotContains(t, changes, "LastName")
+	assert.Equal(t, audit.FieldChange{Before: "[REDACTED]", After: "[REDACTED]"}, changes["Password"])
+
+	// Nested secrets (e.g. a preloaded author) are scrubbed too
+	news := map[string]interface{}{"author": map[string]interface{}{"username": "root", "password": "hash"}}
+	created := audit.Diff(nil, news)
+	encoded, _ := json.Marshal(created)
+	assert.NotContains(t, string(encoded), "hash")
+	assert.Contains(t, string(encoded), "root")
+}
+
+type AuditTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	admin   *models.Administrator
+}
+
+func (suite *AuditTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.Plan{}, &models.AuditEvent{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), suite.admin)))
+			})
+		})
+		r.Post("/api/admin/plans", handlers.CreatePlan)
+		r.Put("/api/admin/plans/{id}", handlers.UpdatePlan)
+		r.Delete("/api/admin/plans/{id}", handlers.DeletePlan)
+		r.Get("/api/admin/audit", handlers.GetAuditEvents)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *AuditTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *AuditTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE audit_events")
+	suite.db.Exec("TRUNCATE TABLE plans")
+	suite.db.Exec("TRUNCATE TABLE administrators")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+	suite.admin = &models.Administrator{
+		Username:  "auditor",
+		Email:     "auditor@example.com",
+		Password:  "password",
+		FirstName: "Audit",
+		LastName:  "Admin",
+		Role:      auth.RoleAdmin,
+		Status:    "Active",
+	}
+	suite.Require().NoError(suite.db.Create(suite.admin).Error)
+}
+
+func (suite *AuditTestSuite) createPlan(name string) uint64 {
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/admin/plans", map[string]interface{}{
+		"name": name, "description": "Plan", "price": 10,
+	})
+	req.RemoteAddr = "203.0.113.5:4321"
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	var plan models.Plan
+	suite.Require().NoError(suite.db.Where("name = ?", name).First(&plan).Error)
+	return plan.ID
+}
+
+func (suite *AuditTestSuite) TestMutationsAreRecordedWithDiff() {
+	planID := suite.createPlan("Basic")
+
+	w, req := suite.helpers.MakeJSONRequest("PUT", fmt.Sprintf("/api/admin/plans/%d", planID), map[string]interface{}{
+		"name": "Basic", "description": "Plan", "price": 25,
+	})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var events []models.AuditEvent
+	suite.db.Order("id").Find(&events)
+	suite.Require().Len(events, 2)
+
+	assert.Equal(suite.T(), "plan.create", events[0].Action)
+	assert.Equal(suite.T(), suite.admin.ID, events[0].ActorID)
+	assert.Equal(suite.T(), "auditor", events[0].ActorUsername)
+	assert.Equal(suite.T(), audit.TargetPlan, events[0].TargetType)
+	assert.Equal(suite.T(), fmt.Sprint(planID), events[0].TargetID)
+	assert.Equal(suite.T(), "203.0.113.5", events[0].IP)
+
+	var changes map[string]audit.FieldChange
+	suite.Require().NoError(json.Unmarshal(events[1].Changes, &changes))
+	assert.Equal(suite.T(), "plan.update", events[1].Action)
+	// Plan has no JSON tags, so the changed fields keep their Go names
+	assert.Equal(suite.T(), audit.FieldChange{Before: float64(10), After: float64(25)}, changes["Price"])
+	assert.NotContains(suite.T(), changes, "Name", "Unchanged fields must not be recorded")
+}
+
+func (suite *AuditTestSuite) TestListFiltersAndCSV() {
+	first := suite.createPlan("First")
+	suite.createPlan("Second")
+
+	w, req := suite.helpers.MakeJSONRequest("DELETE", fmt.Sprintf("/api/admin/plans/%d", first), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	// Filter by target
+	w, req = suite.helpers.MakeJSONRequest("GET", fmt.Sprintf("/api/admin/audit?targetType=plan&targetId=%d", first), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var resp struct {
+		Data  []models.AuditEvent `json:"data"`
+		Total int64               `json:"total"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(suite.T(), int64(2), resp.Total)
+	assert.Equal(suite.T(), "plan.delete", resp.Data[0].Action, "Newest events come first")
+
+	// Filter by action and actor
+	w, req = suite.helpers.MakeJSONRequest("GET", fmt.Sprintf("/api/admin/audit?action=plan.create&actorId=%d", suite.admin.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(suite.T(), int64(2), resp.Total)
+
+	// Time range in the past matches nothing
+	w, req = suite.helpers.MakeJSONRequest("GET", "/api/admin/audit?to=2000-01-01T00:00:00Z", nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(suite.T(), int64(0), resp.Total)
+
+	w, req = suite.helpers.MakeJSONRequest("GET", "/api/admin/audit?from=yesterday", nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// CSV export
+	w, req = suite.helpers.MakeJSONRequest("GET", "/api/admin/audit?format=csv", nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.True(suite.T(), strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	suite.Require().NoError(err)
+	suite.Require().Len(records, 4, "Header plus three events")
+	assert.Equal(suite.T(), "action", records[0][4])
+	assert.Equal(suite.T(), "plan.delete", records[1][4])
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
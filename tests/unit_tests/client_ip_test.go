@@ -0,0 +1,46 @@
+package unit_tests
+
+import (
+	"net/http/httptest"
+	"testing"
+	"user-api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	saved := utils.TrustedProxies
+	defer func() { utils.TrustedProxies = saved }()
+
+	request := func(remote string, forwarded ...string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for _, value := range forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		return utils.ClientIP(r)
+	}
+
+	// Without trusted proxies the header is ignored
+	utils.TrustedProxies = nil
+	assert.Equal(t, "203.0.113.7", request("203.0.113.7:5000", "198.51.100.1"))
+
+	proxies, err := utils.ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	require.NoError(t, err)
+	utils.TrustedProxies = proxies
+
+	// A direct client still cannot choose its address
+	assert.Equal(t, "203.0.113.7", request("203.0.113.7:5000", "198.51.100.1"))
+	// Behind the proxy the right-most untrusted hop is the client, whatever it prepended itself
+	assert.Equal(t, "203.0.113.7", request("10.1.2.3:5000", "198.51.100.1, 203.0.113.7"))
+	assert.Equal(t, "203.0.113.7", request("10.1.2.3:5000", "198.51.100.1", "203.0.113.7, 192.0.2.10"))
+	// Garbage stops the walk at the last proxy that wrote a valid hop
+	assert.Equal(t, "10.9.9.9", request("10.1.2.3:5000", "not-an-ip, 10.9.9.9"))
+	assert.Equal(t, "10.1.2.3", request("10.1.2.3:5000"))
+
+	_, err = utils.ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = utils.ParseTrustedProxies("proxy.local")
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package unit_tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type EmailChangeTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	user    *models.User
+}
+
+func (suite *EmailChangeTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.EmailChange{}, &models.RefreshToken{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/auth/email-change/confirm", handlers.ConfirmEmailChange)
+	suite.router.Post("/api/auth/email-change/undo", handlers.UndoEmailChange)
+	suite.router.With(AuthAs("parent@example.com")).Post("/api/users/self/email", handlers.RequestEmailChange)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *EmailChangeTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *EmailChangeTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"email_changes", "refresh_tokens", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.user = suite.helpers.CreateTestUser("parent@example.com", "client")
+	suite.db.Model(suite.user).Update("password", string(hashed))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// createChange stores an email change with known tokens
+func (suite *EmailChangeTestSuite) createChange(newEmail string, confirmedAt *time.Time) (confirm, undo string) {
+	confirm = fmt.Sprintf("confirm-%d", time.Now().UnixNano())
+	undo = fmt.Sprintf("undo-%d", time.Now().UnixNano())
+	suite.Require().NoError(suite.db.Create(&models.EmailChange{
+		UserID:           suite.user.ID,
+		OldEmail:         suite.user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: sha256Hex(confirm),
+		UndoTokenHash:    sha256Hex(undo),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		ConfirmedAt:      confirmedAt,
+	}).Error)
+	return confirm, undo
+}
+
+func (suite *EmailChangeTestSuite) post(url string, body interface{}) *http.Response {
+	w, req := suite.helpers.MakeJSONRequest("POST", url, body)
+	suite.router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func (suite *EmailChangeTestSuite) addDevice() {
+	suite.Require().NoError(suite.db.Create(&models.RefreshToken{AccountType: "user", AccountID: suite.user.ID,
+		TokenHash: sha256Hex(fmt.Sprint(time.Now().UnixNano())), LastUsedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}).Error)
+}
+
+func (suite *EmailChangeTestSuite) activeDevices() int64 {
+	var count int64
+	suite.db.Model(&models.RefreshToken{}).Where("account_id = ? AND revoked_at IS NULL", suite.user.ID).Count(&count)
+	return count
+}
+
+func (suite *EmailChangeTestSuite) currentEmail() string {
+	var user models.User
+	suite.db.First(&user, suite.user.ID)
+	return user.Email
+}
+
+func (suite *EmailChangeTestSuite) TestRequest_Validation() {
+	suite.helpers.CreateTestUser("taken@example.com", "client")
+
+	cases := []struct {
+		body   map[string]string
+		status int
+	}{
+		{map[string]string{"newEmail": "new@example.com", "password": "wrong-password"}, http.StatusUnauthorized},
+		{map[string]string{"newEmail": "not an email", "password": "password123"}, http.StatusBadRequest},
+		{map[string]string{"newEmail": "parent@example.com", "password": "password123"}, http.StatusBadRequest},
+		{map[string]string{"newEmail": "taken@example.com", "password": "password123"}, http.StatusConflict},
+	}
+	for _, c := range cases {
+		assert.Equal(suite.T(), c.status, suite.post("/api/users/self/email", c.body).StatusCode, c.body["newEmail"])
+	}
+
+	var count int64
+	suite.db.Model(&models.EmailChange{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *EmailChangeTestSuite) TestRequest_SupersedesPendingAndKeepsEmail() {
+	resp := suite.post("/api/users/self/email", map[string]string{"newEmail": "first@example.com", "password": "password123"})
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	resp = suite.post("/api/users/self/email", map[string]string{"newEmail": "second@example.com", "password": "password123"})
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var changes []models.EmailChange
+	suite.db.Order("id").Find(&changes)
+	suite.Require().Len(changes, 2)
+	assert.NotNil(suite.T(), changes[0].CanceledAt, "Only the latest request can be confirmed")
+	assert.Nil(suite.T(), changes[1].CanceledAt)
+	assert.Len(suite.T(), changes[1].ConfirmTokenHash, 64, "Only token hashes are stored")
+	assert.Equal(suite.T(), "parent@example.com", suite.currentEmail(), "The address changes only after confirmation")
+}
+
+func (suite *EmailChangeTestSuite) TestConfirm_SwitchesAndRevokesDevices() {
+	suite.addDevice()
+	suite.addDevice()
+	confirm, _ := suite.createChange("new@example.com", nil)
+
+	resp := suite.post("/api/auth/email-change/confirm", map[string]string{"token": confirm})
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "new@example.com", suite.currentEmail())
+	assert.Equal(suite.T(), int64(0), suite.activeDevices())
+
+	// Single use
+	resp = suite.post("/api/auth/email-change/confirm", map[string]string{"token": confirm})
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *EmailChangeTestSuite) TestConfirm_EmailTakenInTheMeantime() {
+	confirm, _ := suite.createChange("new@example.com", nil)
+	suite.helpers.CreateTestUser("new@example.com", "client")
+
+	resp := suite.post("/api/auth/email-change/confirm", map[string]string{"token": confirm})
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+	assert.Equal(suite.T(), "parent@example.com", suite.currentEmail())
+}
+
+func (suite *EmailChangeTestSuite) TestUndo_BeforeConfirmationCancels() {
+	confirm, undo := suite.createChange("new@example.com", nil)
+
+	resp := suite.post("/api/auth/email-change/undo", map[string]string{"token": undo})
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	resp = suite.post("/api/auth/email-change/confirm", map[string]string{"token": confirm})
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(suite.T(), "parent@example.com", suite.currentEmail())
+}
+
+func (suite *EmailChangeTestSuite) TestUndo_RevertsWithinWindow() {
+	confirm, undo := suite.createChange("attacker@example.com", nil)
+	suite.Require().Equal(http.StatusOK, suite.post("/api/auth/email-change/confirm", map[string]string{"token": confirm}).StatusCode)
+	suite.addDevice() // the new owner signs in
+
+	resp := suite.post("/api/auth/email-change/undo", map[string]string{"token": undo})
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "parent@example.com", suite.currentEmail())
+	assert.Equal(suite.T(), int64(0), suite.activeDevices(), "Undo must sign out the sessions of the new address")
+
+	resp = suite.post("/api/auth/email-change/undo", map[string]string{"token": undo})
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *EmailChangeTestSuite) TestUndo_ExpiresAfter48Hours() {
+	confirmedAt := time.Now().Add(-49 * time.Hour)
+	_, undo := suite.createChange("new@example.com", &confirmedAt)
+	suite.db.Model(suite.user).Update("email", "new@example.com")
+
+	resp := suite.post("/api/auth/email-change/undo", map[string]string{"token": undo})
+	assert.Equal(suite.T(), http.StatusGone, resp.StatusCode)
+	assert.Equal(suite.T(), "new@example.com", suite.currentEmail())
+}
+
+func TestEmailChangeTestSuite(t *testing.T) {
+	suite.Run(t, new(EmailChangeTestSuite))
+}
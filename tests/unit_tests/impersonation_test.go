@@ -0,0 +1,189 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestDenyImpersonation(t *testing.T) {
+	handler := authmw.DenyImpersonation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(principal *auth.AuthPrincipal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/users/self/password", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(auth.WithPrincipal(req.Context(), principal)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(&auth.AuthPrincipal{UserID: 1, Status: "Active"}).Code)
+
+	w := serve(&auth.AuthPrincipal{UserID: 1, Status: "Active", Impersonator: &auth.Impersonator{AdminID: 2, Username: "support"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "IMPERSONATION_FORBIDDEN")
+
+	assert.True(t, auth.Can(auth.RoleAdmin, auth.PermUsersImpersonate))
+	assert.False(t, auth.Can(auth.RoleModerator, auth.PermUsersImpersonate))
+}
+
+type ImpersonationTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	admin   *models.Administrator
+	user    *models.User
+}
+
+func (suite *ImpersonationTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.AuditEvent{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), suite.admin)))
+			})
+		})
+		r.Post("/api/admin/users/{id}/impersonate", handlers.ImpersonateUser)
+	})
+	suite.router.Group(func(r chi.Router) {
+		r.Use(authmw.RequireUser)
+		r.Get("/api/users/whoami", func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := auth.PrincipalFromContext(r.Context())
+			utils.WriteJSON(w, http.StatusOK, principal)
+		})
+		r.With(authmw.DenyImpersonation).Put("/api/users/self/password", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *ImpersonationTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *ImpersonationTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"audit_events", "administrators", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	auth.Principals = auth.NewPrincipalCache(time.Minute)
+
+	suite.admin = &models.Administrator{Username: "support", Email: "support@example.com", Password: "x",
+		FirstName: "Support", LastName: "Admin", Role: auth.RoleAdmin, Status: "Active"}
+	suite.Require().NoError(suite.db.Create(suite.admin).Error)
+	suite.user = suite.helpers.CreateTestUser("viewed@example.com", "psychologist")
+}
+
+// impersonate returns an impersonation token for the user
+func (suite *ImpersonationTestSuite) impersonate(userID uint64) string {
+	w, req := suite.helpers.MakeJSONRequest("POST", fmt.Sprintf("/api/admin/users/%d/impersonate", userID), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var body map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	return body["access_token"].(string)
+}
+
+func (suite *ImpersonationTestSuite) call(method, url, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *ImpersonationTestSuite) auditCount(action string) int64 {
+	var count int64
+	suite.db.Model(&models.AuditEvent{}).Where("action = ? AND actor_id = ?", action, suite.admin.ID).Count(&count)
+	return count
+}
+
+func (suite *ImpersonationTestSuite) TestViewAsUserIsLogged() {
+	token := suite.impersonate(suite.user.ID)
+	assert.Equal(suite.T(), int64(1), suite.auditCount("user.impersonate"))
+
+	w := suite.call("GET", "/api/users/whoami", token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var principal auth.AuthPrincipal
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &principal))
+	assert.Equal(suite.T(), suite.user.ID, principal.UserID)
+	suite.Require().NotNil(principal.Impersonator)
+	assert.Equal(suite.T(), "support", principal.Impersonator.Username)
+
+	// Blocked requests are logged too
+	w = suite.call("PUT", "/api/users/self/password", token)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "IMPERSONATION_FORBIDDEN")
+	assert.Equal(suite.T(), int64(2), suite.auditCount("user.impersonated_request"))
+}
+
+func (suite *ImpersonationTestSuite) TestOwnerIsNotAffected() {
+	suite.Require().Equal(http.StatusOK, suite.call("GET", "/api/users/whoami", suite.impersonate(suite.user.ID)).Code)
+
+	// The cached principal is shared, so the impersonator must not leak into the owner's requests
+	token, err := tokens.Default.IssueAccess(suite.user)
+	suite.Require().NoError(err)
+	w := suite.call("GET", "/api/users/whoami", token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var principal auth.AuthPrincipal
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &principal))
+	assert.Nil(suite.T(), principal.Impersonator)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.call("PUT", "/api/users/self/password", token).Code)
+	assert.Equal(suite.T(), int64(1), suite.auditCount("user.impersonated_request"))
+}
+
+func (suite *ImpersonationTestSuite) TestRevokedWhenAdminIsDisabled() {
+	token := suite.impersonate(suite.user.ID)
+	suite.db.Model(suite.admin).Update("status", "Disabled")
+
+	w := suite.call("GET", "/api/users/whoami", token)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "IMPERSONATION_REVOKED")
+}
+
+func (suite *ImpersonationTestSuite) TestInactiveUserCannotBeImpersonated() {
+	suite.db.Model(suite.user).Update("status", "Blocked")
+	w, req := suite.helpers.MakeJSONRequest("POST", fmt.Sprintf("/api/admin/users/%d/impersonate", suite.user.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func TestImpersonationTestSuite(t *testing.T) {
+	suite.Run(t, new(ImpersonationTestSuite))
+}
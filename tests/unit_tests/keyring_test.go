@@ -0,0 +1,213 @@
+package unit_tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/handlers"
+	"user-api/internal/keyring"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaPEM(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), key
+}
+
+func ed25519PEM(t *testing.T) ([]byte, ed25519.PublicKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), public
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "42", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestKeyRing_RotationKeepsOldTokensValid(t *testing.T) {
+	rsaData, _ := rsaPEM(t)
+	oldKey := keyring.NewHMACKey("2026-01", []byte("old-secret"))
+	newKey, err := keyring.NewKeyFromPEM("2026-10", "RS256", rsaData)
+	require.NoError(t, err)
+
+	before, err := keyring.NewRing("2026-01", oldKey)
+	require.NoError(t, err)
+	oldToken, err := before.Sign(testClaims())
+	require.NoError(t, err)
+
+	// Rotate: the RSA key signs, the old secret still verifies until it expires
+	oldKey.ExpiresAt = time.Now().Add(24 * time.Hour)
+	after, err := keyring.NewRing("2026-10", oldKey, newKey)
+	require.NoError(t, err)
+
+	newToken, err := after.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, err := jwt.Parse(newToken, after.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+
+	_, err = jwt.Parse(oldToken, after.Keyfunc)
+	assert.NoError(t, err, "Tokens of the previous key must stay valid")
+
+	// Once the old key expires its tokens are rejected
+	after.SetClock(func() time.Time { return time.Now().Add(48 * time.Hour) })
+	_, err = jwt.Parse(oldToken, after.Keyfunc)
+	assert.Error(t, err)
+
+	// Unknown kid
+	other, _ := keyring.NewRing("x", keyring.NewHMACKey("x", []byte("other")))
+	foreign, _ := other.Sign(testClaims())
+	_, err = jwt.Parse(foreign, after.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaData, private := rsaPEM(t)
+	key, err := keyring.NewKeyFromPEM("rsa", "RS256", rsaData)
+	require.NoError(t, err)
+	ring, err := keyring.NewRing("rsa", key)
+	require.NoError(t, err)
+
+	// HS256 token "signed" with the public key bytes must not verify
+	publicDER := x509.MarshalPKCS1PublicKey(&private.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "rsa"
+	forgedStr, err := forged.SignedString(publicDER)
+	require.NoError(t, err)
+	_, err = jwt.Parse(forgedStr, ring.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_LegacyTokensWithoutKid(t *testing.T) {
+	legacy := keyring.NewHMACKey("default", []byte("legacy-secret"))
+	legacy.Legacy = true
+	ring, err := keyring.NewRing("default", legacy)
+	require.NoError(t, err)
+
+	// Token issued before key IDs existed
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("legacy-secret"))
+	require.NoError(t, err)
+	_, err = jwt.Parse(token, ring.Keyfunc)
+	assert.NoError(t, err)
+
+	// A ring without a legacy key refuses tokens without kid
+	strict, _ := keyring.NewRing("k", keyring.NewHMACKey("k", []byte("legacy-secret")))
+	_, err = jwt.Parse(token, strict.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_VerifyOnlyKeyCannotBeActive(t *testing.T) {
+	_, private := rsaPEM(t)
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	require.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	key, err := keyring.NewKeyFromPEM("pub", "RS256", publicPEM)
+	require.NoError(t, err)
+	assert.False(t, key.CanSign())
+	_, err = keyring.NewRing("pub", key)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_DeriveFollowsRotation(t *testing.T) {
+	edData, _ := ed25519PEM(t)
+	oldKey := keyring.NewHMACKey("2026-01", []byte("old-secret"))
+	oldKey.ExpiresAt = time.Now().Add(time.Hour)
+	edKey, err := keyring.NewKeyFromPEM("2026-10", "EdDSA", edData)
+	require.NoError(t, err)
+
+	before, err := keyring.NewRing("2026-01", oldKey)
+	require.NoError(t, err)
+	after, err := keyring.NewRing("2026-10", oldKey, edKey)
+	require.NoError(t, err)
+
+	// Derived tokens are HS256 with the ring's key IDs, and never verify against the ring itself
+	oldToken, err := before.Derive("mfa_pending").Sign(testClaims())
+	require.NoError(t, err)
+	_, err = jwt.Parse(oldToken, before.Keyfunc)
+	assert.Error(t, err)
+	_, err = jwt.Parse(oldToken, before.Derive("other_purpose").Keyfunc)
+	assert.Error(t, err, "Every purpose has its own keys")
+
+	// After a rotation the new key signs and the old one verifies until it expires
+	derived := after.Derive("mfa_pending")
+	_, err = jwt.Parse(oldToken, derived.Keyfunc)
+	assert.NoError(t, err)
+	newToken, err := derived.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, err := jwt.Parse(newToken, derived.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+	assert.Equal(t, "HS256", parsed.Method.Alg())
+	_, err = jwt.Parse(newToken, before.Derive("mfa_pending").Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_JWKS(t *testing.T) {
+	rsaData, private := rsaPEM(t)
+	edData, edPublic := ed25519PEM(t)
+	rsaKey, err := keyring.NewKeyFromPEM("a-rsa", "RS256", rsaData)
+	require.NoError(t, err)
+	edKey, err := keyring.NewKeyFromPEM("b-ed", "EdDSA", edData)
+	require.NoError(t, err)
+	ring, err := keyring.NewRing("b-ed", rsaKey, edKey, keyring.NewHMACKey("c-hmac", []byte("secret")))
+	require.NoError(t, err)
+
+	set := ring.JWKS()
+	require.Len(t, set.Keys, 2, "HMAC secrets must never be published")
+
+	assert.Equal(t, "RSA", set.Keys[0].Kty)
+	assert.Equal(t, "a-rsa", set.Keys[0].Kid)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+	n, _ := base64.RawURLEncoding.DecodeString(set.Keys[0].N)
+	assert.Equal(t, private.PublicKey.N.Bytes(), n)
+
+	assert.Equal(t, "OKP", set.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[1].Crv)
+	assert.Equal(t, "EdDSA", set.Keys[1].Alg)
+	x, _ := base64.RawURLEncoding.DecodeString(set.Keys[1].X)
+	assert.Equal(t, []byte(edPublic), x)
+
+	// An EdDSA-signed token verifies against the published key
+	token, err := ring.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return ed25519.PublicKey(x), nil })
+	assert.NoError(t, err)
+}
+
+func TestJWKSEndpointAndUserTokens(t *testing.T) {
+	// The test config has no key sections, so the user ring is the legacy HS256 secret
+	w := httptest.NewRecorder()
+	handlers.JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var set keyring.JWKSet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Empty(t, set.Keys)
+
+	token, err := tokens.Default.IssueAccess(&models.User{ID: 7, Email: "kid@example.com", Role: "client"})
+	require.NoError(t, err)
+	claims, err := tokens.Default.ParseAccess(token)
+	require.NoError(t, err)
+	assert.Equal(t, "kid@example.com", claims.Username)
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "default", parsed.Header["kid"])
+}
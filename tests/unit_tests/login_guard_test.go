@@ -0,0 +1,315 @@
+package unit_tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/loginguard"
+	"user-api/internal/models"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var testLoginPolicy = loginguard.Policy{
+	FreeAttempts:     2,
+	BaseDelay:        time.Second,
+	MaxDelay:         8 * time.Second,
+	LockoutThreshold: 6,
+	LockoutDuration:  time.Hour,
+	ResetAfter:       24 * time.Hour,
+}
+
+// newTestGuard returns a guard with a memory store and a clock controlled by the test
+func newTestGuard(ip loginguard.Policy) (*loginguard.Guard, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard := loginguard.New(loginguard.NewMemoryStore(time.Hour), testLoginPolicy, ip)
+	guard.SetClock(func() time.Time { return now })
+	return guard, &now
+}
+
+func TestLoginGuard_ExponentialBackoffAndLockout(t *testing.T) {
+	guard, now := newTestGuard(loginguard.Policy{})
+	account := loginguard.AccountKey("user", "Victim@Example.com")
+	assert.Equal(t, "user:victim@example.com", account)
+
+	// Free attempts are not delayed
+	for i := 0; i < 2; i++ {
+		locked, err := guard.Fail(account, "")
+		require.NoError(t, err)
+		assert.False(t, locked)
+	}
+	wait, _ := guard.Check(account, "")
+	assert.Zero(t, wait)
+
+	// Then the delay doubles: 1s, 2s, 4s
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		guard.Fail(account, "")
+		wait, _ = guard.Check(account, "")
+		assert.Equal(t, expected, wait)
+		*now = now.Add(wait)
+	}
+
+	// The sixth failure locks the account out, once
+	locked, _ := guard.Fail(account, "")
+	assert.True(t, locked)
+	status, _ := guard.Status(account)
+	assert.True(t, status.Locked)
+	assert.Equal(t, 6, status.Failures)
+	wait, _ = guard.Check(account, "")
+	assert.Equal(t, time.Hour, wait)
+
+	// Other accounts are not affected
+	wait, _ = guard.Check(loginguard.AccountKey("user", "other@example.com"), "")
+	assert.Zero(t, wait)
+
+	// Unlock clears the state
+	require.NoError(t, guard.Unlock(account))
+	wait, _ = guard.Check(account, "")
+	assert.Zero(t, wait)
+}
+
+func TestLoginGuard_SuccessAndExpiryResetCounters(t *testing.T) {
+	guard, now := newTestGuard(loginguard.Policy{})
+	account := loginguard.AccountKey("admin", "root")
+
+	guard.Fail(account, "")
+	guard.Fail(account, "")
+	require.NoError(t, guard.Succeed(account))
+	guard.Fail(account, "")
+	wait, _ := guard.Check(account, "")
+	assert.Zero(t, wait, "Failures before a successful login must be forgotten")
+
+	guard.Fail(account, "")
+	*now = now.Add(25 * time.Hour)
+	guard.Fail(account, "")
+	status, _ := guard.Status(account)
+	assert.Equal(t, 1, status.Failures, "Old failures must expire")
+}
+
+func TestLoginGuard_IPIsTrackedAcrossAccounts(t *testing.T) {
+	guard, _ := newTestGuard(loginguard.Policy{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour})
+
+	for i := 0; i < 4; i++ {
+		guard.Fail(loginguard.AccountKey("user", fmt.Sprintf("user%d@example.com", i)), "198.51.100.7")
+	}
+
+	wait, _ := guard.Check(loginguard.AccountKey("user", "fresh@example.com"), "198.51.100.7")
+	assert.Equal(t, time.Minute, wait)
+	wait, _ = guard.Check(loginguard.AccountKey("user", "fresh@example.com"), "198.51.100.8")
+	assert.Zero(t, wait)
+}
+
+type LoginGuardTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	admin   *models.Administrator
+	guard   *loginguard.Guard // guard configured from config.ini, restored after the suite
+}
+
+func (suite *LoginGuardTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.RefreshToken{},
+		&models.SystemSetting{}, &models.AuditEvent{}, &models.LoginAttempt{}, &models.MFARecoveryCode{}, &models.MFAPendingToken{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/login", handlers.UserLogin)
+	suite.router.Post("/api/auth/mfa/verify", handlers.MFAVerify)
+	suite.router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), suite.admin)))
+			})
+		})
+		r.Get("/api/admin/users/{id}", handlers.GetUser)
+		r.Post("/api/admin/users/{id}/unlock", handlers.UnlockUser)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+	suite.guard = handlers.LoginGuard
+}
+
+func (suite *LoginGuardTestSuite) TearDownSuite() {
+	handlers.LoginGuard = suite.guard
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *LoginGuardTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE login_attempts")
+	suite.db.Exec("TRUNCATE TABLE audit_events")
+	suite.db.Exec("TRUNCATE TABLE refresh_tokens")
+	suite.db.Exec("TRUNCATE TABLE mfa_recovery_codes")
+	suite.db.Exec("TRUNCATE TABLE mfa_pending_tokens")
+	suite.db.Exec("TRUNCATE TABLE administrators")
+	suite.db.Exec("TRUNCATE TABLE users")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+	// The database store is exercised here; the policy locks out quickly
+	handlers.LoginGuard = loginguard.New(loginguard.NewDBStore(), loginguard.Policy{
+		FreeAttempts:     1,
+		BaseDelay:        time.Minute,
+		MaxDelay:         time.Hour,
+		LockoutThreshold: 3,
+		LockoutDuration:  time.Hour,
+		ResetAfter:       24 * time.Hour,
+	}, loginguard.Policy{FreeAttempts: 100})
+
+	suite.admin = &models.Administrator{Username: "unlocker", Email: "unlocker@example.com", Password: "x",
+		FirstName: "Un", LastName: "Locker", Role: auth.RoleAdmin, Status: "Active"}
+	suite.Require().NoError(suite.db.Create(suite.admin).Error)
+}
+
+func (suite *LoginGuardTestSuite) login(email, password string) *http.Response {
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/login", map[string]string{"username": email, "password": password})
+	suite.router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func (suite *LoginGuardTestSuite) TestLockoutReturns429AndAdminCanUnlock() {
+	user := suite.helpers.CreateTestUser("locked@example.com", "client")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.db.Model(user).Update("password", string(hashed))
+
+	// First failure is free, the second one starts the backoff
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.login("locked@example.com", "wrong").StatusCode)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.login("locked@example.com", "wrong").StatusCode)
+
+	// Even the right password is rejected while the account is throttled
+	resp := suite.login("locked@example.com", "password123")
+	assert.Equal(suite.T(), http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(suite.T(), "60", resp.Header.Get("Retry-After"))
+
+	// Reach the lockout threshold directly through the guard
+	locked, err := handlers.LoginGuard.Fail(loginguard.AccountKey("user", "locked@example.com"), "")
+	suite.Require().NoError(err)
+	assert.True(suite.T(), locked)
+
+	// Admin sees the lockout
+	w, req := suite.helpers.MakeJSONRequest("GET", fmt.Sprintf("/api/admin/users/%d", user.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var detail struct {
+		Email   string            `json:"Email"`
+		Lockout loginguard.Status `json:"lockout"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(suite.T(), "locked@example.com", detail.Email)
+	assert.True(suite.T(), detail.Lockout.Locked)
+	assert.Equal(suite.T(), 3, detail.Lockout.Failures)
+
+	// ...and unlocks it
+	w, req = suite.helpers.MakeJSONRequest("POST", fmt.Sprintf("/api/admin/users/%d/unlock", user.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.login("locked@example.com", "password123").StatusCode)
+
+	var events int64
+	suite.db.Model(&models.AuditEvent{}).Where("action = ?", "user.unlock").Count(&events)
+	assert.Equal(suite.T(), int64(1), events)
+}
+
+// mfaLogin signs in with the password and returns the pending two-factor token
+func (suite *LoginGuardTestSuite) mfaLogin(email string) string {
+	resp := suite.login(email, "password123")
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	var body struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+	suite.Require().NotEmpty(body.MFAToken)
+	return body.MFAToken
+}
+
+func (suite *LoginGuardTestSuite) verifyMFA(token, code string) (int, string) {
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/mfa/verify", map[string]string{"mfaToken": token, "code": code})
+	suite.router.ServeHTTP(w, req)
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body.Code
+}
+
+func (suite *LoginGuardTestSuite) TestWrongMFACodesAreLimited() {
+	user := suite.helpers.CreateTestUser("mfa@example.com", "client")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.db.Model(user).Updates(map[string]interface{}{"password": string(hashed), "totp_secret": rfcTOTPSecret, "totp_enabled": true})
+	// The password guard is not in the way here: no backoff before the lockout
+	handlers.LoginGuard = loginguard.New(loginguard.NewDBStore(), loginguard.Policy{
+		FreeAttempts: 100, LockoutThreshold: 8, LockoutDuration: time.Hour, ResetAfter: 24 * time.Hour,
+	}, loginguard.Policy{FreeAttempts: 100})
+
+	// A pending token stops working after five wrong codes, even with the right one
+	token := suite.mfaLogin("mfa@example.com")
+	for i := 0; i < 5; i++ {
+		status, code := suite.verifyMFA(token, "000000")
+		suite.Require().Equal(http.StatusUnauthorized, status)
+		assert.Equal(suite.T(), "INVALID_MFA_CODE", code)
+	}
+	valid, _ := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(time.Now()))
+	status, code := suite.verifyMFA(token, valid)
+	assert.Equal(suite.T(), http.StatusUnauthorized, status)
+	assert.Equal(suite.T(), "INVALID_TOKEN", code)
+
+	// A new login gets a new token, but wrong codes still count against the account until it is locked out
+	token = suite.mfaLogin("mfa@example.com")
+	for i := 0; i < 3; i++ {
+		status, _ = suite.verifyMFA(token, "000000")
+		suite.Require().Equal(http.StatusUnauthorized, status)
+	}
+	status, _ = suite.verifyMFA(suite.mfaLogin("mfa@example.com"), valid)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, status)
+}
+
+func (suite *LoginGuardTestSuite) TestMFAPendingTokenIsSingleUse() {
+	user := suite.helpers.CreateTestUser("single@example.com", "client")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.db.Model(user).Updates(map[string]interface{}{"password": string(hashed), "totp_secret": rfcTOTPSecret, "totp_enabled": true})
+	sum := sha256.Sum256([]byte("recovery1"))
+	suite.Require().NoError(suite.db.Create(&models.MFARecoveryCode{AccountType: "user", AccountID: user.ID, CodeHash: hex.EncodeToString(sum[:])}).Error)
+
+	token := suite.mfaLogin("single@example.com")
+	valid, _ := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(time.Now()))
+	status, _ := suite.verifyMFA(token, valid)
+	suite.Require().Equal(http.StatusOK, status)
+
+	// A second login with the same pending token is refused, even with a fresh valid code
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/mfa/verify", map[string]string{"mfaToken": token, "recoveryCode": "recovery1"})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "INVALID_TOKEN")
+	assert.NotContains(suite.T(), w.Body.String(), "access_token")
+}
+
+func TestLoginGuardTestSuite(t *testing.T) {
+	suite.Run(t, new(LoginGuardTestSuite))
+}
@@ -0,0 +1,213 @@
+package unit_tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type MagicLinkTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	admin   *models.Administrator
+}
+
+func (suite *MagicLinkTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.MagicLinkToken{}, &models.RefreshToken{},
+		&models.SystemSetting{}, &models.AuditEvent{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/auth/magic-link", handlers.RequestMagicLink)
+	suite.router.Get("/api/auth/magic-link/consume", handlers.ConsumeMagicLink)
+	suite.router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), suite.admin)))
+			})
+		})
+		r.Put("/api/admin/settings/magic-link", handlers.UpdateMagicLinkSettings)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *MagicLinkTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *MagicLinkTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"magic_link_tokens", "refresh_tokens", "system_settings", "audit_events", "administrators", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+	suite.admin = &models.Administrator{Username: "master", Email: "master@example.com", Password: "x",
+		FirstName: "Master", LastName: "Admin", Role: auth.RoleMaster, Status: "Active"}
+	suite.Require().NoError(suite.db.Create(suite.admin).Error)
+}
+
+func (suite *MagicLinkTestSuite) enableRoles(roles map[string]bool) {
+	w, req := suite.helpers.MakeJSONRequest("PUT", "/api/admin/settings/magic-link", map[string]interface{}{"roles": roles})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+}
+
+// createLink stores a magic link for the user and returns the plain token
+func (suite *MagicLinkTestSuite) createLink(userID uint64, expiresAt time.Time, binding string) string {
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	token := fmt.Sprintf("magic-token-%d", time.Now().UnixNano())
+	link := &models.MagicLinkToken{UserID: userID, TokenHash: hash(token), ExpiresAt: expiresAt}
+	if binding != "" {
+		link.BindingHash = hash(binding)
+	}
+	suite.Require().NoError(suite.db.Create(link).Error)
+	return token
+}
+
+func (suite *MagicLinkTestSuite) consume(token string, cookies ...*http.Cookie) (int, map[string]interface{}) {
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/auth/magic-link/consume?token="+token, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	suite.router.ServeHTTP(w, req)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code == http.StatusOK {
+		suite.NotNil(findCookie(w, "refresh_token"), "Magic-link login must set the refresh cookie like /api/login")
+	}
+	return w.Code, body
+}
+
+func (suite *MagicLinkTestSuite) TestRequest_DisabledForEveryRole() {
+	suite.helpers.CreateTestUser("parent@example.com", "client")
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/magic-link", map[string]string{"email": "parent@example.com"})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "MAGIC_LINK_DISABLED")
+}
+
+func (suite *MagicLinkTestSuite) TestRequest_OnlyForEnabledRoles() {
+	client := suite.helpers.CreateTestUser("parent@example.com", "client")
+	suite.helpers.CreateTestUser("doctor@example.com", "psychologist")
+	suite.enableRoles(map[string]bool{"client": true})
+
+	bodies := []string{}
+	for _, email := range []string{"parent@example.com", "doctor@example.com", "nobody@example.com"} {
+		w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/magic-link", map[string]interface{}{"email": email, "bindToBrowser": true})
+		suite.router.ServeHTTP(w, req)
+		suite.Require().Equal(http.StatusOK, w.Code)
+		bodies = append(bodies, w.Body.String())
+		assert.NotNil(suite.T(), findCookie(w, "magic_link_binding"))
+	}
+	assert.Equal(suite.T(), bodies[0], bodies[1])
+	assert.Equal(suite.T(), bodies[0], bodies[2])
+
+	var links []models.MagicLinkToken
+	suite.db.Find(&links)
+	suite.Require().Len(links, 1)
+	assert.Equal(suite.T(), client.ID, links[0].UserID)
+	assert.Len(suite.T(), links[0].BindingHash, 64)
+	assert.WithinDuration(suite.T(), time.Now().Add(15*time.Minute), links[0].ExpiresAt, time.Minute)
+}
+
+func (suite *MagicLinkTestSuite) TestConsume_LogsInOnce() {
+	user := suite.helpers.CreateTestUser("once@example.com", "client")
+	suite.enableRoles(map[string]bool{"client": true})
+	token := suite.createLink(user.ID, time.Now().Add(15*time.Minute), "")
+
+	code, body := suite.consume(token)
+	suite.Require().Equal(http.StatusOK, code)
+	claims, err := tokens.Default.ParseAccess(body["access_token"].(string))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.ID, claims.UserID())
+
+	code, _ = suite.consume(token)
+	assert.Equal(suite.T(), http.StatusBadRequest, code, "A magic link works only once")
+}
+
+func (suite *MagicLinkTestSuite) TestConsume_Expired() {
+	user := suite.helpers.CreateTestUser("late@example.com", "client")
+	suite.enableRoles(map[string]bool{"client": true})
+	token := suite.createLink(user.ID, time.Now().Add(-time.Minute), "")
+
+	code, _ := suite.consume(token)
+	assert.Equal(suite.T(), http.StatusBadRequest, code)
+}
+
+func (suite *MagicLinkTestSuite) TestConsume_BoundToBrowser() {
+	user := suite.helpers.CreateTestUser("bound@example.com", "client")
+	suite.enableRoles(map[string]bool{"client": true})
+	token := suite.createLink(user.ID, time.Now().Add(15*time.Minute), "browser-secret")
+
+	code, _ := suite.consume(token)
+	assert.Equal(suite.T(), http.StatusForbidden, code)
+	code, _ = suite.consume(token, &http.Cookie{Name: "magic_link_binding", Value: "other-browser"})
+	assert.Equal(suite.T(), http.StatusForbidden, code)
+
+	// A link opened in the wrong browser stays usable in the right one
+	code, _ = suite.consume(token, &http.Cookie{Name: "magic_link_binding", Value: "browser-secret"})
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func (suite *MagicLinkTestSuite) TestConsume_RechecksStatusAndRole() {
+	blocked := suite.helpers.CreateTestUser("blocked@example.com", "client")
+	suite.enableRoles(map[string]bool{"client": true, "psychologist": true})
+	token := suite.createLink(blocked.ID, time.Now().Add(15*time.Minute), "")
+	suite.db.Model(blocked).Update("status", "Blocked")
+	code, _ := suite.consume(token)
+	assert.Equal(suite.T(), http.StatusForbidden, code)
+
+	doctor := suite.helpers.CreateTestUser("doctor@example.com", "psychologist")
+	token = suite.createLink(doctor.ID, time.Now().Add(15*time.Minute), "")
+	suite.enableRoles(map[string]bool{"psychologist": false})
+	code, _ = suite.consume(token)
+	assert.Equal(suite.T(), http.StatusForbidden, code)
+
+	var events int64
+	suite.db.Model(&models.AuditEvent{}).Where("action = ?", "settings.update").Count(&events)
+	assert.Equal(suite.T(), int64(3), events, "Every changed role is audited")
+}
+
+func (suite *MagicLinkTestSuite) TestUpdateSettings_RejectsUnknownRole() {
+	w, req := suite.helpers.MakeJSONRequest("PUT", "/api/admin/settings/magic-link", map[string]interface{}{"roles": map[string]bool{"admin": true}})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestMagicLinkTestSuite(t *testing.T) {
+	suite.Run(t, new(MagicLinkTestSuite))
+}
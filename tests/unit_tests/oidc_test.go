@@ -0,0 +1,465 @@
+package unit_tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/oidc"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// stubIssuer is a minimal OpenID provider: discovery, JWKS and a token endpoint that checks PKCE
+type stubIssuer struct {
+	t        *testing.T
+	server   *httptest.Server
+	clientID string
+	key      *rsa.PrivateKey
+	kid      string
+
+	mu          sync.Mutex
+	codes       map[string]stubGrant
+	jwksFetches int32
+}
+
+type stubGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s := &stubIssuer{t: t, clientID: "neurohelp-test", key: key, kid: "stub-1", codes: map[string]stubGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.jwksFetches, 1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": s.kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(s.key.PublicKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		grant, ok := s.codes[r.Form.Get("code")]
+		delete(s.codes, r.Form.Get("code"))
+		s.mu.Unlock()
+		if !ok || r.Form.Get("client_id") != s.clientID || oidc.Challenge(r.Form.Get("code_verifier")) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": s.sign(grant.claims)})
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *stubIssuer) provider(name string) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Name:        name,
+		Issuer:      s.server.URL,
+		ClientID:    s.clientID,
+		RedirectURL: "http://localhost:3000/oauth/callback/" + name,
+		Scopes:      []string{"email", "profile"},
+	}, s.server.Client())
+}
+
+// idClaims returns valid ID token claims for a subject; tests override single claims
+func (s *stubIssuer) idClaims(subject, email string, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            s.server.URL,
+		"aud":            s.clientID,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"given_name":     "Olena",
+		"family_name":    "Koval",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+}
+
+func (s *stubIssuer) sign(claims jwt.MapClaims) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	require.NoError(s.t, err)
+	return signed
+}
+
+// rotate replaces the signing key, as a provider does during key rotation
+func (s *stubIssuer) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(s.t, err)
+	s.mu.Lock()
+	s.key, s.kid = key, kid
+	s.mu.Unlock()
+}
+
+// authorize plays the user signing in at the provider: it reads the authorization URL and
+// returns the code the provider would redirect back with
+func (s *stubIssuer) authorize(authURL string, claims func(nonce string) jwt.MapClaims) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(s.t, err)
+	q := u.Query()
+	require.Equal(s.t, "S256", q.Get("code_challenge_method"))
+	code = fmt.Sprintf("code-%d", time.Now().UnixNano())
+	s.mu.Lock()
+	s.codes[code] = stubGrant{challenge: q.Get("code_challenge"), claims: claims(q.Get("nonce"))}
+	s.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func TestOIDC_DiscoveryAndAuthCodeURL(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider("stub")
+
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(t.Context(), "state-1", "nonce-1", oidc.Challenge(verifier))
+	require.NoError(t, err)
+
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, stub.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	assert.Equal(t, "state-1", q.Get("state"))
+	assert.Equal(t, "nonce-1", q.Get("nonce"))
+	assert.Equal(t, oidc.Challenge(verifier), q.Get("code_challenge"))
+	assert.NotEqual(t, verifier, q.Get("code_challenge"), "The verifier itself must never leave the server")
+
+	// A discovery document for another issuer is rejected
+	wrong := oidc.NewProvider(oidc.Config{Name: "wrong", Issuer: stub.server.URL + "/other", ClientID: "x"}, stub.server.Client())
+	_, err = wrong.Discover(t.Context())
+	assert.Error(t, err)
+}
+
+func TestOIDC_ExchangeChecksPKCEAndNonce(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider("stub")
+	verifier, _ := oidc.NewVerifier()
+	authURL, err := provider.AuthCodeURL(t.Context(), "s", "expected-nonce", oidc.Challenge(verifier))
+	require.NoError(t, err)
+
+	claimsFor := func(nonce string) jwt.MapClaims { return stub.idClaims("user-1", "olena@example.com", nonce) }
+
+	code, _ := stub.authorize(authURL, claimsFor)
+	claims, err := provider.Exchange(t.Context(), code, verifier, "expected-nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "olena@example.com", claims.Email)
+	assert.True(t, bool(claims.EmailVerified))
+	assert.Equal(t, "Olena", claims.GivenName)
+
+	// Wrong verifier: the provider refuses the code
+	code, _ = stub.authorize(authURL, claimsFor)
+	otherVerifier, _ := oidc.NewVerifier()
+	_, err = provider.Exchange(t.Context(), code, otherVerifier, "expected-nonce")
+	assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+
+	// ID token minted for another login attempt
+	code, _ = stub.authorize(authURL, claimsFor)
+	_, err = provider.Exchange(t.Context(), code, verifier, "another-nonce")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestOIDC_VerifyRejectsInvalidTokens(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider("stub")
+
+	valid := stub.idClaims("user-1", "olena@example.com", "")
+	_, err := provider.Verify(t.Context(), stub.sign(valid), "")
+	require.NoError(t, err)
+
+	cases := map[string]func(c jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"foreign azp":    func(c jwt.MapClaims) { c["aud"] = []string{stub.clientID, "other"}; c["azp"] = "other" },
+	}
+	for name, mutate := range cases {
+		claims := stub.idClaims("user-1", "olena@example.com", "")
+		mutate(claims)
+		_, err := provider.Verify(t.Context(), stub.sign(claims), "")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+
+	// HS256 "signed" with the public modulus must not verify (algorithm confusion)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, valid)
+	forged.Header["kid"] = stub.kid
+	forgedStr, _ := forged.SignedString(stub.key.PublicKey.N.Bytes())
+	_, err = provider.Verify(t.Context(), forgedStr, "")
+	assert.Error(t, err)
+
+	// Signed by a key the provider never published
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	foreign := jwt.NewWithClaims(jwt.SigningMethodRS256, valid)
+	foreign.Header["kid"] = stub.kid
+	foreignStr, _ := foreign.SignedString(other)
+	_, err = provider.Verify(t.Context(), foreignStr, "")
+	assert.Error(t, err)
+}
+
+func TestOIDC_JWKSCachedAndRefetchedOnRotation(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider("stub")
+	now := time.Now()
+	provider.SetClock(func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		_, err := provider.Verify(t.Context(), stub.sign(stub.idClaims("u", "u@example.com", "")), "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&stub.jwksFetches), "Keys must be cached between tokens")
+
+	// The provider rotates its key: an unknown kid triggers one refetch (once the refetch guard has passed)
+	stub.rotate("stub-2")
+	now = now.Add(time.Minute)
+	_, err := provider.Verify(t.Context(), stub.sign(stub.idClaims("u", "u@example.com", "")), "")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&stub.jwksFetches))
+
+	// Unknown kids right after a fetch do not hammer the provider
+	junk := jwt.NewWithClaims(jwt.SigningMethodRS256, stub.idClaims("u", "u@example.com", ""))
+	junk.Header["kid"] = "junk"
+	junkStr, _ := junk.SignedString(stub.key)
+	for i := 0; i < 5; i++ {
+		_, err = provider.Verify(t.Context(), junkStr, "")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&stub.jwksFetches))
+}
+
+type OIDCTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	stub    *stubIssuer
+}
+
+func (suite *OIDCTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Child{}, &models.UserIdentity{}, &models.OIDCLoginState{},
+		&models.RefreshToken{}, &models.SystemSetting{})
+	suite.Require().NoError(err)
+
+	suite.stub = newStubIssuer(suite.T())
+	handlers.OIDCProviders = map[string]*oidc.Provider{"stub": suite.stub.provider("stub")}
+
+	suite.router = chi.NewRouter()
+	suite.router.Get("/api/auth/oidc/providers", handlers.GetOIDCProviders)
+	suite.router.Get("/api/auth/oidc/{provider}/start", handlers.OIDCStart)
+	suite.router.Post("/api/auth/oidc/{provider}/callback", handlers.OIDCCallback)
+	suite.router.Post("/api/register", handlers.RegisterUser)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *OIDCTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *OIDCTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"user_identities", "oidc_login_states", "refresh_tokens", "system_settings", "children", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+}
+
+// start begins a login and returns the authorization URL and the browser binding cookie
+func (suite *OIDCTestSuite) start() (string, *http.Cookie) {
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/auth/oidc/stub/start", nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var body map[string]string
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	cookie := findCookie(w, "oidc_binding")
+	suite.Require().NotNil(cookie)
+	return body["authorizationUrl"], cookie
+}
+
+func (suite *OIDCTestSuite) callback(code, state string, cookie *http.Cookie) (int, map[string]interface{}) {
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/oidc/stub/callback", map[string]string{"code": code, "state": state})
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	suite.router.ServeHTTP(w, req)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+// login runs the whole flow for a provider account
+func (suite *OIDCTestSuite) login(subject, email string, verified bool) (int, map[string]interface{}) {
+	authURL, cookie := suite.start()
+	code, state := suite.stub.authorize(authURL, func(nonce string) jwt.MapClaims {
+		c := suite.stub.idClaims(subject, email, nonce)
+		c["email_verified"] = verified
+		return c
+	})
+	return suite.callback(code, state, cookie)
+}
+
+func (suite *OIDCTestSuite) TestProviders() {
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/auth/oidc/providers", nil)
+	suite.router.ServeHTTP(w, req)
+	assert.JSONEq(suite.T(), `{"providers":["stub"]}`, w.Body.String())
+
+	w, req = suite.helpers.MakeJSONRequest("GET", "/api/auth/oidc/unknown/start", nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *OIDCTestSuite) TestNewIdentity_RegistrationRequiredThenRegister() {
+	status, body := suite.login("sub-new", "new@example.com", true)
+	suite.Require().Equal(http.StatusOK, status)
+	assert.Equal(suite.T(), "registration_required", body["status"])
+	assert.Equal(suite.T(), "stub", body["provider"])
+	assert.Equal(suite.T(), map[string]interface{}{
+		"email": "new@example.com", "firstName": "Olena", "lastName": "Koval", "googleId": "sub-new",
+	}, body["googleUser"], "The registration_required shape must stay the same for every provider")
+	registrationToken, _ := body["registrationToken"].(string)
+	suite.Require().NotEmpty(registrationToken)
+
+	// A forged or foreign token cannot link an identity
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/register", map[string]interface{}{
+		"Email": "new@example.com", "Role": "client", "FirstName": "Olena", "LastName": "Koval", "registrationToken": "forged",
+	})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "INVALID_REGISTRATION_TOKEN")
+
+	w, req = suite.helpers.MakeJSONRequest("POST", "/api/register", map[string]interface{}{
+		"Email": "new@example.com", "Role": "client", "FirstName": "Olena", "LastName": "Koval", "registrationToken": registrationToken,
+	})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var user models.User
+	suite.Require().NoError(suite.db.Where("email = ?", "new@example.com").First(&user).Error)
+	assert.True(suite.T(), user.Verified)
+	assert.Equal(suite.T(), "Active", user.Status)
+	var identity models.UserIdentity
+	suite.Require().NoError(suite.db.Where("provider = ? AND subject = ?", "stub", "sub-new").First(&identity).Error)
+	assert.Equal(suite.T(), user.ID, identity.UserID)
+
+	// The next login goes straight through
+	status, body = suite.login("sub-new", "new@example.com", true)
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "authenticated", body["status"])
+	assert.NotEmpty(suite.T(), body["access_token"])
+}
+
+func (suite *OIDCTestSuite) TestExistingAccount_LinkedOnlyWithVerifiedEmail() {
+	user := suite.helpers.CreateTestUser("parent@example.com", "client")
+
+	status, body := suite.login("sub-parent", "parent@example.com", false)
+	assert.Equal(suite.T(), http.StatusConflict, status)
+	assert.Equal(suite.T(), "ACCOUNT_EXISTS", body["code"])
+	var count int64
+	suite.db.Model(&models.UserIdentity{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+
+	status, body = suite.login("sub-parent", "parent@example.com", true)
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "authenticated", body["status"])
+	var identity models.UserIdentity
+	suite.Require().NoError(suite.db.Where("provider = ? AND subject = ?", "stub", "sub-parent").First(&identity).Error)
+	assert.Equal(suite.T(), user.ID, identity.UserID)
+
+	// Identities are matched by subject, not email: a changed provider email still signs in
+	status, body = suite.login("sub-parent", "renamed@example.com", true)
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "authenticated", body["status"])
+}
+
+func (suite *OIDCTestSuite) TestBlockedUserRejected() {
+	user := suite.helpers.CreateTestUser("blocked@example.com", "client")
+	suite.db.Model(user).Update("status", "Blocked")
+	suite.db.Create(&models.UserIdentity{UserID: user.ID, Provider: "stub", Subject: "sub-blocked"})
+
+	status, body := suite.login("sub-blocked", "blocked@example.com", true)
+	assert.Equal(suite.T(), http.StatusForbidden, status)
+	assert.Equal(suite.T(), "ACCOUNT_BLOCKED", body["code"])
+}
+
+func (suite *OIDCTestSuite) TestCallback_StateIsBoundAndSingleUse() {
+	authURL, cookie := suite.start()
+	code, state := suite.stub.authorize(authURL, func(nonce string) jwt.MapClaims {
+		return suite.stub.idClaims("sub-x", "x@example.com", nonce)
+	})
+
+	// Without the binding cookie (another browser) the state is not consumed
+	status, body := suite.callback(code, state, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, status)
+	assert.Equal(suite.T(), "WRONG_BROWSER", body["code"])
+	status, _ = suite.callback(code, state, &http.Cookie{Name: "oidc_binding", Value: "other"})
+	assert.Equal(suite.T(), http.StatusForbidden, status)
+
+	status, _ = suite.callback(code, state, cookie)
+	assert.Equal(suite.T(), http.StatusOK, status)
+
+	status, body = suite.callback(code, state, cookie)
+	assert.Equal(suite.T(), http.StatusBadRequest, status)
+	assert.Equal(suite.T(), "INVALID_STATE", body["code"])
+
+	// A state that was never issued
+	_, body = suite.callback("code", "unknown-state", cookie)
+	assert.Equal(suite.T(), "INVALID_STATE", body["code"])
+}
+
+func TestOIDCTestSuite(t *testing.T) {
+	suite.Run(t, new(OIDCTestSuite))
+}
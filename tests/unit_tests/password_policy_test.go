@@ -0,0 +1,112 @@
+package unit_tests
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"user-api/internal/handlers"
+	"user-api/internal/passwordpolicy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	policy := &passwordpolicy.Policy{MinLength: 10, MaxLength: 72, MinCharClasses: 3, ForbidPersonalInfo: true}
+	personal := []string{"Olena", "Koval", "olena.koval@example.com"}
+
+	cases := []struct {
+		password string
+		code     string
+	}{
+		{"a", passwordpolicy.CodeTooShort},
+		{"Ab1!", passwordpolicy.CodeTooShort},
+		{"Ab1!" + string(make([]byte, 80)), passwordpolicy.CodeTooLong},
+		{"alllowercaseletters", passwordpolicy.CodeTooSimple},
+		{"lowercase1234", passwordpolicy.CodeTooSimple},
+		{"My-Olena-Secret9", passwordpolicy.CodePersonalInfo},
+		{"KOVAL-house-77", passwordpolicy.CodePersonalInfo},
+		{"Correct-Horse-42", ""},
+		{"Пароль-Київ-2026", ""}, // length is counted in characters, not bytes
+	}
+	for _, c := range cases {
+		violation := policy.Check(c.password, personal...)
+		if c.code == "" {
+			assert.Nil(t, violation, c.password)
+			continue
+		}
+		if assert.NotNil(t, violation, c.password) {
+			assert.Equal(t, c.code, violation.Code, c.password)
+		}
+	}
+
+	tooShort := policy.Check("Ab1!", personal...)
+	assert.Equal(t, 10, tooShort.Params["minLength"])
+
+	// Name parts shorter than 3 characters are too common to forbid
+	assert.Nil(t, policy.Check("Lighthouse-Keeper-8", "Li", "Wu", "li@example.com"))
+
+	policy.ForbidPersonalInfo = false
+	assert.Nil(t, policy.Check("My-Olena-Secret9", personal...))
+}
+
+func TestPasswordPolicy_BundledBreachedList(t *testing.T) {
+	list := passwordpolicy.NewBreachedList("../../data/breached-passwords.txt")
+	require.Greater(t, list.Size(), 100)
+
+	assert.True(t, list.Contains("P@ssw0rd"))
+	assert.True(t, list.Contains("Password123"))
+	assert.False(t, list.Contains("Correct-Horse-42"))
+
+	policy := &passwordpolicy.Policy{MinLength: 8, MinCharClasses: 3, Breached: list}
+	violation := policy.Check("Qwerty123!")
+	require.NotNil(t, violation)
+	assert.Equal(t, passwordpolicy.CodeBreached, violation.Code)
+}
+
+func TestPasswordPolicy_BreachedListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+
+	// A missing file disables the check instead of failing
+	list := passwordpolicy.NewBreachedList(path)
+	assert.False(t, list.Contains("Correct-Horse-42"))
+	assert.Equal(t, 0, list.Size())
+
+	// SHA-1 of "Correct-Horse-42", with a count and a malformed line around it
+	content := "# comment\nnot-a-hash\n" + sha1Upper("Correct-Horse-42") + ":12\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	list = passwordpolicy.NewBreachedList(path)
+	assert.True(t, list.Contains("Correct-Horse-42"))
+	assert.Equal(t, 1, list.Size())
+}
+
+func sha1Upper(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestRegisterUser_RejectsWeakPassword(t *testing.T) {
+	helpers := NewTestHelpers(nil, t)
+	w, req := helpers.MakeJSONRequest("POST", "/api/register", map[string]interface{}{
+		"Email": "olena.koval@example.com", "Role": "client", "FirstName": "Olena", "LastName": "Koval", "Password": "short",
+	})
+	handlers.RegisterUser(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "PASSWORD_TOO_SHORT", body["code"])
+	assert.Equal(t, float64(handlers.PasswordPolicy.MinLength), body["params"].(map[string]interface{})["minLength"])
+
+	w, req = helpers.MakeJSONRequest("POST", "/api/register", map[string]interface{}{
+		"Email": "olena.koval@example.com", "Role": "client", "FirstName": "Olena", "LastName": "Koval", "Password": "Qwerty123!",
+	})
+	handlers.RegisterUser(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "PASSWORD_BREACHED")
+}
@@ -0,0 +1,187 @@
+package unit_tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type PasswordResetTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+}
+
+func (suite *PasswordResetTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.PasswordResetToken{}, &models.RefreshToken{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/auth/password/forgot", handlers.ForgotPassword)
+	suite.router.Post("/api/auth/password/reset", handlers.ResetPassword)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *PasswordResetTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *PasswordResetTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE password_reset_tokens")
+	suite.db.Exec("TRUNCATE TABLE refresh_tokens")
+	suite.db.Exec("TRUNCATE TABLE administrators")
+	suite.db.Exec("TRUNCATE TABLE users")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+}
+
+// createResetToken stores a reset token for the user and returns the plain token
+func (suite *PasswordResetTestSuite) createResetToken(userID uint64, expiresAt time.Time) string {
+	token := fmt.Sprintf("reset-token-%d", time.Now().UnixNano())
+	sum := sha256.Sum256([]byte(token))
+	err := suite.db.Create(&models.PasswordResetToken{
+		AccountType: "user",
+		AccountID:   userID,
+		TokenHash:   hex.EncodeToString(sum[:]),
+		ExpiresAt:   expiresAt,
+	}).Error
+	suite.Require().NoError(err)
+	return token
+}
+
+func (suite *PasswordResetTestSuite) TestForgotPassword_SameResponseForUnknownEmail() {
+	suite.helpers.CreateTestUser("known@example.com", "client")
+
+	w1, req1 := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/forgot", map[string]string{"email": "known@example.com"})
+	suite.router.ServeHTTP(w1, req1)
+	w2, req2 := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/forgot", map[string]string{"email": "unknown@example.com"})
+	suite.router.ServeHTTP(w2, req2)
+
+	assert.Equal(suite.T(), http.StatusOK, w1.Code)
+	assert.Equal(suite.T(), w1.Code, w2.Code)
+	assert.JSONEq(suite.T(), w1.Body.String(), w2.Body.String())
+
+	var count int64
+	suite.db.Model(&models.PasswordResetToken{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count, "Only the existing account should get a reset token")
+}
+
+func (suite *PasswordResetTestSuite) TestForgotPassword_StoresOnlyHash() {
+	suite.helpers.CreateTestUser("known@example.com", "client")
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/forgot", map[string]string{"email": "known@example.com"})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var reset models.PasswordResetToken
+	suite.Require().NoError(suite.db.First(&reset).Error)
+	assert.Len(suite.T(), reset.TokenHash, 64)
+	assert.True(suite.T(), reset.ExpiresAt.After(time.Now()))
+	assert.Nil(suite.T(), reset.UsedAt)
+}
+
+func (suite *PasswordResetTestSuite) TestForgotPassword_CooldownSendsOneEmail() {
+	suite.helpers.CreateTestUser("known@example.com", "client")
+
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/forgot", map[string]string{"email": "known@example.com"})
+		suite.router.ServeHTTP(w, req)
+		suite.Require().Equal(http.StatusOK, w.Code)
+		bodies = append(bodies, w.Body.String())
+	}
+	assert.JSONEq(suite.T(), bodies[0], bodies[1], "The response must not reveal the cooldown")
+
+	var count int64
+	suite.db.Model(&models.PasswordResetToken{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count, "A second request within the cooldown must not issue another token")
+}
+
+func (suite *PasswordResetTestSuite) TestResetPassword_Success() {
+	user := suite.helpers.CreateTestUser("reset@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.RefreshToken{
+		AccountType: "user",
+		AccountID:   user.ID,
+		TokenHash:   "stale-refresh-token-hash",
+		LastUsedAt:  time.Now(),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}).Error)
+	token := suite.createResetToken(user.ID, time.Now().Add(time.Hour))
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/reset", map[string]string{
+		"token":       token,
+		"newPassword": "newSecurePassword1",
+	})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var updated models.User
+	suite.Require().NoError(suite.db.First(&updated, user.ID).Error)
+	assert.NoError(suite.T(), bcrypt.CompareHashAndPassword([]byte(updated.Password), []byte("newSecurePassword1")))
+
+	var active int64
+	suite.db.Model(&models.RefreshToken{}).Where("account_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	assert.Equal(suite.T(), int64(0), active, "All devices must be signed out after reset")
+}
+
+func (suite *PasswordResetTestSuite) TestResetPassword_TokenIsSingleUse() {
+	user := suite.helpers.CreateTestUser("reset@example.com", "client")
+	token := suite.createResetToken(user.ID, time.Now().Add(time.Hour))
+
+	body := map[string]string{"token": token, "newPassword": "newSecurePassword1"}
+	w1, req1 := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/reset", body)
+	suite.router.ServeHTTP(w1, req1)
+	assert.Equal(suite.T(), http.StatusOK, w1.Code)
+
+	w2, req2 := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/reset", body)
+	suite.router.ServeHTTP(w2, req2)
+	assert.Equal(suite.T(), http.StatusBadRequest, w2.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w2.Body.Bytes(), &response)
+	assert.Equal(suite.T(), "INVALID_TOKEN", response["code"])
+}
+
+func (suite *PasswordResetTestSuite) TestResetPassword_ExpiredToken() {
+	user := suite.helpers.CreateTestUser("reset@example.com", "client")
+	token := suite.createResetToken(user.ID, time.Now().Add(-time.Minute))
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/password/reset", map[string]string{
+		"token":       token,
+		"newPassword": "newSecurePassword1",
+	})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordResetTestSuite(t *testing.T) {
+	suite.Run(t, new(PasswordResetTestSuite))
+}
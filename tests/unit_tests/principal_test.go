@@ -0,0 +1,164 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+	"user-api/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestPrincipalCache_TTLAndInvalidate(t *testing.T) {
+	cache := auth.NewPrincipalCache(30 * time.Second)
+	now := time.Now()
+	cache.SetClock(func() time.Time { return now })
+
+	loads := 0
+	status := "Active"
+	load := func(id uint64) (*auth.AuthPrincipal, error) {
+		loads++
+		return &auth.AuthPrincipal{UserID: id, Status: status}, nil
+	}
+
+	p, err := cache.Get(1, load)
+	require.NoError(t, err)
+	assert.Equal(t, "Active", p.Status)
+	cache.Get(1, load)
+	assert.Equal(t, 1, loads, "A cached principal must not be reloaded")
+
+	// A status change is picked up after the TTL...
+	status = "Blocked"
+	now = now.Add(31 * time.Second)
+	p, _ = cache.Get(1, load)
+	assert.Equal(t, "Blocked", p.Status)
+	assert.Equal(t, 2, loads)
+
+	// ...or right away after Invalidate
+	status = "Active"
+	cache.Invalidate(1)
+	p, _ = cache.Get(1, load)
+	assert.Equal(t, "Active", p.Status)
+	assert.Equal(t, 3, loads)
+}
+
+func TestPrincipalCache_ErrorsAreNotCached(t *testing.T) {
+	cache := auth.NewPrincipalCache(time.Minute)
+	_, err := cache.Get(2, func(uint64) (*auth.AuthPrincipal, error) { return nil, errors.New("db down") })
+	assert.Error(t, err)
+
+	p, err := cache.Get(2, func(id uint64) (*auth.AuthPrincipal, error) { return &auth.AuthPrincipal{UserID: id}, nil })
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), p.UserID)
+}
+
+func TestPrincipalFromContext_Missing(t *testing.T) {
+	_, ok := auth.PrincipalFromContext(httptest.NewRequest("GET", "/", nil).Context())
+	assert.False(t, ok)
+}
+
+type PrincipalTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+}
+
+func (suite *PrincipalTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.With(authmw.RequireUser).Get("/api/users/whoami", func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		utils.WriteJSON(w, http.StatusOK, principal)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *PrincipalTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *PrincipalTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE users")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	auth.Principals = auth.NewPrincipalCache(time.Minute)
+}
+
+func (suite *PrincipalTestSuite) whoami(user *models.User) *httptest.ResponseRecorder {
+	token, err := tokens.Default.IssueAccess(user)
+	suite.Require().NoError(err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/users/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *PrincipalTestSuite) TestActiveUserGetsPrincipal() {
+	user := suite.helpers.CreateTestUser("principal@example.com", "psychologist")
+
+	w := suite.whoami(user)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var principal auth.AuthPrincipal
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &principal))
+	assert.Equal(suite.T(), user.ID, principal.UserID)
+	assert.Equal(suite.T(), "psychologist", principal.Role)
+	assert.Equal(suite.T(), "Active", principal.Status)
+}
+
+func (suite *PrincipalTestSuite) TestBlockedUserLosesAccessOnInvalidate() {
+	user := suite.helpers.CreateTestUser("blocked@example.com", "client")
+	suite.Require().Equal(http.StatusOK, suite.whoami(user).Code)
+
+	suite.db.Model(user).Update("status", "Blocked")
+	auth.Principals.Invalidate(user.ID)
+
+	w := suite.whoami(user)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "ACCOUNT_BLOCKED")
+}
+
+func (suite *PrincipalTestSuite) TestDisabledAndDeletedUsers() {
+	disabled := suite.helpers.CreateTestUser("disabled@example.com", "client")
+	suite.db.Model(disabled).Update("status", "Disabled")
+	w := suite.whoami(disabled)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "ACCOUNT_DISABLED")
+
+	deleted := suite.helpers.CreateTestUser("deleted@example.com", "client")
+	suite.db.Delete(deleted)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.whoami(deleted).Code)
+}
+
+func TestPrincipalTestSuite(t *testing.T) {
+	suite.Run(t, new(PrincipalTestSuite))
+}
@@ -0,0 +1,95 @@
+package unit_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/handlers"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ratelimit.ParsePolicy("search", "60/1m")
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Policy{Name: "search", Limit: 60, Period: time.Minute}, p)
+
+	for _, spec := range []string{"60", "0/1m", "x/1m", "5/soon", "5/-1s"} {
+		_, err := ratelimit.ParsePolicy("bad", spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTokenBucket_BurstAndRefill(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Policy{Name: "upload", Limit: 3, Period: 30 * time.Second})
+	limiter.SetClock(func() time.Time { return now })
+
+	// The full bucket allows a burst of 3
+	for i := 2; i >= 0; i-- {
+		result, err := limiter.Allow("upload", "user:a")
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, _ := limiter.Allow("upload", "user:a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter, "One token is refilled every 10s")
+	assert.Equal(t, 30*time.Second, result.Reset)
+
+	// Keys have separate buckets
+	result, _ = limiter.Allow("upload", "user:b")
+	assert.True(t, result.Allowed)
+
+	// A token comes back after 10s
+	now = now.Add(10 * time.Second)
+	result, _ = limiter.Allow("upload", "user:a")
+	assert.True(t, result.Allowed)
+	result, _ = limiter.Allow("upload", "user:a")
+	assert.False(t, result.Allowed)
+
+	_, err := limiter.Allow("missing", "user:a")
+	assert.Error(t, err)
+}
+
+func TestRateLimitMiddleware_HeadersAndKeys(t *testing.T) {
+	original := handlers.RateLimiter
+	defer func() { handlers.RateLimiter = original }()
+	handlers.RateLimiter = ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Policy{Name: handlers.RateLimitRegister, Limit: 2, Period: time.Minute})
+
+	handler := authmw.RateLimit(handlers.RateLimitRegister)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request := func(ip string, userID uint64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/register", nil)
+		req.RemoteAddr = ip + ":1234"
+		if userID != 0 {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.AuthPrincipal{UserID: userID, Status: "Active"}))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("198.51.100.1", 0)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	request("198.51.100.1", 0)
+	w = request("198.51.100.1", 0)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	// A different IP, or an authenticated user behind the same IP, has its own bucket
+	assert.Equal(t, http.StatusCreated, request("198.51.100.2", 0).Code)
+	assert.Equal(t, http.StatusCreated, request("198.51.100.1", 17).Code)
+}
@@ -0,0 +1,290 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	authmw "user-api/internal/middleware"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type RefreshTokensTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+}
+
+func (suite *RefreshTokensTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.RefreshToken{}, &models.SystemSetting{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/login", handlers.UserLogin)
+	suite.router.Post("/api/admin/login", handlers.AdminLogin)
+	suite.router.Post("/api/auth/refresh", handlers.RefreshToken)
+	suite.router.Post("/api/admin/refresh", handlers.AdminRefreshToken)
+	suite.router.Get("/api/admin/verify", handlers.VerifyAdminToken)
+	suite.router.With(authmw.RequireAdmin).Get("/api/admin/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	suite.router.Post("/api/auth/logout", handlers.Logout)
+	suite.router.Get("/api/users/self/devices", handlers.GetMyDevices)
+	suite.router.Delete("/api/users/self/devices/{id}", handlers.RevokeMyDevice)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *RefreshTokensTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *RefreshTokensTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE refresh_tokens")
+	suite.db.Exec("TRUNCATE TABLE system_settings")
+	suite.db.Exec("TRUNCATE TABLE administrators")
+	suite.db.Exec("TRUNCATE TABLE users")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+}
+
+func (suite *RefreshTokensTestSuite) createUserWithPassword(email, password string) *models.User {
+	user := suite.helpers.CreateTestUser(email, "client")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	suite.db.Model(user).Update("password", string(hashed))
+	return user
+}
+
+func (suite *RefreshTokensTestSuite) createAdmin(username, password string) *models.Administrator {
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	admin := &models.Administrator{
+		Username:  username,
+		Email:     username + "@example.com",
+		Password:  string(hashed),
+		FirstName: "Admin",
+		LastName:  "User",
+		Role:      "admin",
+		Status:    "Active",
+	}
+	suite.Require().NoError(suite.db.Create(admin).Error)
+	return admin
+}
+
+// login performs a login request and returns the refresh cookie set by the server
+func (suite *RefreshTokensTestSuite) login(path string, creds map[string]string, cookieName string) *http.Cookie {
+	w, req := suite.helpers.MakeJSONRequest("POST", path, creds)
+	req.Header.Set("User-Agent", "test-agent/"+path)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	return findCookie(w, cookieName)
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (suite *RefreshTokensTestSuite) TestLoginOnSecondDeviceKeepsFirst() {
+	suite.createUserWithPassword("multi@example.com", "password123")
+	creds := map[string]string{"username": "multi@example.com", "password": "password123"}
+
+	first := suite.login("/api/login", creds, "refresh_token")
+	second := suite.login("/api/login", creds, "refresh_token")
+	suite.Require().NotNil(first)
+	suite.Require().NotNil(second)
+	assert.NotEqual(suite.T(), first.Value, second.Value)
+
+	var active int64
+	suite.db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	assert.Equal(suite.T(), int64(2), active)
+
+	var stored models.RefreshToken
+	suite.db.First(&stored)
+	assert.Len(suite.T(), stored.TokenHash, 64, "Only the token hash must be stored")
+	assert.NotEqual(suite.T(), first.Value, stored.TokenHash)
+}
+
+func (suite *RefreshTokensTestSuite) TestAdminRefreshRotatesAndDetectsReuse() {
+	suite.createAdmin("rotating", "password123")
+	original := suite.login("/api/admin/login", map[string]string{"username": "rotating", "password": "password123"}, "admin_refresh_token")
+	suite.Require().NotNil(original)
+
+	// First refresh rotates the token
+	w1, req1 := suite.helpers.MakeJSONRequest("POST", "/api/admin/refresh", nil)
+	req1.AddCookie(original)
+	suite.router.ServeHTTP(w1, req1)
+	suite.Require().Equal(http.StatusOK, w1.Code)
+	rotated := findCookie(w1, "admin_refresh_token")
+	suite.Require().NotNil(rotated)
+	assert.NotEqual(suite.T(), original.Value, rotated.Value)
+
+	// Presenting the rotated-out token again is reuse
+	w2, req2 := suite.helpers.MakeJSONRequest("POST", "/api/admin/refresh", nil)
+	req2.AddCookie(original)
+	suite.router.ServeHTTP(w2, req2)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w2.Code)
+
+	// ...which revokes the whole family, including the newest token
+	w3, req3 := suite.helpers.MakeJSONRequest("POST", "/api/admin/refresh", nil)
+	req3.AddCookie(rotated)
+	suite.router.ServeHTTP(w3, req3)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w3.Code)
+}
+
+func (suite *RefreshTokensTestSuite) TestAdminRefreshTokenIsNotAnAccessToken() {
+	suite.createAdmin("bearer", "password123")
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/admin/login", map[string]string{"username": "bearer", "password": "password123"})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	refresh := findCookie(w, "admin_refresh_token")
+	suite.Require().NotNil(refresh)
+	var body map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	access, _ := body["token"].(string)
+	suite.Require().NotEmpty(access)
+
+	for _, path := range []string{"/api/admin/users", "/api/admin/verify"} {
+		// The access token is accepted...
+		w, req := suite.helpers.MakeJSONRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), http.StatusOK, w.Code, path)
+
+		// ...the refresh token is not
+		w, req = suite.helpers.MakeJSONRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+refresh.Value)
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+func (suite *RefreshTokensTestSuite) TestRefreshRefusedForInactiveAccounts() {
+	user := suite.createUserWithPassword("blocked@example.com", "password123")
+	userCookie := suite.login("/api/login", map[string]string{"username": "blocked@example.com", "password": "password123"}, "refresh_token")
+	suite.Require().NotNil(userCookie)
+	admin := suite.createAdmin("disabled", "password123")
+	adminCookie := suite.login("/api/admin/login", map[string]string{"username": "disabled", "password": "password123"}, "admin_refresh_token")
+	suite.Require().NotNil(adminCookie)
+
+	// Accounts blocked or disabled after login
+	suite.db.Model(user).Update("status", "Blocked")
+	suite.db.Model(admin).Update("status", "Disabled")
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/refresh", nil)
+	req.AddCookie(userCookie)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "ACCOUNT_BLOCKED")
+	assert.NotContains(suite.T(), w.Body.String(), "access_token")
+
+	w, req = suite.helpers.MakeJSONRequest("POST", "/api/admin/refresh", nil)
+	req.AddCookie(adminCookie)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "token")
+}
+
+func (suite *RefreshTokensTestSuite) TestListAndRevokeDevices() {
+	user := suite.createUserWithPassword("devices@example.com", "password123")
+	creds := map[string]string{"username": "devices@example.com", "password": "password123"}
+	current := suite.login("/api/login", creds, "refresh_token")
+	suite.login("/api/login", creds, "refresh_token")
+
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/users/self/devices", nil)
+	req.AddCookie(current)
+	req = WithUser(req, user)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var response struct {
+		Data []struct {
+			ID      uint64 `json:"id"`
+			Current bool   `json:"current"`
+		} `json:"data"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Require().Len(response.Data, 2)
+
+	var other uint64
+	currentCount := 0
+	for _, d := range response.Data {
+		if d.Current {
+			currentCount++
+		} else {
+			other = d.ID
+		}
+	}
+	assert.Equal(suite.T(), 1, currentCount)
+
+	w2, req2 := suite.helpers.MakeJSONRequest("DELETE", fmt.Sprintf("/api/users/self/devices/%d", other), nil)
+	req2 = WithUser(req2, user)
+	suite.router.ServeHTTP(w2, req2)
+	assert.Equal(suite.T(), http.StatusOK, w2.Code)
+
+	var revoked models.RefreshToken
+	suite.db.First(&revoked, other)
+	assert.NotNil(suite.T(), revoked.RevokedAt)
+}
+
+func (suite *RefreshTokensTestSuite) TestCannotRevokeOtherUsersDevice() {
+	owner := suite.createUserWithPassword("owner@example.com", "password123")
+	intruder := suite.helpers.CreateTestUser("intruder@example.com", "client")
+	suite.login("/api/login", map[string]string{"username": owner.Email, "password": "password123"}, "refresh_token")
+
+	var device models.RefreshToken
+	suite.Require().NoError(suite.db.First(&device).Error)
+
+	w, req := suite.helpers.MakeJSONRequest("DELETE", fmt.Sprintf("/api/users/self/devices/%d", device.ID), nil)
+	req = WithUser(req, intruder)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *RefreshTokensTestSuite) TestLogoutRevokesCurrentDevice() {
+	suite.createUserWithPassword("logout@example.com", "password123")
+	cookie := suite.login("/api/login", map[string]string{"username": "logout@example.com", "password": "password123"}, "refresh_token")
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/logout", nil)
+	req.AddCookie(cookie)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	cleared := findCookie(w, "refresh_token")
+	suite.Require().NotNil(cleared)
+	assert.True(suite.T(), cleared.MaxAge < 0)
+
+	var active int64
+	suite.db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	assert.Equal(suite.T(), int64(0), active)
+}
+
+func TestRefreshTokensTestSuite(t *testing.T) {
+	suite.Run(t, new(RefreshTokensTestSuite))
+}
@@ -0,0 +1,217 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/schedule"
+	"user-api/internal/sessionstate"
+	"user-api/internal/timezone"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func clock(value string) *string { return &value }
+
+func TestScheduleExceptionRules(t *testing.T) {
+	valid := []models.ScheduleException{
+		{Kind: schedule.KindOff, StartDate: "2026-08-01", EndDate: "2026-08-14"},
+		{Kind: schedule.KindOff, StartDate: "2026-08-01", EndDate: "2026-08-01", StartTime: clock("13:00"), EndTime: clock("15:00")},
+		{Kind: schedule.KindOverride, StartDate: "2026-12-10", EndDate: "2026-12-10", StartTime: clock("10:00"), EndTime: clock("12:00"), SlotDurationMinutes: 60},
+	}
+	for _, ex := range valid {
+		assert.NoError(t, schedule.Validate(ex), ex.Kind)
+	}
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: "holiday", StartDate: "2026-08-01", EndDate: "2026-08-01"}), schedule.ErrKind)
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: schedule.KindOff, StartDate: "2026-08-14", EndDate: "2026-08-01"}), schedule.ErrDates)
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: schedule.KindOff, StartDate: "2026-01-01", EndDate: "2027-01-02"}), schedule.ErrDates)
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: schedule.KindExtra, StartDate: "2026-08-01", EndDate: "2026-08-01"}), schedule.ErrHours)
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: schedule.KindOff, StartDate: "2026-08-01", EndDate: "2026-08-01",
+		StartTime: clock("15:00"), EndTime: clock("13:00")}), schedule.ErrHours)
+	assert.ErrorIs(t, schedule.Validate(models.ScheduleException{Kind: schedule.KindExtra, StartDate: "2026-08-01", EndDate: "2026-08-01",
+		StartTime: clock("10:00"), EndTime: clock("10:30"), SlotDurationMinutes: 60}), schedule.ErrSlotDuration)
+
+	kyiv, err := timezone.Load("Europe/Kyiv")
+	require.NoError(t, err)
+	at := func(day, hour int) time.Time { return time.Date(2026, time.December, day, hour, 0, 0, 0, kyiv).UTC() }
+
+	// Two days off block both days from midnight to midnight in the psychologist's zone
+	blocked := schedule.Blocked(models.ScheduleException{Kind: schedule.KindOff, StartDate: "2026-12-01", EndDate: "2026-12-02"}, kyiv)
+	assert.Equal(t, []timezone.Range{{Start: at(1, 0), End: at(2, 0)}, {Start: at(2, 0), End: at(3, 0)}}, blocked)
+	// An override takes away the hours outside it
+	override := models.ScheduleException{Kind: schedule.KindOverride, StartDate: "2026-12-10", EndDate: "2026-12-10",
+		StartTime: clock("10:00"), EndTime: clock("12:00"), SlotDurationMinutes: 60}
+	assert.Equal(t, []timezone.Range{{Start: at(10, 0), End: at(10, 10)}, {Start: at(10, 12), End: at(11, 0)}}, schedule.Blocked(override, kyiv))
+	assert.Empty(t, schedule.Blocked(models.ScheduleException{Kind: schedule.KindExtra, StartDate: "2026-12-10", EndDate: "2026-12-10",
+		StartTime: clock("18:00"), EndTime: clock("20:00"), SlotDurationMinutes: 60}, kyiv))
+
+	date := time.Date(2026, time.December, 10, 0, 0, 0, 0, time.UTC)
+	lunch := models.ScheduleException{Kind: schedule.KindOff, StartDate: "2026-12-10", EndDate: "2026-12-10", StartTime: clock("11:00"), EndTime: clock("11:30")}
+	day := schedule.PlanDay(date, []models.ScheduleException{override, lunch}, kyiv)
+	assert.False(t, day.Templates)
+	assert.Equal(t, []timezone.Range{{Start: at(10, 10), End: at(10, 11)}, {Start: at(10, 11), End: at(10, 12)}}, day.Slots)
+	assert.False(t, day.IsOff(at(10, 10), at(10, 11)))
+	assert.True(t, day.IsOff(at(10, 11), at(10, 12)))
+
+	other := schedule.PlanDay(date.AddDate(0, 0, 1), []models.ScheduleException{override, lunch}, kyiv)
+	assert.True(t, other.Templates, "Exceptions of other dates are ignored")
+	assert.Empty(t, other.Slots)
+}
+
+type ScheduleExceptionsTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+	day          time.Time
+}
+
+func (suite *ScheduleExceptionsTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{}, &models.ScheduleTemplate{},
+		&models.ScheduleException{}, &models.Session{}, &models.SessionEvent{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/schedule-exceptions", handlers.CreateScheduleException)
+	suite.router.Get("/api/users/schedule-exceptions", handlers.GetMyScheduleExceptions)
+	suite.router.Delete("/api/users/schedule-exceptions/{id}", handlers.DeleteScheduleException)
+	suite.router.Post("/api/users/schedule-templates/generate", handlers.GenerateSlotsFromTemplates)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *ScheduleExceptionsTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *ScheduleExceptionsTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_events", "sessions", "schedule_exceptions", "schedule_templates", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID}).Error)
+	// A date a week ahead, as midnight UTC (the default zone of the tests)
+	now := time.Now().UTC()
+	suite.day = time.Date(now.Year(), now.Month(), now.Day()+7, 0, 0, 0, 0, time.UTC)
+	dayOfWeek := (int(suite.day.Weekday()) + 6) % 7 // 0 = Monday
+	suite.Require().NoError(suite.db.Create(&models.ScheduleTemplate{PsychologistID: suite.psychologist.ID, DayOfWeek: dayOfWeek,
+		StartTime: "09:00", EndTime: "13:00", SlotDurationMinutes: 60, IsActive: true}).Error)
+}
+
+func (suite *ScheduleExceptionsTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// generate generates the slots of suite.day and returns the decoded response
+func (suite *ScheduleExceptionsTestSuite) generate() map[string]interface{} {
+	date := suite.day.Format("2006-01-02")
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate", map[string]string{"startDate": date, "endDate": date})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var result map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	return result
+}
+
+// hours returns the start hours of the psychologist's slots
+func (suite *ScheduleExceptionsTestSuite) hours() []int {
+	var slots []models.Availability
+	suite.Require().NoError(suite.db.Where("psychologist_id = ?", suite.psychologist.ID).Order("start_time").Find(&slots).Error)
+	hours := make([]int, len(slots))
+	for i, slot := range slots {
+		hours[i] = slot.StartTime.UTC().Hour()
+	}
+	return hours
+}
+
+func (suite *ScheduleExceptionsTestSuite) TestDayOffRemovesSlotsAndListsSessions() {
+	suite.generate()
+	suite.Require().Equal([]int{9, 10, 11, 12}, suite.hours())
+	// The 10:00 slot is booked
+	var booked models.Availability
+	suite.Require().NoError(suite.db.Where("psychologist_id = ? AND start_time = ?", suite.psychologist.ID, suite.day.Add(10*time.Hour)).First(&booked).Error)
+	suite.Require().NoError(suite.db.Model(&booked).Update("status", "booked").Error)
+	session := models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, AvailabilityID: &booked.ID,
+		StartTime: booked.StartTime, EndTime: booked.EndTime, Status: sessionstate.Confirmed}
+	suite.Require().NoError(suite.db.Create(&session).Error)
+
+	date := suite.day.Format("2006-01-02")
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "off", "startDate": date, "endDate": date, "reason": "Vacation"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		RemovedSlots     int                      `json:"removedSlots"`
+		AffectedSessions []map[string]interface{} `json:"affectedSessions"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(suite.T(), 3, created.RemovedSlots)
+	suite.Require().Len(created.AffectedSessions, 1)
+	assert.Equal(suite.T(), float64(session.ID), created.AffectedSessions[0]["id"])
+	assert.Equal(suite.T(), []int{10}, suite.hours(), "The booked slot stays")
+
+	// The list repeats the affected session, and generating adds nothing
+	w = suite.as(suite.psychologist, "GET", "/api/users/schedule-exceptions", nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var list []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &list))
+	suite.Require().Len(list, 1)
+	assert.Len(suite.T(), list[0]["affectedSessions"], 1)
+	result := suite.generate()
+	assert.Equal(suite.T(), float64(0), result["generated"])
+	assert.Equal(suite.T(), float64(4), result["excluded"])
+}
+
+func (suite *ScheduleExceptionsTestSuite) TestOverrideAndExtraHours() {
+	date := suite.day.Format("2006-01-02")
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "override", "startDate": date, "startTime": "10:00", "endTime": "12:00"}).Code)
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "extra", "startDate": date, "startTime": "18:00", "endTime": "19:30", "slotDurationMinutes": 45}).Code)
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "off", "startDate": date, "startTime": "11:00", "endTime": "12:00"}).Code)
+
+	result := suite.generate()
+	assert.Equal(suite.T(), float64(3), result["generated"])
+	assert.Equal(suite.T(), []int{10, 18, 18}, suite.hours(), "10:00 of the override, 18:00 and 18:45 extra; 11:00 is off")
+}
+
+func (suite *ScheduleExceptionsTestSuite) TestInvalidExceptionsAreRejected() {
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "extra", "startDate": suite.day.Format("2006-01-02")})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.as(suite.client, "POST", "/api/users/schedule-exceptions",
+		map[string]interface{}{"kind": "off", "startDate": suite.day.Format("2006-01-02")})
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func TestScheduleExceptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleExceptionsTestSuite))
+}
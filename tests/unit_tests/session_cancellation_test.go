@@ -0,0 +1,182 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestClassifyCancellation(t *testing.T) {
+	now := time.Now()
+	window := 24 * time.Hour
+
+	assert.Equal(t, sessionstate.CancellationFree, sessionstate.ClassifyCancellation(sessionstate.Confirmed, now.Add(48*time.Hour), now, window))
+	assert.Equal(t, sessionstate.CancellationFree, sessionstate.ClassifyCancellation(sessionstate.Confirmed, now.Add(24*time.Hour), now, window))
+	assert.Equal(t, sessionstate.CancellationLate, sessionstate.ClassifyCancellation(sessionstate.Rescheduled, now.Add(3*time.Hour), now, window))
+	assert.Equal(t, sessionstate.CancellationLate, sessionstate.ClassifyCancellation(sessionstate.Confirmed, now.Add(-time.Hour), now, window))
+	// An unconfirmed request can always be withdrawn, and a zero window makes every cancellation free
+	assert.Equal(t, sessionstate.CancellationFree, sessionstate.ClassifyCancellation(sessionstate.Pending, now.Add(time.Hour), now, window))
+	assert.Equal(t, sessionstate.CancellationFree, sessionstate.ClassifyCancellation(sessionstate.Confirmed, now.Add(time.Minute), now, 0))
+}
+
+type SessionCancellationTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+}
+
+func (suite *SessionCancellationTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{},
+		&models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
+	suite.router.Put("/api/users/sessions/{id}/no-show", handlers.MarkNoShow)
+	suite.router.Get("/api/users/sessions/clients/stats", handlers.GetClientSessionStats)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *SessionCancellationTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SessionCancellationTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_reschedules", "session_events", "sessions", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID, FreeCancelHours: 24, NoShowGraceMinutes: 15}).Error)
+}
+
+// as sends a request on behalf of user
+func (suite *SessionCancellationTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// session creates a session of the client with the given status, starting after the given duration
+func (suite *SessionCancellationTestSuite) session(client *models.User, status string, in time.Duration) *models.Session {
+	start := time.Now().Add(in).Truncate(time.Second)
+	session := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &client.ID, StartTime: start, EndTime: start.Add(time.Hour), Status: status}
+	suite.Require().NoError(suite.db.Create(session).Error)
+	return session
+}
+
+func (suite *SessionCancellationTestSuite) reload(id uint64) models.Session {
+	var session models.Session
+	suite.Require().NoError(suite.db.First(&session, id).Error)
+	return session
+}
+
+func (suite *SessionCancellationTestSuite) TestCancelIsClassifiedAgainstPolicy() {
+	early := suite.session(suite.client, sessionstate.Confirmed, 72*time.Hour)
+	late := suite.session(suite.client, sessionstate.Confirmed, 3*time.Hour)
+
+	suite.Require().Equal(http.StatusOK, suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", early.ID), nil).Code)
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", late.ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(suite.T(), w.Body.String(), `"cancellation":"late"`)
+
+	saved := suite.reload(early.ID)
+	assert.Equal(suite.T(), sessionstate.CancellationFree, *saved.Cancellation)
+	assert.Equal(suite.T(), suite.client.ID, *saved.CanceledBy)
+	assert.NotNil(suite.T(), saved.CanceledAt)
+	saved = suite.reload(late.ID)
+	assert.Equal(suite.T(), sessionstate.CancellationLate, *saved.Cancellation)
+
+	// A wider window turns the same notice into a late cancellation
+	suite.Require().NoError(suite.db.Model(&models.Portfolio{}).Where("psychologist_id = ?", suite.psychologist.ID).Update("free_cancel_hours", 96).Error)
+	other := suite.session(suite.client, sessionstate.Confirmed, 72*time.Hour)
+	suite.Require().Equal(http.StatusOK, suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", other.ID), nil).Code)
+	saved = suite.reload(other.ID)
+	assert.Equal(suite.T(), sessionstate.CanceledByPsychologist, saved.Status)
+	assert.Equal(suite.T(), suite.psychologist.ID, *saved.CanceledBy)
+	assert.Equal(suite.T(), sessionstate.CancellationLate, *saved.Cancellation)
+}
+
+func (suite *SessionCancellationTestSuite) TestMarkNoShow() {
+	upcoming := suite.session(suite.client, sessionstate.Confirmed, 2*time.Hour)
+	justStarted := suite.session(suite.client, sessionstate.Confirmed, -5*time.Minute)
+	missed := suite.session(suite.client, sessionstate.Confirmed, -30*time.Minute)
+
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/no-show", missed.ID), nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	for _, session := range []*models.Session{upcoming, justStarted} {
+		w = suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/no-show", session.ID), nil)
+		assert.Equal(suite.T(), http.StatusConflict, w.Code)
+		assert.Contains(suite.T(), w.Body.String(), "TOO_EARLY")
+	}
+
+	w = suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/no-show", missed.ID), map[string]string{"reason": "No answer"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(suite.T(), sessionstate.NoShow, suite.reload(missed.ID).Status)
+}
+
+func (suite *SessionCancellationTestSuite) TestClientStats() {
+	other := suite.helpers.CreateTestUser("other@example.com", "client")
+	suite.session(suite.client, sessionstate.Completed, -48*time.Hour)
+	suite.session(suite.client, sessionstate.NoShow, -24*time.Hour)
+	late := suite.session(suite.client, sessionstate.Confirmed, 2*time.Hour)
+	free := suite.session(suite.client, sessionstate.Confirmed, 72*time.Hour)
+	suite.session(other, sessionstate.Confirmed, 96*time.Hour)
+	suite.Require().Equal(http.StatusOK, suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", late.ID), nil).Code)
+	suite.Require().Equal(http.StatusOK, suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", free.ID), nil).Code)
+
+	w := suite.as(suite.psychologist, "GET", "/api/users/sessions/clients/stats", nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var stats []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &stats))
+	suite.Require().Len(stats, 2)
+	assert.Equal(suite.T(), float64(suite.client.ID), stats[0]["clientId"])
+	assert.Equal(suite.T(), "Test User", stats[0]["clientName"])
+	assert.Equal(suite.T(), float64(4), stats[0]["totalSessions"])
+	assert.Equal(suite.T(), float64(1), stats[0]["completed"])
+	assert.Equal(suite.T(), float64(1), stats[0]["freeCancels"])
+	assert.Equal(suite.T(), float64(1), stats[0]["lateCancels"])
+	assert.Equal(suite.T(), float64(1), stats[0]["noShows"])
+
+	w = suite.as(suite.psychologist, "GET", fmt.Sprintf("/api/users/sessions/clients/stats?clientId=%d", other.ID), nil)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &stats))
+	suite.Require().Len(stats, 1)
+	assert.Equal(suite.T(), float64(0), stats[0]["lateCancels"])
+
+	assert.Equal(suite.T(), http.StatusForbidden, suite.as(suite.client, "GET", "/api/users/sessions/clients/stats", nil).Code)
+}
+
+func TestSessionCancellationTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionCancellationTestSuite))
+}
@@ -0,0 +1,235 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+	"user-api/internal/timezone"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type SessionConflictsTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+	start        time.Time
+}
+
+func (suite *SessionConflictsTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{}, &models.ScheduleTemplate{},
+		&models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/availability", handlers.CreateAvailabilitySlot)
+	suite.router.Post("/api/users/schedule-templates/generate", handlers.GenerateSlotsFromTemplates)
+	suite.router.Post("/api/users/sessions/request", handlers.RequestFreeTimeSession)
+	suite.router.Put("/api/users/sessions/{id}/confirm", handlers.ConfirmSession)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *SessionConflictsTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SessionConflictsTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_reschedules", "session_events", "sessions", "schedule_templates", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID}).Error)
+	suite.start = time.Now().AddDate(0, 0, 2).Truncate(time.Hour)
+}
+
+// as sends a request on behalf of user
+func (suite *SessionConflictsTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// at returns the range starting the given number of minutes after suite.start and lasting an hour
+func (suite *SessionConflictsTestSuite) at(minutes int) map[string]interface{} {
+	start := suite.start.Add(time.Duration(minutes) * time.Minute)
+	return map[string]interface{}{"startTime": start.Format(time.RFC3339), "endTime": start.Add(time.Hour).Format(time.RFC3339)}
+}
+
+// conflicts decodes a 409 TIME_CONFLICT response
+func (suite *SessionConflictsTestSuite) conflicts(w *httptest.ResponseRecorder) []map[string]interface{} {
+	suite.Require().Equal(http.StatusConflict, w.Code, w.Body.String())
+	var body struct {
+		Code   string `json:"code"`
+		Params struct {
+			Conflicts []map[string]interface{} `json:"conflicts"`
+		} `json:"params"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	suite.Require().Equal("TIME_CONFLICT", body.Code)
+	return body.Params.Conflicts
+}
+
+func (suite *SessionConflictsTestSuite) TestOverlappingSlotsAreRejected() {
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(0)).Code)
+
+	found := suite.conflicts(suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(30)))
+	suite.Require().Len(found, 1)
+	assert.Equal(suite.T(), "slot", found[0]["type"])
+
+	// Slots may be back to back, with or without a buffer
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(60)).Code)
+	suite.Require().NoError(suite.db.Model(&models.Portfolio{}).Where("psychologist_id = ?", suite.psychologist.ID).Update("buffer_minutes", 15).Error)
+	suite.Require().Equal(http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(120)).Code)
+
+	// The buffer is kept around sessions
+	session := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: suite.start.Add(4 * time.Hour),
+		EndTime: suite.start.Add(5 * time.Hour), Status: sessionstate.Confirmed}
+	suite.Require().NoError(suite.db.Create(session).Error)
+	found = suite.conflicts(suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(300)))
+	suite.Require().Len(found, 1)
+	assert.Equal(suite.T(), "session", found[0]["type"])
+	assert.Equal(suite.T(), http.StatusCreated, suite.as(suite.psychologist, "POST", "/api/users/availability", suite.at(315)).Code)
+}
+
+func (suite *SessionConflictsTestSuite) TestRequestAndConfirmCheckSessions() {
+	start := suite.start
+	confirmed := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: start, EndTime: start.Add(time.Hour), Status: sessionstate.Confirmed}
+	suite.Require().NoError(suite.db.Create(confirmed).Error)
+
+	request := suite.at(30)
+	request["psychologistId"] = suite.psychologist.ID
+	found := suite.conflicts(suite.as(suite.client, "POST", "/api/users/sessions/request", request))
+	suite.Require().Len(found, 1)
+	assert.Equal(suite.T(), "session", found[0]["type"])
+	assert.Equal(suite.T(), float64(confirmed.ID), found[0]["id"])
+
+	// A request made before the other session was confirmed cannot be confirmed any more
+	pending := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: start.Add(30 * time.Minute),
+		EndTime: start.Add(90 * time.Minute), Status: sessionstate.Pending}
+	suite.Require().NoError(suite.db.Create(pending).Error)
+	suite.conflicts(suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/confirm", pending.ID), nil))
+
+	// Once the other session is canceled the time is free
+	suite.Require().NoError(suite.db.Model(confirmed).Update("status", sessionstate.CanceledByClient).Error)
+	assert.Equal(suite.T(), http.StatusOK, suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/confirm", pending.ID), nil).Code)
+}
+
+func (suite *SessionConflictsTestSuite) TestGenerateSkipsConflicts() {
+	day := suite.start.AddDate(0, 0, 1)
+	dayOfWeek := (int(day.Weekday()) + 6) % 7 // 0 = Monday
+	suite.Require().NoError(suite.db.Create(&models.ScheduleTemplate{PsychologistID: suite.psychologist.ID, DayOfWeek: dayOfWeek,
+		StartTime: "09:00", EndTime: "12:00", SlotDurationMinutes: 60, IsActive: true}).Error)
+	// Templates of a psychologist without a time zone are in the default zone
+	nine := time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, timezone.Default)
+	busy := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: nine.Add(90 * time.Minute),
+		EndTime: nine.Add(150 * time.Minute), Status: sessionstate.Confirmed}
+	suite.Require().NoError(suite.db.Create(busy).Error)
+
+	body := map[string]string{"startDate": day.Format("2006-01-02"), "endDate": day.Format("2006-01-02")}
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate", body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var result map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(suite.T(), float64(1), result["generated"], "Only 9:00 is free; 10:00 and 11:00 overlap the 10:30 session")
+	assert.Len(suite.T(), result["conflicts"], 2)
+
+	// Generating again reports the same conflicts but not the slot generated before
+	w = suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate", body)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(suite.T(), float64(0), result["generated"])
+	assert.Len(suite.T(), result["conflicts"], 2)
+}
+
+func (suite *SessionConflictsTestSuite) TestGenerateWithBuffer() {
+	day := suite.start.AddDate(0, 0, 1)
+	dayOfWeek := (int(day.Weekday()) + 6) % 7 // 0 = Monday
+	suite.Require().NoError(suite.db.Create(&models.ScheduleTemplate{PsychologistID: suite.psychologist.ID, DayOfWeek: dayOfWeek,
+		StartTime: "09:00", EndTime: "12:00", SlotDurationMinutes: 60, IsActive: true}).Error)
+	suite.Require().NoError(suite.db.Model(&models.Portfolio{}).Where("psychologist_id = ?", suite.psychologist.ID).Update("buffer_minutes", 15).Error)
+
+	body := map[string]string{"startDate": day.Format("2006-01-02"), "endDate": day.Format("2006-01-02")}
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate", body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var result map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(suite.T(), float64(3), result["generated"], "Back-to-back template slots do not conflict with each other")
+	assert.Empty(suite.T(), result["conflicts"])
+
+	// A session keeps the buffer free: 12:00-13:00 would start right after it
+	nine := time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, timezone.Default)
+	suite.Require().NoError(suite.db.Create(&models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID,
+		StartTime: nine.Add(2 * time.Hour), EndTime: nine.Add(3 * time.Hour), Status: sessionstate.Confirmed}).Error)
+	suite.Require().NoError(suite.db.Model(&models.ScheduleTemplate{}).Where("psychologist_id = ?", suite.psychologist.ID).Update("end_time", "13:00").Error)
+	w = suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate", body)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(suite.T(), float64(0), result["generated"])
+	assert.Len(suite.T(), result["conflicts"], 1, "12:00 starts within the buffer after the 11:00 session")
+}
+
+func (suite *SessionConflictsTestSuite) TestParallelRequestsForTheSameTime() {
+	const parallel = 8
+	clients := make([]*models.User, parallel)
+	for i := range clients {
+		clients[i] = suite.helpers.CreateTestUser(fmt.Sprintf("parallel%d@example.com", i), "client")
+	}
+	request := suite.at(0)
+	request["psychologistId"] = suite.psychologist.ID
+
+	codes := make([]int, parallel)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = suite.as(clients[i], "POST", "/api/users/sessions/request", request).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			created++
+		} else {
+			assert.Equal(suite.T(), http.StatusConflict, code)
+		}
+	}
+	assert.Equal(suite.T(), 1, created, "Exactly one request gets the time")
+	var count int64
+	suite.db.Model(&models.Session{}).Where("psychologist_id = ?", suite.psychologist.ID).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func TestSessionConflictsTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionConflictsTestSuite))
+}
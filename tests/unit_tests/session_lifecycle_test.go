@@ -0,0 +1,216 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestSessionStateMachine(t *testing.T) {
+	assert.NoError(t, sessionstate.Check(sessionstate.Pending, sessionstate.Confirmed, sessionstate.ActorPsychologist))
+	assert.ErrorIs(t, sessionstate.Check(sessionstate.Pending, sessionstate.Confirmed, sessionstate.ActorClient), sessionstate.ErrActorNotAllowed)
+	assert.ErrorIs(t, sessionstate.Check(sessionstate.Confirmed, sessionstate.CanceledByPsychologist, sessionstate.ActorClient), sessionstate.ErrActorNotAllowed)
+	assert.NoError(t, sessionstate.Check(sessionstate.Rescheduled, sessionstate.InProgress, sessionstate.ActorSystem))
+	assert.NoError(t, sessionstate.Check(sessionstate.InProgress, sessionstate.NoShow, sessionstate.ActorPsychologist))
+	assert.ErrorIs(t, sessionstate.Check(sessionstate.Pending, sessionstate.Completed, sessionstate.ActorPsychologist), sessionstate.ErrInvalidTransition)
+
+	for _, final := range []string{sessionstate.Completed, sessionstate.CanceledByClient, sessionstate.CanceledByPsychologist, sessionstate.Canceled, sessionstate.NoShow} {
+		assert.True(t, sessionstate.IsFinal(final), final)
+		assert.Empty(t, sessionstate.Next(final, sessionstate.ActorPsychologist), final)
+	}
+	for _, active := range sessionstate.Active() {
+		assert.False(t, sessionstate.IsFinal(active), active)
+	}
+
+	assert.Equal(t, []string{sessionstate.Rescheduled, sessionstate.CanceledByClient}, sessionstate.Next(sessionstate.Confirmed, sessionstate.ActorClient))
+	assert.Equal(t, sessionstate.CanceledByClient, sessionstate.CanceledBy(sessionstate.ActorClient))
+	assert.Equal(t, sessionstate.CanceledByPsychologist, sessionstate.CanceledBy(sessionstate.ActorPsychologist))
+	assert.True(t, sessionstate.IsCanceled(sessionstate.Canceled), "Legacy cancellations are cancellations")
+}
+
+type SessionLifecycleTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+}
+
+func (suite *SessionLifecycleTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Availability{}, &models.Session{}, &models.SessionEvent{}, &models.SchemaMigration{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/sessions/book/{slotId}", handlers.BookSession)
+	suite.router.Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
+	suite.router.Put("/api/users/sessions/{id}/confirm", handlers.ConfirmSession)
+	suite.router.Put("/api/users/sessions/{id}/start", handlers.StartSession)
+	suite.router.Put("/api/users/sessions/{id}/complete", handlers.CompleteSession)
+	suite.router.Get("/api/users/sessions/{id}/history", handlers.GetSessionHistory)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *SessionLifecycleTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SessionLifecycleTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"schema_migrations", "session_events", "sessions", "availabilities", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+}
+
+// as sends a request on behalf of user
+func (suite *SessionLifecycleTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// book books a new slot as the client and returns the session ID
+func (suite *SessionLifecycleTestSuite) book() uint64 {
+	slot := &models.Availability{PsychologistID: suite.psychologist.ID, StartTime: time.Now().Add(24 * time.Hour),
+		EndTime: time.Now().Add(25 * time.Hour), Status: "available"}
+	suite.Require().NoError(suite.db.Create(slot).Error)
+	w := suite.as(suite.client, "POST", fmt.Sprintf("/api/users/sessions/book/%d", slot.ID), nil)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var session models.Session
+	suite.Require().NoError(suite.db.Where("availability_id = ?", slot.ID).First(&session).Error)
+	return session.ID
+}
+
+func (suite *SessionLifecycleTestSuite) history(user *models.User, id uint64) []map[string]interface{} {
+	w := suite.as(user, "GET", fmt.Sprintf("/api/users/sessions/%d/history", id), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var events []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &events))
+	return events
+}
+
+func (suite *SessionLifecycleTestSuite) TestCancelRecordsWhoAndWhy() {
+	id := suite.book()
+
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", id), map[string]string{"reason": "Feeling unwell"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var session models.Session
+	suite.Require().NoError(suite.db.First(&session, id).Error)
+	assert.Equal(suite.T(), sessionstate.CanceledByClient, session.Status)
+	var slot models.Availability
+	suite.Require().NoError(suite.db.First(&slot, *session.AvailabilityID).Error)
+	assert.Equal(suite.T(), "available", slot.Status, "A canceled session gives its slot back")
+
+	events := suite.history(suite.psychologist, id)
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), "", events[0]["fromStatus"])
+	assert.Equal(suite.T(), sessionstate.Confirmed, events[0]["toStatus"])
+	assert.Equal(suite.T(), sessionstate.Confirmed, events[1]["fromStatus"])
+	assert.Equal(suite.T(), sessionstate.CanceledByClient, events[1]["toStatus"])
+	assert.Equal(suite.T(), "client", events[1]["actorType"])
+	assert.Equal(suite.T(), float64(suite.client.ID), events[1]["actorId"])
+	assert.Equal(suite.T(), "Test User", events[1]["actorName"])
+	assert.Equal(suite.T(), "Feeling unwell", events[1]["reason"])
+
+	// Final statuses cannot change
+	w = suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", id), nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *SessionLifecycleTestSuite) TestPsychologistLifecycle() {
+	id := suite.book()
+
+	// Start, then complete; a completed session cannot be completed again
+	suite.Require().Equal(http.StatusOK, suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/start", id), nil).Code)
+	suite.Require().Equal(http.StatusOK, suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/complete", id), nil).Code)
+	w := suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/complete", id), nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "INVALID_STATUS")
+
+	var statuses []string
+	for _, event := range suite.history(suite.client, id) {
+		statuses = append(statuses, event["toStatus"].(string))
+	}
+	assert.Equal(suite.T(), []string{sessionstate.Confirmed, sessionstate.InProgress, sessionstate.Completed}, statuses)
+}
+
+func (suite *SessionLifecycleTestSuite) TestOnlyParticipantsAndAllowedActors() {
+	id := suite.book()
+	stranger := suite.helpers.CreateTestUser("other@example.com", "client")
+
+	assert.Equal(suite.T(), http.StatusForbidden, suite.as(stranger, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", id), nil).Code)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.as(stranger, "GET", fmt.Sprintf("/api/users/sessions/%d/history", id), nil).Code)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/complete", id), nil).Code)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.as(suite.client, "GET", "/api/users/sessions/999/history", nil).Code)
+
+	// Confirming a session that is already confirmed is not a valid transition
+	assert.Equal(suite.T(), http.StatusConflict, suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/confirm", id), nil).Code)
+}
+
+func (suite *SessionLifecycleTestSuite) TestLegacyCancellationsAreNotBlamedOnPsychologists() {
+	create := func(status string, canceledBy *uint64) uint64 {
+		session := models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: time.Now().Add(-48 * time.Hour),
+			EndTime: time.Now().Add(-47 * time.Hour), Status: status, CanceledBy: canceledBy}
+		suite.Require().NoError(suite.db.Create(&session).Error)
+		return session.ID
+	}
+	legacy := create(sessionstate.Canceled, nil)
+	migratedBefore := create(sessionstate.CanceledByPsychologist, nil)
+	byClient := create(sessionstate.Canceled, &suite.client.ID)
+	// Canceled through the state machine: by the psychologist, or by the system without an actor
+	byPsychologist := create(sessionstate.CanceledByPsychologist, &suite.psychologist.ID)
+	bySystem := create(sessionstate.CanceledByPsychologist, nil)
+	suite.Require().NoError(suite.db.Create(&models.SessionEvent{SessionID: bySystem, FromStatus: sessionstate.Pending,
+		ToStatus: sessionstate.CanceledByPsychologist, ActorType: string(sessionstate.ActorSystem)}).Error)
+
+	suite.Require().NoError(db.ApplyOnce("sessions_legacy_cancellations", db.ClassifyLegacyCancellations))
+
+	status := func(id uint64) string {
+		var session models.Session
+		suite.Require().NoError(suite.db.First(&session, id).Error)
+		return session.Status
+	}
+	assert.Equal(suite.T(), sessionstate.Canceled, status(legacy))
+	assert.Equal(suite.T(), sessionstate.Canceled, status(migratedBefore))
+	assert.Equal(suite.T(), sessionstate.CanceledByClient, status(byClient))
+	assert.Equal(suite.T(), sessionstate.CanceledByPsychologist, status(byPsychologist))
+	assert.Equal(suite.T(), sessionstate.CanceledByPsychologist, status(bySystem))
+
+	// The migration runs once: a later boot leaves the statuses alone
+	suite.Require().NoError(suite.db.Model(&models.Session{}).Where("id = ?", legacy).Update("status", sessionstate.CanceledByPsychologist).Error)
+	suite.Require().NoError(db.ApplyOnce("sessions_legacy_cancellations", db.ClassifyLegacyCancellations))
+	assert.Equal(suite.T(), sessionstate.CanceledByPsychologist, status(legacy))
+}
+
+func TestSessionLifecycleTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionLifecycleTestSuite))
+}
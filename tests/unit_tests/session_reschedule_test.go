@@ -0,0 +1,251 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/sessionstate"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type SessionRescheduleTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+	approval     bool
+}
+
+func (suite *SessionRescheduleTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{},
+		&models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/sessions/book/{slotId}", handlers.BookSession)
+	suite.router.Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
+	suite.router.Put("/api/users/sessions/{id}/reschedule", handlers.RescheduleSession)
+	suite.router.Put("/api/users/sessions/{id}/reschedule/approve", handlers.ApproveReschedule)
+	suite.router.Put("/api/users/sessions/{id}/reschedule/decline", handlers.DeclineReschedule)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+	suite.approval = handlers.Sessions.RescheduleApproval
+}
+
+func (suite *SessionRescheduleTestSuite) TearDownSuite() {
+	handlers.Sessions.RescheduleApproval = suite.approval
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SessionRescheduleTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_reschedules", "session_events", "sessions", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	handlers.Sessions.RescheduleApproval = true
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+}
+
+// as sends a request on behalf of user
+func (suite *SessionRescheduleTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// slot creates an available slot starting in the given number of hours
+func (suite *SessionRescheduleTestSuite) slot(inHours int) *models.Availability {
+	start := time.Now().Add(time.Duration(inHours) * time.Hour).Truncate(time.Second)
+	slot := &models.Availability{PsychologistID: suite.psychologist.ID, StartTime: start, EndTime: start.Add(time.Hour), Status: "available"}
+	suite.Require().NoError(suite.db.Create(slot).Error)
+	return slot
+}
+
+// book books the slot as the client and returns the session
+func (suite *SessionRescheduleTestSuite) book(slot *models.Availability) models.Session {
+	w := suite.as(suite.client, "POST", fmt.Sprintf("/api/users/sessions/book/%d", slot.ID), nil)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var session models.Session
+	suite.Require().NoError(suite.db.Where("availability_id = ?", slot.ID).First(&session).Error)
+	return session
+}
+
+func (suite *SessionRescheduleTestSuite) slotStatus(id uint64) string {
+	var slot models.Availability
+	suite.Require().NoError(suite.db.First(&slot, id).Error)
+	return slot.Status
+}
+
+func (suite *SessionRescheduleTestSuite) code(w *httptest.ResponseRecorder) string {
+	var body map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	code, _ := body["code"].(string)
+	return code
+}
+
+func (suite *SessionRescheduleTestSuite) TestDirectSwapWithoutApproval() {
+	handlers.Sessions.RescheduleApproval = false
+	oldSlot, newSlot := suite.slot(24), suite.slot(48)
+	session := suite.book(oldSlot)
+
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": newSlot.ID, "reason": "Exam that day"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	suite.Require().NoError(suite.db.First(&session, session.ID).Error)
+	assert.Equal(suite.T(), sessionstate.Rescheduled, session.Status)
+	assert.Equal(suite.T(), newSlot.ID, *session.AvailabilityID)
+	assert.True(suite.T(), newSlot.StartTime.Equal(session.StartTime))
+	assert.Equal(suite.T(), "available", suite.slotStatus(oldSlot.ID), "The old slot is released")
+	assert.Equal(suite.T(), "booked", suite.slotStatus(newSlot.ID))
+
+	var event models.SessionEvent
+	suite.Require().NoError(suite.db.Where("session_id = ?", session.ID).Order("id DESC").First(&event).Error)
+	assert.Equal(suite.T(), sessionstate.Rescheduled, event.ToStatus)
+	assert.Equal(suite.T(), "Exam that day", event.Reason)
+	if assert.NotNil(suite.T(), event.StartTime) {
+		assert.True(suite.T(), newSlot.StartTime.Equal(*event.StartTime))
+	}
+
+	// A slot that is already taken cannot be the target
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": newSlot.ID})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "SLOT_NOT_FOUND_OR_BOOKED", suite.code(w))
+}
+
+func (suite *SessionRescheduleTestSuite) TestProposalNeedsCounterpartApproval() {
+	oldSlot, newSlot := suite.slot(24), suite.slot(48)
+	session := suite.book(oldSlot)
+
+	w := suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": newSlot.ID})
+	suite.Require().Equal(http.StatusAccepted, w.Code, w.Body.String())
+	assert.Equal(suite.T(), "booked", suite.slotStatus(newSlot.ID), "The proposed slot is reserved")
+
+	// The session keeps its time until the proposal is approved
+	suite.Require().NoError(suite.db.First(&session, session.ID).Error)
+	assert.Equal(suite.T(), sessionstate.Confirmed, session.Status)
+	assert.Equal(suite.T(), oldSlot.ID, *session.AvailabilityID)
+
+	// Only one proposal at a time, and its author cannot approve it
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": suite.slot(72).ID})
+	assert.Equal(suite.T(), "RESCHEDULE_PENDING", suite.code(w))
+	w = suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule/approve", session.ID), nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule/approve", session.ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	suite.Require().NoError(suite.db.First(&session, session.ID).Error)
+	assert.Equal(suite.T(), sessionstate.Rescheduled, session.Status)
+	assert.Equal(suite.T(), newSlot.ID, *session.AvailabilityID)
+	assert.Equal(suite.T(), "available", suite.slotStatus(oldSlot.ID))
+
+	var proposal models.SessionReschedule
+	suite.Require().NoError(suite.db.Where("session_id = ?", session.ID).First(&proposal).Error)
+	assert.Equal(suite.T(), "approved", proposal.Status)
+	assert.Equal(suite.T(), suite.client.ID, *proposal.ResolvedBy)
+}
+
+func (suite *SessionRescheduleTestSuite) TestDeclineReleasesReservedSlot() {
+	oldSlot, newSlot := suite.slot(24), suite.slot(48)
+	session := suite.book(oldSlot)
+
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": newSlot.ID})
+	suite.Require().Equal(http.StatusAccepted, w.Code, w.Body.String())
+
+	w = suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule/decline", session.ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(suite.T(), "available", suite.slotStatus(newSlot.ID))
+	assert.Equal(suite.T(), "booked", suite.slotStatus(oldSlot.ID))
+
+	var proposal models.SessionReschedule
+	suite.Require().NoError(suite.db.Where("session_id = ?", session.ID).First(&proposal).Error)
+	assert.Equal(suite.T(), "declined", proposal.Status)
+
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule/approve", session.ID), nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *SessionRescheduleTestSuite) TestCancelDropsPendingProposal() {
+	oldSlot, newSlot := suite.slot(24), suite.slot(48)
+	session := suite.book(oldSlot)
+
+	w := suite.as(suite.psychologist, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID),
+		map[string]interface{}{"availabilityId": newSlot.ID})
+	suite.Require().Equal(http.StatusAccepted, w.Code, w.Body.String())
+
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", session.ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(suite.T(), "available", suite.slotStatus(oldSlot.ID))
+	assert.Equal(suite.T(), "available", suite.slotStatus(newSlot.ID))
+
+	var proposal models.SessionReschedule
+	suite.Require().NoError(suite.db.Where("session_id = ?", session.ID).First(&proposal).Error)
+	assert.Equal(suite.T(), "canceled", proposal.Status)
+}
+
+func (suite *SessionRescheduleTestSuite) TestFreeTimeRange() {
+	handlers.Sessions.RescheduleApproval = false
+	session := suite.book(suite.slot(24))
+	other := suite.book(suite.slot(48))
+
+	// Overlapping another active session of the psychologist
+	start := other.StartTime.Add(30 * time.Minute)
+	w := suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID), map[string]interface{}{
+		"startTime": start.Format(time.RFC3339), "endTime": start.Add(time.Hour).Format(time.RFC3339),
+	})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "TIME_CONFLICT", suite.code(w))
+
+	// A free range is fine...
+	start = other.EndTime.Add(2 * time.Hour)
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID), map[string]interface{}{
+		"startTime": start.Format(time.RFC3339), "endTime": start.Add(time.Hour).Format(time.RFC3339),
+	})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.Require().NoError(suite.db.First(&session, session.ID).Error)
+	assert.Nil(suite.T(), session.AvailabilityID)
+
+	// ...unless the psychologist accepts slot bookings only
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID, ScheduleEnforced: true}).Error)
+	start = start.Add(24 * time.Hour)
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/reschedule", session.ID), map[string]interface{}{
+		"startTime": start.Format(time.RFC3339), "endTime": start.Add(time.Hour).Format(time.RFC3339),
+	})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Equal(suite.T(), "SCHEDULE_ENFORCED", suite.code(w))
+}
+
+func TestSessionRescheduleTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionRescheduleTestSuite))
+}
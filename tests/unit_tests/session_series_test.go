@@ -0,0 +1,241 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/recurrence"
+	"user-api/internal/sessionstate"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestRecurrenceRule(t *testing.T) {
+	start := time.Date(2030, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	times := recurrence.Rule{Frequency: recurrence.Weekly, Count: 3}.Expand(start)
+	assert.Equal(t, []time.Time{start, start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)}, times)
+
+	until := start.AddDate(0, 0, 28)
+	times = recurrence.Rule{Frequency: recurrence.Biweekly, Until: &until}.Expand(start)
+	assert.Equal(t, []time.Time{start, start.AddDate(0, 0, 14), start.AddDate(0, 0, 28)}, times)
+
+	assert.NoError(t, recurrence.Rule{Frequency: recurrence.Weekly, Count: 52}.Validate(start))
+	assert.ErrorIs(t, recurrence.Rule{Frequency: "daily", Count: 3}.Validate(start), recurrence.ErrFrequency)
+	assert.ErrorIs(t, recurrence.Rule{Frequency: recurrence.Weekly}.Validate(start), recurrence.ErrBounds)
+	assert.ErrorIs(t, recurrence.Rule{Frequency: recurrence.Weekly, Count: 3, Until: &until}.Validate(start), recurrence.ErrBounds)
+	before := start.Add(-time.Hour)
+	assert.ErrorIs(t, recurrence.Rule{Frequency: recurrence.Weekly, Until: &before}.Validate(start), recurrence.ErrBounds)
+	assert.ErrorIs(t, recurrence.Rule{Frequency: recurrence.Weekly, Count: 53}.Validate(start), recurrence.ErrTooMany)
+	farAway := start.AddDate(2, 0, 0)
+	assert.ErrorIs(t, recurrence.Rule{Frequency: recurrence.Weekly, Until: &farAway}.Validate(start), recurrence.ErrTooMany)
+}
+
+type SessionSeriesTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+}
+
+func (suite *SessionSeriesTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{},
+		&models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{}, &models.SessionSeries{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/sessions/series", handlers.BookSessionSeries)
+	suite.router.Get("/api/users/sessions/series/{id}", handlers.GetSessionSeries)
+	suite.router.Put("/api/users/sessions/{id}/cancel", handlers.CancelSession)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *SessionSeriesTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SessionSeriesTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_series", "session_reschedules", "session_events", "sessions", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+}
+
+// as sends a request on behalf of user
+func (suite *SessionSeriesTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+// weeklySlots creates an available one-hour slot at the same time for each of the given weeks
+func (suite *SessionSeriesTestSuite) weeklySlots(first time.Time, weeks ...int) []*models.Availability {
+	var slots []*models.Availability
+	for _, week := range weeks {
+		start := first.AddDate(0, 0, 7*week)
+		slot := &models.Availability{PsychologistID: suite.psychologist.ID, StartTime: start, EndTime: start.Add(time.Hour), Status: "available"}
+		suite.Require().NoError(suite.db.Create(slot).Error)
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+func (suite *SessionSeriesTestSuite) firstStart() time.Time {
+	return time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+}
+
+func (suite *SessionSeriesTestSuite) seriesSessions() []models.Session {
+	var sessions []models.Session
+	suite.Require().NoError(suite.db.Where("series_id IS NOT NULL").Order("start_time").Find(&sessions).Error)
+	return sessions
+}
+
+func (suite *SessionSeriesTestSuite) TestBookWeeklySeries() {
+	slots := suite.weeklySlots(suite.firstStart(), 0, 1, 2, 3)
+
+	w := suite.as(suite.client, "POST", "/api/users/sessions/series", map[string]interface{}{
+		"availabilityId": slots[0].ID, "frequency": "weekly", "count": 4,
+	})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	sessions := suite.seriesSessions()
+	suite.Require().Len(sessions, 4)
+	for i, session := range sessions {
+		assert.Equal(suite.T(), slots[i].ID, *session.AvailabilityID)
+		assert.Equal(suite.T(), sessionstate.Confirmed, session.Status)
+		assert.Equal(suite.T(), *sessions[0].SeriesID, *session.SeriesID)
+	}
+	var booked int64
+	suite.db.Model(&models.Availability{}).Where("status = 'booked'").Count(&booked)
+	assert.Equal(suite.T(), int64(4), booked)
+
+	w = suite.as(suite.psychologist, "GET", fmt.Sprintf("/api/users/sessions/series/%d", *sessions[0].SeriesID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var body map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(suite.T(), body["sessions"], 4)
+	assert.Equal(suite.T(), "weekly", body["series"].(map[string]interface{})["frequency"])
+
+	stranger := suite.helpers.CreateTestUser("other@example.com", "client")
+	assert.Equal(suite.T(), http.StatusForbidden, suite.as(stranger, "GET", fmt.Sprintf("/api/users/sessions/series/%d", *sessions[0].SeriesID), nil).Code)
+}
+
+func (suite *SessionSeriesTestSuite) TestConflictsAreReported() {
+	slots := suite.weeklySlots(suite.firstStart(), 0, 1, 3) // no slot in week 2
+
+	w := suite.as(suite.client, "POST", "/api/users/sessions/series", map[string]interface{}{
+		"availabilityId": slots[0].ID, "frequency": "weekly", "count": 4,
+	})
+	suite.Require().Equal(http.StatusConflict, w.Code, w.Body.String())
+	var body map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "SERIES_CONFLICT", body["code"])
+	conflicts := body["params"].(map[string]interface{})["conflicts"].([]interface{})
+	suite.Require().Len(conflicts, 1)
+	assert.Equal(suite.T(), "slot_unavailable", conflicts[0].(map[string]interface{})["reason"])
+
+	// Nothing was reserved
+	assert.Empty(suite.T(), suite.seriesSessions())
+	var booked int64
+	suite.db.Model(&models.Availability{}).Where("status = 'booked'").Count(&booked)
+	assert.Zero(suite.T(), booked)
+
+	// With skipConflicts the available weeks are booked
+	w = suite.as(suite.client, "POST", "/api/users/sessions/series", map[string]interface{}{
+		"availabilityId": slots[0].ID, "frequency": "weekly", "count": 4, "skipConflicts": true,
+	})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	assert.Len(suite.T(), suite.seriesSessions(), 3)
+}
+
+func (suite *SessionSeriesTestSuite) TestCancelThisAndFollowing() {
+	slots := suite.weeklySlots(suite.firstStart(), 0, 1, 2, 3)
+	w := suite.as(suite.client, "POST", "/api/users/sessions/series", map[string]interface{}{
+		"availabilityId": slots[0].ID, "frequency": "weekly", "count": 4,
+	})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	sessions := suite.seriesSessions()
+
+	// One occurrence only
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel", sessions[0].ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	// The third and every later one
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel?scope=following", sessions[2].ID), map[string]string{"reason": "Moving away"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var statuses []string
+	for _, session := range suite.seriesSessions() {
+		statuses = append(statuses, session.Status)
+	}
+	assert.Equal(suite.T(), []string{sessionstate.CanceledByClient, sessionstate.Confirmed, sessionstate.CanceledByClient, sessionstate.CanceledByClient}, statuses)
+	var available int64
+	suite.db.Model(&models.Availability{}).Where("status = 'available'").Count(&available)
+	assert.Equal(suite.T(), int64(3), available)
+
+	// A single session is not part of a series
+	single := &models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID, StartTime: suite.firstStart(),
+		EndTime: suite.firstStart().Add(time.Hour), Status: sessionstate.Confirmed}
+	suite.Require().NoError(suite.db.Create(single).Error)
+	w = suite.as(suite.client, "PUT", fmt.Sprintf("/api/users/sessions/%d/cancel?scope=following", single.ID), nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "NOT_IN_SERIES")
+}
+
+func (suite *SessionSeriesTestSuite) TestFreeTimeSeries() {
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID}).Error)
+	start := suite.firstStart()
+	// Another client already has the second week
+	other := suite.helpers.CreateTestUser("other@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.Session{PsychologistID: suite.psychologist.ID, ClientID: &other.ID,
+		StartTime: start.AddDate(0, 0, 7), EndTime: start.AddDate(0, 0, 7).Add(time.Hour), Status: sessionstate.Confirmed}).Error)
+
+	request := map[string]interface{}{
+		"psychologistId": suite.psychologist.ID, "startTime": start.Format(time.RFC3339), "endTime": start.Add(time.Hour).Format(time.RFC3339),
+		"frequency": "biweekly", "until": start.AddDate(0, 0, 28).Format("2006-01-02"),
+	}
+	w := suite.as(suite.client, "POST", "/api/users/sessions/series", request)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	sessions := suite.seriesSessions()
+	suite.Require().Len(sessions, 3, "Biweekly occurrences skip the busy week")
+	for _, session := range sessions {
+		assert.Equal(suite.T(), sessionstate.Pending, session.Status)
+		assert.Nil(suite.T(), session.AvailabilityID)
+	}
+
+	request["frequency"] = "weekly"
+	w = suite.as(suite.client, "POST", "/api/users/sessions/series", request)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "time_conflict")
+}
+
+func TestSessionSeriesTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionSeriesTestSuite))
+}
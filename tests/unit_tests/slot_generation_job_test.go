@@ -0,0 +1,204 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type SlotGenerationTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+}
+
+func (suite *SlotGenerationTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{}, &models.ScheduleTemplate{},
+		&models.ScheduleException{}, &models.Session{}, &models.JobLease{}, &models.JobRun{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Get("/api/admin/jobs/slot-generation", handlers.GetSlotGenerationStatus)
+	suite.router.Delete("/api/users/availability/{slotId}", handlers.DeleteAvailabilitySlot)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *SlotGenerationTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *SlotGenerationTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"job_runs", "job_leases", "sessions", "schedule_exceptions", "schedule_templates", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.addTemplates(suite.psychologist.ID)
+}
+
+// addTemplates gives the psychologist one 09:00-10:00 slot every day of the week
+func (suite *SlotGenerationTestSuite) addTemplates(psychologistID uint64) {
+	for day := 0; day < 7; day++ {
+		suite.Require().NoError(suite.db.Create(&models.ScheduleTemplate{PsychologistID: psychologistID, DayOfWeek: day,
+			StartTime: "09:00", EndTime: "10:00", SlotDurationMinutes: 60, IsActive: true}).Error)
+	}
+}
+
+func (suite *SlotGenerationTestSuite) countSlots(psychologistID uint64) int64 {
+	var count int64
+	suite.db.Model(&models.Availability{}).Where("psychologist_id = ?", psychologistID).Count(&count)
+	return count
+}
+
+func (suite *SlotGenerationTestSuite) TestRunKeepsSlotsGeneratedAhead() {
+	now := time.Now().UTC()
+	blocked := suite.helpers.CreateTestUser("blocked@example.com", "psychologist")
+	suite.db.Model(blocked).Update("status", "Blocked")
+	suite.addTemplates(blocked.ID)
+
+	stale := models.Availability{PsychologistID: suite.psychologist.ID, StartTime: now.Add(-3 * time.Hour), EndTime: now.Add(-2 * time.Hour), Status: "available"}
+	booked := models.Availability{PsychologistID: suite.psychologist.ID, StartTime: now.Add(-5 * time.Hour), EndTime: now.Add(-4 * time.Hour), Status: "booked"}
+	suite.Require().NoError(suite.db.Create(&stale).Error)
+	suite.Require().NoError(suite.db.Create(&booked).Error)
+
+	run, err := handlers.RunSlotGeneration(now)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(run)
+	assert.Equal(suite.T(), "succeeded", run.Status)
+	assert.Equal(suite.T(), 1, run.Processed, "Blocked psychologists are skipped")
+	assert.Equal(suite.T(), 7*handlers.SlotGeneration.WeeksAhead, run.Generated)
+	assert.Equal(suite.T(), int64(1), run.RemovedStale)
+	assert.Equal(suite.T(), int64(0), suite.countSlots(blocked.ID))
+
+	var first models.Availability
+	suite.db.Where("psychologist_id = ? AND status = ?", suite.psychologist.ID, "available").Order("start_time").First(&first)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 9, 0, 0, 0, time.UTC)
+	assert.Equal(suite.T(), tomorrow, first.StartTime.UTC())
+	var count int64
+	suite.db.Model(&models.Availability{}).Where("id IN ?", []uint64{stale.ID, booked.ID}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count, "Only the unbooked slot in the past is deleted")
+
+	// The next run only adds the days that came into range
+	run, err = handlers.RunSlotGeneration(now.Add(24 * time.Hour))
+	suite.Require().NoError(err)
+	suite.Require().NotNil(run)
+	assert.Equal(suite.T(), 1, run.Generated)
+
+	var runs []models.JobRun
+	suite.db.Order("id").Find(&runs)
+	suite.Require().Len(runs, 2)
+	assert.NotNil(suite.T(), runs[0].FinishedAt)
+}
+
+func (suite *SlotGenerationTestSuite) TestLeaseHeldByAnotherInstance() {
+	now := time.Now().UTC()
+	suite.Require().NoError(suite.db.Create(&models.JobLease{Name: "slot_generation", Owner: "other-instance", ExpiresAt: now.Add(5 * time.Minute)}).Error)
+
+	run, err := handlers.RunSlotGeneration(now)
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), run)
+	assert.Equal(suite.T(), int64(0), suite.countSlots(suite.psychologist.ID))
+
+	// Once the lease expires this instance takes over, and releases it after the run
+	run, err = handlers.RunSlotGeneration(now.Add(10 * time.Minute))
+	suite.Require().NoError(err)
+	suite.Require().NotNil(run)
+	assert.Positive(suite.T(), suite.countSlots(suite.psychologist.ID))
+	var lease models.JobLease
+	suite.db.First(&lease, "name = ?", "slot_generation")
+	assert.NotEqual(suite.T(), "other-instance", lease.Owner)
+	assert.False(suite.T(), lease.ExpiresAt.After(time.Now()))
+}
+
+func (suite *SlotGenerationTestSuite) TestDeletedSlotsAreNotRecreated() {
+	now := time.Now().UTC()
+	_, err := handlers.RunSlotGeneration(now)
+	suite.Require().NoError(err)
+	generated := suite.countSlots(suite.psychologist.ID)
+
+	var slot models.Availability
+	suite.Require().NoError(suite.db.Where("psychologist_id = ?", suite.psychologist.ID).Order("start_time").First(&slot).Error)
+	manual := models.Availability{PsychologistID: suite.psychologist.ID, StartTime: slot.StartTime.Add(3 * time.Hour),
+		EndTime: slot.StartTime.Add(4 * time.Hour), Status: "available"}
+	suite.Require().NoError(suite.db.Create(&manual).Error)
+
+	remove := func(id uint64) map[string]interface{} {
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, WithUser(httptest.NewRequest("DELETE", fmt.Sprintf("/api/users/availability/%d", id), nil), suite.psychologist))
+		suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+		var body map[string]interface{}
+		suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+	// A generated slot leaves an "off" exception for its time; a slot added by hand does not
+	exception, ok := remove(slot.ID)["exception"].(map[string]interface{})
+	suite.Require().True(ok)
+	assert.Equal(suite.T(), "off", exception["kind"])
+	assert.Equal(suite.T(), slot.StartTime.UTC().Format("2006-01-02"), exception["startDate"])
+	assert.Equal(suite.T(), "09:00", exception["startTime"])
+	assert.Equal(suite.T(), "10:00", exception["endTime"])
+	assert.Nil(suite.T(), remove(manual.ID)["exception"])
+
+	run, err := handlers.RunSlotGeneration(now)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(run)
+	assert.Equal(suite.T(), 0, run.Generated, "The deleted slot is not generated again")
+	assert.Equal(suite.T(), generated-1, suite.countSlots(suite.psychologist.ID))
+
+	// Deleting the exception brings the slot back
+	suite.Require().NoError(suite.db.Where("psychologist_id = ?", suite.psychologist.ID).Delete(&models.ScheduleException{}).Error)
+	run, err = handlers.RunSlotGeneration(now)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, run.Generated)
+}
+
+func (suite *SlotGenerationTestSuite) TestAdminStatus() {
+	_, err := handlers.RunSlotGeneration(time.Now())
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/admin/jobs/slot-generation", nil))
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var status struct {
+		WeeksAhead int              `json:"weeksAhead"`
+		Lease      *models.JobLease `json:"lease"`
+		Runs       []models.JobRun  `json:"runs"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(suite.T(), handlers.SlotGeneration.WeeksAhead, status.WeeksAhead)
+	assert.Nil(suite.T(), status.Lease, "The lease is released after the run")
+	suite.Require().Len(status.Runs, 1)
+	assert.Equal(suite.T(), "succeeded", status.Runs[0].Status)
+	assert.Equal(suite.T(), 7*handlers.SlotGeneration.WeeksAhead, status.Runs[0].Generated)
+}
+
+func TestSlotGenerationTestSuite(t *testing.T) {
+	suite.Run(t, new(SlotGenerationTestSuite))
+}
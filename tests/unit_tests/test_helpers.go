@@ -7,6 +7,9 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
 	"user-api/internal/models"
 
 	"github.com/stretchr/testify/assert"
@@ -53,6 +56,43 @@ func (h *TestHelpers) AssertUserExists(email string) {
 	assert.NoError(h.t, err, "User should exist in database")
 }
 
+// AuthAs simulates middleware.RequireUser for the user with the given email. The user is looked up
+// on every request, so it may be created after the route is registered; unknown emails get 401.
+func AuthAs(email string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var user models.User
+			if err := db.DB.Select("id").Where("email = ?", email).First(&user).Error; err != nil {
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+			principal, err := handlers.LoadPrincipal(user.ID)
+			if err != nil {
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// WithUser returns a copy of req authenticated as user
+func WithUser(req *http.Request, user *models.User) *http.Request {
+	return req.WithContext(auth.WithPrincipal(req.Context(), &auth.AuthPrincipal{
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+		Status: user.Status,
+		PlanID: user.PlanID,
+	}))
+}
+
+// nonexistentUser is an active user with the given role that is not stored in the database,
+// for requests built with WithUser that reach the handler's own lookup
+func nonexistentUser(role string) *models.User {
+	return &models.User{ID: 999999999, Email: "nonexistent@example.com", Role: role, Status: "Active"}
+}
+
 // getEnv is a helper to read environment variables with a fallback.
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
@@ -0,0 +1,228 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+	"user-api/internal/recurrence"
+	"user-api/internal/sessionstate"
+	"user-api/internal/timezone"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTimeZoneLoad(t *testing.T) {
+	kyiv, err := timezone.Load("Europe/Kyiv")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Kyiv", kyiv.String())
+
+	loc, err := timezone.Load("")
+	require.NoError(t, err)
+	assert.Equal(t, timezone.Default, loc)
+	for _, name := range []string{"Local", "Mars/Olympus_Mons", "/etc/localtime"} {
+		_, err := timezone.Load(name)
+		assert.ErrorIs(t, err, timezone.ErrUnknown, name)
+	}
+
+	assert.Equal(t, "Europe/Kyiv", timezone.Resolve("", "Europe/Kyiv").String(), "Empty zones fall through")
+	assert.Equal(t, "America/New_York", timezone.Resolve("America/New_York", "Europe/Kyiv").String())
+	assert.Equal(t, timezone.Default, timezone.Resolve("", "Nowhere/Invalid"))
+
+	minutes, err := timezone.ParseClock("09:30")
+	require.NoError(t, err)
+	assert.Equal(t, 570, minutes)
+	minutes, err = timezone.ParseClock("18:00:00")
+	require.NoError(t, err)
+	assert.Equal(t, 1080, minutes)
+	_, err = timezone.ParseClock("9am")
+	assert.Error(t, err)
+}
+
+func TestDaySlotsAcrossDaylightSaving(t *testing.T) {
+	kyiv, err := timezone.Load("Europe/Kyiv")
+	require.NoError(t, err)
+	utc := func(day, hour int) time.Time { return time.Date(2026, time.March, day, hour, 0, 0, 0, time.UTC) }
+
+	// 09:00-11:00 in Kyiv is 07:00 UTC in winter and 06:00 UTC in summer
+	winter := timezone.DaySlots(utc(28, 0), 9*60, 11*60, time.Hour, kyiv)
+	assert.Equal(t, []timezone.Range{{Start: utc(28, 7), End: utc(28, 8)}, {Start: utc(28, 8), End: utc(28, 9)}}, winter)
+	summer := timezone.DaySlots(utc(30, 0), 9*60, 11*60, time.Hour, kyiv)
+	assert.Equal(t, []timezone.Range{{Start: utc(30, 6), End: utc(30, 7)}, {Start: utc(30, 7), End: utc(30, 8)}}, summer)
+
+	// On 29 March clocks jump from 03:00 to 04:00: the 03:00 slot does not exist
+	change := timezone.DaySlots(utc(29, 0), 2*60, 5*60, time.Hour, kyiv)
+	require.Len(t, change, 2)
+	assert.Equal(t, utc(29, 0), change[0].Start, "02:00 EET")
+	assert.Equal(t, utc(29, 1), change[1].Start, "04:00 EEST")
+	assert.Equal(t, time.Hour, change[1].End.Sub(change[1].Start))
+
+	_, ok := timezone.At(utc(29, 0), 3*60+30, kyiv)
+	assert.False(t, ok)
+}
+
+func TestRecurrenceKeepsWallClockInZone(t *testing.T) {
+	newYork, err := timezone.Load("America/New_York")
+	require.NoError(t, err)
+	// 10:00 in New York on 2 March 2026 (EST); clocks move forward on 8 March
+	start := time.Date(2026, time.March, 2, 15, 0, 0, 0, time.UTC)
+
+	times := recurrence.Rule{Frequency: recurrence.Weekly, Count: 2}.Expand(start.In(newYork))
+	require.Len(t, times, 2)
+	assert.Equal(t, 10, times[1].Hour())
+	assert.Equal(t, time.Date(2026, time.March, 9, 14, 0, 0, 0, time.UTC), times[1].UTC())
+}
+
+type TimeZonesTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	router       *chi.Mux
+	helpers      *TestHelpers
+	psychologist *models.User
+	client       *models.User
+}
+
+func (suite *TimeZonesTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	suite.Require().NoError(testDB.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Availability{}, &models.ScheduleTemplate{},
+		&models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{}))
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/users/schedule-templates/generate", handlers.GenerateSlotsFromTemplates)
+	suite.router.Get("/api/users/availability/{psychologistId}", handlers.GetPsychologistAvailability)
+	suite.router.Get("/api/users/sessions/my", handlers.GetMySessions)
+	suite.router.Put("/api/users/self/updateuser", handlers.ClientSelfUpdate)
+	suite.router.Put("/api/users/self/portfolio", handlers.UpdateSelfPortfolio)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *TimeZonesTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *TimeZonesTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"session_reschedules", "session_events", "sessions", "schedule_templates", "availabilities", "portfolios", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	suite.psychologist = suite.helpers.CreateTestUser("psy@example.com", "psychologist")
+	suite.client = suite.helpers.CreateTestUser("client@example.com", "client")
+	suite.Require().NoError(suite.db.Create(&models.Portfolio{PsychologistID: suite.psychologist.ID, TimeZone: "America/New_York"}).Error)
+}
+
+func (suite *TimeZonesTestSuite) as(user *models.User, method, url string, body interface{}) *httptest.ResponseRecorder {
+	w, req := suite.helpers.MakeJSONRequest(method, url, body)
+	suite.router.ServeHTTP(w, WithUser(req, user))
+	return w
+}
+
+func (suite *TimeZonesTestSuite) TestTemplatesExpandInPsychologistZone() {
+	// The same Monday template before and after New York moves its clocks forward (8 March 2026)
+	suite.Require().NoError(suite.db.Create(&models.ScheduleTemplate{PsychologistID: suite.psychologist.ID, DayOfWeek: 0,
+		StartTime: "09:00", EndTime: "10:00", SlotDurationMinutes: 60, IsActive: true}).Error)
+
+	w := suite.as(suite.psychologist, "POST", "/api/users/schedule-templates/generate",
+		map[string]string{"startDate": "2026-03-02", "endDate": "2026-03-09"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var slots []models.Availability
+	suite.Require().NoError(suite.db.Where("psychologist_id = ?", suite.psychologist.ID).Order("start_time").Find(&slots).Error)
+	suite.Require().Len(slots, 2)
+	assert.Equal(suite.T(), time.Date(2026, time.March, 2, 14, 0, 0, 0, time.UTC), slots[0].StartTime.UTC(), "09:00 EST")
+	assert.Equal(suite.T(), time.Date(2026, time.March, 9, 13, 0, 0, 0, time.UTC), slots[1].StartTime.UTC(), "09:00 EDT")
+}
+
+func (suite *TimeZonesTestSuite) TestResponsesIncludeViewerLocalTimes() {
+	start := time.Now().UTC().AddDate(0, 0, 3).Truncate(time.Hour)
+	suite.Require().NoError(suite.db.Create(&models.Session{PsychologistID: suite.psychologist.ID, ClientID: &suite.client.ID,
+		StartTime: start, EndTime: start.Add(time.Hour), Status: sessionstate.Confirmed}).Error)
+	suite.Require().NoError(suite.db.Create(&models.Availability{PsychologistID: suite.psychologist.ID,
+		StartTime: start.Add(2 * time.Hour), EndTime: start.Add(3 * time.Hour), Status: "available"}).Error)
+
+	// The client's own zone
+	suite.Require().Equal(http.StatusOK, suite.as(suite.client, "PUT", "/api/users/self/updateuser",
+		map[string]interface{}{"firstName": "Test", "lastName": "User", "timeZone": "Europe/Kyiv"}).Code)
+	suite.client.TimeZone = "Europe/Kyiv"
+	kyiv, _ := timezone.Load("Europe/Kyiv")
+
+	w := suite.as(suite.client, "GET", "/api/users/sessions/my", nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var sessions []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &sessions))
+	suite.Require().Len(sessions, 1)
+	assert.Equal(suite.T(), start.Format(time.RFC3339), sessions[0]["startTime"])
+	assert.Equal(suite.T(), start.In(kyiv).Format(time.RFC3339), sessions[0]["startTimeLocal"])
+	assert.Equal(suite.T(), "Europe/Kyiv", sessions[0]["timeZone"])
+
+	// ?tz= overrides the viewer's zone, also for anonymous viewers
+	tokyo, _ := timezone.Load("Asia/Tokyo")
+	w = suite.as(suite.client, "GET", fmt.Sprintf("/api/users/availability/%d?tz=Asia/Tokyo", suite.psychologist.ID), nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var slots []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &slots))
+	suite.Require().Len(slots, 1)
+	assert.Equal(suite.T(), start.Add(2*time.Hour).Format(time.RFC3339), slots[0]["startTime"])
+	assert.Equal(suite.T(), start.Add(2*time.Hour).In(tokyo).Format(time.RFC3339), slots[0]["startTimeLocal"])
+}
+
+func (suite *TimeZonesTestSuite) TestInvalidTimeZonesAreRejected() {
+	w := suite.as(suite.client, "PUT", "/api/users/self/updateuser",
+		map[string]interface{}{"firstName": "Test", "lastName": "User", "timeZone": "Local"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.as(suite.psychologist, "PUT", "/api/users/self/portfolio", map[string]interface{}{"timeZone": "Europe/Atlantis"})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.as(suite.psychologist, "PUT", "/api/users/self/portfolio",
+		map[string]interface{}{"timeZone": "Europe/Kyiv"}).Code)
+	var portfolio models.Portfolio
+	suite.db.Where("psychologist_id = ?", suite.psychologist.ID).First(&portfolio)
+	assert.Equal(suite.T(), "Europe/Kyiv", portfolio.TimeZone)
+}
+
+func (suite *TimeZonesTestSuite) TestLegacyLocalTimesAreConvertedToUTC() {
+	// Written by an older version on a server two hours ahead of UTC
+	local := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	slot := models.Availability{PsychologistID: suite.psychologist.ID, StartTime: local, EndTime: local.Add(time.Hour), Status: "available"}
+	suite.Require().NoError(suite.db.Create(&slot).Error)
+
+	suite.Require().NoError(suite.db.Transaction(func(tx *gorm.DB) error {
+		return db.ConvertDatetimesToUTC(tx, "+02:00")
+	}))
+	suite.Require().NoError(suite.db.First(&slot, slot.ID).Error)
+	assert.Equal(suite.T(), local.Add(-2*time.Hour), slot.StartTime.UTC())
+	assert.Equal(suite.T(), local.Add(-time.Hour), slot.EndTime.UTC())
+
+	// A zone MySQL does not know stops the migration instead of clearing the columns
+	assert.Error(suite.T(), suite.db.Transaction(func(tx *gorm.DB) error {
+		return db.ConvertDatetimesToUTC(tx, "Nowhere/Unknown")
+	}))
+	suite.Require().NoError(suite.db.First(&slot, slot.ID).Error)
+	assert.Equal(suite.T(), local.Add(-2*time.Hour), slot.StartTime.UTC())
+}
+
+func TestTimeZonesTestSuite(t *testing.T) {
+	suite.Run(t, new(TimeZonesTestSuite))
+}
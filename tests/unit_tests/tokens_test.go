@@ -0,0 +1,241 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/keyring"
+	"user-api/internal/models"
+	"user-api/internal/tokens"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newTestTokenService(t *testing.T) *tokens.Service {
+	access, err := keyring.NewRing("a", keyring.NewHMACKey("a", []byte("access-secret")))
+	require.NoError(t, err)
+	refresh, err := keyring.NewRing("r", keyring.NewHMACKey("r", []byte("refresh-secret")))
+	require.NoError(t, err)
+	return tokens.New(tokens.Config{
+		Issuer:          "test-issuer",
+		AccessAudience:  "test-api",
+		RefreshAudience: "test-refresh",
+		AccessTTL:       15 * time.Minute,
+		RefreshTTL:      24 * time.Hour,
+		ImpersonateTTL:  5 * time.Minute,
+	}, access, refresh)
+}
+
+func TestTokens_AccessRoundTrip(t *testing.T) {
+	service := newTestTokenService(t)
+	issuedAt := time.Now().Truncate(time.Second)
+	service.SetClock(func() time.Time { return issuedAt })
+
+	token, err := service.IssueAccess(&models.User{ID: 42, Email: "round@example.com", Role: "psychologist"})
+	require.NoError(t, err)
+	claims, err := service.ParseAccess(token)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(42), claims.UserID())
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, "round@example.com", claims.Username)
+	assert.Equal(t, "psychologist", claims.Role)
+	assert.Equal(t, "test-issuer", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"test-api"}, claims.Audience)
+	assert.Equal(t, issuedAt.Add(15*time.Minute), claims.ExpiresAt.Time)
+}
+
+func TestTokens_AccessAndRefreshAreNotInterchangeable(t *testing.T) {
+	service := newTestTokenService(t)
+	user := &models.User{ID: 5, Email: "swap@example.com", Role: "client"}
+
+	access, err := service.IssueAccess(user)
+	require.NoError(t, err)
+	refresh, err := service.IssueRefresh(user, 9)
+	require.NoError(t, err)
+
+	claims, err := service.ParseRefresh(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), claims.UserID())
+	assert.Equal(t, uint64(9), claims.DeviceID)
+	assert.NotEmpty(t, claims.ID)
+
+	_, err = service.ParseAccess(refresh)
+	assert.ErrorIs(t, err, tokens.ErrInvalidAccessToken)
+	_, err = service.ParseRefresh(access)
+	assert.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func TestTokens_RejectsForeignIssuerAndMissingSubject(t *testing.T) {
+	service := newTestTokenService(t)
+	ring, err := keyring.NewRing("a", keyring.NewHMACKey("a", []byte("access-secret")))
+	require.NoError(t, err)
+
+	// Same key, other issuer
+	other := tokens.New(tokens.Config{Issuer: "someone-else", AccessAudience: "test-api", AccessTTL: time.Hour}, ring, ring)
+	foreign, err := other.IssueAccess(&models.User{ID: 1})
+	require.NoError(t, err)
+	_, err = service.ParseAccess(foreign)
+	assert.Error(t, err)
+
+	// Tokens without a user ID (issued before the service existed) are rejected
+	legacy, err := ring.Sign(&tokens.AccessClaims{
+		Username: "old@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "test-issuer",
+			Audience:  jwt.ClaimStrings{"test-api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	require.NoError(t, err)
+	_, err = service.ParseAccess(legacy)
+	assert.Error(t, err)
+}
+
+func TestTokens_ImpersonationCarriesActor(t *testing.T) {
+	service := newTestTokenService(t)
+	issuedAt := time.Now().Truncate(time.Second)
+	service.SetClock(func() time.Time { return issuedAt })
+
+	token, expiresAt, err := service.IssueImpersonation(&models.User{ID: 42, Email: "viewed@example.com", Role: "client"}, 7, "support")
+	require.NoError(t, err)
+	assert.Equal(t, issuedAt.Add(5*time.Minute), expiresAt)
+
+	claims, err := service.ParseAccess(token)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), claims.UserID())
+	require.NotNil(t, claims.Actor)
+	assert.Equal(t, uint64(7), claims.Actor.AdminID())
+	assert.Equal(t, "support", claims.Actor.Username)
+	assert.Equal(t, issuedAt.Add(5*time.Minute), claims.ExpiresAt.Time)
+
+	// Regular tokens have no actor
+	token, err = service.IssueAccess(&models.User{ID: 42})
+	require.NoError(t, err)
+	claims, err = service.ParseAccess(token)
+	require.NoError(t, err)
+	assert.Nil(t, claims.Actor)
+}
+
+func TestTokens_Expired(t *testing.T) {
+	service := newTestTokenService(t)
+	service.SetClock(func() time.Time { return time.Now().Add(-time.Hour) })
+
+	token, err := service.IssueAccess(&models.User{ID: 3})
+	require.NoError(t, err)
+	_, err = service.ParseAccess(token)
+	assert.Error(t, err, "An access token older than AccessTTL must be rejected")
+}
+
+type TokensTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+}
+
+func (suite *TokensTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.SystemSetting{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Post("/api/login", handlers.UserLogin)
+	suite.router.Post("/api/auth/refresh", handlers.RefreshToken)
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *TokensTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *TokensTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	suite.db.Exec("TRUNCATE TABLE refresh_tokens")
+	suite.db.Exec("TRUNCATE TABLE system_settings")
+	suite.db.Exec("TRUNCATE TABLE users")
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+}
+
+func (suite *TokensTestSuite) TestLoginTokenCanBeRefreshed() {
+	user := suite.helpers.CreateTestUser("refreshable@example.com", "client")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.db.Model(user).Update("password", string(hashed))
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/login", map[string]string{
+		"username": user.Email,
+		"password": "password123",
+	})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &login))
+	accessClaims, err := tokens.Default.ParseAccess(login.AccessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.ID, accessClaims.UserID())
+
+	cookie := findCookie(w, "refresh_token")
+	suite.Require().NotNil(cookie)
+
+	// The refresh token issued at login is accepted by the refresh endpoint
+	w2, req2 := suite.helpers.MakeJSONRequest("POST", "/api/auth/refresh", nil)
+	req2.AddCookie(cookie)
+	suite.router.ServeHTTP(w2, req2)
+	suite.Require().Equal(http.StatusOK, w2.Code)
+
+	var refreshed struct {
+		AccessToken string `json:"access_token"`
+	}
+	suite.Require().NoError(json.Unmarshal(w2.Body.Bytes(), &refreshed))
+	claims, err := tokens.Default.ParseAccess(refreshed.AccessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.ID, claims.UserID())
+	assert.Equal(suite.T(), user.Email, claims.Username)
+
+	rotated := findCookie(w2, "refresh_token")
+	suite.Require().NotNil(rotated)
+	assert.NotEqual(suite.T(), cookie.Value, rotated.Value)
+	_, err = tokens.Default.ParseRefresh(rotated.Value)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *TokensTestSuite) TestAccessTokenIsNotARefreshToken() {
+	user := suite.helpers.CreateTestUser("wrongkind@example.com", "client")
+	access, err := tokens.Default.IssueAccess(user)
+	suite.Require().NoError(err)
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: access})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestTokensTestSuite(t *testing.T) {
+	suite.Run(t, new(TokensTestSuite))
+}
@@ -0,0 +1,41 @@
+package unit_tests
+
+import (
+	"testing"
+	"time"
+	"user-api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B test secret ("12345678901234567890"), base32-encoded
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+	}
+	for unix, expected := range vectors {
+		code, err := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "unix time %d", unix)
+	}
+}
+
+func TestValidateTOTP_AllowsOneStepSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previous, _ := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(now)-1)
+	tooOld, _ := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(now)-2)
+
+	step, ok := utils.ValidateTOTP(rfcTOTPSecret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, utils.TOTPStep(now)-1, step)
+
+	_, ok = utils.ValidateTOTP(rfcTOTPSecret, tooOld, now)
+	assert.False(t, ok)
+
+	_, ok = utils.ValidateTOTP(rfcTOTPSecret, "12345", now)
+	assert.False(t, ok)
+}
@@ -2,7 +2,6 @@ package unit_tests
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -74,10 +73,7 @@ func (suite *UserBlogTestSuite) setupRoutes() {
 }
 
 func (suite *UserBlogTestSuite) mockUserMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), "email", "psychologist@example.com")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return AuthAs("psychologist@example.com")(next)
 }
 
 func (suite *UserBlogTestSuite) createTestPsychologist(email string) *models.User {
@@ -138,10 +134,7 @@ func (suite *UserBlogTestSuite) TestCreateBlogPost_Forbidden() {
 	// Create a new router and middleware for this specific test
 	router := chi.NewRouter()
 	mockClientMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "client@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		return AuthAs("client@example.com")(next)
 	}
 	router.With(mockClientMiddleware).Post("/api/users/blog/", handlers.CreateBlogPost)
 
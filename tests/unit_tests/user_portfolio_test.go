@@ -14,7 +14,9 @@ import (
 	"testing"
 	"user-api/internal/db"
 	"user-api/internal/handlers"
+	authmw "user-api/internal/middleware"
 	"user-api/internal/models"
+	"user-api/internal/tokens"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -106,11 +108,7 @@ func (suite *UserPortfolioTestSuite) setupRoutes() {
 }
 
 func (suite *UserPortfolioTestSuite) mockUserMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Добавляем email в контекст для аутентификации
-		ctx := context.WithValue(r.Context(), "email", "test@example.com")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return AuthAs("test@example.com")(next)
 }
 
 func (suite *UserPortfolioTestSuite) createTestPsychologist() *models.User {
@@ -148,7 +146,6 @@ func (suite *UserPortfolioTestSuite) createTestPortfolio(userID uint64) *models.
 		PsychologistID: userID,
 		Description:    "Test portfolio",
 		Experience:     5,
-		Education:      "Master's degree",
 		ContactEmail:   stringPtr("contact@example.com"),
 		ContactPhone:   stringPtr("+1234567890"),
 	}
@@ -202,7 +199,6 @@ func (suite *UserPortfolioTestSuite) TestUpdateSelfPortfolio_CreateNew() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), "Updated portfolio description", portfolio.Description)
 	assert.Equal(suite.T(), 10, portfolio.Experience)
-	assert.Equal(suite.T(), "PhD in Psychology", portfolio.Education)
 	assert.Equal(suite.T(), "new.contact@example.com", *portfolio.ContactEmail)
 	assert.Equal(suite.T(), "+9876543210", *portfolio.ContactPhone)
 }
@@ -234,7 +230,6 @@ func (suite *UserPortfolioTestSuite) TestUpdateSelfPortfolio_UpdateExisting() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), "Updated description", updatedPortfolio.Description)
 	assert.Equal(suite.T(), 15, updatedPortfolio.Experience)
-	assert.Equal(suite.T(), "Updated education", updatedPortfolio.Education)
 	assert.Equal(suite.T(), "updated@example.com", *updatedPortfolio.ContactEmail)
 	assert.Equal(suite.T(), "+1111111111", *updatedPortfolio.ContactPhone)
 }
@@ -285,24 +280,25 @@ func (suite *UserPortfolioTestSuite) TestUpdateSelfPortfolio_UserNotFound() {
 		"description": "Test description",
 	}
 
+	// Дійсний токен психолога, якого вже немає в БД, відхиляє RequireUser
+	token, err := tokens.Default.IssueAccess(nonexistentUser("psychologist"))
+	suite.Require().NoError(err)
+
 	body, _ := json.Marshal(updateData)
 	req := httptest.NewRequest("PUT", "/api/users/self/portfolio", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 	w := httptest.NewRecorder()
 
-	// Используем middleware с email, который не существует в БД
-	mockMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "nonexistent@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-
 	router := chi.NewRouter()
-	router.With(mockMiddleware).Put("/api/users/self/portfolio", handlers.UpdateSelfPortfolio)
+	router.With(authmw.RequireUser).Put("/api/users/self/portfolio", handlers.UpdateSelfPortfolio)
 	router.ServeHTTP(w, req)
 
-	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "USER_NOT_FOUND")
+	var count int64
+	suite.db.Model(&models.Portfolio{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count, "No portfolio is created for a missing user")
 }
 
 func (suite *UserPortfolioTestSuite) TestUpdateSelfPortfolio_InvalidJSON() {
@@ -568,19 +564,12 @@ func (suite *UserPortfolioTestSuite) TestDeletePortfolioPhoto_Unauthorized() {
 }
 
 func (suite *UserPortfolioTestSuite) TestDeletePortfolioPhoto_UserNotFound() {
-	req := httptest.NewRequest("DELETE", "/api/users/portfolio/photo/1", nil)
+	// Аутентифицированный психолог, которого нет в БД
+	req := WithUser(httptest.NewRequest("DELETE", "/api/users/portfolio/photo/1", nil), nonexistentUser("psychologist"))
 	w := httptest.NewRecorder()
 
-	// Используем middleware с email, который не существует в БД
-	mockMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "nonexistent@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-
 	router := chi.NewRouter()
-	router.With(mockMiddleware).Delete("/api/users/portfolio/photo/{photo_id}", handlers.DeletePortfolioPhoto)
+	router.Delete("/api/users/portfolio/photo/{photo_id}", handlers.DeletePortfolioPhoto)
 
 	// Добавляем параметр в контекст
 	rctx := chi.NewRouteContext()
@@ -616,10 +605,7 @@ func (suite *UserPortfolioTestSuite) TestDeletePortfolioPhoto_AccessDenied() {
 
 	// Создаем middleware с email второго пользователя
 	mockMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "another@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		return AuthAs("another@example.com")(next)
 	}
 
 	router := chi.NewRouter()
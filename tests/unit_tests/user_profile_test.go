@@ -102,25 +102,19 @@ func (suite *UserProfileTestSuite) setupRoutes() {
 }
 
 func (suite *UserProfileTestSuite) mockUserMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Добавляем email в контекст для аутентификации
-		ctx := context.WithValue(r.Context(), "email", "test@example.com")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return AuthAs("test@example.com")(next)
 }
 
 func (suite *UserProfileTestSuite) createTestUser() *models.User {
 	timestamp := time.Now().UnixNano()
 	user := &models.User{
-		FirstName:         "John",
-		LastName:          "Doe",
-		Email:             fmt.Sprintf("john.doe.%d@example.com", timestamp),
-		Password:          "hashedpassword",
-		Role:              "client",
-		Status:            "Active",
-		Verified:          true,
-		RefreshToken:      "refresh_token",
-		VerificationToken: "verification_token",
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     fmt.Sprintf("john.doe.%d@example.com", timestamp),
+		Password:  "hashedpassword",
+		Role:      "client",
+		Status:    "Active",
+		Verified:  true,
 	}
 	err := suite.db.Create(user).Error
 	suite.Require().NoError(err)
@@ -130,15 +124,13 @@ func (suite *UserProfileTestSuite) createTestUser() *models.User {
 func (suite *UserProfileTestSuite) createTestPsychologist() *models.User {
 	timestamp := time.Now().UnixNano()
 	user := &models.User{
-		FirstName:         "Jane",
-		LastName:          "Smith",
-		Email:             fmt.Sprintf("jane.smith.%d@example.com", timestamp),
-		Password:          "hashedpassword",
-		Role:              "psychologist",
-		Status:            "Active",
-		Verified:          true,
-		RefreshToken:      "refresh_token",
-		VerificationToken: "verification_token",
+		FirstName: "Jane",
+		LastName:  "Smith",
+		Email:     fmt.Sprintf("jane.smith.%d@example.com", timestamp),
+		Password:  "hashedpassword",
+		Role:      "psychologist",
+		Status:    "Active",
+		Verified:  true,
 	}
 	err := suite.db.Create(user).Error
 	suite.Require().NoError(err)
@@ -147,8 +139,7 @@ func (suite *UserProfileTestSuite) createTestPsychologist() *models.User {
 	portfolio := &models.Portfolio{
 		PsychologistID: user.ID,
 		Description:    "Test psychologist",
-		Experience:     5, // Если это int
-		Education:      "Master's degree",
+		Experience:     5,                                // Если это int
 		ContactEmail:   stringPtr("contact@example.com"), // Если это *string
 		ContactPhone:   stringPtr("+1234567890"),         // Если это *string
 	}
@@ -195,16 +186,14 @@ func (suite *UserProfileTestSuite) createTestPsychologist() *models.User {
 
 func (suite *UserProfileTestSuite) createAuthenticatedUser() *models.User {
 	user := &models.User{
-		FirstName:         "Test",
-		LastName:          "User",
-		Email:             "test@example.com",
-		Password:          "hashedpassword",
-		Role:              "client",
-		Status:            "Active",
-		Verified:          true,
-		Phone:             stringPtr("+1234567890"),
-		RefreshToken:      "refresh_token",
-		VerificationToken: "verification_token",
+		FirstName: "Test",
+		LastName:  "User",
+		Email:     "test@example.com",
+		Password:  "hashedpassword",
+		Role:      "client",
+		Status:    "Active",
+		Verified:  true,
+		Phone:     stringPtr("+1234567890"),
 	}
 	err := suite.db.Create(user).Error
 	suite.Require().NoError(err)
@@ -242,8 +231,7 @@ func (suite *UserProfileTestSuite) TestGetUserProfile_Success() {
 
 	// Проверяем, что конфиденциальные данные очищены
 	assert.Empty(suite.T(), responseUser.Password)
-	assert.Empty(suite.T(), responseUser.RefreshToken)
-	assert.Empty(suite.T(), responseUser.VerificationToken)
+	assert.Empty(suite.T(), responseUser.VerificationHash)
 }
 
 func (suite *UserProfileTestSuite) TestGetUserProfile_PsychologistWithPortfolio() {
@@ -347,8 +335,7 @@ func (suite *UserProfileTestSuite) TestGetSelfProfile_PsychologistWithPortfolio(
 	portfolio := &models.Portfolio{
 		PsychologistID: user.ID,
 		Description:    "Test psychologist",
-		Experience:     5, // Если это int
-		Education:      "Master's degree",
+		Experience:     5,                                // Если это int
 		ContactEmail:   stringPtr("contact@example.com"), // Если это *string
 		ContactPhone:   stringPtr("+1234567890"),         // Если это *string
 	}
@@ -408,22 +395,16 @@ func (suite *UserProfileTestSuite) TestGetSelfProfile_Unauthorized() {
 }
 
 func (suite *UserProfileTestSuite) TestGetSelfProfile_UserNotFound() {
-	req := httptest.NewRequest("GET", "/api/users/self", nil)
+	// Аутентифицированный пользователь, которого нет в БД
+	req := WithUser(httptest.NewRequest("GET", "/api/users/self", nil), nonexistentUser("client"))
 	w := httptest.NewRecorder()
 
-	// Используем middleware с email, который не существует в БД
-	mockMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "nonexistent@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-
 	router := chi.NewRouter()
-	router.With(mockMiddleware).Get("/api/users/self", handlers.GetSelfProfile)
+	router.Get("/api/users/self", handlers.GetSelfProfile)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "NOT_FOUND")
 }
 
 // ============== ТЕСТЫ ДЛЯ ClientSelfUpdate ==============
@@ -527,23 +508,17 @@ func (suite *UserProfileTestSuite) TestClientSelfUpdate_UserNotFound() {
 	}
 
 	body, _ := json.Marshal(updateData)
-	req := httptest.NewRequest("PUT", "/api/users/self/updateuser", bytes.NewBuffer(body))
+	// Аутентифицированный пользователь, которого нет в БД
+	req := WithUser(httptest.NewRequest("PUT", "/api/users/self/updateuser", bytes.NewBuffer(body)), nonexistentUser("client"))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	// Используем middleware с email, который не существует в БД
-	mockMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "nonexistent@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-
 	router := chi.NewRouter()
-	router.With(mockMiddleware).Put("/api/users/self/updateuser", handlers.ClientSelfUpdate)
+	router.Put("/api/users/self/updateuser", handlers.ClientSelfUpdate)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "NOT_FOUND")
 }
 
 func (suite *UserProfileTestSuite) TearDownSuite() {
@@ -66,10 +66,7 @@ func (suite *UserReviewsTestSuite) setupRoutes() {
 }
 
 func (suite *UserReviewsTestSuite) mockClientMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), "email", "client@example.com")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return AuthAs("client@example.com")(next)
 }
 
 func (suite *UserReviewsTestSuite) createTestUser(email, role string) *models.User {
@@ -149,10 +146,7 @@ func (suite *UserReviewsTestSuite) TestCreateReview_ForbiddenForPsychologist() {
 	// Создаем новый роутер с middleware для психолога
 	router := chi.NewRouter()
 	mockPsychologistMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "psychologist@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		return AuthAs("psychologist@example.com")(next)
 	}
 	router.With(mockPsychologistMiddleware).Post("/api/reviews/{psychologist_id}", handlers.CreateReview)
 
@@ -154,7 +154,6 @@ func (suite *UserSearchTestSuite) seedTestData() {
 			PsychologistID: users[0].ID,
 			Description:    "Experienced therapist",
 			Experience:     5,
-			Education:      "PhD in Psychology",
 			ContactEmail:   stringPtr("john.contact@example.com"),
 			City:           stringPtr("New York"),
 			DateOfBirth:    &birthDate1,
@@ -164,7 +163,6 @@ func (suite *UserSearchTestSuite) seedTestData() {
 			PsychologistID: users[1].ID,
 			Description:    "Family specialist",
 			Experience:     8,
-			Education:      "MA in Family Therapy",
 			ContactEmail:   stringPtr("jane.contact@example.com"),
 			City:           stringPtr("Los Angeles"),
 			DateOfBirth:    &birthDate2,
@@ -174,7 +172,6 @@ func (suite *UserSearchTestSuite) seedTestData() {
 			PsychologistID: users[2].ID,
 			Description:    "Cognitive behavioral therapist",
 			Experience:     10,
-			Education:      "PhD in Clinical Psychology",
 			City:           stringPtr("Chicago"),
 			DateOfBirth:    &birthDate3,
 			Gender:         stringPtr("male"),
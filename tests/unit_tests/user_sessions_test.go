@@ -42,7 +42,7 @@ func (suite *UserSessionsTestSuite) SetupSuite() {
 	db.DB = testDB // Set global DB for handlers
 
 	// Auto-migrate models
-	err = testDB.AutoMigrate(&models.User{}, &models.Availability{}, &models.Session{})
+	err = testDB.AutoMigrate(&models.User{}, &models.Availability{}, &models.Session{}, &models.SessionEvent{}, &models.SessionReschedule{})
 	suite.Require().NoError(err)
 
 	// Setup router
@@ -61,6 +61,7 @@ func (suite *UserSessionsTestSuite) SetupTest() {
 	// Clean up data before each test
 	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 	suite.db.Exec("TRUNCATE TABLE sessions")
+	suite.db.Exec("TRUNCATE TABLE session_events")
 	suite.db.Exec("TRUNCATE TABLE availabilities") // ИЗМЕНЕНО: имя таблицы
 	suite.db.Exec("TRUNCATE TABLE users")
 	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
@@ -72,8 +73,7 @@ func (suite *UserSessionsTestSuite) SetupTest() {
 func (suite *UserSessionsTestSuite) mockUserMiddleware(user *models.User) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "user", user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, WithUser(r, user))
 		})
 	}
 }
@@ -69,10 +69,7 @@ func (suite *UserSkillsTestSuite) setupRoutes() {
 }
 
 func (suite *UserSkillsTestSuite) mockUserMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), "email", "psychologist@example.com")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return AuthAs("psychologist@example.com")(next)
 }
 
 func (suite *UserSkillsTestSuite) createTestPsychologist(email string) *models.User {
@@ -137,10 +134,7 @@ func (suite *UserSkillsTestSuite) TestSetSpecialistSkills_ClientForbidden() {
 	// Create a new router and middleware for this specific test
 	router := chi.NewRouter()
 	mockClientMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := context.WithValue(r.Context(), "email", "client@example.com")
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		return AuthAs("client@example.com")(next)
 	}
 	router.With(mockClientMiddleware).Put("/api/users/self/skills", handlers.SetSpecialistSkills)
 
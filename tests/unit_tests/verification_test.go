@@ -0,0 +1,205 @@
+package unit_tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"user-api/internal/auth"
+	"user-api/internal/db"
+	"user-api/internal/handlers"
+	"user-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type VerificationTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	router  *chi.Mux
+	helpers *TestHelpers
+	admin   *models.Administrator
+}
+
+func (suite *VerificationTestSuite) SetupSuite() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		getEnv("DB_USER", "testuser"),
+		getEnv("DB_PASSWORD", "testpass"),
+		getEnv("DB_HOST", "localhost"),
+		"3306",
+		getEnv("DB_NAME", "testdb"),
+	)
+	testDB, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.db = testDB
+	db.DB = testDB
+
+	err = testDB.AutoMigrate(&models.User{}, &models.Administrator{}, &models.AuditEvent{}, &models.Child{},
+		&models.Portfolio{}, &models.PsychologistSkills{}, &models.Availability{}, &models.ScheduleTemplate{},
+		&models.UserIdentity{}, &models.EmailChange{}, &models.MagicLinkToken{}, &models.APIKey{}, &models.RefreshToken{}, &models.PasswordResetToken{})
+	suite.Require().NoError(err)
+
+	suite.router = chi.NewRouter()
+	suite.router.Get("/api/verify", handlers.VerifyEmail)
+	suite.router.Post("/api/verify/resend", handlers.ResendVerification)
+	suite.router.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(auth.WithAdmin(r.Context(), suite.admin)))
+			})
+		})
+		r.Post("/api/admin/users/{id}/verification/resend", handlers.AdminResendVerification)
+	})
+	suite.helpers = NewTestHelpers(testDB, suite.T())
+}
+
+func (suite *VerificationTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	sqlDB.Close()
+}
+
+func (suite *VerificationTestSuite) SetupTest() {
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	for _, table := range []string{"children", "user_identities", "email_changes", "magic_link_tokens", "refresh_tokens",
+		"password_reset_tokens", "api_keys", "audit_events", "administrators", "users"} {
+		suite.db.Exec("TRUNCATE TABLE " + table)
+	}
+	suite.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+	suite.admin = &models.Administrator{Username: "master", Email: "master@example.com", Password: "x",
+		FirstName: "Master", LastName: "Admin", Role: auth.RoleMaster, Status: "Active"}
+	suite.Require().NoError(suite.db.Create(suite.admin).Error)
+}
+
+// createUnverified stores an unverified account registered `age` ago
+func (suite *VerificationTestSuite) createUnverified(email string, age time.Duration) *models.User {
+	user := suite.helpers.CreateTestUser(email, "client")
+	registered := time.Now().Add(-age)
+	suite.Require().NoError(suite.db.Model(user).Updates(map[string]interface{}{
+		"verified": false, "status": "Disabled", "created_at": registered, "token_sent_at": registered,
+	}).Error)
+	return suite.reload(user.ID)
+}
+
+func (suite *VerificationTestSuite) reload(id uint64) *models.User {
+	var user models.User
+	suite.Require().NoError(suite.db.First(&user, id).Error)
+	return &user
+}
+
+func (suite *VerificationTestSuite) exists(id uint64) bool {
+	var count int64
+	suite.db.Model(&models.User{}).Where("id = ?", id).Count(&count)
+	return count == 1
+}
+
+func (suite *VerificationTestSuite) TestVerify_ByHashSingleUse() {
+	user := suite.createUnverified("new@example.com", time.Minute)
+	suite.db.Model(user).Update("verification_hash", sha256Hex("plain-token"))
+
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/verify?token=plain-token", nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	user = suite.reload(user.ID)
+	assert.True(suite.T(), user.Verified)
+	assert.Equal(suite.T(), "Active", user.Status)
+	assert.Empty(suite.T(), user.VerificationHash)
+
+	w, req = suite.helpers.MakeJSONRequest("GET", "/api/verify?token=plain-token", nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *VerificationTestSuite) TestVerify_Expired() {
+	user := suite.createUnverified("new@example.com", 25*time.Hour)
+	suite.db.Model(user).Update("verification_hash", sha256Hex("plain-token"))
+
+	w, req := suite.helpers.MakeJSONRequest("GET", "/api/verify?token=plain-token", nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusGone, w.Code)
+	assert.False(suite.T(), suite.reload(user.ID).Verified)
+}
+
+func (suite *VerificationTestSuite) TestResend_RespectsCooldown() {
+	user := suite.createUnverified("new@example.com", 10*time.Minute)
+	suite.db.Model(user).Update("verification_hash", sha256Hex("old-token"))
+
+	w, req := suite.helpers.MakeJSONRequest("POST", "/api/verify/resend", map[string]string{"email": "new@example.com"})
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	first := suite.reload(user.ID).VerificationHash
+	assert.NotEqual(suite.T(), sha256Hex("old-token"), first, "A new link replaces the old one")
+	assert.Len(suite.T(), first, 64)
+
+	w, req = suite.helpers.MakeJSONRequest("POST", "/api/verify/resend", map[string]string{"email": "new@example.com"})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), first, suite.reload(user.ID).VerificationHash, "No new link within the cooldown")
+
+	// Unknown accounts get the same answer
+	w, req = suite.helpers.MakeJSONRequest("POST", "/api/verify/resend", map[string]string{"email": "nobody@example.com"})
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *VerificationTestSuite) TestAdminResend() {
+	verified := suite.helpers.CreateTestUser("done@example.com", "client")
+	w, req := suite.helpers.MakeJSONRequest("POST", fmt.Sprintf("/api/admin/users/%d/verification/resend", verified.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// The admin action ignores the cooldown
+	user := suite.createUnverified("new@example.com", time.Second)
+	w, req = suite.helpers.MakeJSONRequest("POST", fmt.Sprintf("/api/admin/users/%d/verification/resend", user.ID), nil)
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.Len(suite.T(), suite.reload(user.ID).VerificationHash, 64)
+
+	var count int64
+	suite.db.Model(&models.AuditEvent{}).Where("action = ? AND target_id = ?", "user.verification_resend", user.ID).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *VerificationTestSuite) TestSweep_RemindsThenPurges() {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	fresh := suite.createUnverified("fresh@example.com", day)
+	due := suite.createUnverified("due@example.com", 4*day)
+	expired := suite.createUnverified("expired@example.com", 15*day)
+	suite.db.Model(expired).Update("reminded_at", now.Add(-12*day))
+	suite.Require().NoError(suite.db.Create(&models.Child{ClientID: expired.ID, Age: 7}).Error)
+	lateReminder := suite.createUnverified("late@example.com", 15*day)
+	suite.db.Model(lateReminder).Update("reminded_at", now.Add(-day))
+	activated := suite.createUnverified("activated@example.com", 30*day)
+	suite.db.Model(activated).Update("status", "Active")
+
+	reminded, purged, err := handlers.SweepUnverifiedAccounts(now)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, reminded)
+	assert.Equal(suite.T(), 1, purged)
+
+	assert.Nil(suite.T(), suite.reload(fresh.ID).RemindedAt)
+	assert.NotNil(suite.T(), suite.reload(due.ID).RemindedAt)
+	assert.False(suite.T(), suite.exists(expired.ID))
+	assert.True(suite.T(), suite.exists(lateReminder.ID), "Every user gets the full notice period after the reminder")
+	assert.True(suite.T(), suite.exists(activated.ID), "Accounts activated by an administrator are kept")
+
+	var children int64
+	suite.db.Model(&models.Child{}).Where("client_id = ?", expired.ID).Count(&children)
+	assert.Equal(suite.T(), int64(0), children)
+
+	// A second run does nothing
+	reminded, purged, err = handlers.SweepUnverifiedAccounts(now)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 0, reminded+purged)
+}
+
+func TestVerificationTestSuite(t *testing.T) {
+	suite.Run(t, new(VerificationTestSuite))
+}